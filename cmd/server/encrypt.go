@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/database"
+	"midjourney-proxy-go/pkg/fieldcrypt"
+)
+
+// encryptBatchSize 每批处理的账号数
+const encryptBatchSize = 100
+
+// runEncryptAccounts 执行 encrypt-accounts 子命令：读取全部账号（包括已删除的账号）并重新保存Token和登录凭据，
+// 明文和使用旧密钥的密文都会改为使用当前密钥加密，可重复执行，返回进程退出码
+func runEncryptAccounts(cfg *config.Config, keyring *fieldcrypt.Keyring) int {
+	if keyring == nil {
+		fmt.Fprintf(os.Stderr, "Encryption key is not configured, set security.encryption_key_file or %s\n", fieldcrypt.EnvKeys)
+		return 1
+	}
+
+	repos, err := database.Open(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer repos.Close()
+
+	ctx := context.Background()
+	query := repository.AccountQuery{IncludeDeleted: true, Limit: encryptBatchSize}
+	total := 0
+	for {
+		accounts, err := repos.Accounts.Find(ctx, query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to query accounts: %v\n", err)
+			return 1
+		}
+		for i := range accounts {
+			if err := repos.Accounts.SaveCredentials(ctx, &accounts[i]); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to encrypt account %s: %v\n", accounts[i].ID, err)
+				return 1
+			}
+			total++
+		}
+		if len(accounts) < encryptBatchSize {
+			break
+		}
+		query.Offset += encryptBatchSize
+	}
+
+	fmt.Printf("%d accounts encrypted with key %s\n", total, keyring.ActiveID())
+	return 0
+}
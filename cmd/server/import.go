@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/database"
+	"midjourney-proxy-go/internal/infrastructure/legacy"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// runImport 执行 import 子命令，从.NET版导入数据，返回进程退出码
+func runImport(cfg *config.Config, logger logger.Logger, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, `用法: server import (-json <目录> | -mongo-uri <连接串> -mongo-db <数据库>)
+
+从.NET版midjourney-proxy导入账号、用户、禁用词和任务，保留原有ID，已导入的记录会跳过，可重复执行。
+JSON目录中每个集合一个文件：account、user、word、task（.json 或 .jsonl），
+可以是JSON数组、逐行JSON或MongoDB扩展JSON（mongoexport、LiteDB导出）。
+
+参数:`)
+		flags.PrintDefaults()
+	}
+	dir := flags.String("json", "", "JSON导出目录")
+	mongoURI := flags.String("mongo-uri", "", ".NET版使用的MongoDB连接串")
+	mongoDB := flags.String("mongo-db", "", ".NET版使用的MongoDB数据库名")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx := context.Background()
+	var source legacy.Source
+	var err error
+	switch {
+	case *dir != "" && *mongoURI == "":
+		source, err = legacy.NewJSONSource(*dir)
+	case *dir == "" && *mongoURI != "" && *mongoDB != "":
+		source, err = legacy.NewMongoSource(ctx, *mongoURI, *mongoDB)
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open import source: %v\n", err)
+		return 1
+	}
+	defer source.Close(ctx)
+
+	repos, err := database.Open(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer repos.Close()
+
+	reports, err := service.NewLegacyImporter(repos, logger).Import(ctx, source)
+	for _, report := range reports {
+		fmt.Printf("%-8s imported: %d, existing: %d, skipped: %d\n", report.Collection, report.Imported, report.Existing, len(report.Skipped))
+		for _, skip := range report.Skipped {
+			fmt.Printf("  skipped %s: %s\n", skip.ID, skip.Reason)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
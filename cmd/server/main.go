@@ -5,16 +5,24 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"midjourney-proxy-go/internal/api"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
 	"midjourney-proxy-go/internal/infrastructure/config"
 	"midjourney-proxy-go/internal/infrastructure/database"
 	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/internal/infrastructure/faceswap"
+	"midjourney-proxy-go/internal/infrastructure/fetcher"
+	"midjourney-proxy-go/internal/infrastructure/storage"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/fieldcrypt"
 	"midjourney-proxy-go/pkg/logger"
+	"midjourney-proxy-go/pkg/redact"
 
 	"github.com/gin-gonic/gin"
 )
@@ -40,22 +48,130 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// 配置中的密钥在日志中替换为掩码，标准库日志（包括依赖库的输出）同样处理
+	redact.Register(cfg.Secrets()...)
+	log.SetOutput(redact.Writer(log.Writer()))
+
+	// Discord账号Token和登录凭据的加密密钥，未配置时以明文保存
+	keyring, err := fieldcrypt.Load(cfg.Security.EncryptionKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load encryption key: %v", err)
+	}
+	fieldcrypt.Use(keyring)
+
 	// 初始化日志
 	logger := logger.New(cfg.Log.Level, cfg.Log.Format)
 
-	// 初始化数据库
-	db, err := database.New(cfg.Database)
+	// migrate 子命令：执行、回滚迁移或查看迁移状态
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg.Database, os.Args[2:]))
+	}
+
+	// import 子命令：从.NET版导入数据
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(cfg, logger, os.Args[2:]))
+	}
+
+	// encrypt-accounts 子命令：使用当前密钥加密已有账号的Token和登录凭据
+	if len(os.Args) > 1 && os.Args[1] == "encrypt-accounts" {
+		os.Exit(runEncryptAccounts(cfg, keyring))
+	}
+
+	if keyring == nil {
+		logger.Warnf("Encryption key is not configured, Discord account credentials are stored in plaintext")
+	}
+
+	// 初始化数据库（SQL数据库会自动迁移）
+	repos, err := database.Open(cfg.Database)
 	if err != nil {
 		logger.Fatalf("Failed to initialize database: %v", err)
 	}
+	defer repos.Close()
 
-	// 自动迁移
-	if err := database.Migrate(db); err != nil {
-		logger.Fatalf("Failed to migrate database: %v", err)
+	// 初始化集群节点：启用Redis时多个副本共享账号锁、任务队列、限流计数和任务事件
+	var node *cluster.Node
+	if cfg.Redis.Enabled {
+		node, err = cluster.Connect(cfg.Redis, logger)
+		if err != nil {
+			logger.Fatalf("Failed to initialize cluster node: %v", err)
+		}
+		node.Start()
+		logger.Infof("Cluster mode enabled, node ID: %s", node.ID())
 	}
 
 	// 初始化Discord连接管理器
 	discordManager := discord.NewManager(cfg.Discord, logger)
+	if node != nil {
+		if err := discordManager.SetClusterNode(node); err != nil {
+			logger.Fatalf("Failed to enable cluster mode for Discord manager: %v", err)
+		}
+	}
+
+	// 初始化任务服务和超时看门狗
+	notifyService := service.NewNotifyService(repos.WebhookDeliveries, cfg.Notification, logger)
+	translator := service.NewTranslator(cfg.Translate)
+	resultStore := newResultStore(cfg, logger)
+	imageProxyConfig := cfg.ImageProxy
+	if u, err := url.Parse(cfg.Discord.NgDiscord.CDN); err == nil && u.Hostname() != "" {
+		imageProxyConfig.AllowedHosts = append(imageProxyConfig.AllowedHosts, u.Hostname())
+	}
+	imageProxy, err := service.NewImageProxy(imageProxyConfig, resultStore, discord.NewHTTPClient(cfg.Discord.Proxy), logger)
+	if err != nil {
+		logger.Fatalf("Failed to initialize image proxy: %v", err)
+	}
+	fileFetcher := fetcher.New(cfg.Fetch)
+	taskService := service.NewTaskService(repos, discordManager, notifyService, translator, resultStore, imageProxy, logger)
+	taskWatchdog := service.NewTaskWatchdog(taskService, logger)
+	faceSwapService := service.NewFaceSwapService(cfg.FaceSwap, taskService, faceswap.NewReplicateProvider(faceswap.ReplicateConfig{
+		BaseURL:     cfg.FaceSwap.BaseURL,
+		Token:       cfg.FaceSwap.Token,
+		Version:     cfg.FaceSwap.Version,
+		SourceField: cfg.FaceSwap.SourceField,
+		TargetField: cfg.FaceSwap.TargetField,
+	}), faceswap.NewReplicateProvider(faceswap.ReplicateConfig{
+		BaseURL:     cfg.FaceSwap.BaseURL,
+		Token:       cfg.FaceSwap.Token,
+		Version:     cfg.FaceSwap.Video.Version,
+		SourceField: cfg.FaceSwap.Video.SourceField,
+		TargetField: cfg.FaceSwap.Video.TargetField,
+	}), logger)
+
+	var taskCluster *service.TaskCluster
+	if node != nil {
+		taskCluster, err = service.NewTaskCluster(taskService, node, logger)
+		if err != nil {
+			logger.Fatalf("Failed to enable cluster mode for task service: %v", err)
+		}
+	}
+
+	// 初始化运行时设置：配置文件之上叠加数据库中的覆盖值，修改后立即应用
+	settings, err := service.NewSettingsService(repos.Settings, repos.SettingChanges, cfg, node, logger)
+	if err != nil {
+		logger.Fatalf("Failed to initialize settings: %v", err)
+	}
+	applySettings(settings, cfg, discordManager, taskService, notifyService)
+
+	// 初始化IP封禁，启用Redis时各副本共享违规计数并同步封禁变更
+	ipBans, err := service.NewIPBanService(repos.IPBans, cfg.RateLimit, node, logger)
+	if err != nil {
+		logger.Fatalf("Failed to initialize IP bans: %v", err)
+	}
+
+	// 审计记录：查看密钥等敏感操作
+	audit := service.NewAuditService(repos.AuditLogs, logger)
+
+	// API密钥和登录令牌，认证时逐个请求检查吊销状态
+	apiKeys := service.NewAPIKeyService(repos.APIKeys, logger)
+	tokens := service.NewTokenService(cfg.Security, repos, logger)
+
+	// 初始化选举和定时任务：多副本时只有领导者执行超时检查、每日计数重置、账号信息同步和存储清理
+	elector, err := service.NewLeaderElector(cfg.Leader, repos.Leases, node, logger)
+	if err != nil {
+		logger.Fatalf("Failed to initialize leader election: %v", err)
+	}
+	scheduler := service.NewScheduler(elector, repos.JobRuns, logger)
+	accountSync := service.NewAccountSyncService(repos.Accounts, discordManager, logger)
+	registerJobs(scheduler, cfg, taskService, taskWatchdog, notifyService, tokens, accountSync)
 
 	// 设置Gin模式
 	if cfg.App.Mode == "production" {
@@ -63,7 +179,7 @@ func main() {
 	}
 
 	// 初始化路由
-	router := api.NewRouter(cfg, db, discordManager, logger)
+	router := api.NewRouter(cfg, repos, node, discordManager, taskService, notifyService, faceSwapService, accountSync, imageProxy, scheduler, ipBans, settings, audit, apiKeys, tokens, fileFetcher, logger)
 
 	// 创建HTTP服务器
 	server := &http.Server{
@@ -73,6 +189,10 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 	}
 
+	// 启动服务器前加载运行时设置和封禁列表
+	settings.Start()
+	ipBans.Start()
+
 	// 启动服务器
 	go func() {
 		logger.Infof("Server starting on port %d", cfg.App.Port)
@@ -85,9 +205,26 @@ func main() {
 	go func() {
 		if err := discordManager.Start(); err != nil {
 			logger.Errorf("Failed to start Discord manager: %v", err)
+			return
 		}
+
+		// 等待实例连接后恢复上次运行遗留的任务
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		discordManager.WaitConnected(waitCtx)
+		waitCancel()
+
+		taskService.Recover(context.Background())
 	}()
 
+	// 启动回调投递、换脸执行器和定时任务
+	notifyService.Start()
+	faceSwapService.Start()
+	elector.Start()
+	scheduler.Start()
+	if taskCluster != nil {
+		taskCluster.Start()
+	}
+
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -102,8 +239,78 @@ func main() {
 		logger.Errorf("Server forced to shutdown: %v", err)
 	}
 
-	// 关闭Discord连接
+	// 停止定时任务并释放领导者租约，由其他副本立即接替
+	scheduler.Stop()
+	elector.Stop()
+
+	// 关闭Discord连接，集群模式下先停止消费共享队列，再释放账号锁
+	if taskCluster != nil {
+		taskCluster.Stop()
+	}
 	discordManager.Stop()
+	faceSwapService.Stop()
+	notifyService.Stop()
+	ipBans.Stop()
+	settings.Stop()
+	if node != nil {
+		node.Close()
+	}
 
 	logger.Info("Server exited")
-}
\ No newline at end of file
+}
+
+// registerJobs 注册只在领导者节点上执行的定时任务
+func registerJobs(scheduler *service.Scheduler, cfg *config.Config, taskService *service.TaskService, taskWatchdog *service.TaskWatchdog, notifyService *service.NotifyService, tokens *service.TokenService, accountSync *service.AccountSyncService) {
+	scheduler.Register(service.JobTaskTimeout, service.Every(service.TaskTimeoutInterval), taskWatchdog.Run)
+	scheduler.Register(service.JobDailyReset, service.Daily(0, 0), taskService.ResetDailyCounts)
+	scheduler.Register(service.JobTokenCleanup, service.Every(time.Hour), tokens.Cleanup)
+	scheduler.Register(service.JobAccountSync, service.Every(service.AccountSyncInterval), accountSync.SyncAll)
+
+	if cfg.Storage.RetentionDays > 0 {
+		retention := time.Duration(cfg.Storage.RetentionDays) * 24 * time.Hour
+		scheduler.Register(service.JobStorageCleanup, service.Daily(3, 0), func(ctx context.Context) error {
+			_, err := taskService.CleanupStoredResults(ctx, retention)
+			return err
+		})
+	}
+
+	if cfg.Notification.RetentionDays > 0 {
+		retention := time.Duration(cfg.Notification.RetentionDays) * 24 * time.Hour
+		scheduler.Register(service.JobWebhookCleanup, service.Daily(3, 30), func(ctx context.Context) error {
+			_, err := notifyService.CleanupDeliveries(ctx, retention)
+			return err
+		})
+	}
+}
+
+// applySettings 将运行时设置应用到各组件，注册时应用一次，之后在设置变化时应用
+func applySettings(settings *service.SettingsService, cfg *config.Config, discordManager *discord.Manager, taskService *service.TaskService, notifyService *service.NotifyService) {
+	settings.OnChange(func(old, current *service.RuntimeSettings) {
+		if old == nil || old.AccountSelectMode != current.AccountSelectMode {
+			discordManager.SetAccountSelectMode(discord.AccountSelectMode(current.AccountSelectMode))
+		}
+		if old == nil || old.TranslateWay != current.TranslateWay {
+			translateConfig := cfg.Translate
+			translateConfig.Way = current.TranslateWay
+			taskService.SetTranslator(service.NewTranslator(translateConfig))
+		}
+		notifyService.SetDefaultWebhook(current.NotifyHook)
+		taskService.SetBannedWordCheck(current.BannedWordsEnabled, current.BannedWordsCheckTranslated)
+	})
+}
+
+// newResultStore 创建任务结果转存服务，未开启转存或存储初始化失败时不转存
+func newResultStore(cfg *config.Config, logger logger.Logger) *service.ResultStore {
+	if !cfg.Discord.NgDiscord.SaveToLocal {
+		return service.NewResultStore(nil, nil, false, nil, logger)
+	}
+
+	store, err := storage.New(storage.WithDefaultCDN(cfg.Storage, cfg.Discord.NgDiscord.CustomCDN))
+	if err != nil {
+		logger.Errorf("Failed to initialize %s storage, results will not be stored: %v", cfg.Storage.Type, err)
+		return service.NewResultStore(nil, nil, false, nil, logger)
+	}
+
+	thumbnailer := service.NewThumbnailer(cfg.Storage.Thumbnail)
+	return service.NewResultStore(store, thumbnailer, cfg.Storage.SplitGrid, discord.NewHTTPClient(cfg.Discord.Proxy), logger)
+}
@@ -1,34 +1,49 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 
 	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
 	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/internal/service"
 	"midjourney-proxy-go/pkg/logger"
+	"midjourney-proxy-go/pkg/redact"
 )
 
-// AccountHandler 账号处理器
+// AccountHandler 账号处理器，响应中的Token、登录密码和2FA密钥均为掩码，明文只能通过 RevealSecrets 查看
 type AccountHandler struct {
-	db             *gorm.DB
+	accounts       repository.AccountRepository
 	discordManager *discord.Manager
+	accountSync    *service.AccountSyncService
+	audit          *service.AuditService
 	logger         logger.Logger
 }
 
 // NewAccountHandler 创建账号处理器
-func NewAccountHandler(db *gorm.DB, discordManager *discord.Manager, logger logger.Logger) *AccountHandler {
+func NewAccountHandler(accounts repository.AccountRepository, discordManager *discord.Manager, accountSync *service.AccountSyncService, audit *service.AuditService, logger logger.Logger) *AccountHandler {
 	return &AccountHandler{
-		db:             db,
+		accounts:       accounts,
 		discordManager: discordManager,
+		accountSync:    accountSync,
+		audit:          audit,
 		logger:         logger,
 	}
 }
 
+// AccountSecrets 账号密钥明文
+type AccountSecrets struct {
+	UserToken     string `json:"user_token"`
+	BotToken      string `json:"bot_token,omitempty"`
+	LoginPassword string `json:"login_password,omitempty"`
+	Login2FA      string `json:"login_2fa,omitempty"`
+}
+
 // List 获取账号列表
 func (h *AccountHandler) List(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -44,38 +59,41 @@ func (h *AccountHandler) List(c *gin.Context) {
 
 	offset := (page - 1) * size
 
-	var accounts []entity.DiscordAccount
-	var total int64
-
-	query := h.db.Model(&entity.DiscordAccount{})
-	if keyword != "" {
-		query = query.Where("channel_id LIKE ? OR guild_id LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
-	}
+	query := repository.AccountQuery{Keyword: keyword}
 
 	// 获取总数
-	query.Count(&total)
+	total, _ := h.accounts.Count(c.Request.Context(), query)
 
 	// 获取账号列表
-	query.Order("created_at DESC").
-		Offset(offset).
-		Limit(size).
-		Find(&accounts)
+	query.Offset = offset
+	query.Limit = size
+	accounts, err := h.accounts.Find(c.Request.Context(), query)
+	if err != nil {
+		h.logger.Errorf("Failed to list accounts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50000,
+			"message": "查询账号失败",
+		})
+		return
+	}
 
 	// 更新运行状态信息
 	instances := h.discordManager.GetAllInstances()
+	list := make([]*entity.DiscordAccount, 0, len(accounts))
 	for i := range accounts {
 		if instance, exists := instances[accounts[i].ID]; exists {
 			accounts[i].Running = instance.IsConnected()
 			accounts[i].RunningCount = 0 // TODO: 实际的运行任务数
 			accounts[i].QueueCount = 0   // TODO: 实际的队列任务数
 		}
+		list = append(list, accounts[i].Redacted())
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
 		"message": "查询成功",
 		"data": gin.H{
-			"list":  accounts,
+			"list":  list,
 			"total": total,
 			"page":  page,
 			"size":  size,
@@ -91,6 +109,9 @@ func (h *AccountHandler) Create(c *gin.Context) {
 		UserToken            string                       `json:"user_token" binding:"required"`
 		BotToken             string                       `json:"bot_token"`
 		UserAgent            string                       `json:"user_agent"`
+		LoginAccount         string                       `json:"login_account"`
+		LoginPassword        string                       `json:"login_password"`
+		Login2FA             string                       `json:"login_2fa"`
 		Enabled              bool                         `json:"enabled"`
 		EnableMJ             bool                         `json:"enable_mj"`
 		EnableNiji           bool                         `json:"enable_niji"`
@@ -122,16 +143,26 @@ func (h *AccountHandler) Create(c *gin.Context) {
 		return
 	}
 
+	// 掩码只会出现在查询结果中，创建时不能作为密钥保存
+	for _, secret := range []string{req.UserToken, req.BotToken, req.LoginPassword, req.Login2FA} {
+		if redact.IsMasked(secret) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40000,
+				"message": "Token和登录信息不能是掩码",
+			})
+			return
+		}
+	}
+
 	// 检查频道ID是否已存在
-	var existingAccount entity.DiscordAccount
-	err := h.db.Where("channel_id = ?", req.ChannelID).First(&existingAccount).Error
+	_, err := h.accounts.GetByChannelID(c.Request.Context(), req.ChannelID)
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"code":    40900,
 			"message": "频道ID已存在",
 		})
 		return
-	} else if err != gorm.ErrRecordNotFound {
+	} else if err != repository.ErrNotFound {
 		h.logger.Errorf("Failed to check existing account: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -148,6 +179,9 @@ func (h *AccountHandler) Create(c *gin.Context) {
 		UserToken:          req.UserToken,
 		BotToken:           req.BotToken,
 		UserAgent:          req.UserAgent,
+		LoginAccount:       req.LoginAccount,
+		LoginPassword:      req.LoginPassword,
+		Login2FA:           req.Login2FA,
 		Enabled:            req.Enabled,
 		EnableMJ:           req.EnableMJ,
 		EnableNiji:         req.EnableNiji,
@@ -195,7 +229,7 @@ func (h *AccountHandler) Create(c *gin.Context) {
 	}
 
 	// 保存账号
-	if err := h.db.Create(&account).Error; err != nil {
+	if err := h.accounts.Create(c.Request.Context(), &account); err != nil {
 		h.logger.Errorf("Failed to create account: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -208,7 +242,7 @@ func (h *AccountHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"code":    1,
 		"message": "创建成功",
-		"data":    account,
+		"data":    account.Redacted(),
 	})
 }
 
@@ -223,9 +257,9 @@ func (h *AccountHandler) Get(c *gin.Context) {
 		return
 	}
 
-	var account entity.DiscordAccount
-	if err := h.db.Where("id = ?", accountID).First(&account).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	account, err := h.accounts.Get(c.Request.Context(), accountID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40400,
 				"message": "账号不存在",
@@ -249,7 +283,7 @@ func (h *AccountHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
 		"message": "查询成功",
-		"data":    account,
+		"data":    account.Redacted(),
 	})
 }
 
@@ -268,6 +302,9 @@ func (h *AccountHandler) Update(c *gin.Context) {
 		UserToken            *string                       `json:"user_token,omitempty"`
 		BotToken             *string                       `json:"bot_token,omitempty"`
 		UserAgent            *string                       `json:"user_agent,omitempty"`
+		LoginAccount         *string                       `json:"login_account,omitempty"`
+		LoginPassword        *string                       `json:"login_password,omitempty"`
+		Login2FA             *string                       `json:"login_2fa,omitempty"`
 		Enabled              *bool                         `json:"enabled,omitempty"`
 		EnableMJ             *bool                         `json:"enable_mj,omitempty"`
 		EnableNiji           *bool                         `json:"enable_niji,omitempty"`
@@ -300,9 +337,9 @@ func (h *AccountHandler) Update(c *gin.Context) {
 	}
 
 	// 查找账号
-	var account entity.DiscordAccount
-	if err := h.db.Where("id = ?", accountID).First(&account).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	account, err := h.accounts.Get(c.Request.Context(), accountID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40400,
 				"message": "账号不存在",
@@ -316,16 +353,25 @@ func (h *AccountHandler) Update(c *gin.Context) {
 		return
 	}
 
-	// 更新字段
+	// 更新字段，密钥字段提交的是查询结果中的掩码时保留原值
 	if req.UserToken != nil {
-		account.UserToken = *req.UserToken
+		account.UserToken = redact.Keep(*req.UserToken, account.UserToken)
 	}
 	if req.BotToken != nil {
-		account.BotToken = *req.BotToken
+		account.BotToken = redact.Keep(*req.BotToken, account.BotToken)
 	}
 	if req.UserAgent != nil {
 		account.UserAgent = *req.UserAgent
 	}
+	if req.LoginAccount != nil {
+		account.LoginAccount = *req.LoginAccount
+	}
+	if req.LoginPassword != nil {
+		account.LoginPassword = redact.Keep(*req.LoginPassword, account.LoginPassword)
+	}
+	if req.Login2FA != nil {
+		account.Login2FA = redact.Keep(*req.Login2FA, account.Login2FA)
+	}
 	if req.Enabled != nil {
 		account.Enabled = *req.Enabled
 	}
@@ -391,7 +437,7 @@ func (h *AccountHandler) Update(c *gin.Context) {
 	}
 
 	// 保存更新
-	if err := h.db.Save(&account).Error; err != nil {
+	if err := h.accounts.Save(c.Request.Context(), account); err != nil {
 		h.logger.Errorf("Failed to update account: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -407,6 +453,45 @@ func (h *AccountHandler) Update(c *gin.Context) {
 	})
 }
 
+// RevealSecrets 查看账号密钥明文
+// @Summary 查看账号密钥
+// @Description 返回账号的用户Token、机器人Token、登录密码和2FA密钥明文，每次查看都会写入审计记录。使用API密钥时需要 admin:write 权限
+// @Tags 账号管理
+// @Produce json
+// @Param id path string true "账号ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/accounts/{id}/secrets [post]
+func (h *AccountHandler) RevealSecrets(c *gin.Context) {
+	account, err := h.accounts.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, ErrorResult(40400, "账号不存在"))
+		} else {
+			h.logger.Errorf("Failed to get account: %v", err)
+			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询账号失败"))
+		}
+		return
+	}
+
+	// 审计记录保存失败时不返回明文
+	if err := h.audit.Record(c.Request.Context(), entity.AuditRevealAccountSecrets, account.ID, operatorName(c), c.ClientIP(), account.ChannelID); err != nil {
+		h.logger.Errorf("Failed to audit secrets access of account %s: %v", account.ID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "记录审计日志失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data": AccountSecrets{
+			UserToken:     account.UserToken,
+			BotToken:      account.BotToken,
+			LoginPassword: account.LoginPassword,
+			Login2FA:      account.Login2FA,
+		},
+	})
+}
+
 // Delete 删除账号
 func (h *AccountHandler) Delete(c *gin.Context) {
 	accountID := c.Param("id")
@@ -419,9 +504,9 @@ func (h *AccountHandler) Delete(c *gin.Context) {
 	}
 
 	// 查找账号
-	var account entity.DiscordAccount
-	if err := h.db.Where("id = ?", accountID).First(&account).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	account, err := h.accounts.Get(c.Request.Context(), accountID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40400,
 				"message": "账号不存在",
@@ -439,7 +524,7 @@ func (h *AccountHandler) Delete(c *gin.Context) {
 	h.discordManager.RemoveAccount(accountID)
 
 	// 删除账号
-	if err := h.db.Where("id = ?", accountID).Delete(&entity.DiscordAccount{}).Error; err != nil {
+	if err := h.accounts.Delete(c.Request.Context(), accountID); err != nil {
 		h.logger.Errorf("Failed to delete account: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -455,7 +540,7 @@ func (h *AccountHandler) Delete(c *gin.Context) {
 	})
 }
 
-// Sync 同步账号信息
+// Sync 同步账号信息：使用账号Token读取Discord用户和频道，更新服务器ID和同步时间，Token失效时禁用账号
 func (h *AccountHandler) Sync(c *gin.Context) {
 	accountID := c.Param("id")
 	if accountID == "" {
@@ -467,9 +552,9 @@ func (h *AccountHandler) Sync(c *gin.Context) {
 	}
 
 	// 查找账号
-	var account entity.DiscordAccount
-	if err := h.db.Where("id = ?", accountID).First(&account).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	account, err := h.accounts.Get(c.Request.Context(), accountID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40400,
 				"message": "账号不存在",
@@ -483,15 +568,28 @@ func (h *AccountHandler) Sync(c *gin.Context) {
 		return
 	}
 
-	// TODO: 实现同步账号信息逻辑
-	// 1. 连接Discord获取最新信息
-	// 2. 更新账号设置
-	// 3. 保存到数据库
+	if err := h.accountSync.Sync(c.Request.Context(), account); err != nil {
+		if errors.Is(err, discord.ErrUnauthorized) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    40000,
+				"message": "Discord Token已失效，账号已禁用",
+				"data":    account.Redacted(),
+			})
+			return
+		}
+		h.logger.Errorf("Failed to sync Discord account %s: %v", account.ChannelID, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"code":    50200,
+			"message": "同步账号信息失败",
+		})
+		return
+	}
 
-	h.logger.Infof("Discord account %s sync requested", account.ChannelID)
+	h.logger.Infof("Discord account %s synced", account.ChannelID)
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
 		"message": "同步成功",
+		"data":    account.Redacted(),
 	})
 }
 
@@ -507,7 +605,7 @@ func (h *AccountHandler) Enable(c *gin.Context) {
 	}
 
 	// 更新账号状态
-	if err := h.db.Model(&entity.DiscordAccount{}).Where("id = ?", accountID).Update("enabled", true).Error; err != nil {
+	if err := h.accounts.SetEnabled(c.Request.Context(), accountID, true); err != nil {
 		h.logger.Errorf("Failed to enable account: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -535,7 +633,7 @@ func (h *AccountHandler) Disable(c *gin.Context) {
 	}
 
 	// 更新账号状态
-	if err := h.db.Model(&entity.DiscordAccount{}).Where("id = ?", accountID).Update("enabled", false).Error; err != nil {
+	if err := h.accounts.SetEnabled(c.Request.Context(), accountID, false); err != nil {
 		h.logger.Errorf("Failed to disable account: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -1,52 +1,170 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"runtime"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 
 	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
 	"midjourney-proxy-go/internal/infrastructure/config"
 	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/internal/service"
 	"midjourney-proxy-go/pkg/logger"
 )
 
 // AdminHandler 管理员处理器
 type AdminHandler struct {
-	db             *gorm.DB
+	repos          *repository.Repositories
 	discordManager *discord.Manager
+	settings       *service.SettingsService
+	audit          *service.AuditService
 	config         *config.Config
 	logger         logger.Logger
 }
 
 // NewAdminHandler 创建管理员处理器
-func NewAdminHandler(db *gorm.DB, discordManager *discord.Manager, config *config.Config, logger logger.Logger) *AdminHandler {
+func NewAdminHandler(repos *repository.Repositories, discordManager *discord.Manager, settings *service.SettingsService, audit *service.AuditService, config *config.Config, logger logger.Logger) *AdminHandler {
 	return &AdminHandler{
-		db:             db,
+		repos:          repos,
 		discordManager: discordManager,
+		settings:       settings,
+		audit:          audit,
 		config:         config,
 		logger:         logger,
 	}
 }
 
 // GetSettings 获取系统设置
+// @Summary 获取运行时设置
+// @Description 返回可在运行时修改的设置项、当前生效的值和配置文件中的值
+// @Tags 系统管理
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/settings [get]
 func (h *AdminHandler) GetSettings(c *gin.Context) {
-	// TODO: 实现获取系统设置逻辑
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
 		"message": "查询成功",
-		"data":    h.config,
+		"data":    h.settings.List(),
 	})
 }
 
 // UpdateSettings 更新系统设置
+// @Summary 修改运行时设置
+// @Description 请求体的键为设置项，值为新值，null表示恢复为配置文件中的值；全部校验通过后保存并立即生效
+// @Tags 系统管理
+// @Accept json
+// @Produce json
+// @Param request body map[string]interface{} true "设置项和新值"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/settings [put]
 func (h *AdminHandler) UpdateSettings(c *gin.Context) {
-	// TODO: 实现更新系统设置逻辑
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"code":    50100,
-		"message": "功能暂未实现",
+	var values map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&values); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "参数错误: "+err.Error()))
+		return
+	}
+
+	if err := h.settings.Update(c.Request.Context(), values, operatorName(c)); err != nil {
+		var settingErr *service.SettingError
+		if errors.As(err, &settingErr) {
+			c.JSON(http.StatusBadRequest, ErrorResult(40000, err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to update settings: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "保存设置失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "保存成功",
+		"data":    h.settings.List(),
+	})
+}
+
+// GetSettingHistory 获取设置变更历史
+// @Summary 查询设置变更历史
+// @Description 按变更时间倒序返回，可按设置项过滤
+// @Tags 系统管理
+// @Produce json
+// @Param key query string false "设置项"
+// @Param page query int false "页码"
+// @Param size query int false "每页数量"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/settings/history [get]
+func (h *AdminHandler) GetSettingHistory(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	changes, total, err := h.settings.History(c.Request.Context(), c.Query("key"), page, size)
+	if err != nil {
+		h.logger.Errorf("Failed to list setting changes: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询变更历史失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data": gin.H{
+			"list":  changes,
+			"total": total,
+			"page":  page,
+			"size":  size,
+		},
+	})
+}
+
+// ListAuditLogs 查询审计记录
+// @Summary 查询审计记录
+// @Description 按时间倒序返回查看密钥等敏感操作的记录
+// @Tags 系统管理
+// @Produce json
+// @Param action query string false "操作"
+// @Param target query string false "操作对象"
+// @Param page query int false "页码"
+// @Param size query int false "每页数量"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/audit-logs [get]
+func (h *AdminHandler) ListAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	logs, total, err := h.audit.List(c.Request.Context(), c.Query("action"), c.Query("target"), page, size)
+	if err != nil {
+		h.logger.Errorf("Failed to list audit logs: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询审计记录失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data": gin.H{
+			"list":  logs,
+			"total": total,
+			"page":  page,
+			"size":  size,
+		},
 	})
 }
 
@@ -73,13 +191,17 @@ func (h *AdminHandler) GetSystemInfo(c *gin.Context) {
 		InProgress int64 `json:"in_progress"`
 	}
 
-	h.db.Model(&entity.Task{}).Count(&taskStats.Total)
-	h.db.Model(&entity.Task{}).Where("status = ?", entity.TaskStatusSuccess).Count(&taskStats.Success)
-	h.db.Model(&entity.Task{}).Where("status = ?", entity.TaskStatusFailure).Count(&taskStats.Failed)
-	h.db.Model(&entity.Task{}).Where("status IN ?", []entity.TaskStatus{
-		entity.TaskStatusSubmitted,
-		entity.TaskStatusInProgress,
-	}).Count(&taskStats.InProgress)
+	ctx := c.Request.Context()
+	taskStats.Total, _ = h.repos.Tasks.Count(ctx, repository.TaskQuery{})
+	taskStats.Success, _ = h.repos.Tasks.Count(ctx, repository.TaskQuery{
+		Statuses: []entity.TaskStatus{entity.TaskStatusSuccess},
+	})
+	taskStats.Failed, _ = h.repos.Tasks.Count(ctx, repository.TaskQuery{
+		Statuses: []entity.TaskStatus{entity.TaskStatusFailure},
+	})
+	taskStats.InProgress, _ = h.repos.Tasks.Count(ctx, repository.TaskQuery{
+		Statuses: []entity.TaskStatus{entity.TaskStatusSubmitted, entity.TaskStatusInProgress},
+	})
 
 	// 获取用户统计
 	var userStats struct {
@@ -88,9 +210,10 @@ func (h *AdminHandler) GetSystemInfo(c *gin.Context) {
 		Admin   int64 `json:"admin"`
 	}
 
-	h.db.Model(&entity.User{}).Count(&userStats.Total)
-	h.db.Model(&entity.User{}).Where("enabled = ?", true).Count(&userStats.Enabled)
-	h.db.Model(&entity.User{}).Where("role = ?", entity.RoleAdmin).Count(&userStats.Admin)
+	enabled := true
+	userStats.Total, _ = h.repos.Users.Count(ctx, repository.UserQuery{})
+	userStats.Enabled, _ = h.repos.Users.Count(ctx, repository.UserQuery{Enabled: &enabled})
+	userStats.Admin, _ = h.repos.Users.Count(ctx, repository.UserQuery{Role: entity.RoleAdmin})
 
 	systemInfo := gin.H{
 		"app": gin.H{
@@ -133,19 +256,23 @@ func (h *AdminHandler) GetOverview(c *gin.Context) {
 		PendingTasks  int64 `json:"pending_tasks"`
 	}
 
-	today := "date(created_at) = date('now')"
-	if h.config.Database.Type == "mysql" {
-		today = "date(created_at) = curdate()"
-	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 
-	h.db.Model(&entity.Task{}).Where(today).Count(&todayStats.TotalTasks)
-	h.db.Model(&entity.Task{}).Where(today+" AND status = ?", entity.TaskStatusSuccess).Count(&todayStats.SuccessTasks)
-	h.db.Model(&entity.Task{}).Where(today+" AND status = ?", entity.TaskStatusFailure).Count(&todayStats.FailedTasks)
-	h.db.Model(&entity.Task{}).Where(today+" AND status IN ?", []entity.TaskStatus{
-		entity.TaskStatusNotStart,
-		entity.TaskStatusSubmitted,
-		entity.TaskStatusInProgress,
-	}).Count(&todayStats.PendingTasks)
+	ctx := c.Request.Context()
+	todayStats.TotalTasks, _ = h.repos.Tasks.Count(ctx, repository.TaskQuery{CreatedFrom: &today})
+	todayStats.SuccessTasks, _ = h.repos.Tasks.Count(ctx, repository.TaskQuery{
+		CreatedFrom: &today,
+		Statuses:    []entity.TaskStatus{entity.TaskStatusSuccess},
+	})
+	todayStats.FailedTasks, _ = h.repos.Tasks.Count(ctx, repository.TaskQuery{
+		CreatedFrom: &today,
+		Statuses:    []entity.TaskStatus{entity.TaskStatusFailure},
+	})
+	todayStats.PendingTasks, _ = h.repos.Tasks.Count(ctx, repository.TaskQuery{
+		CreatedFrom: &today,
+		Statuses:    entity.UnfinishedTaskStatuses,
+	})
 
 	// 获取Discord实例状态
 	instances := h.discordManager.GetAllInstances()
@@ -191,8 +318,7 @@ func (h *AdminHandler) GetAccountStats(c *gin.Context) {
 
 // ListBannedWords 获取禁用词列表
 func (h *AdminHandler) ListBannedWords(c *gin.Context) {
-	var words []entity.BannedWord
-	h.db.Order("created_at DESC").Find(&words)
+	words, _ := h.repos.BannedWords.Find(c.Request.Context(), false)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
@@ -230,8 +356,7 @@ func (h *AdminHandler) DeleteBannedWord(c *gin.Context) {
 
 // ListDomainTags 获取领域标签列表
 func (h *AdminHandler) ListDomainTags(c *gin.Context) {
-	var tags []entity.DomainTag
-	h.db.Order("sort ASC, created_at DESC").Find(&tags)
+	tags, _ := h.repos.DomainTags.Find(c.Request.Context())
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
@@ -267,6 +392,14 @@ func (h *AdminHandler) DeleteDomainTag(c *gin.Context) {
 	})
 }
 
+// operatorName 当前登录用户的用户名，用于变更和审计记录
+func operatorName(c *gin.Context) string {
+	if user, exists := c.Get("user"); exists {
+		return user.(*entity.User).Username
+	}
+	return ""
+}
+
 // bToMb 字节转MB
 func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
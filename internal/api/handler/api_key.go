@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// APIKeyHandler API密钥处理器
+type APIKeyHandler struct {
+	apiKeys *service.APIKeyService
+	audit   *service.AuditService
+	logger  logger.Logger
+}
+
+// NewAPIKeyHandler 创建API密钥处理器
+func NewAPIKeyHandler(apiKeys *service.APIKeyService, audit *service.AuditService, logger logger.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeys: apiKeys,
+		audit:   audit,
+		logger:  logger,
+	}
+}
+
+// CreateAPIKeyRequest 创建密钥请求
+type CreateAPIKeyRequest struct {
+	Name       string               `json:"name" binding:"required"`
+	Scopes     []entity.APIKeyScope `json:"scopes" binding:"required"`
+	AllowedIPs []string             `json:"allowed_ips"`          // IP或CIDR，为空时不限制
+	ExpiresAt  *time.Time           `json:"expires_at,omitempty"` // 为空表示永不过期
+}
+
+// List 查询当前用户的密钥
+// @Summary 查询我的API密钥
+// @Description 默认只返回未吊销的密钥，include_revoked=true时包括已吊销的密钥
+// @Tags API密钥
+// @Produce json
+// @Param include_revoked query bool false "包括已吊销的密钥"
+// @Param page query int false "页码"
+// @Param size query int false "每页数量"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/keys [get]
+func (h *APIKeyHandler) List(c *gin.Context) {
+	h.list(c, c.GetString("user_id"))
+}
+
+// AdminList 查询所有用户的密钥
+// @Summary 查询API密钥
+// @Description 管理员查询密钥，可按用户过滤
+// @Tags 系统管理
+// @Produce json
+// @Param user_id query string false "用户ID"
+// @Param include_revoked query bool false "包括已吊销的密钥"
+// @Param page query int false "页码"
+// @Param size query int false "每页数量"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/api-keys [get]
+func (h *APIKeyHandler) AdminList(c *gin.Context) {
+	h.list(c, c.Query("user_id"))
+}
+
+// list 分页查询密钥，userID为空时不过滤
+func (h *APIKeyHandler) list(c *gin.Context, userID string) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+	includeRevoked, _ := strconv.ParseBool(c.Query("include_revoked"))
+
+	keys, total, err := h.apiKeys.List(c.Request.Context(), userID, includeRevoked, page, size)
+	if err != nil {
+		h.logger.Errorf("Failed to list API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询密钥失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data": gin.H{
+			"list":  keys,
+			"total": total,
+			"page":  page,
+			"size":  size,
+		},
+	})
+}
+
+// Create 创建密钥
+// @Summary 创建API密钥
+// @Description 密钥明文只在响应中返回一次，服务端只保存摘要。admin:read和admin:write只能由管理员创建
+// @Tags API密钥
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "密钥信息"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/keys [post]
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "参数错误: "+err.Error()))
+		return
+	}
+
+	owner := c.MustGet("user").(*entity.User)
+	key, raw, err := h.apiKeys.Create(c.Request.Context(), owner, service.APIKeyInput{
+		Name:       req.Name,
+		Scopes:     req.Scopes,
+		AllowedIPs: req.AllowedIPs,
+		ExpiresAt:  req.ExpiresAt,
+	})
+	if err != nil {
+		if keyErr, ok := err.(*service.APIKeyError); ok {
+			c.JSON(http.StatusBadRequest, ErrorResult(40000, keyErr.Message))
+			return
+		}
+		h.logger.Errorf("Failed to create API key: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建密钥失败"))
+		return
+	}
+	h.record(c, entity.AuditCreateAPIKey, key)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "创建成功，请立即保存密钥，之后将无法再次查看",
+		"data": gin.H{
+			"key":     raw,
+			"api_key": key,
+		},
+	})
+}
+
+// Revoke 吊销当前用户的密钥
+// @Summary 吊销API密钥
+// @Description 吊销后立即失效，记录保留用于查看最近使用情况
+// @Tags API密钥
+// @Produce json
+// @Param id path string true "密钥ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	h.revoke(c, c.GetString("user_id"))
+}
+
+// AdminRevoke 吊销任意用户的密钥
+// @Summary 吊销API密钥
+// @Description 管理员吊销任意用户的密钥，立即失效
+// @Tags 系统管理
+// @Produce json
+// @Param id path string true "密钥ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) AdminRevoke(c *gin.Context) {
+	h.revoke(c, "")
+}
+
+// revoke 吊销密钥，userID非空时只能吊销该用户的密钥
+func (h *APIKeyHandler) revoke(c *gin.Context, userID string) {
+	key, err := h.apiKeys.Revoke(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, ErrorResult(40400, "密钥不存在"))
+			return
+		}
+		h.logger.Errorf("Failed to revoke API key %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "吊销密钥失败"))
+		return
+	}
+	h.record(c, entity.AuditRevokeAPIKey, key)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "吊销成功",
+		"data":    key,
+	})
+}
+
+// record 记录密钥的创建和吊销，操作已经完成，记录失败只写日志
+func (h *APIKeyHandler) record(c *gin.Context, action string, key *entity.APIKey) {
+	detail := key.Prefix + " " + key.Name
+	if action == entity.AuditCreateAPIKey {
+		scopes := make([]string, len(key.Scopes))
+		for i, scope := range key.Scopes {
+			scopes[i] = string(scope)
+		}
+		detail += " [" + strings.Join(scopes, ",") + "]"
+	}
+	if err := h.audit.Record(c.Request.Context(), action, key.ID, operatorName(c), c.ClientIP(), detail); err != nil {
+		h.logger.Errorf("Failed to audit %s of API key %s: %v", action, key.ID, err)
+	}
+}
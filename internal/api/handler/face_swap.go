@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/fetcher"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// FaceSwapHandler 换脸处理器
+type FaceSwapHandler struct {
+	faceSwapService *service.FaceSwapService
+	fetcher         *fetcher.Fetcher
+	maxFileSize     int64
+	logger          logger.Logger
+}
+
+// NewFaceSwapHandler 创建换脸处理器
+func NewFaceSwapHandler(faceSwapService *service.FaceSwapService, fetcher *fetcher.Fetcher, maxFileSize int64, logger logger.Logger) *FaceSwapHandler {
+	return &FaceSwapHandler{
+		faceSwapService: faceSwapService,
+		fetcher:         fetcher,
+		maxFileSize:     maxFileSize,
+		logger:          logger,
+	}
+}
+
+// SwapFaceRequest 换脸请求，人脸图片和目标图片均可使用base64或链接
+type SwapFaceRequest struct {
+	SourceBase64 string `json:"sourceBase64,omitempty"`
+	SourceURL    string `json:"sourceUrl,omitempty"`
+	TargetBase64 string `json:"targetBase64,omitempty"`
+	TargetURL    string `json:"targetUrl,omitempty"`
+	State        string `json:"state,omitempty"`
+	NotifyHook   string `json:"notifyHook,omitempty"`
+}
+
+// SwapFace 提交换脸任务
+// @Summary 提交换脸任务
+// @Description 将人脸图片中的人脸替换到目标图片上
+// @Tags 换脸
+// @Accept json
+// @Produce json
+// @Param request body SwapFaceRequest true "换脸请求"
+// @Success 200 {object} SubmitResultVO
+// @Router /api/insight-face/swap [post]
+func (h *FaceSwapHandler) SwapFace(c *gin.Context) {
+	if !h.faceSwapService.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, ErrorResult(50300, service.ErrFaceSwapDisabled.Error()))
+		return
+	}
+
+	var req SwapFaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "参数错误: "+err.Error()))
+		return
+	}
+
+	source, err := loadInput(c.Request.Context(), h.fetcher, req.SourceBase64, req.SourceURL, h.maxFileSize, "image/")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "人脸图片无效: "+err.Error()))
+		return
+	}
+	target, err := loadInput(c.Request.Context(), h.fetcher, req.TargetBase64, req.TargetURL, h.maxFileSize, "image/")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "目标图片无效: "+err.Error()))
+		return
+	}
+
+	// 获取用户信息
+	userID := "guest"
+	if uid, exists := c.Get("user_id"); exists {
+		userID = uid.(string)
+	}
+
+	// 创建任务
+	now := time.Now()
+	task := &entity.Task{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		Action:          entity.TaskActionSwapFace,
+		Status:          entity.TaskStatusNotStart,
+		Description:     "/swap_face",
+		State:           req.State,
+		NotifyHook:      req.NotifyHook,
+		ClientIP:        c.ClientIP(),
+		SubmitTime:      &now,
+		IsReplicate:     true,
+		ReplicateSource: req.SourceURL,
+		ReplicateTarget: req.TargetURL,
+		Inputs:          []*entity.DataURL{source, target},
+	}
+	if req.SourceBase64 != "" {
+		task.ReplicateSource = ""
+	}
+	if req.TargetBase64 != "" {
+		task.ReplicateTarget = ""
+	}
+
+	if err := h.faceSwapService.Submit(task); err != nil {
+		h.logger.Errorf("Failed to submit face swap task %s: %v", task.ID, err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResult(50300, err.Error()))
+		return
+	}
+
+	h.logger.Infof("Face swap task %s submitted by user %s", task.ID, userID)
+	c.JSON(http.StatusOK, SuccessResult(task.ID))
+}
+
+// SwapVideoFaceRequest 视频换脸请求，人脸为图片，目标为MP4/MOV视频，均可使用base64或链接
+type SwapVideoFaceRequest struct {
+	SourceBase64 string `json:"sourceBase64,omitempty"`
+	SourceURL    string `json:"sourceUrl,omitempty"`
+	TargetBase64 string `json:"targetBase64,omitempty"`
+	TargetURL    string `json:"targetUrl,omitempty"`
+	State        string `json:"state,omitempty"`
+	NotifyHook   string `json:"notifyHook,omitempty"`
+}
+
+// SwapVideoFace 提交视频换脸任务
+// @Summary 提交视频换脸任务
+// @Description 将人脸图片中的人脸替换到目标视频中，视频有大小和时长限制
+// @Tags 换脸
+// @Accept json
+// @Produce json
+// @Param request body SwapVideoFaceRequest true "视频换脸请求"
+// @Success 200 {object} SubmitResultVO
+// @Router /api/insight-face/video/swap [post]
+func (h *FaceSwapHandler) SwapVideoFace(c *gin.Context) {
+	if !h.faceSwapService.VideoEnabled() {
+		c.JSON(http.StatusServiceUnavailable, ErrorResult(50300, service.ErrVideoFaceSwapDisabled.Error()))
+		return
+	}
+
+	var req SwapVideoFaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "参数错误: "+err.Error()))
+		return
+	}
+
+	source, err := loadInput(c.Request.Context(), h.fetcher, req.SourceBase64, req.SourceURL, h.maxFileSize, "image/")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "人脸图片无效: "+err.Error()))
+		return
+	}
+
+	maxSize, maxDuration := h.faceSwapService.VideoLimits()
+	target, err := loadInput(c.Request.Context(), h.fetcher, req.TargetBase64, req.TargetURL, maxSize, "video/mp4", "video/quicktime")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "目标视频无效: "+err.Error()))
+		return
+	}
+	duration, err := service.VideoDuration(target.Data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "目标视频无效: "+err.Error()))
+		return
+	}
+	if duration > maxDuration {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, fmt.Sprintf("目标视频时长不能超过%d秒", int(maxDuration.Seconds()))))
+		return
+	}
+
+	// 获取用户信息
+	userID := "guest"
+	if uid, exists := c.Get("user_id"); exists {
+		userID = uid.(string)
+	}
+
+	// 创建任务
+	now := time.Now()
+	task := &entity.Task{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		Action:          entity.TaskActionSwapVideoFace,
+		Status:          entity.TaskStatusNotStart,
+		Description:     "/swap_video_face",
+		State:           req.State,
+		NotifyHook:      req.NotifyHook,
+		ClientIP:        c.ClientIP(),
+		SubmitTime:      &now,
+		IsReplicate:     true,
+		ReplicateSource: req.SourceURL,
+		ReplicateTarget: req.TargetURL,
+		Inputs:          []*entity.DataURL{source, target},
+	}
+	if req.SourceBase64 != "" {
+		task.ReplicateSource = ""
+	}
+	if req.TargetBase64 != "" {
+		task.ReplicateTarget = ""
+	}
+	task.SetProperty("videoDuration", duration.Seconds())
+
+	if err := h.faceSwapService.Submit(task); err != nil {
+		h.logger.Errorf("Failed to submit video face swap task %s: %v", task.ID, err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResult(50300, err.Error()))
+		return
+	}
+
+	h.logger.Infof("Video face swap task %s submitted by user %s", task.ID, userID)
+	c.JSON(http.StatusOK, SuccessResult(task.ID))
+}
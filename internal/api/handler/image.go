@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// ImageHandler 图片代理处理器
+type ImageHandler struct {
+	tasks      repository.TaskRepository
+	imageProxy *service.ImageProxy
+	logger     logger.Logger
+}
+
+// NewImageHandler 创建图片代理处理器
+func NewImageHandler(tasks repository.TaskRepository, imageProxy *service.ImageProxy, logger logger.Logger) *ImageHandler {
+	return &ImageHandler{
+		tasks:      tasks,
+		imageProxy: imageProxy,
+		logger:     logger,
+	}
+}
+
+// GetImage 获取任务图片
+// @Summary 获取任务图片
+// @Description 返回已转存的图片，未转存时经代理从Discord CDN获取并缓存
+// @Tags 图片
+// @Produce image/png,image/jpeg,image/webp
+// @Param taskId path string true "任务ID"
+// @Router /api/mj/image/{taskId} [get]
+func (h *ImageHandler) GetImage(c *gin.Context) {
+	h.serve(c, false)
+}
+
+// GetThumbnail 获取任务缩略图
+// @Summary 获取任务缩略图
+// @Description 返回任务缩略图，没有缩略图时返回原图
+// @Tags 图片
+// @Produce image/png,image/jpeg,image/webp
+// @Param taskId path string true "任务ID"
+// @Router /api/mj/image/{taskId}/thumbnail [get]
+func (h *ImageHandler) GetThumbnail(c *gin.Context) {
+	h.serve(c, true)
+}
+
+// serve 输出图片
+func (h *ImageHandler) serve(c *gin.Context, thumbnail bool) {
+	task, err := h.tasks.Get(c.Request.Context(), c.Param("taskId"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, ErrorResult(40400, "任务不存在"))
+		} else {
+			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
+		}
+		return
+	}
+
+	image, err := h.imageProxy.Open(c.Request.Context(), task, thumbnail)
+	if err != nil {
+		if err == service.ErrImageNotFound {
+			c.JSON(http.StatusNotFound, ErrorResult(40400, err.Error()))
+			return
+		}
+		h.logger.Errorf("Failed to open image of task %s: %v", task.ID, err)
+		c.JSON(http.StatusBadGateway, ErrorResult(50200, "获取图片失败"))
+		return
+	}
+	defer image.Body.Close()
+
+	// 未完成任务的预览图会持续变化，不允许缓存
+	cacheControl := "no-cache"
+	if task.IsFinished() {
+		cacheControl = "public, max-age=" + strconv.Itoa(h.imageProxy.MaxAge()) + ", immutable"
+	}
+
+	c.Header("ETag", image.ETag)
+	c.Header("Cache-Control", cacheControl)
+
+	if match := c.GetHeader("If-None-Match"); match != "" && etagMatches(match, image.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Header("Content-Type", image.ContentType)
+	if image.Size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(image.Size, 10))
+	}
+	c.Status(http.StatusOK)
+
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(c.Writer, image.Body); err != nil {
+		h.logger.Debugf("Failed to write image of task %s: %v", task.ID, err)
+	}
+}
+
+// etagMatches If-None-Match 是否包含指定ETag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
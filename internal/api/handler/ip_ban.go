@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// IPBanHandler IP封禁管理处理器
+type IPBanHandler struct {
+	bans   *service.IPBanService
+	logger logger.Logger
+}
+
+// NewIPBanHandler 创建IP封禁管理处理器
+func NewIPBanHandler(bans *service.IPBanService, logger logger.Logger) *IPBanHandler {
+	return &IPBanHandler{
+		bans:   bans,
+		logger: logger,
+	}
+}
+
+// CreateIPBanRequest 添加封禁请求
+type CreateIPBanRequest struct {
+	IP              string `json:"ip" binding:"required"`
+	Reason          string `json:"reason"`
+	DurationMinutes int    `json:"duration_minutes"` // 0表示永久封禁
+}
+
+// List 查询封禁列表
+// @Summary 查询IP封禁
+// @Description 默认只返回生效中的封禁，include_expired=true时包括已到期的自动封禁记录
+// @Tags 系统管理
+// @Produce json
+// @Param include_expired query bool false "包括已到期的记录"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/ip-bans [get]
+func (h *IPBanHandler) List(c *gin.Context) {
+	includeExpired, _ := strconv.ParseBool(c.Query("include_expired"))
+	bans, err := h.bans.List(c.Request.Context(), includeExpired)
+	if err != nil {
+		h.logger.Errorf("Failed to list IP bans: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询封禁列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data":    bans,
+	})
+}
+
+// Get 查询封禁详情
+// @Summary 查询IP封禁详情
+// @Description 返回封禁来源、原因、到期时间和累计封禁次数，CIDR直接写在路径中
+// @Tags 系统管理
+// @Produce json
+// @Param ip path string true "IP地址或CIDR"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/ip-bans/{ip} [get]
+func (h *IPBanHandler) Get(c *gin.Context) {
+	ban, err := h.bans.Get(c.Request.Context(), banTarget(c))
+	if err != nil {
+		h.respondError(c, err, "查询封禁失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data":    ban,
+	})
+}
+
+// Create 添加封禁
+// @Summary 添加IP封禁
+// @Description 封禁IP地址或CIDR，已有记录时覆盖原因和到期时间
+// @Tags 系统管理
+// @Accept json
+// @Produce json
+// @Param request body CreateIPBanRequest true "封禁信息"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/ip-bans [post]
+func (h *IPBanHandler) Create(c *gin.Context) {
+	var req CreateIPBanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "参数错误: "+err.Error()))
+		return
+	}
+	if req.DurationMinutes < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "封禁时长不能为负数"))
+		return
+	}
+
+	duration := time.Duration(req.DurationMinutes) * time.Minute
+	ban, err := h.bans.Ban(c.Request.Context(), req.IP, req.Reason, duration, operatorName(c))
+	if err != nil {
+		h.respondError(c, err, "添加封禁失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "封禁成功",
+		"data":    ban,
+	})
+}
+
+// Delete 解除封禁
+// @Summary 解除IP封禁
+// @Description 删除封禁记录，之后再次自动封禁时从最短的时长开始
+// @Tags 系统管理
+// @Produce json
+// @Param ip path string true "IP地址或CIDR"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/ip-bans/{ip} [delete]
+func (h *IPBanHandler) Delete(c *gin.Context) {
+	if err := h.bans.Unban(c.Request.Context(), banTarget(c)); err != nil {
+		h.respondError(c, err, "解除封禁失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "解除成功",
+	})
+}
+
+// banTarget 路径中的IP地址或CIDR，CIDR包含斜杠，因此使用通配参数
+func banTarget(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("ip"), "/")
+}
+
+// respondError 根据错误返回响应
+func (h *IPBanHandler) respondError(c *gin.Context, err error, message string) {
+	switch err {
+	case service.ErrInvalidBanTarget:
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, err.Error()))
+	case repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, ErrorResult(40400, "封禁记录不存在"))
+	default:
+		h.logger.Errorf("IP ban request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, message))
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// SchedulerHandler 定时任务处理器
+type SchedulerHandler struct {
+	scheduler *service.Scheduler
+	logger    logger.Logger
+}
+
+// NewSchedulerHandler 创建定时任务处理器
+func NewSchedulerHandler(scheduler *service.Scheduler, logger logger.Logger) *SchedulerHandler {
+	return &SchedulerHandler{
+		scheduler: scheduler,
+		logger:    logger,
+	}
+}
+
+// GetStatus 查询定时任务状态
+// @Summary 查询定时任务状态
+// @Description 返回当前领导者节点和各定时任务最近一次执行情况
+// @Tags 系统管理
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/scheduler [get]
+func (h *SchedulerHandler) GetStatus(c *gin.Context) {
+	status, err := h.scheduler.Status(c.Request.Context())
+	if err != nil {
+		h.logger.Errorf("Failed to get scheduler status: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询定时任务状态失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data":    status,
+	})
+}
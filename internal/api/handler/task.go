@@ -1,31 +1,44 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
+	"github.com/gorilla/websocket"
 
 	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
 	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/internal/infrastructure/fetcher"
+	"midjourney-proxy-go/internal/service"
 	"midjourney-proxy-go/pkg/logger"
 )
 
 // TaskHandler 任务处理器
 type TaskHandler struct {
-	db             *gorm.DB
+	tasks          repository.TaskRepository
 	discordManager *discord.Manager
+	taskService    *service.TaskService
+	ipBans         *service.IPBanService
+	fetcher        *fetcher.Fetcher
+	upgrader       websocket.Upgrader
 	logger         logger.Logger
 }
 
-// NewTaskHandler 创建任务处理器
-func NewTaskHandler(db *gorm.DB, discordManager *discord.Manager, logger logger.Logger) *TaskHandler {
+// NewTaskHandler 创建任务处理器，allowedOrigins为允许建立任务WebSocket的跨域来源
+func NewTaskHandler(tasks repository.TaskRepository, discordManager *discord.Manager, taskService *service.TaskService, ipBans *service.IPBanService, fetcher *fetcher.Fetcher, allowedOrigins []string, logger logger.Logger) *TaskHandler {
 	return &TaskHandler{
-		db:             db,
+		tasks:          tasks,
 		discordManager: discordManager,
+		taskService:    taskService,
+		ipBans:         ipBans,
+		fetcher:        fetcher,
+		upgrader:       newTaskSocketUpgrader(allowedOrigins),
 		logger:         logger,
 	}
 }
@@ -39,6 +52,7 @@ type SubmitImagineRequest struct {
 	NotifyHook    string                      `json:"notifyHook,omitempty"`
 	AccountFilter *entity.AccountFilter       `json:"accountFilter,omitempty"`
 	Mode          entity.GenerationSpeedMode  `json:"mode,omitempty"`
+	SplitGrid     *bool                       `json:"splitGrid,omitempty"`
 }
 
 // SubmitChangeRequest 提交变化请求
@@ -49,6 +63,7 @@ type SubmitChangeRequest struct {
 	State         string                `json:"state,omitempty"`
 	NotifyHook    string                `json:"notifyHook,omitempty"`
 	AccountFilter *entity.AccountFilter `json:"accountFilter,omitempty"`
+	SplitGrid     *bool                 `json:"splitGrid,omitempty"`
 }
 
 // SubmitDescribeRequest 提交描述请求
@@ -111,6 +126,19 @@ func (h *TaskHandler) SubmitImagine(c *gin.Context) {
 	// 获取客户端IP
 	clientIP := c.ClientIP()
 
+	// 校验垫图：base64随任务上传，提示词中的链接由Discord读取，这里只确认可访问且为图片
+	inputs, err := h.loadImages(c.Request.Context(), req.Base64Array, nil)
+	if err != nil {
+		respondInvalidImage(c, err)
+		return
+	}
+	for _, link := range promptImageURLs(req.Prompt) {
+		if _, err := h.fetcher.FetchImage(c.Request.Context(), link); err != nil {
+			respondInvalidImage(c, fmt.Errorf("%s: %w", link, err))
+			return
+		}
+	}
+
 	// 创建任务
 	task := &entity.Task{
 		ID:            uuid.New().String(),
@@ -121,9 +149,11 @@ func (h *TaskHandler) SubmitImagine(c *gin.Context) {
 		Prompt:        req.Prompt,
 		Description:   "/imagine " + req.Prompt,
 		State:         req.State,
+		NotifyHook:    req.NotifyHook,
 		ClientIP:      clientIP,
 		Mode:          req.Mode,
 		AccountFilter: req.AccountFilter,
+		Inputs:        inputs,
 	}
 
 	// 设置Bot类型
@@ -131,50 +161,27 @@ func (h *TaskHandler) SubmitImagine(c *gin.Context) {
 		task.BotType = entity.BotTypeNijijourney
 	}
 
+	if req.SplitGrid != nil {
+		task.SetProperty(service.SplitGridProperty, *req.SplitGrid)
+	}
+
 	// 设置提交时间
 	now := time.Now()
 	task.SubmitTime = &now
 
 	// 保存任务到数据库
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
 	}
 
-	// 获取可用的Discord实例
-	instance := h.discordManager.GetAvailableInstanceWithFilter(req.AccountFilter)
-	if instance == nil {
-		// 更新任务状态为失败
-		task.Fail("没有可用的Discord实例")
-		h.db.Save(task)
-		c.JSON(http.StatusServiceUnavailable, ErrorResult(50300, "没有可用的Discord实例"))
+	// 禁用词检查、翻译、选择账号并提交到实例执行队列
+	if err := h.taskService.Dispatch(c.Request.Context(), task, service.DispatchOptions{}); err != nil {
+		h.respondDispatchError(c, task, err)
 		return
 	}
 
-	// 启动任务
-	task.Start()
-	task.InstanceID = instance.ID
-	h.db.Save(task)
-
-	// 异步提交到Discord
-	go func() {
-		h.logger.Infof("Submitting imagine task %s to Discord instance %s", task.ID, instance.ID)
-		
-		// TODO: 实际提交到Discord
-		// 这里应该调用Discord API提交任务
-		
-		// 模拟处理时间
-		time.Sleep(2 * time.Second)
-		
-		// 模拟成功
-		task.Success()
-		task.ImageURL = "https://example.com/image.jpg" // 模拟图片URL
-		h.db.Save(task)
-		
-		h.logger.Infof("Task %s completed successfully", task.ID)
-	}()
-
 	h.logger.Infof("Task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
 }
@@ -196,9 +203,9 @@ func (h *TaskHandler) SubmitChange(c *gin.Context) {
 	}
 
 	// 查找父任务
-	var parentTask entity.Task
-	if err := h.db.Where("id = ?", req.TaskID).First(&parentTask).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	parentTask, err := h.tasks.Get(c.Request.Context(), req.TaskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, ErrorResult(40400, "关联任务不存在"))
 		} else {
 			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
@@ -230,6 +237,7 @@ func (h *TaskHandler) SubmitChange(c *gin.Context) {
 		Prompt:      parentTask.Prompt,
 		PromptEn:    parentTask.PromptEn,
 		State:       req.State,
+		NotifyHook:  req.NotifyHook,
 		ClientIP:    c.ClientIP(),
 		InstanceID:  parentTask.InstanceID,
 	}
@@ -244,12 +252,16 @@ func (h *TaskHandler) SubmitChange(c *gin.Context) {
 		task.Description = "/up " + req.TaskID + " R"
 	}
 
+	if req.SplitGrid != nil {
+		task.SetProperty(service.SplitGridProperty, *req.SplitGrid)
+	}
+
 	// 设置提交时间
 	now := time.Now()
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create change task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -257,7 +269,7 @@ func (h *TaskHandler) SubmitChange(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Change task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -298,7 +310,7 @@ func (h *TaskHandler) SubmitSimpleChange(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create simple change task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -321,6 +333,18 @@ func (h *TaskHandler) SubmitDescribe(c *gin.Context) {
 		return
 	}
 
+	var base64Array, links []string
+	if req.Base64 != "" {
+		base64Array = []string{req.Base64}
+	} else {
+		links = []string{req.Link}
+	}
+	inputs, err := h.loadImages(c.Request.Context(), base64Array, links)
+	if err != nil {
+		respondInvalidImage(c, err)
+		return
+	}
+
 	// 获取用户信息
 	userID := "guest"
 	if uid, exists := c.Get("user_id"); exists {
@@ -336,7 +360,9 @@ func (h *TaskHandler) SubmitDescribe(c *gin.Context) {
 		Status:      entity.TaskStatusNotStart,
 		Description: "/describe",
 		State:       req.State,
+		NotifyHook:  req.NotifyHook,
 		ClientIP:    c.ClientIP(),
+		Inputs:      inputs,
 	}
 
 	// 设置Bot类型
@@ -349,7 +375,7 @@ func (h *TaskHandler) SubmitDescribe(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create describe task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -374,6 +400,12 @@ func (h *TaskHandler) SubmitBlend(c *gin.Context) {
 		return
 	}
 
+	inputs, err := h.loadImages(c.Request.Context(), req.Base64Array, nil)
+	if err != nil {
+		respondInvalidImage(c, err)
+		return
+	}
+
 	// 获取用户信息
 	userID := "guest"
 	if uid, exists := c.Get("user_id"); exists {
@@ -389,8 +421,10 @@ func (h *TaskHandler) SubmitBlend(c *gin.Context) {
 		Status:        entity.TaskStatusNotStart,
 		Description:   "/blend",
 		State:         req.State,
+		NotifyHook:    req.NotifyHook,
 		ClientIP:      c.ClientIP(),
 		AccountFilter: req.AccountFilter,
+		Inputs:        inputs,
 	}
 
 	// 设置提交时间
@@ -398,7 +432,7 @@ func (h *TaskHandler) SubmitBlend(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create blend task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -406,7 +440,7 @@ func (h *TaskHandler) SubmitBlend(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Blend task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -442,6 +476,7 @@ func (h *TaskHandler) SubmitShorten(c *gin.Context) {
 		Prompt:        req.Prompt,
 		Description:   "/shorten " + req.Prompt,
 		State:         req.State,
+		NotifyHook:    req.NotifyHook,
 		ClientIP:      c.ClientIP(),
 		AccountFilter: req.AccountFilter,
 	}
@@ -451,7 +486,7 @@ func (h *TaskHandler) SubmitShorten(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create shorten task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -459,7 +494,7 @@ func (h *TaskHandler) SubmitShorten(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Shorten task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -480,9 +515,9 @@ func (h *TaskHandler) SubmitShow(c *gin.Context) {
 	}
 
 	// 查找关联任务
-	var parentTask entity.Task
-	if err := h.db.Where("id = ?", req.TaskID).First(&parentTask).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	parentTask, err := h.tasks.Get(c.Request.Context(), req.TaskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, ErrorResult(40400, "关联任务不存在"))
 		} else {
 			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
@@ -506,6 +541,7 @@ func (h *TaskHandler) SubmitShow(c *gin.Context) {
 		Status:        entity.TaskStatusNotStart,
 		Description:   "/show " + req.TaskID,
 		State:         req.State,
+		NotifyHook:    req.NotifyHook,
 		ClientIP:      c.ClientIP(),
 		AccountFilter: req.AccountFilter,
 		InstanceID:    parentTask.InstanceID,
@@ -516,7 +552,7 @@ func (h *TaskHandler) SubmitShow(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create show task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -524,7 +560,7 @@ func (h *TaskHandler) SubmitShow(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Show task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -545,9 +581,9 @@ func (h *TaskHandler) SubmitAction(c *gin.Context) {
 	}
 
 	// 查找关联任务
-	var parentTask entity.Task
-	if err := h.db.Where("id = ?", req.TaskID).First(&parentTask).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	parentTask, err := h.tasks.Get(c.Request.Context(), req.TaskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, ErrorResult(40400, "关联任务不存在"))
 		} else {
 			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
@@ -571,6 +607,7 @@ func (h *TaskHandler) SubmitAction(c *gin.Context) {
 		Status:      entity.TaskStatusNotStart,
 		Description: "/action " + req.CustomID,
 		State:       req.State,
+		NotifyHook:  req.NotifyHook,
 		ClientIP:    c.ClientIP(),
 		InstanceID:  parentTask.InstanceID,
 	}
@@ -580,7 +617,7 @@ func (h *TaskHandler) SubmitAction(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create action task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -588,7 +625,7 @@ func (h *TaskHandler) SubmitAction(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Action task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -610,9 +647,9 @@ func (h *TaskHandler) SubmitModal(c *gin.Context) {
 	}
 
 	// 查找关联任务
-	var parentTask entity.Task
-	if err := h.db.Where("id = ?", req.TaskID).First(&parentTask).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	parentTask, err := h.tasks.Get(c.Request.Context(), req.TaskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, ErrorResult(40400, "关联任务不存在"))
 		} else {
 			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
@@ -637,6 +674,7 @@ func (h *TaskHandler) SubmitModal(c *gin.Context) {
 		Prompt:      req.Prompt,
 		Description: "/modal " + req.Prompt,
 		State:       req.State,
+		NotifyHook:  req.NotifyHook,
 		ClientIP:    c.ClientIP(),
 		InstanceID:  parentTask.InstanceID,
 	}
@@ -646,7 +684,7 @@ func (h *TaskHandler) SubmitModal(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create modal task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -654,7 +692,7 @@ func (h *TaskHandler) SubmitModal(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Modal task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -701,7 +739,7 @@ func (h *TaskHandler) UploadDiscordImages(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create upload task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建上传任务失败"))
 		return
@@ -709,7 +747,7 @@ func (h *TaskHandler) UploadDiscordImages(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Upload task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -733,9 +771,9 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 		return
 	}
 
-	var task entity.Task
-	if err := h.db.Where("id = ?", taskID).First(&task).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	task, err := h.tasks.Get(c.Request.Context(), taskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40400,
 				"message": "任务不存在",
@@ -784,22 +822,18 @@ func (h *TaskHandler) ListTasks(c *gin.Context) {
 		userID = uid.(string)
 	}
 
-	var tasks []entity.Task
-	var total int64
-
-	query := h.db.Model(&entity.Task{})
+	query := repository.TaskQuery{}
 	if userID != "admin" {
-		query = query.Where("user_id = ?", userID)
+		query.UserID = userID
 	}
 
 	// 获取总数
-	query.Count(&total)
+	total, _ := h.tasks.Count(c.Request.Context(), query)
 
 	// 获取任务列表
-	query.Order("created_at DESC").
-		Offset(offset).
-		Limit(size).
-		Find(&tasks)
+	query.Offset = offset
+	query.Limit = size
+	tasks, _ := h.tasks.Find(c.Request.Context(), query)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
@@ -815,21 +849,21 @@ func (h *TaskHandler) ListTasks(c *gin.Context) {
 
 // GetQueue 获取队列状态
 func (h *TaskHandler) GetQueue(c *gin.Context) {
-	// 统计各状态的任务数量
-	var stats []struct {
+	// 统计各状态的任务数量，只返回有任务的状态
+	type statusCount struct {
 		Status entity.TaskStatus `json:"status"`
 		Count  int64             `json:"count"`
 	}
+	var stats []statusCount
 
-	h.db.Model(&entity.Task{}).
-		Select("status, count(*) as count").
-		Where("status IN ?", []entity.TaskStatus{
-			entity.TaskStatusNotStart,
-			entity.TaskStatusSubmitted,
-			entity.TaskStatusInProgress,
-		}).
-		Group("status").
-		Find(&stats)
+	for _, status := range entity.UnfinishedTaskStatuses {
+		count, err := h.tasks.Count(c.Request.Context(), repository.TaskQuery{
+			Statuses: []entity.TaskStatus{status},
+		})
+		if err == nil && count > 0 {
+			stats = append(stats, statusCount{Status: status, Count: count})
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
@@ -859,7 +893,7 @@ func (h *TaskHandler) AdminDelete(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Where("id = ?", taskID).Delete(&entity.Task{}).Error; err != nil {
+	if err := h.tasks.Delete(c.Request.Context(), taskID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
 			"message": "删除任务失败",
@@ -873,12 +907,273 @@ func (h *TaskHandler) AdminDelete(c *gin.Context) {
 	})
 }
 
+// respondDispatchError 根据提交流程的错误返回响应
+func (h *TaskHandler) respondDispatchError(c *gin.Context, task *entity.Task, err error) {
+	var bannedErr *service.BannedPromptError
+	switch {
+	case errors.As(err, &bannedErr):
+		h.ipBans.RecordViolation(c.ClientIP(), service.ViolationBannedPrompt, bannedErr.Word)
+		c.JSON(http.StatusBadRequest, ErrorResult(40001, err.Error()))
+	case errors.Is(err, service.ErrUnsupportedAction):
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, err.Error()))
+	case err == service.ErrNoAvailableInstance:
+		c.JSON(http.StatusServiceUnavailable, ErrorResult(50300, err.Error()))
+	default:
+		h.logger.Errorf("Failed to submit task %s: %v", task.ID, err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResult(50300, "提交任务失败: "+err.Error()))
+	}
+}
+
+// RetryRequest 重试请求
+type RetryRequest struct {
+	ExcludeFailedInstance bool   `json:"exclude_failed_instance"`
+	InstanceID            string `json:"instance_id,omitempty"`
+}
+
 // AdminRetry 管理员重试任务
+// @Summary 重试失败任务
+// @Description 在原任务ID上重新执行提交流程，可排除失败的实例或指定实例
+// @Tags 任务管理
+// @Accept json
+// @Produce json
+// @Param id path string true "任务ID"
+// @Param request body RetryRequest false "重试选项"
+// @Success 200 {object} SubmitResultVO
+// @Router /api/admin/tasks/{id}/retry [post]
 func (h *TaskHandler) AdminRetry(c *gin.Context) {
-	// TODO: 实现重试任务逻辑
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"code":    50100,
-		"message": "功能暂未实现",
+	var req RetryRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResult(40000, "参数错误: "+err.Error()))
+			return
+		}
+	}
+
+	task, err := h.tasks.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, ErrorResult(40400, "任务不存在"))
+		} else {
+			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
+		}
+		return
+	}
+
+	err = h.taskService.Retry(c.Request.Context(), task, service.RetryOptions{
+		ExcludeFailedInstance: req.ExcludeFailedInstance,
+		InstanceID:            req.InstanceID,
+	})
+	if err != nil {
+		if err == service.ErrTaskNotRetryable {
+			c.JSON(http.StatusBadRequest, ErrorResult(40000, err.Error()))
+			return
+		}
+		h.respondDispatchError(c, task, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SubmitResultVO{
+		Code:    1,
+		Message: "重试成功",
+		Result:  task.ID,
+	})
+}
+
+// BulkRetryRequest 批量重试请求
+type BulkRetryRequest struct {
+	Start                 time.Time `json:"start" binding:"required"`
+	End                   time.Time `json:"end" binding:"required"`
+	Reason                string    `json:"reason,omitempty"`
+	Limit                 int       `json:"limit,omitempty"`
+	ExcludeFailedInstance bool      `json:"exclude_failed_instance"`
+	InstanceID            string    `json:"instance_id,omitempty"`
+}
+
+// AdminBulkRetry 批量重试指定时间段内因指定原因失败的任务
+// @Summary 批量重试失败任务
+// @Tags 任务管理
+// @Accept json
+// @Produce json
+// @Param request body BulkRetryRequest true "批量重试条件"
+// @Success 200 {object} service.BulkRetryResult
+// @Router /api/admin/tasks/retry [post]
+func (h *TaskHandler) AdminBulkRetry(c *gin.Context) {
+	var req BulkRetryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "参数错误: "+err.Error()))
+		return
+	}
+
+	if !req.End.After(req.Start) {
+		c.JSON(http.StatusBadRequest, ErrorResult(40000, "结束时间必须晚于开始时间"))
+		return
+	}
+
+	result, err := h.taskService.RetryFailed(c.Request.Context(), service.BulkRetryFilter{
+		Start:  req.Start,
+		End:    req.End,
+		Reason: req.Reason,
+		Limit:  req.Limit,
+	}, service.RetryOptions{
+		ExcludeFailedInstance: req.ExcludeFailedInstance,
+		InstanceID:            req.InstanceID,
+	})
+	if err != nil {
+		h.logger.Errorf("Failed to bulk retry tasks: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "批量重试失败"))
+		return
+	}
+
+	h.logger.Infof("Bulk retry finished: %d/%d tasks retried", result.Retried, result.Total)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "重试完成",
+		"data":    result,
+	})
+}
+
+// CancelTask 取消任务
+// @Summary 取消任务
+// @Description 取消排队中或执行中的任务，仅已登录的任务所有者或管理员可操作
+// @Tags 任务查询
+// @Produce json
+// @Param id path string true "任务ID"
+// @Success 200 {object} SubmitResultVO
+// @Router /api/mj/task/{id}/cancel [post]
+func (h *TaskHandler) CancelTask(c *gin.Context) {
+	taskID := c.Param("id")
+
+	task, err := h.tasks.Get(c.Request.Context(), taskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, ErrorResult(40400, "任务不存在"))
+		} else {
+			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
+		}
+		return
+	}
+
+	if !canAccessTask(c, task) {
+		c.JSON(http.StatusForbidden, ErrorResult(40300, "无权取消该任务"))
+		return
+	}
+
+	if err := h.taskService.Cancel(c.Request.Context(), task); err != nil {
+		if err == service.ErrTaskFinished {
+			c.JSON(http.StatusBadRequest, ErrorResult(40000, "任务已结束，无法取消"))
+			return
+		}
+		h.logger.Errorf("Failed to cancel task %s: %v", task.ID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "取消任务失败"))
+		return
+	}
+
+	h.logger.Infof("Task %s cancelled by user %s", task.ID, currentUserID(c))
+	c.JSON(http.StatusOK, SubmitResultVO{
+		Code:    1,
+		Message: "取消成功",
+		Result:  task.ID,
+	})
+}
+
+// GetTaskImages 获取任务切分后的图片
+// @Summary 获取网格切分图片
+// @Description 获取2x2网格结果切分后的4张图片及其缩略图
+// @Tags 任务查询
+// @Produce json
+// @Param id path string true "任务ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/mj/task/{id}/images [get]
+func (h *TaskHandler) GetTaskImages(c *gin.Context) {
+	task, err := h.tasks.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, ErrorResult(40400, "任务不存在"))
+		} else {
+			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
+		}
+		return
+	}
+
+	if !canAccessTask(c, task) {
+		c.JSON(http.StatusForbidden, ErrorResult(40300, "无权访问该任务"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data": gin.H{
+			"id":           task.ID,
+			"imageUrl":     task.ImageURL,
+			"thumbnailUrl": task.ThumbnailURL,
+			"images":       service.GridImages(task),
+		},
+	})
+}
+
+// AdminRecovery 获取启动时未完成任务的恢复结果
+func (h *TaskHandler) AdminRecovery(c *gin.Context) {
+	summary := h.taskService.LastRecovery()
+	if summary == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    1,
+			"message": "恢复尚未完成",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data":    summary,
+	})
+}
+
+// AdminStartThumbnailBackfill 启动缩略图回填
+// @Summary 回填缩略图
+// @Description 在后台为缺少缩略图的成功任务生成缩略图
+// @Tags 任务管理
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/tasks/thumbnails/backfill [post]
+func (h *TaskHandler) AdminStartThumbnailBackfill(c *gin.Context) {
+	status, err := h.taskService.StartThumbnailBackfill()
+	if err != nil {
+		switch err {
+		case service.ErrBackfillRunning:
+			c.JSON(http.StatusConflict, ErrorResult(40900, err.Error()))
+		case service.ErrThumbnailsDisabled:
+			c.JSON(http.StatusBadRequest, ErrorResult(40000, err.Error()))
+		default:
+			h.logger.Errorf("Failed to start thumbnail backfill: %v", err)
+			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "启动回填失败"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "回填已启动",
+		"data":    status,
+	})
+}
+
+// AdminThumbnailBackfillStatus 获取缩略图回填进度
+func (h *TaskHandler) AdminThumbnailBackfillStatus(c *gin.Context) {
+	status := h.taskService.ThumbnailBackfillStatus()
+	if status == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    1,
+			"message": "尚未运行回填",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data":    status,
 	})
 }
 
@@ -904,9 +1199,9 @@ func (h *TaskHandler) SubmitPan(c *gin.Context) {
 	}
 
 	// 查找父任务
-	var parentTask entity.Task
-	if err := h.db.Where("id = ?", req.TaskID).First(&parentTask).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	parentTask, err := h.tasks.Get(c.Request.Context(), req.TaskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, ErrorResult(40400, "关联任务不存在"))
 		} else {
 			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
@@ -930,6 +1225,7 @@ func (h *TaskHandler) SubmitPan(c *gin.Context) {
 		Status:      entity.TaskStatusNotStart,
 		Description: "/pan " + req.Direction + " " + req.TaskID,
 		State:       req.State,
+		NotifyHook:  req.NotifyHook,
 		ClientIP:    c.ClientIP(),
 		InstanceID:  parentTask.InstanceID,
 	}
@@ -942,7 +1238,7 @@ func (h *TaskHandler) SubmitPan(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create pan task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -950,7 +1246,7 @@ func (h *TaskHandler) SubmitPan(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Pan task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -985,9 +1281,9 @@ func (h *TaskHandler) SubmitZoom(c *gin.Context) {
 	}
 
 	// 查找父任务
-	var parentTask entity.Task
-	if err := h.db.Where("id = ?", req.TaskID).First(&parentTask).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	parentTask, err := h.tasks.Get(c.Request.Context(), req.TaskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, ErrorResult(40400, "关联任务不存在"))
 		} else {
 			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
@@ -1011,6 +1307,7 @@ func (h *TaskHandler) SubmitZoom(c *gin.Context) {
 		Status:      entity.TaskStatusNotStart,
 		Description: "/zoom " + req.ZoomType + " " + req.TaskID,
 		State:       req.State,
+		NotifyHook:  req.NotifyHook,
 		ClientIP:    c.ClientIP(),
 		InstanceID:  parentTask.InstanceID,
 	}
@@ -1026,7 +1323,7 @@ func (h *TaskHandler) SubmitZoom(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create zoom task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -1034,7 +1331,7 @@ func (h *TaskHandler) SubmitZoom(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Zoom task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -1070,9 +1367,9 @@ func (h *TaskHandler) SubmitVary(c *gin.Context) {
 	}
 
 	// 查找父任务
-	var parentTask entity.Task
-	if err := h.db.Where("id = ?", req.TaskID).First(&parentTask).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	parentTask, err := h.tasks.Get(c.Request.Context(), req.TaskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, ErrorResult(40400, "关联任务不存在"))
 		} else {
 			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
@@ -1097,6 +1394,7 @@ func (h *TaskHandler) SubmitVary(c *gin.Context) {
 		Prompt:      req.Prompt,
 		Description: "/vary " + req.VaryType + " " + req.TaskID,
 		State:       req.State,
+		NotifyHook:  req.NotifyHook,
 		ClientIP:    c.ClientIP(),
 		InstanceID:  parentTask.InstanceID,
 	}
@@ -1112,7 +1410,7 @@ func (h *TaskHandler) SubmitVary(c *gin.Context) {
 	task.SubmitTime = &now
 
 	// 保存任务
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.tasks.Create(c.Request.Context(), task); err != nil {
 		h.logger.Errorf("Failed to create vary task: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "创建任务失败"))
 		return
@@ -1120,7 +1418,7 @@ func (h *TaskHandler) SubmitVary(c *gin.Context) {
 
 	// 启动任务
 	task.Start()
-	h.db.Save(task)
+	h.tasks.Save(c.Request.Context(), task)
 
 	h.logger.Infof("Vary task %s submitted by user %s", task.ID, userID)
 	c.JSON(http.StatusOK, SuccessResult(task.ID))
@@ -1137,9 +1435,9 @@ func (h *TaskHandler) GetSeed(c *gin.Context) {
 		return
 	}
 
-	var task entity.Task
-	if err := h.db.Where("id = ?", taskID).First(&task).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	task, err := h.tasks.Get(c.Request.Context(), taskID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40400,
 				"message": "任务不存在",
@@ -1162,4 +1460,27 @@ func (h *TaskHandler) GetSeed(c *gin.Context) {
 			"job_id":  task.JobID,
 		},
 	})
-}
\ No newline at end of file
+}
+
+// currentUserID 获取当前请求的用户ID，未认证时为guest
+func currentUserID(c *gin.Context) string {
+	if uid, exists := c.Get("user_id"); exists {
+		return uid.(string)
+	}
+	return "guest"
+}
+
+// isGuest 当前请求是否为未认证的游客，所有游客共用同一个guest身份
+func isGuest(c *gin.Context) bool {
+	_, exists := c.Get("user_id")
+	return !exists
+}
+
+// canAccessTask 当前用户是否为任务所有者或管理员。游客共用guest身份，不能据此判断归属
+func canAccessTask(c *gin.Context, task *entity.Task) bool {
+	if isGuest(c) {
+		return false
+	}
+	role, _ := c.Get("user_role")
+	return task.UserID == currentUserID(c) || role == entity.RoleAdmin
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/fetcher"
+)
+
+// maxPromptImages 提示词中最多校验的图片链接数
+const maxPromptImages = 5
+
+// loadImages 解析base64输入并下载链接，统一转换为内存中的图片
+func (h *TaskHandler) loadImages(ctx context.Context, base64Array []string, links []string) ([]*entity.DataURL, error) {
+	images := make([]*entity.DataURL, 0, len(base64Array)+len(links))
+
+	for i, value := range base64Array {
+		image, err := entity.ParseDataURL(value)
+		if err != nil {
+			return nil, fmt.Errorf("第%d张图片: %w", i+1, err)
+		}
+		if err := h.fetcher.Validate(image, "image/"); err != nil {
+			return nil, fmt.Errorf("第%d张图片: %w", i+1, err)
+		}
+		images = append(images, image)
+	}
+
+	for _, link := range links {
+		image, err := h.fetcher.FetchImage(ctx, link)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", link, err)
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// loadInput 将base64或链接转换为内存中的文件，两者都提供时使用base64；maxSize大于0时替代全局的大小上限
+func loadInput(ctx context.Context, f *fetcher.Fetcher, base64Value, link string, maxSize int64, allowed ...string) (*entity.DataURL, error) {
+	if maxSize <= 0 {
+		maxSize = f.MaxSize()
+	}
+
+	switch {
+	case base64Value != "":
+		file, err := entity.ParseDataURL(base64Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.ValidateWithLimit(file, maxSize, allowed...); err != nil {
+			return nil, err
+		}
+		return file, nil
+	case link != "":
+		return f.FetchWithLimit(ctx, link, maxSize, allowed...)
+	default:
+		return nil, fmt.Errorf("base64或链接不能为空")
+	}
+}
+
+// respondInvalidImage 返回图片校验失败
+func respondInvalidImage(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, ErrorResult(40000, "图片无效: "+err.Error()))
+}
+
+// promptImageURLs 提取提示词开头的垫图链接
+func promptImageURLs(prompt string) []string {
+	var urls []string
+	for _, field := range strings.Fields(prompt) {
+		if !strings.HasPrefix(field, "http://") && !strings.HasPrefix(field, "https://") {
+			break
+		}
+		urls = append(urls, field)
+		if len(urls) == maxPromptImages {
+			break
+		}
+	}
+	return urls
+}
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"midjourney-proxy-go/internal/api/middleware"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/service"
+)
+
+const (
+	streamKeepAlive = 15 * time.Second
+	socketPongWait  = 60 * time.Second
+	socketPing      = 30 * time.Second
+	socketWriteWait = 10 * time.Second
+)
+
+// newTaskSocketUpgrader 任务WebSocket升级器，只接受同源和允许列表中的跨域来源，
+// 防止其他站点借用浏览器中的凭据建立连接
+func newTaskSocketUpgrader(allowedOrigins []string) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     middleware.CheckOrigin(allowedOrigins),
+	}
+}
+
+// StreamTask 通过SSE推送任务进度
+// @Summary 订阅任务进度(SSE)
+// @Description 以Server-Sent Events推送任务状态、进度和预览图，任务结束后关闭连接
+// @Tags 任务查询
+// @Produce text/event-stream
+// @Param id path string true "任务ID"
+// @Router /api/mj/task/{id}/stream [get]
+func (h *TaskHandler) StreamTask(c *gin.Context) {
+	task, err := h.tasks.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, ErrorResult(40400, "任务不存在"))
+		} else {
+			c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询任务失败"))
+		}
+		return
+	}
+
+	if !canAccessTask(c, task) {
+		c.JSON(http.StatusForbidden, ErrorResult(40300, "无权访问该任务"))
+		return
+	}
+
+	// 先订阅再推送当前状态，避免遗漏两者之间的变更
+	sub := h.taskService.Events().Subscribe(currentUserID(c))
+	defer sub.Close()
+	sub.Watch(task.ID)
+
+	// 长连接不受服务器写超时限制
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent("task", service.NewTaskEvent(task))
+	c.Writer.Flush()
+	if task.IsFinished() {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := c.Writer.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case event, ok := <-sub.C:
+			// 订阅因积压被关闭时结束推送，EventSource重连后会先收到任务当前状态
+			if !ok {
+				return
+			}
+			c.SSEvent("task", event)
+			c.Writer.Flush()
+			if event.Finished {
+				return
+			}
+		}
+	}
+}
+
+// TaskSocketRequest WebSocket客户端消息
+type TaskSocketRequest struct {
+	Action  string   `json:"action"` // subscribe, unsubscribe, subscribe_own, unsubscribe_own
+	TaskIDs []string `json:"taskIds,omitempty"`
+}
+
+// TaskSocketMessage WebSocket服务端消息
+type TaskSocketMessage struct {
+	Type    string             `json:"type"` // task, subscribed, unsubscribed, error
+	Data    *service.TaskEvent `json:"data,omitempty"`
+	TaskIDs []string           `json:"taskIds,omitempty"`
+	Message string             `json:"message,omitempty"`
+}
+
+// TaskSocket 多路复用的任务进度WebSocket
+// @Summary 订阅任务进度(WebSocket)
+// @Description 客户端发送 {"action":"subscribe","taskIds":[...]} 订阅指定任务，或 {"action":"subscribe_own"} 订阅自己的全部任务
+// @Tags 任务查询
+// @Router /api/mj/task/ws [get]
+func (h *TaskHandler) TaskSocket(c *gin.Context) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		h.logger.Warnf("Failed to upgrade task websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	userID := currentUserID(c)
+	sub := h.taskService.Events().Subscribe(userID)
+	defer sub.Close()
+
+	// 写操作只在写协程中进行
+	outgoing := make(chan TaskSocketMessage, 16)
+	done := make(chan struct{})
+	go h.writeTaskSocket(conn, sub, outgoing, done)
+	defer close(done)
+
+	conn.SetReadLimit(64 * 1024)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		var req TaskSocketRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				h.logger.Debugf("Task websocket of user %s closed: %v", userID, err)
+			}
+			return
+		}
+
+		var replies []TaskSocketMessage
+		switch req.Action {
+		case "subscribe":
+			replies = h.subscribeTasks(c, sub, req.TaskIDs)
+		case "unsubscribe":
+			for _, taskID := range req.TaskIDs {
+				sub.Unwatch(taskID)
+			}
+			replies = []TaskSocketMessage{{Type: "unsubscribed", TaskIDs: req.TaskIDs}}
+		case "subscribe_own":
+			if isGuest(c) {
+				replies = []TaskSocketMessage{{Type: "error", Message: "游客不能订阅自己的任务，请先登录"}}
+				break
+			}
+			sub.WatchOwn(true)
+			replies = []TaskSocketMessage{{Type: "subscribed", Message: "own"}}
+		case "unsubscribe_own":
+			sub.WatchOwn(false)
+			replies = []TaskSocketMessage{{Type: "unsubscribed", Message: "own"}}
+		default:
+			replies = []TaskSocketMessage{{Type: "error", Message: "未知的操作: " + req.Action}}
+		}
+
+		for _, reply := range replies {
+			select {
+			case outgoing <- reply:
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+// subscribeTasks 校验任务归属后订阅，并返回任务当前状态
+func (h *TaskHandler) subscribeTasks(c *gin.Context, sub *service.TaskSubscription, taskIDs []string) []TaskSocketMessage {
+	if len(taskIDs) == 0 {
+		return []TaskSocketMessage{{Type: "error", Message: "taskIds不能为空"}}
+	}
+
+	tasks, err := h.tasks.Find(c.Request.Context(), repository.TaskQuery{IDs: taskIDs})
+	if err != nil {
+		return []TaskSocketMessage{{Type: "error", Message: "查询任务失败"}}
+	}
+
+	var subscribed []string
+	var snapshots []TaskSocketMessage
+	for i := range tasks {
+		task := &tasks[i]
+		if !canAccessTask(c, task) {
+			continue
+		}
+
+		sub.Watch(task.ID)
+		subscribed = append(subscribed, task.ID)
+
+		event := service.NewTaskEvent(task)
+		snapshots = append(snapshots, TaskSocketMessage{Type: "task", Data: &event})
+	}
+
+	replies := []TaskSocketMessage{{Type: "subscribed", TaskIDs: subscribed}}
+	if len(subscribed) < len(taskIDs) {
+		replies = append(replies, TaskSocketMessage{Type: "error", Message: "部分任务不存在或无权访问"})
+	}
+
+	return append(replies, snapshots...)
+}
+
+// writeTaskSocket 写协程：推送订阅事件、回复和心跳
+func (h *TaskHandler) writeTaskSocket(conn *websocket.Conn, sub *service.TaskSubscription, outgoing <-chan TaskSocketMessage, done <-chan struct{}) {
+	ping := time.NewTicker(socketPing)
+	defer ping.Stop()
+
+	write := func(message TaskSocketMessage) bool {
+		conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+		return conn.WriteJSON(message) == nil
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case message := <-outgoing:
+			if !write(message) {
+				conn.Close()
+				return
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				// 订阅因积压被关闭，通知客户端稍后重连，关闭连接同时结束读循环
+				conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many pending events"))
+				conn.Close()
+				return
+			}
+			if !write(TaskSocketMessage{Type: "task", Data: &event}) {
+				conn.Close()
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
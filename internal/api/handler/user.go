@@ -7,27 +7,31 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 
-	"midjourney-proxy-go/internal/api/middleware"
 	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
 	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/service"
 	"midjourney-proxy-go/pkg/logger"
 )
 
 // UserHandler 用户处理器
 type UserHandler struct {
-	db     *gorm.DB
-	config *config.Config
-	logger logger.Logger
+	users    repository.UserRepository
+	settings *service.SettingsService
+	tokens   *service.TokenService
+	config   *config.Config
+	logger   logger.Logger
 }
 
 // NewUserHandler 创建用户处理器
-func NewUserHandler(db *gorm.DB, config *config.Config, logger logger.Logger) *UserHandler {
+func NewUserHandler(users repository.UserRepository, settings *service.SettingsService, tokens *service.TokenService, config *config.Config, logger logger.Logger) *UserHandler {
 	return &UserHandler{
-		db:     db,
-		config: config,
-		logger: logger,
+		users:    users,
+		settings: settings,
+		tokens:   tokens,
+		config:   config,
+		logger:   logger,
 	}
 }
 
@@ -44,15 +48,22 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// RefreshTokenRequest 刷新令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 // LoginResponse 登录响应
 type LoginResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Data    *struct {
-		Token     string `json:"token"`
-		TokenType string `json:"token_type"`
-		ExpiresIn int    `json:"expires_in"`
-		User      *UserInfo `json:"user"`
+		Token            string    `json:"token"`
+		TokenType        string    `json:"token_type"`
+		ExpiresIn        int       `json:"expires_in"`
+		RefreshToken     string    `json:"refresh_token"`
+		RefreshExpiresIn int       `json:"refresh_expires_in"`
+		User             *UserInfo `json:"user"`
 	} `json:"data,omitempty"`
 }
 
@@ -91,10 +102,9 @@ func (h *UserHandler) Login(c *gin.Context) {
 	}
 
 	// 查找用户
-	var user entity.User
-	err := h.db.Where("username = ?", req.Username).First(&user).Error
+	user, err := h.users.GetByUsername(c.Request.Context(), req.Username)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"code":    40100,
 				"message": "用户名或密码错误",
@@ -135,13 +145,8 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 生成JWT token
-	token, err := middleware.GenerateJWTToken(
-		user.ID,
-		user.Role,
-		h.config.Security.JWTSecret,
-		h.config.Security.JWTExpireHours,
-	)
+	// 签发访问令牌和刷新令牌
+	tokens, err := h.tokens.Issue(c.Request.Context(), user, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		h.logger.Errorf("Failed to generate JWT token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -156,14 +161,18 @@ func (h *UserHandler) Login(c *gin.Context) {
 		Code:    1,
 		Message: "登录成功",
 		Data: &struct {
-			Token     string `json:"token"`
-			TokenType string `json:"token_type"`
-			ExpiresIn int    `json:"expires_in"`
-			User      *UserInfo `json:"user"`
+			Token            string    `json:"token"`
+			TokenType        string    `json:"token_type"`
+			ExpiresIn        int       `json:"expires_in"`
+			RefreshToken     string    `json:"refresh_token"`
+			RefreshExpiresIn int       `json:"refresh_expires_in"`
+			User             *UserInfo `json:"user"`
 		}{
-			Token:     token,
-			TokenType: "Bearer",
-			ExpiresIn: h.config.Security.JWTExpireHours * 3600,
+			Token:            tokens.AccessToken,
+			TokenType:        "Bearer",
+			ExpiresIn:        tokens.AccessExpiresIn,
+			RefreshToken:     tokens.RefreshToken,
+			RefreshExpiresIn: tokens.RefreshExpiresIn,
 			User: &UserInfo{
 				ID:             user.ID,
 				Username:       user.Username,
@@ -194,7 +203,7 @@ func (h *UserHandler) Login(c *gin.Context) {
 // @Success 200 {object} LoginResponse
 // @Router /api/auth/register [post]
 func (h *UserHandler) Register(c *gin.Context) {
-	if !h.config.App.EnableRegister {
+	if !h.settings.Current().EnableRegister {
 		c.JSON(http.StatusForbidden, gin.H{
 			"code":    40300,
 			"message": "注册功能已关闭",
@@ -212,15 +221,14 @@ func (h *UserHandler) Register(c *gin.Context) {
 	}
 
 	// 检查用户名是否已存在
-	var existingUser entity.User
-	err := h.db.Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser).Error
+	_, err := h.users.FindByUsernameOrEmail(c.Request.Context(), req.Username, req.Email)
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"code":    40900,
 			"message": "用户名或邮箱已存在",
 		})
 		return
-	} else if err != gorm.ErrRecordNotFound {
+	} else if err != repository.ErrNotFound {
 		h.logger.Errorf("Failed to check existing user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -249,7 +257,7 @@ func (h *UserHandler) Register(c *gin.Context) {
 	}
 
 	// 保存用户
-	if err := h.db.Create(&user).Error; err != nil {
+	if err := h.users.Create(c.Request.Context(), &user); err != nil {
 		h.logger.Errorf("Failed to create user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -258,13 +266,8 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// 生成JWT token
-	token, err := middleware.GenerateJWTToken(
-		user.ID,
-		user.Role,
-		h.config.Security.JWTSecret,
-		h.config.Security.JWTExpireHours,
-	)
+	// 签发访问令牌和刷新令牌
+	tokens, err := h.tokens.Issue(c.Request.Context(), &user, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		h.logger.Errorf("Failed to generate JWT token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -279,14 +282,18 @@ func (h *UserHandler) Register(c *gin.Context) {
 		Code:    1,
 		Message: "注册成功",
 		Data: &struct {
-			Token     string `json:"token"`
-			TokenType string `json:"token_type"`
-			ExpiresIn int    `json:"expires_in"`
-			User      *UserInfo `json:"user"`
+			Token            string    `json:"token"`
+			TokenType        string    `json:"token_type"`
+			ExpiresIn        int       `json:"expires_in"`
+			RefreshToken     string    `json:"refresh_token"`
+			RefreshExpiresIn int       `json:"refresh_expires_in"`
+			User             *UserInfo `json:"user"`
 		}{
-			Token:     token,
-			TokenType: "Bearer",
-			ExpiresIn: h.config.Security.JWTExpireHours * 3600,
+			Token:            tokens.AccessToken,
+			TokenType:        "Bearer",
+			ExpiresIn:        tokens.AccessExpiresIn,
+			RefreshToken:     tokens.RefreshToken,
+			RefreshExpiresIn: tokens.RefreshExpiresIn,
 			User: &UserInfo{
 				ID:             user.ID,
 				Username:       user.Username,
@@ -308,54 +315,147 @@ func (h *UserHandler) Register(c *gin.Context) {
 }
 
 // RefreshToken 刷新token
+// @Summary 刷新token
+// @Description 使用刷新令牌换发新的访问令牌和刷新令牌，原刷新令牌立即作废；已作废的刷新令牌再次使用时吊销该次登录的全部令牌
+// @Tags 用户认证
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "刷新令牌"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/auth/refresh [post]
 func (h *UserHandler) RefreshToken(c *gin.Context) {
-	// 获取当前用户
-	userInterface, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code":    40100,
-			"message": "用户未登录",
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    40000,
+			"message": "参数错误: " + err.Error(),
 		})
 		return
 	}
 
-	user := userInterface.(*entity.User)
-
-	// 生成新的JWT token
-	token, err := middleware.GenerateJWTToken(
-		user.ID,
-		user.Role,
-		h.config.Security.JWTSecret,
-		h.config.Security.JWTExpireHours,
-	)
+	tokens, user, err := h.tokens.Refresh(c.Request.Context(), req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
-		h.logger.Errorf("Failed to generate JWT token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    50000,
-			"message": "刷新token失败",
-		})
+		switch err {
+		case service.ErrTokenInvalid, service.ErrTokenRevoked, service.ErrRefreshTokenReused:
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    40100,
+				"message": "刷新令牌无效，请重新登录",
+			})
+		case service.ErrUserUnavailable:
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    40300,
+				"message": "账号已被禁用或已过期",
+			})
+		default:
+			h.logger.Errorf("Failed to refresh token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    50000,
+				"message": "刷新token失败",
+			})
+		}
 		return
 	}
 
+	h.logger.Debugf("Token of user %s refreshed", user.Username)
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
 		"message": "刷新成功",
 		"data": gin.H{
-			"token":      token,
-			"token_type": "Bearer",
-			"expires_in": h.config.Security.JWTExpireHours * 3600,
+			"token":              tokens.AccessToken,
+			"token_type":         "Bearer",
+			"expires_in":         tokens.AccessExpiresIn,
+			"refresh_token":      tokens.RefreshToken,
+			"refresh_expires_in": tokens.RefreshExpiresIn,
 		},
 	})
 }
 
 // Logout 用户登出
+// @Summary 用户登出
+// @Description 吊销当前访问令牌和本次登录的刷新令牌，使用配置中的令牌或API密钥时不做处理
+// @Tags 用户认证
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/auth/logout [post]
 func (h *UserHandler) Logout(c *gin.Context) {
+	if claims, exists := c.Get("token_claims"); exists {
+		if err := h.tokens.Logout(c.Request.Context(), claims.(*service.AccessClaims)); err != nil {
+			h.logger.Errorf("Failed to revoke token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    50000,
+				"message": "登出失败",
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    1,
 		"message": "登出成功",
 	})
 }
 
+// LogoutAll 退出所有设备
+// @Summary 退出所有设备
+// @Description 吊销当前用户所有登录的刷新令牌和访问令牌
+// @Tags 用户认证
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/auth/logout-all [post]
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	h.revokeSessions(c, c.GetString("user_id"))
+}
+
+// RevokeSessions 强制用户退出所有设备（管理员）
+// @Summary 强制用户退出所有设备
+// @Description 吊销用户所有登录的刷新令牌和访问令牌，不影响API密钥
+// @Tags 用户管理
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/users/{id}/logout-all [post]
+func (h *UserHandler) RevokeSessions(c *gin.Context) {
+	userID := c.Param("id")
+	if _, err := h.users.Get(c.Request.Context(), userID); err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    40400,
+				"message": "用户不存在",
+			})
+		} else {
+			h.logger.Errorf("Failed to get user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    50000,
+				"message": "获取用户失败",
+			})
+		}
+		return
+	}
+
+	h.revokeSessions(c, userID)
+}
+
+// revokeSessions 吊销用户的所有登录
+func (h *UserHandler) revokeSessions(c *gin.Context, userID string) {
+	count, err := h.tokens.RevokeUser(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Errorf("Failed to revoke sessions of user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    50000,
+			"message": "退出登录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "已退出所有设备",
+		"data": gin.H{
+			"revoked": count,
+		},
+	})
+}
+
 // List 用户列表（管理员）
 func (h *UserHandler) List(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -371,22 +471,15 @@ func (h *UserHandler) List(c *gin.Context) {
 
 	offset := (page - 1) * size
 
-	var users []entity.User
-	var total int64
-
-	query := h.db.Model(&entity.User{})
-	if keyword != "" {
-		query = query.Where("username LIKE ? OR email LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
-	}
+	query := repository.UserQuery{Keyword: keyword}
 
 	// 获取总数
-	query.Count(&total)
+	total, _ := h.users.Count(c.Request.Context(), query)
 
 	// 获取用户列表
-	query.Order("created_at DESC").
-		Offset(offset).
-		Limit(size).
-		Find(&users)
+	query.Offset = offset
+	query.Limit = size
+	users, _ := h.users.Find(c.Request.Context(), query)
 
 	// 转换为用户信息
 	var userInfos []UserInfo
@@ -441,15 +534,14 @@ func (h *UserHandler) Create(c *gin.Context) {
 	}
 
 	// 检查用户名是否已存在
-	var existingUser entity.User
-	err := h.db.Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser).Error
+	_, err := h.users.FindByUsernameOrEmail(c.Request.Context(), req.Username, req.Email)
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"code":    40900,
 			"message": "用户名或邮箱已存在",
 		})
 		return
-	} else if err != gorm.ErrRecordNotFound {
+	} else if err != repository.ErrNotFound {
 		h.logger.Errorf("Failed to check existing user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -486,7 +578,7 @@ func (h *UserHandler) Create(c *gin.Context) {
 	}
 
 	// 保存用户
-	if err := h.db.Create(&user).Error; err != nil {
+	if err := h.users.Create(c.Request.Context(), &user); err != nil {
 		h.logger.Errorf("Failed to create user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -526,9 +618,9 @@ func (h *UserHandler) Get(c *gin.Context) {
 		return
 	}
 
-	var user entity.User
-	if err := h.db.Where("id = ?", userID).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	user, err := h.users.Get(c.Request.Context(), userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40400,
 				"message": "用户不存在",
@@ -592,9 +684,9 @@ func (h *UserHandler) Update(c *gin.Context) {
 	}
 
 	// 查找用户
-	var user entity.User
-	if err := h.db.Where("id = ?", userID).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	user, err := h.users.Get(c.Request.Context(), userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    40400,
 				"message": "用户不存在",
@@ -642,7 +734,7 @@ func (h *UserHandler) Update(c *gin.Context) {
 	}
 
 	// 保存更新
-	if err := h.db.Save(&user).Error; err != nil {
+	if err := h.users.Save(c.Request.Context(), user); err != nil {
 		h.logger.Errorf("Failed to update user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -669,7 +761,7 @@ func (h *UserHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Where("id = ?", userID).Delete(&entity.User{}).Error; err != nil {
+	if err := h.users.Delete(c.Request.Context(), userID); err != nil {
 		h.logger.Errorf("Failed to delete user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    50000,
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// WebhookHandler 回调投递处理器
+type WebhookHandler struct {
+	notifyService *service.NotifyService
+	logger        logger.Logger
+}
+
+// NewWebhookHandler 创建回调投递处理器
+func NewWebhookHandler(notifyService *service.NotifyService, logger logger.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		notifyService: notifyService,
+		logger:        logger,
+	}
+}
+
+// ListDeliveries 查询回调投递记录
+// @Summary 查询回调投递记录
+// @Description 按任务ID和投递状态筛选回调投递记录
+// @Tags 回调管理
+// @Produce json
+// @Param task_id query string false "任务ID"
+// @Param status query string false "投递状态(PENDING/SUCCESS/FAILURE)"
+// @Param page query int false "页码"
+// @Param size query int false "每页数量"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/webhooks/deliveries [get]
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	status := entity.WebhookDeliveryStatus(c.Query("status"))
+	deliveries, total, err := h.notifyService.ListDeliveries(c.Query("task_id"), status, page, size)
+	if err != nil {
+		h.logger.Errorf("Failed to list webhook deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResult(50000, "查询投递记录失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data": gin.H{
+			"list":  deliveries,
+			"total": total,
+			"page":  page,
+			"size":  size,
+		},
+	})
+}
+
+// GetDelivery 获取回调投递记录详情
+// @Summary 获取回调投递记录
+// @Description 获取投递记录详情，包含原始负载和最后一次错误
+// @Tags 回调管理
+// @Produce json
+// @Param id path string true "投递记录ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/webhooks/deliveries/{id} [get]
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	delivery, err := h.notifyService.GetDelivery(c.Param("id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "查询成功",
+		"data":    delivery,
+	})
+}
+
+// ReplayDelivery 重新投递回调
+// @Summary 重新投递回调
+// @Description 使用记录中保存的原始负载重新投递回调
+// @Tags 回调管理
+// @Produce json
+// @Param id path string true "投递记录ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/webhooks/deliveries/{id}/replay [post]
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	delivery, err := h.notifyService.Replay(c.Param("id"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "已加入投递队列",
+		"data":    delivery,
+	})
+}
+
+// respondError 根据错误返回响应
+func (h *WebhookHandler) respondError(c *gin.Context, err error) {
+	if err == service.ErrDeliveryNotFound {
+		c.JSON(http.StatusNotFound, ErrorResult(40400, err.Error()))
+		return
+	}
+
+	h.logger.Errorf("Webhook delivery operation failed: %v", err)
+	c.JSON(http.StatusInternalServerError, ErrorResult(50000, "操作失败"))
+}
@@ -3,29 +3,27 @@ package middleware
 import (
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"gorm.io/gorm"
 
 	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
 	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/service"
 	"midjourney-proxy-go/pkg/logger"
 )
 
-// Claims JWT载荷
-type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-// Auth 认证中间件
-func Auth(securityCfg config.SecurityConfig, db *gorm.DB, logger logger.Logger) gin.HandlerFunc {
+// Auth 认证中间件，接受配置中的令牌、JWT和用户的API密钥
+func Auth(securityCfg config.SecurityConfig, users repository.UserRepository, apiKeys *service.APIKeyService, tokens *service.TokenService, logger logger.Logger) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		// 检查Authorization头
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			// 检查X-API-Key头
+			if key := c.GetHeader("X-API-Key"); key != "" {
+				authHeader = "Bearer " + key
+			}
+		}
 		if authHeader == "" {
 			// 检查token查询参数
 			token := c.Query("token")
@@ -56,22 +54,27 @@ func Auth(securityCfg config.SecurityConfig, db *gorm.DB, logger logger.Logger)
 
 		tokenString := parts[1]
 
+		// API密钥每次都查询数据库，吊销后立即生效
+		if service.IsAPIKey(tokenString) {
+			authenticateAPIKey(c, tokenString, users, apiKeys, logger)
+			return
+		}
+
 		// 检查是否是管理员token
 		if tokenString == securityCfg.AdminToken {
 			// 查找或创建管理员用户
-			var adminUser entity.User
-			err := db.Where("role = ? AND token = ?", entity.RoleAdmin, tokenString).First(&adminUser).Error
+			adminUser, err := users.GetByToken(c.Request.Context(), entity.RoleAdmin, tokenString)
 			if err != nil {
-				if err == gorm.ErrRecordNotFound {
+				if err == repository.ErrNotFound {
 					// 创建默认管理员用户
-					adminUser = entity.User{
+					adminUser = &entity.User{
 						ID:       "admin",
 						Username: "admin",
 						Role:     entity.RoleAdmin,
 						Token:    tokenString,
 						Enabled:  true,
 					}
-					if err := db.Create(&adminUser).Error; err != nil {
+					if err := users.Create(c.Request.Context(), adminUser); err != nil {
 						logger.Errorf("Failed to create admin user: %v", err)
 						c.JSON(http.StatusInternalServerError, gin.H{
 							"code":    500,
@@ -91,7 +94,7 @@ func Auth(securityCfg config.SecurityConfig, db *gorm.DB, logger logger.Logger)
 				}
 			}
 
-			c.Set("user", &adminUser)
+			c.Set("user", adminUser)
 			c.Set("user_id", adminUser.ID)
 			c.Set("user_role", adminUser.Role)
 			c.Next()
@@ -101,19 +104,18 @@ func Auth(securityCfg config.SecurityConfig, db *gorm.DB, logger logger.Logger)
 		// 检查是否是用户token
 		if tokenString == securityCfg.UserToken && securityCfg.UserToken != "" {
 			// 查找或创建用户
-			var user entity.User
-			err := db.Where("role = ? AND token = ?", entity.RoleUser, tokenString).First(&user).Error
+			user, err := users.GetByToken(c.Request.Context(), entity.RoleUser, tokenString)
 			if err != nil {
-				if err == gorm.ErrRecordNotFound {
+				if err == repository.ErrNotFound {
 					// 创建默认用户
-					user = entity.User{
+					user = &entity.User{
 						ID:       "user",
 						Username: "user",
 						Role:     entity.RoleUser,
 						Token:    tokenString,
 						Enabled:  true,
 					}
-					if err := db.Create(&user).Error; err != nil {
+					if err := users.Create(c.Request.Context(), user); err != nil {
 						logger.Errorf("Failed to create user: %v", err)
 						c.JSON(http.StatusInternalServerError, gin.H{
 							"code":    500,
@@ -133,91 +135,213 @@ func Auth(securityCfg config.SecurityConfig, db *gorm.DB, logger logger.Logger)
 				}
 			}
 
-			c.Set("user", &user)
+			c.Set("user", user)
 			c.Set("user_id", user.ID)
 			c.Set("user_role", user.Role)
 			c.Next()
 			return
 		}
 
-		// 解析JWT token
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(securityCfg.JWTSecret), nil
-		})
-
+		// 解析JWT token，已登出或退出所有设备的令牌在吊销列表中
+		claims, err := tokens.Parse(c.Request.Context(), tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "Invalid token",
-			})
+			switch err {
+			case service.ErrTokenInvalid:
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"code":    401,
+					"message": "Invalid token",
+				})
+			case service.ErrTokenRevoked:
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"code":    401,
+					"message": "Token revoked",
+				})
+			default:
+				logger.Errorf("Failed to check token revocation: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"code":    500,
+					"message": "Internal server error",
+				})
+			}
 			c.Abort()
 			return
 		}
 
-		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-			// 检查token是否过期
-			if claims.ExpiresAt.Time.Before(time.Now()) {
+		// 查找用户
+		user, err := users.Get(c.Request.Context(), claims.UserID)
+		if err != nil {
+			if err == repository.ErrNotFound {
 				c.JSON(http.StatusUnauthorized, gin.H{
 					"code":    401,
-					"message": "Token expired",
+					"message": "User not found",
+				})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"code":    500,
+					"message": "Internal server error",
 				})
-				c.Abort()
-				return
 			}
+			c.Abort()
+			return
+		}
 
-			// 查找用户
-			var user entity.User
-			err := db.Where("id = ?", claims.UserID).First(&user).Error
-			if err != nil {
-				if err == gorm.ErrRecordNotFound {
-					c.JSON(http.StatusUnauthorized, gin.H{
-						"code":    401,
-						"message": "User not found",
-					})
-				} else {
-					c.JSON(http.StatusInternalServerError, gin.H{
-						"code":    500,
-						"message": "Internal server error",
-					})
-				}
-				c.Abort()
-				return
-			}
+		// 检查用户状态
+		if !user.Enabled {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "User is disabled",
+			})
+			c.Abort()
+			return
+		}
 
-			// 检查用户状态
-			if !user.Enabled {
-				c.JSON(http.StatusForbidden, gin.H{
-					"code":    403,
-					"message": "User is disabled",
-				})
-				c.Abort()
-				return
-			}
+		// 检查用户是否过期
+		if user.IsExpired() {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "User is expired",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("user", user)
+		c.Set("user_id", user.ID)
+		c.Set("user_role", user.Role)
+		c.Set("token_claims", claims)
+		c.Next()
+	})
+}
+
+// authenticateAPIKey 使用API密钥认证，成功时在上下文中记录密钥供 RequireScope 检查
+func authenticateAPIKey(c *gin.Context, raw string, users repository.UserRepository, apiKeys *service.APIKeyService, logger logger.Logger) {
+	key, err := apiKeys.Authenticate(c.Request.Context(), raw, c.ClientIP())
+	if err != nil {
+		switch err {
+		case service.ErrAPIKeyInvalid, service.ErrAPIKeyExpired:
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": err.Error(),
+			})
+		case service.ErrAPIKeyIPNotAllowed:
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": err.Error(),
+			})
+		default:
+			logger.Errorf("Failed to authenticate API key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Internal server error",
+			})
+		}
+		c.Abort()
+		return
+	}
+
+	user, err := users.Get(c.Request.Context(), key.UserID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "User not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Internal server error",
+			})
+		}
+		c.Abort()
+		return
+	}
 
-			// 检查用户是否过期
-			if user.IsExpired() {
+	if !user.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "User is disabled",
+		})
+		c.Abort()
+		return
+	}
+	if user.IsExpired() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "User is expired",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("user_role", user.Role)
+	c.Set("api_key", key)
+	c.Next()
+}
+
+// RequireScope 使用API密钥认证时要求密钥具有指定的权限范围，其他认证方式不受限制
+func RequireScope(scope entity.APIKeyScope) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if value, exists := c.Get("api_key"); exists {
+			if key, ok := value.(*entity.APIKey); ok && !key.HasScope(scope) {
 				c.JSON(http.StatusForbidden, gin.H{
 					"code":    403,
-					"message": "User is expired",
+					"message": "API key does not have scope " + string(scope),
 				})
 				c.Abort()
 				return
 			}
+		}
+		c.Next()
+	})
+}
 
-			c.Set("user", &user)
-			c.Set("user_id", user.ID)
-			c.Set("user_role", user.Role)
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "Invalid token",
+// RequireAdminScope 管理接口的查询请求需要 admin:read，其他请求需要 admin:write。
+// 查看密钥明文等敏感操作即使只读也应注册为非GET请求
+func RequireAdminScope() gin.HandlerFunc {
+	read, write := RequireScope(entity.ScopeAdminRead), RequireScope(entity.ScopeAdminWrite)
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			read(c)
+			return
+		}
+		write(c)
+	})
+}
+
+// RejectAPIKey 拒绝API密钥认证的请求，用于刷新JWT和管理密钥，避免用密钥换取更大的权限
+func RejectAPIKey() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if _, exists := c.Get("api_key"); exists {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "This endpoint does not accept API keys",
 			})
 			c.Abort()
+			return
 		}
+		c.Next()
 	})
 }
 
+// AuthUnlessGuest 请求携带凭证时总是使用auth认证，开启游客模式时没有凭证的请求作为游客放行。
+// 游客模式可在运行时切换
+func AuthUnlessGuest(auth gin.HandlerFunc, settings *service.SettingsService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if settings.Current().EnableGuest && !hasCredentials(c) {
+			c.Next()
+			return
+		}
+		auth(c)
+	})
+}
+
+// hasCredentials 请求是否携带了Auth读取的任一凭证
+func hasCredentials(c *gin.Context) bool {
+	return c.GetHeader("Authorization") != "" || c.GetHeader("X-API-Key") != "" || c.Query("token") != ""
+}
+
 // AdminOnly 管理员权限中间件
 func AdminOnly() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -243,19 +367,3 @@ func AdminOnly() gin.HandlerFunc {
 		c.Next()
 	})
 }
-
-// GenerateJWTToken 生成JWT token
-func GenerateJWTToken(userID string, role entity.UserRole, secret string, expireHours int) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Role:   string(role),
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * time.Duration(expireHours))),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
-}
\ No newline at end of file
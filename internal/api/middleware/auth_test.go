@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/database"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// serveWithKey 依次执行handlers处理请求，key非空时模拟API密钥认证
+func serveWithKey(key *entity.APIKey, method string, handlers ...gin.HandlerFunc) int {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	chain := []gin.HandlerFunc{func(c *gin.Context) {
+		if key != nil {
+			c.Set("api_key", key)
+		}
+		c.Next()
+	}}
+	chain = append(chain, handlers...)
+	chain = append(chain, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	engine.Handle(method, "/admin/accounts/:id/secrets", chain...)
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(method, "/admin/accounts/1/secrets", nil))
+	return recorder.Code
+}
+
+func TestRequireAdminScope(t *testing.T) {
+	readOnly := &entity.APIKey{Scopes: []entity.APIKeyScope{entity.ScopeAdminRead}}
+	writeOnly := &entity.APIKey{Scopes: []entity.APIKeyScope{entity.ScopeAdminWrite}}
+	submit := &entity.APIKey{Scopes: []entity.APIKeyScope{entity.ScopeSubmit, entity.ScopeFetch}}
+
+	tests := []struct {
+		name   string
+		key    *entity.APIKey
+		method string
+		want   int
+	}{
+		{"jwt get", nil, http.MethodGet, http.StatusNoContent},
+		{"jwt post", nil, http.MethodPost, http.StatusNoContent},
+		{"read key get", readOnly, http.MethodGet, http.StatusNoContent},
+		{"read key head", readOnly, http.MethodHead, http.StatusNoContent},
+		{"read key post", readOnly, http.MethodPost, http.StatusForbidden},
+		{"read key delete", readOnly, http.MethodDelete, http.StatusForbidden},
+		{"write key get", writeOnly, http.MethodGet, http.StatusForbidden},
+		{"write key post", writeOnly, http.MethodPost, http.StatusNoContent},
+		{"submit key get", submit, http.MethodGet, http.StatusForbidden},
+		{"submit key post", submit, http.MethodPost, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveWithKey(tt.key, tt.method, RequireAdminScope()); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	submit := &entity.APIKey{Scopes: []entity.APIKeyScope{entity.ScopeSubmit}}
+	fetch := &entity.APIKey{Scopes: []entity.APIKeyScope{entity.ScopeFetch}}
+
+	if got := serveWithKey(submit, http.MethodPost, RequireScope(entity.ScopeSubmit)); got != http.StatusNoContent {
+		t.Fatalf("submit key = %d, want %d", got, http.StatusNoContent)
+	}
+	if got := serveWithKey(fetch, http.MethodPost, RequireScope(entity.ScopeSubmit)); got != http.StatusForbidden {
+		t.Fatalf("fetch key = %d, want %d", got, http.StatusForbidden)
+	}
+	if got := serveWithKey(nil, http.MethodPost, RequireScope(entity.ScopeSubmit)); got != http.StatusNoContent {
+		t.Fatalf("jwt = %d, want %d", got, http.StatusNoContent)
+	}
+}
+
+func TestRejectAPIKey(t *testing.T) {
+	admin := &entity.APIKey{Scopes: entity.APIKeyScopes}
+
+	if got := serveWithKey(admin, http.MethodPost, RejectAPIKey()); got != http.StatusForbidden {
+		t.Fatalf("api key = %d, want %d", got, http.StatusForbidden)
+	}
+	if got := serveWithKey(nil, http.MethodPost, RejectAPIKey()); got != http.StatusNoContent {
+		t.Fatalf("jwt = %d, want %d", got, http.StatusNoContent)
+	}
+}
+
+func TestAuthUnlessGuestAuthenticatesCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repos, err := database.Open(config.DatabaseConfig{
+		Type:   "sqlite",
+		SQLite: config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "test.db")},
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	cfg := &config.Config{App: config.AppConfig{EnableGuest: true}}
+	settings, err := service.NewSettingsService(repos.Settings, repos.SettingChanges, cfg, nil, logger.New("error", "text"))
+	if err != nil {
+		t.Fatalf("NewSettingsService: %v", err)
+	}
+
+	// 只接受valid凭证的认证中间件
+	auth := func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer valid" && c.GetHeader("X-API-Key") != "valid" && c.Query("token") != "valid" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("user_id", "user-1")
+		c.Next()
+	}
+	engine := gin.New()
+	engine.GET("/task", AuthUnlessGuest(auth, settings), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("user_id"))
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		query  string
+		code   int
+		user   string
+	}{
+		{"guest", "", "", "", http.StatusOK, ""},
+		{"bearer", "Authorization", "Bearer valid", "", http.StatusOK, "user-1"},
+		{"api key header", "X-API-Key", "valid", "", http.StatusOK, "user-1"},
+		{"token query", "", "", "?token=valid", http.StatusOK, "user-1"},
+		{"invalid credentials", "Authorization", "Bearer revoked", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/task"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+			if recorder.Code != tt.code || recorder.Body.String() != tt.user {
+				t.Fatalf("got %d %q, want %d %q", recorder.Code, recorder.Body.String(), tt.code, tt.user)
+			}
+		})
+	}
+}
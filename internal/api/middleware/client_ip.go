@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// ClientIPHeader 解析出的客户端IP写入的请求头，作为gin的TrustedPlatform，
+// 使c.ClientIP()、限流和任务记录使用同一个结果；客户端发送的同名请求头会被覆盖
+const ClientIPHeader = "X-Mj-Client-Ip"
+
+// ClientIPResolver 客户端IP解析：只有直接连接的对端是受信任的代理时才读取转发头
+// （RFC 7239 Forwarded、X-Forwarded-For、X-Real-IP），并从右向左跳过受信任的代理，
+// 第一个不受信任的地址即为客户端IP
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver 创建客户端IP解析器，trustedProxies为IP或CIDR，无效的条目会被忽略
+func NewClientIPResolver(trustedProxies []string, logger logger.Logger) *ClientIPResolver {
+	r := &ClientIPResolver{}
+	for _, item := range trustedProxies {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				r.trusted = append(r.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			logger.Warnf("Invalid trusted proxy %q, ignored", item)
+			continue
+		}
+		r.trusted = append(r.trusted, network)
+	}
+	return r
+}
+
+// isTrusted 地址是否为受信任的代理
+func (r *ClientIPResolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve 解析请求的客户端IP
+func (r *ClientIPResolver) Resolve(req *http.Request) string {
+	peer := parseAddress(req.RemoteAddr)
+	if peer == nil {
+		return req.RemoteAddr
+	}
+	if !r.isTrusted(peer) {
+		return peer.String()
+	}
+
+	chain := forwardedChain(req.Header)
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseAddress(chain[i])
+		if ip == nil {
+			// 无法识别的地址（如unknown或混淆标识），以最后一个可信的地址为准
+			break
+		}
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedChain 转发链上的地址，从客户端到最近的代理排列，优先使用标准的Forwarded头
+func forwardedChain(header http.Header) []string {
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		var chain []string
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				chain = append(chain, forwardedFor(element))
+			}
+		}
+		return chain
+	}
+
+	if values := header.Values("X-Forwarded-For"); len(values) > 0 {
+		var chain []string
+		for _, value := range values {
+			for _, item := range strings.Split(value, ",") {
+				chain = append(chain, strings.TrimSpace(item))
+			}
+		}
+		return chain
+	}
+
+	if value := header.Get("X-Real-IP"); value != "" {
+		return []string{strings.TrimSpace(value)}
+	}
+	return nil
+}
+
+// forwardedFor 读取Forwarded头中一个元素的for参数，如 for="[2001:db8::17]:4711";proto=https
+func forwardedFor(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && strings.EqualFold(strings.TrimSpace(name), "for") {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// parseAddress 解析IP地址，支持带端口和方括号的格式
+func parseAddress(address string) net.IP {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// ClientIP 客户端IP中间件，需注册在最前面，并将gin的TrustedPlatform设为 ClientIPHeader
+func ClientIP(resolver *ClientIPResolver) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		c.Request.Header.Set(ClientIPHeader, resolver.Resolve(c.Request))
+		c.Next()
+	})
+}
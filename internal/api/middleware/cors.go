@@ -1,21 +1,26 @@
 package middleware
 
 import (
+	"net/http"
+	"net/url"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
-// CORS 跨域中间件
-func CORS() gin.HandlerFunc {
+// CORS 跨域中间件，allowedOrigins为空时允许任意来源，否则只对列表中的来源返回跨域头
+func CORS(allowedOrigins []string) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
-		
+
 		// 设置允许的域名
-		if origin != "" {
-			c.Header("Access-Control-Allow-Origin", origin)
-		} else {
+		if origin == "" {
 			c.Header("Access-Control-Allow-Origin", "*")
+		} else if len(allowedOrigins) == 0 || OriginAllowed(allowedOrigins, origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
 		}
-		
+
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
@@ -27,4 +32,30 @@ func CORS() gin.HandlerFunc {
 
 		c.Next()
 	})
-}
\ No newline at end of file
+}
+
+// OriginAllowed 来源是否在允许列表中，"*" 匹配任意来源，比较时忽略大小写和末尾的斜杠
+func OriginAllowed(allowedOrigins []string, origin string) bool {
+	origin = strings.TrimRight(origin, "/")
+	for _, allowed := range allowedOrigins {
+		allowed = strings.TrimRight(strings.TrimSpace(allowed), "/")
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin WebSocket来源校验：没有Origin头的非浏览器客户端、同源请求和允许列表中的来源可以连接
+func CheckOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		return OriginAllowed(allowedOrigins, origin)
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	allowed := []string{"https://app.example.com/"}
+
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		want    bool
+	}{
+		{"no origin", nil, "", true},
+		{"same origin", nil, "http://proxy.example.com:8080", true},
+		{"cross origin without list", nil, "https://evil.example.net", false},
+		{"listed origin", allowed, "https://APP.example.com", true},
+		{"unlisted origin", allowed, "https://evil.example.net", false},
+		{"scheme mismatch", allowed, "http://app.example.com", false},
+		{"wildcard", []string{"*"}, "https://evil.example.net", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://proxy.example.com:8080/api/mj/task/ws", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := CheckOrigin(tt.origins)(req); got != tt.want {
+				t.Fatalf("CheckOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(origins []string, origin string) string {
+		engine := gin.New()
+		engine.Use(CORS(origins))
+		engine.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		return recorder.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	if got := serve(nil, "https://any.example.net"); got != "https://any.example.net" {
+		t.Fatalf("without list = %q, want reflected origin", got)
+	}
+	if got := serve([]string{"https://app.example.com"}, "https://app.example.com"); got != "https://app.example.com" {
+		t.Fatalf("listed = %q, want reflected origin", got)
+	}
+	if got := serve([]string{"https://app.example.com"}, "https://evil.example.net"); got != "" {
+		t.Fatalf("unlisted = %q, want no header", got)
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/service"
+)
+
+// IPBan IP封禁中间件：封禁中的IP返回403，临时封禁附带距离解封的Retry-After
+func IPBan(bans *service.IPBanService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		ban := bans.Check(c.ClientIP())
+		if ban == nil {
+			c.Next()
+			return
+		}
+
+		if ban.ExpiresAt != nil {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(time.Until(*ban.ExpiresAt))))
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "IP is banned",
+		})
+		c.Abort()
+	})
+}
@@ -0,0 +1,363 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+const (
+	// RateLimitBackendLocal 每个副本单独计数
+	RateLimitBackendLocal = "local"
+	// RateLimitBackendRedis 所有副本通过Redis共享计数
+	RateLimitBackendRedis = "redis"
+
+	// limiterSweepInterval 清理空闲限流记录的间隔
+	limiterSweepInterval = time.Minute
+)
+
+// rateLimitRule 限流规则，pattern为"方法 路径"格式，*匹配任意字符
+type rateLimitRule struct {
+	pattern string
+	limits  []cluster.WindowLimit
+}
+
+// parseRateLimitRules 解析配置中的限流规则，更具体（非通配字符更多）的规则优先匹配。
+// 配置库会将键名转为小写，规则按不区分大小写匹配
+func parseRateLimitRules(rules map[string]map[string]int, logger logger.Logger) []rateLimitRule {
+	parsed := make([]rateLimitRule, 0, len(rules))
+	for pattern, windows := range rules {
+		rule := rateLimitRule{pattern: strings.ToLower(strings.TrimSpace(pattern))}
+		for window, limit := range windows {
+			seconds, err := strconv.Atoi(window)
+			if err != nil || seconds <= 0 || limit < 0 {
+				logger.Warnf("Invalid rate limit window %q: %d for %s, ignored", window, limit, pattern)
+				continue
+			}
+			rule.limits = append(rule.limits, cluster.WindowLimit{
+				Window: time.Duration(seconds) * time.Second,
+				Limit:  limit,
+			})
+		}
+		if len(rule.limits) == 0 {
+			continue
+		}
+
+		sort.Slice(rule.limits, func(i, j int) bool {
+			return rule.limits[i].Window < rule.limits[j].Window
+		})
+		parsed = append(parsed, rule)
+	}
+
+	sort.Slice(parsed, func(i, j int) bool {
+		li := len(strings.ReplaceAll(parsed[i].pattern, "*", ""))
+		lj := len(strings.ReplaceAll(parsed[j].pattern, "*", ""))
+		if li != lj {
+			return li > lj
+		}
+		return parsed[i].pattern < parsed[j].pattern
+	})
+	return parsed
+}
+
+// matchRule 查找请求匹配的规则
+func matchRule(rules []rateLimitRule, method, path string) *rateLimitRule {
+	key := strings.ToLower(method + " " + path)
+	for i := range rules {
+		if matchPattern(rules[i].pattern, key) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// matchPattern 通配符匹配，*匹配任意长度的任意字符
+func matchPattern(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
+
+// slidingWindows 一个限流对象在各窗口内的请求时间，与规则的窗口一一对应
+type slidingWindows struct {
+	hits     [][]time.Time
+	windows  []time.Duration
+	ttl      time.Duration // 最长的窗口，超过该时间未访问时所有记录都已过期
+	lastSeen time.Time
+}
+
+// newSlidingWindows 按规则的窗口创建空记录
+func newSlidingWindows(limits []cluster.WindowLimit) *slidingWindows {
+	entry := &slidingWindows{
+		hits:    make([][]time.Time, len(limits)),
+		windows: make([]time.Duration, len(limits)),
+	}
+	for i, limit := range limits {
+		entry.windows[i] = limit.Window
+		if limit.Window > entry.ttl {
+			entry.ttl = limit.Window
+		}
+	}
+	return entry
+}
+
+// matches 记录的窗口是否与规则一致，规则在运行时修改后旧记录不再适用
+func (w *slidingWindows) matches(limits []cluster.WindowLimit) bool {
+	if len(w.windows) != len(limits) {
+		return false
+	}
+	for i, limit := range limits {
+		if w.windows[i] != limit.Window {
+			return false
+		}
+	}
+	return true
+}
+
+// LocalLimiter 本地滑动窗口限流器，按规则和限流对象分别记录，长时间未访问的记录会被清理
+type LocalLimiter struct {
+	mu        sync.Mutex
+	entries   map[string]*slidingWindows
+	lastSweep time.Time
+}
+
+// NewLocalLimiter 创建本地限流器
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{
+		entries:   make(map[string]*slidingWindows),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take 记录一次请求，任一窗口超限时不记录并返回false
+func (l *LocalLimiter) Take(key string, limits []cluster.WindowLimit) (bool, []cluster.WindowUsage) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	entry, exists := l.entries[key]
+	if !exists || !entry.matches(limits) {
+		entry = newSlidingWindows(limits)
+		l.entries[key] = entry
+	}
+	entry.lastSeen = now
+
+	allowed := true
+	usage := make([]cluster.WindowUsage, len(limits))
+	for i, limit := range limits {
+		hits := entry.hits[i]
+		expired := 0
+		for expired < len(hits) && !hits[expired].After(now.Add(-limit.Window)) {
+			expired++
+		}
+		hits = hits[expired:]
+		entry.hits[i] = hits
+
+		usage[i].Count = len(hits)
+		if len(hits) >= limit.Limit {
+			allowed = false
+			if limit.Limit > 0 {
+				usage[i].Wait = hits[len(hits)-limit.Limit].Add(limit.Window).Sub(now)
+			} else {
+				usage[i].Wait = limit.Window
+			}
+		} else if len(hits) > 0 {
+			usage[i].Wait = hits[0].Add(limit.Window).Sub(now)
+		} else {
+			usage[i].Wait = limit.Window
+		}
+	}
+
+	if allowed {
+		for i := range limits {
+			entry.hits[i] = append(entry.hits[i], now)
+			usage[i].Count++
+		}
+	}
+
+	return allowed, usage
+}
+
+// sweep 定期清理所有窗口都已过期的记录，调用方需持有锁
+func (l *LocalLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, entry := range l.entries {
+		if now.Sub(entry.lastSeen) >= entry.ttl {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// rateLimitSubject 限流对象：已认证的请求按用户，否则按IP
+func rateLimitSubject(c *gin.Context) string {
+	if userID := c.GetString("user_id"); userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + getClientIP(c)
+}
+
+// setRateLimitHeaders 设置限流响应头：允许时取剩余次数最少的窗口，超限时取需要等待最久的窗口
+func setRateLimitHeaders(c *gin.Context, limits []cluster.WindowLimit, usage []cluster.WindowUsage, allowed bool) {
+	selected := 0
+	for i := range limits {
+		if allowed {
+			left, selectedLeft := limits[i].Limit-usage[i].Count, limits[selected].Limit-usage[selected].Count
+			if left < selectedLeft || (left == selectedLeft && usage[i].Wait > usage[selected].Wait) {
+				selected = i
+			}
+			continue
+		}
+
+		exceeded := usage[i].Count >= limits[i].Limit
+		selectedExceeded := usage[selected].Count >= limits[selected].Limit
+		if exceeded && (!selectedExceeded || usage[i].Wait > usage[selected].Wait) {
+			selected = i
+		}
+	}
+
+	remaining := limits[selected].Limit - usage[selected].Count
+	if remaining < 0 || !allowed {
+		remaining = 0
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limits[selected].Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(usage[selected].Wait)))
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(usage[selected].Wait)))
+	}
+}
+
+// ceilSeconds 向上取整的秒数
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// RateLimit 限流中间件：按匹配的规则对每个用户（未认证时为IP）应用多个滑动窗口，
+// 响应头返回剩余次数最少的窗口的限额（X-RateLimit-Reset为距离窗口释放的秒数），超限时返回429和Retry-After。
+// 使用Redis后端时所有副本共享计数，Redis不可用时退回本地计数。被限流的请求计入该IP的自动封禁。
+// 规则取自运行时设置，修改后立即生效
+func RateLimit(config config.RateLimitConfig, settings *service.SettingsService, node *cluster.Node, bans *service.IPBanService, logger logger.Logger) gin.HandlerFunc {
+	if !config.Enabled {
+		return gin.HandlerFunc(func(c *gin.Context) {
+			c.Next()
+		})
+	}
+
+	var rules atomic.Pointer[[]rateLimitRule]
+	settings.OnChange(func(old, current *service.RuntimeSettings) {
+		if old == nil || !reflect.DeepEqual(old.RateLimitRules, current.RateLimitRules) {
+			parsed := parseRateLimitRules(current.RateLimitRules, logger)
+			rules.Store(&parsed)
+		}
+	})
+	local := NewLocalLimiter()
+	if config.Backend == RateLimitBackendLocal {
+		node = nil
+	} else if config.Backend == RateLimitBackendRedis && node == nil {
+		logger.Warn("Rate limit backend redis requires redis to be enabled, using local limiter")
+	}
+
+	return gin.HandlerFunc(func(c *gin.Context) {
+		ip := getClientIP(c)
+
+		// 检查白名单
+		if isIPInList(ip, config.Whitelist) {
+			c.Next()
+			return
+		}
+
+		// 检查黑名单
+		if isIPInList(ip, config.Blacklist) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "IP is blacklisted",
+			})
+			c.Abort()
+			return
+		}
+
+		rule := matchRule(*rules.Load(), c.Request.Method, c.Request.URL.Path)
+		if rule == nil {
+			c.Next()
+			return
+		}
+
+		subject := rateLimitSubject(c)
+		key := rule.pattern + ":" + subject
+
+		var allowed bool
+		var usage []cluster.WindowUsage
+		shared := false
+		if node != nil {
+			var err error
+			allowed, usage, err = takeShared(c.Request.Context(), node, key, rule.limits)
+			if err != nil {
+				logger.Warnf("Shared rate limit unavailable, using local limiter: %v", err)
+			} else {
+				shared = true
+			}
+		}
+		if !shared {
+			allowed, usage = local.Take(key, rule.limits)
+		}
+
+		setRateLimitHeaders(c, rule.limits, usage, allowed)
+		if !allowed {
+			logger.Warnf("Rate limit exceeded for %s on %s %s", subject, c.Request.Method, c.Request.URL.Path)
+			bans.RecordViolation(ip, service.ViolationRateLimit, c.Request.Method+" "+c.Request.URL.Path)
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"code":    429,
+				"message": "Rate limit exceeded",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
+
+// takeShared 使用集群共享的滑动窗口计数
+func takeShared(ctx context.Context, node *cluster.Node, key string, limits []cluster.WindowLimit) (bool, []cluster.WindowUsage, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	return node.TakeSlidingWindow(ctx, "ratelimit:"+key, limits)
+}
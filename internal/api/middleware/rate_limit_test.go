@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/database"
+	"midjourney-proxy-go/internal/service"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+func TestLocalLimiterSlidingWindow(t *testing.T) {
+	limiter := NewLocalLimiter()
+	limits := []cluster.WindowLimit{{Window: 200 * time.Millisecond, Limit: 2}}
+
+	if allowed, _ := limiter.Take("user:1", limits); !allowed {
+		t.Fatal("first take denied")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if allowed, usage := limiter.Take("user:1", limits); !allowed || usage[0].Count != 2 {
+		t.Fatalf("second take = %v, %+v", allowed, usage)
+	}
+
+	allowed, usage := limiter.Take("user:1", limits)
+	if allowed {
+		t.Fatal("third take within the window was allowed")
+	}
+	// 需要等到第一个请求滑出窗口
+	if usage[0].Count != 2 || usage[0].Wait <= 0 || usage[0].Wait > 100*time.Millisecond {
+		t.Fatalf("denied usage = %+v", usage[0])
+	}
+
+	// 其他限流对象单独计数
+	if allowed, _ := limiter.Take("user:2", limits); !allowed {
+		t.Fatal("another subject was limited")
+	}
+
+	// 只有最早的请求过期，第二个请求仍在窗口内
+	time.Sleep(usage[0].Wait + 10*time.Millisecond)
+	if allowed, usage := limiter.Take("user:1", limits); !allowed || usage[0].Count != 2 {
+		t.Fatalf("take after first hit expired = %v, %+v", allowed, usage)
+	}
+	if allowed, _ := limiter.Take("user:1", limits); allowed {
+		t.Fatal("window is full again but take was allowed")
+	}
+}
+
+func TestLocalLimiterMultipleWindows(t *testing.T) {
+	limiter := NewLocalLimiter()
+	limits := []cluster.WindowLimit{
+		{Window: 50 * time.Millisecond, Limit: 1},
+		{Window: time.Minute, Limit: 2},
+	}
+
+	if allowed, _ := limiter.Take("ip:1", limits); !allowed {
+		t.Fatal("first take denied")
+	}
+	if allowed, _ := limiter.Take("ip:1", limits); allowed {
+		t.Fatal("short window not enforced")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if allowed, _ := limiter.Take("ip:1", limits); !allowed {
+		t.Fatal("take after short window denied")
+	}
+
+	// 被拒绝的请求不计数，此时长窗口已满
+	time.Sleep(60 * time.Millisecond)
+	allowed, usage := limiter.Take("ip:1", limits)
+	if allowed {
+		t.Fatal("long window not enforced")
+	}
+	if usage[1].Count != 2 || usage[1].Wait < 50*time.Second {
+		t.Fatalf("long window usage = %+v", usage[1])
+	}
+}
+
+func TestLocalLimiterRuleWindowsChanged(t *testing.T) {
+	limiter := NewLocalLimiter()
+
+	if allowed, _ := limiter.Take("user:1", []cluster.WindowLimit{{Window: time.Minute, Limit: 5}}); !allowed {
+		t.Fatal("first take denied")
+	}
+
+	// 运行时给规则增加一个窗口，旧记录按新窗口重新计数
+	limits := []cluster.WindowLimit{
+		{Window: time.Second, Limit: 1},
+		{Window: time.Minute, Limit: 5},
+	}
+	allowed, usage := limiter.Take("user:1", limits)
+	if !allowed || len(usage) != 2 || usage[0].Count != 1 || usage[1].Count != 1 {
+		t.Fatalf("take after windows changed = %v, %+v", allowed, usage)
+	}
+	if allowed, _ := limiter.Take("user:1", limits); allowed {
+		t.Fatal("new short window not enforced")
+	}
+}
+
+func TestMatchRulePrefersSpecificPattern(t *testing.T) {
+	rules := parseRateLimitRules(map[string]map[string]int{
+		"* /api/*":              {"60": 100},
+		"POST /api/mj/submit/*": {"60": 5},
+		"post /api/auth/login":  {"60": 3, "bad": 1},
+		"get /api/empty":        {"0": 1},
+	}, logger.New("error", "text"))
+
+	if len(rules) != 3 {
+		t.Fatalf("parsed %d rules, want 3 (rule without valid windows dropped)", len(rules))
+	}
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{"POST", "/api/mj/submit/imagine", "post /api/mj/submit/*"},
+		{"POST", "/api/auth/login", "post /api/auth/login"},
+		{"GET", "/api/mj/task/1/fetch", "* /api/*"},
+		{"GET", "/health", ""},
+	}
+	for _, tt := range tests {
+		rule := matchRule(rules, tt.method, tt.path)
+		got := ""
+		if rule != nil {
+			got = rule.pattern
+		}
+		if got != tt.want {
+			t.Errorf("matchRule(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitSharedAcrossGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	log := logger.New("error", "text")
+
+	repos, err := database.Open(config.DatabaseConfig{
+		Type:   "sqlite",
+		SQLite: config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "test.db")},
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{
+		Enabled: true,
+		Backend: RateLimitBackendLocal,
+		Rules:   map[string]map[string]int{"get /api/*/items": {"60": 2}},
+	}}
+	settings, err := service.NewSettingsService(repos.Settings, repos.SettingChanges, cfg, nil, log)
+	if err != nil {
+		t.Fatalf("NewSettingsService: %v", err)
+	}
+	bans, err := service.NewIPBanService(repos.IPBans, cfg.RateLimit, nil, log)
+	if err != nil {
+		t.Fatalf("NewIPBanService: %v", err)
+	}
+
+	// 与路由相同：一个实例挂在多个分组上
+	rateLimit := RateLimit(cfg.RateLimit, settings, nil, bans, log)
+	engine := gin.New()
+	api := engine.Group("/api")
+	for _, name := range []string{"/a", "/b"} {
+		group := api.Group(name)
+		group.Use(rateLimit)
+		group.GET("/items", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+		group.GET("/other", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	}
+
+	serve := func(path string) int {
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	for _, path := range []string{"/api/a/items", "/api/b/items"} {
+		if code := serve(path); code != http.StatusNoContent {
+			t.Fatalf("%s = %d, want %d", path, code, http.StatusNoContent)
+		}
+	}
+	if code := serve("/api/a/items"); code != http.StatusTooManyRequests {
+		t.Fatalf("third request = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := serve("/api/b/other"); code != http.StatusNoContent {
+		t.Fatalf("unmatched path = %d, want %d", code, http.StatusNoContent)
+	}
+}
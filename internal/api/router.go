@@ -5,31 +5,57 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
 	
 	"midjourney-proxy-go/internal/api/handler"
 	"midjourney-proxy-go/internal/api/middleware"
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
 	"midjourney-proxy-go/internal/infrastructure/config"
 	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/internal/infrastructure/fetcher"
+	"midjourney-proxy-go/internal/infrastructure/storage"
+	"midjourney-proxy-go/internal/service"
 	"midjourney-proxy-go/pkg/logger"
+	"midjourney-proxy-go/pkg/redact"
 )
 
 // NewRouter 创建路由器
 func NewRouter(
 	cfg *config.Config,
-	db *gorm.DB,
+	repos *repository.Repositories,
+	node *cluster.Node,
 	discordManager *discord.Manager,
+	taskService *service.TaskService,
+	notifyService *service.NotifyService,
+	faceSwapService *service.FaceSwapService,
+	accountSync *service.AccountSyncService,
+	imageProxy *service.ImageProxy,
+	scheduler *service.Scheduler,
+	ipBans *service.IPBanService,
+	settings *service.SettingsService,
+	audit *service.AuditService,
+	apiKeys *service.APIKeyService,
+	tokens *service.TokenService,
+	fetcher *fetcher.Fetcher,
 	logger logger.Logger,
 ) *gin.Engine {
 	// 创建Gin引擎
 	router := gin.New()
 
+	// 客户端IP只由 ClientIP 中间件按受信任代理解析，c.ClientIP() 读取其结果
+	router.TrustedPlatform = middleware.ClientIPHeader
+	if err := router.SetTrustedProxies(nil); err != nil {
+		logger.Warnf("Failed to reset trusted proxies: %v", err)
+	}
+
 	// 中间件
-	router.Use(gin.Logger())
+	router.Use(middleware.ClientIP(middleware.NewClientIPResolver(cfg.Security.TrustedProxies, logger)))
+	router.Use(gin.LoggerWithWriter(redact.Writer(gin.DefaultWriter)))
 	router.Use(gin.Recovery())
-	router.Use(middleware.CORS())
+	router.Use(middleware.CORS(cfg.Security.AllowedOrigins))
 	router.Use(middleware.RequestID())
 
 	// 静态文件服务
@@ -37,6 +63,15 @@ func NewRouter(
 	router.StaticFile("/", "./web/dist/index.html")
 	router.StaticFile("/favicon.ico", "./web/dist/favicon.ico")
 
+	// 本地存储的任务结果，配置CDN时由CDN提供
+	if (cfg.Storage.Type == "" || cfg.Storage.Type == "local") && cfg.Storage.Local.CDN == "" {
+		localPath := cfg.Storage.Local.Path
+		if localPath == "" {
+			localPath = storage.DefaultLocalPath
+		}
+		router.Static(storage.LocalURLPrefix, localPath)
+	}
+
 	// 健康检查
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -47,48 +82,70 @@ func NewRouter(
 	})
 
 	// 创建处理器
-	taskHandler := handler.NewTaskHandler(db, discordManager, logger)
-	accountHandler := handler.NewAccountHandler(db, discordManager, logger)
-	userHandler := handler.NewUserHandler(db, cfg, logger)
-	adminHandler := handler.NewAdminHandler(db, discordManager, cfg, logger)
+	taskHandler := handler.NewTaskHandler(repos.Tasks, discordManager, taskService, ipBans, fetcher, cfg.Security.AllowedOrigins, logger)
+	accountHandler := handler.NewAccountHandler(repos.Accounts, discordManager, accountSync, audit, logger)
+	userHandler := handler.NewUserHandler(repos.Users, settings, tokens, cfg, logger)
+	adminHandler := handler.NewAdminHandler(repos, discordManager, settings, audit, cfg, logger)
+	webhookHandler := handler.NewWebhookHandler(notifyService, logger)
+	imageHandler := handler.NewImageHandler(repos.Tasks, imageProxy, logger)
+	faceSwapHandler := handler.NewFaceSwapHandler(faceSwapService, fetcher, cfg.FaceSwap.MaxFileSize, logger)
+	schedulerHandler := handler.NewSchedulerHandler(scheduler, logger)
+	ipBanHandler := handler.NewIPBanHandler(ipBans, logger)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeys, audit, logger)
 
 	// API路由组
 	api := router.Group("/api")
+	api.Use(middleware.IPBan(ipBans))
 	{
 		// 认证中间件
-		authMiddleware := middleware.Auth(cfg.Security, db, logger)
+		authMiddleware := middleware.Auth(cfg.Security, repos.Users, apiKeys, tokens, logger)
+
+		// 限流中间件：所有分组共用一个实例（同一份规则和计数），挂在各分组的认证之后，
+		// 登录用户按用户计数，否则按IP计数；规则按"方法 路径"匹配，未匹配的请求不限流
+		rateLimit := middleware.RateLimit(cfg.RateLimit, settings, node, ipBans, logger)
 
 		// 公开API
 		public := api.Group("/public")
+		public.Use(rateLimit)
 		{
 			public.GET("/info", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{
 					"name":     cfg.App.Name,
 					"version":  cfg.App.Version,
 					"demo":     cfg.App.DemoMode,
-					"register": cfg.App.EnableRegister,
-					"guest":    cfg.App.EnableGuest,
+					"register": settings.Current().EnableRegister,
+					"guest":    settings.Current().EnableGuest,
 				})
 			})
 		}
 
 		// 用户认证
 		auth := api.Group("/auth")
+		auth.Use(rateLimit)
 		{
 			auth.POST("/login", userHandler.Login)
-			if cfg.App.EnableRegister {
-				auth.POST("/register", userHandler.Register)
-			}
-			auth.POST("/refresh", authMiddleware, userHandler.RefreshToken)
+			auth.POST("/register", userHandler.Register)
+			auth.POST("/refresh", userHandler.RefreshToken)
 			auth.POST("/logout", authMiddleware, userHandler.Logout)
+			auth.POST("/logout-all", authMiddleware, middleware.RejectAPIKey(), userHandler.LogoutAll)
+		}
+
+		// API密钥管理，不接受API密钥认证
+		keys := api.Group("/keys")
+		keys.Use(authMiddleware)
+		keys.Use(middleware.RejectAPIKey())
+		keys.Use(rateLimit)
+		{
+			keys.GET("", apiKeyHandler.List)
+			keys.POST("", apiKeyHandler.Create)
+			keys.DELETE("/:id", apiKeyHandler.Revoke)
 		}
 
 		// 任务提交API
 		submit := api.Group("/mj/submit")
-		if !cfg.App.EnableGuest {
-			submit.Use(authMiddleware)
-		}
-		submit.Use(middleware.RateLimit(cfg.RateLimit, logger))
+		submit.Use(middleware.AuthUnlessGuest(authMiddleware, settings))
+		submit.Use(middleware.RequireScope(entity.ScopeSubmit))
+		submit.Use(rateLimit)
 		{
 			submit.POST("/imagine", taskHandler.SubmitImagine)
 			submit.POST("/change", taskHandler.SubmitChange)
@@ -105,15 +162,37 @@ func NewRouter(
 			submit.POST("/upload-discord-images", taskHandler.UploadDiscordImages)
 		}
 
+		// 换脸API
+		insightFace := api.Group("/insight-face")
+		insightFace.Use(middleware.AuthUnlessGuest(authMiddleware, settings))
+		insightFace.Use(middleware.RequireScope(entity.ScopeSubmit))
+		insightFace.Use(rateLimit)
+		{
+			insightFace.POST("/swap", faceSwapHandler.SwapFace)
+			insightFace.POST("/video/swap", faceSwapHandler.SwapVideoFace)
+		}
+
+		// 图片代理，任务ID不可猜测，便于直接用于<img>标签
+		image := api.Group("/mj/image")
+		image.Use(rateLimit)
+		{
+			image.GET("/:taskId", imageHandler.GetImage)
+			image.GET("/:taskId/thumbnail", imageHandler.GetThumbnail)
+		}
+
 		// 任务查询API
 		task := api.Group("/mj/task")
-		if !cfg.App.EnableGuest {
-			task.Use(authMiddleware)
-		}
+		task.Use(middleware.AuthUnlessGuest(authMiddleware, settings))
+		task.Use(middleware.RequireScope(entity.ScopeFetch))
+		task.Use(rateLimit)
 		{
 			task.GET("/:id", taskHandler.GetTask)
 			task.GET("/:id/fetch", taskHandler.FetchTask)
 			task.GET("/:id/seed", taskHandler.GetSeed)
+			task.POST("/:id/cancel", middleware.RequireScope(entity.ScopeSubmit), taskHandler.CancelTask)
+			task.GET("/:id/stream", taskHandler.StreamTask)
+			task.GET("/:id/images", taskHandler.GetTaskImages)
+			task.GET("/ws", taskHandler.TaskSocket)
 			task.GET("/list", taskHandler.ListTasks)
 			task.GET("/queue", taskHandler.GetQueue)
 		}
@@ -122,6 +201,8 @@ func NewRouter(
 		admin := api.Group("/admin")
 		admin.Use(authMiddleware)
 		admin.Use(middleware.AdminOnly())
+		admin.Use(middleware.RequireAdminScope())
+		admin.Use(rateLimit)
 		{
 			// 账号管理
 			accounts := admin.Group("/accounts")
@@ -129,6 +210,8 @@ func NewRouter(
 				accounts.GET("", accountHandler.List)
 				accounts.POST("", accountHandler.Create)
 				accounts.GET("/:id", accountHandler.Get)
+				// 查看明文使用POST，API密钥需要 admin:write
+				accounts.POST("/:id/secrets", accountHandler.RevealSecrets)
 				accounts.PUT("/:id", accountHandler.Update)
 				accounts.DELETE("/:id", accountHandler.Delete)
 				accounts.POST("/:id/sync", accountHandler.Sync)
@@ -144,25 +227,52 @@ func NewRouter(
 				users.GET("/:id", userHandler.Get)
 				users.PUT("/:id", userHandler.Update)
 				users.DELETE("/:id", userHandler.Delete)
+				users.POST("/:id/logout-all", userHandler.RevokeSessions)
 			}
 
 			// 任务管理
 			tasks := admin.Group("/tasks")
 			{
 				tasks.GET("", taskHandler.AdminList)
+				tasks.GET("/recovery", taskHandler.AdminRecovery)
+				tasks.GET("/thumbnails/backfill", taskHandler.AdminThumbnailBackfillStatus)
+				tasks.POST("/thumbnails/backfill", taskHandler.AdminStartThumbnailBackfill)
 				tasks.GET("/:id", taskHandler.AdminGet)
 				tasks.DELETE("/:id", taskHandler.AdminDelete)
 				tasks.POST("/:id/retry", taskHandler.AdminRetry)
+				tasks.POST("/retry", taskHandler.AdminBulkRetry)
+			}
+
+			// 回调投递记录
+			webhooks := admin.Group("/webhooks")
+			{
+				webhooks.GET("/deliveries", webhookHandler.ListDeliveries)
+				webhooks.GET("/deliveries/:id", webhookHandler.GetDelivery)
+				webhooks.POST("/deliveries/:id/replay", webhookHandler.ReplayDelivery)
 			}
 
 			// 系统设置
-			settings := admin.Group("/settings")
+			settingsGroup := admin.Group("/settings")
+			{
+				settingsGroup.GET("", adminHandler.GetSettings)
+				settingsGroup.PUT("", adminHandler.UpdateSettings)
+				settingsGroup.GET("/history", adminHandler.GetSettingHistory)
+				settingsGroup.GET("/info", adminHandler.GetSystemInfo)
+			}
+
+			// 审计记录：查看密钥等敏感操作
+			admin.GET("/audit-logs", adminHandler.ListAuditLogs)
+
+			// API密钥管理：查询和吊销所有用户的密钥
+			apiKeysGroup := admin.Group("/api-keys")
 			{
-				settings.GET("", adminHandler.GetSettings)
-				settings.PUT("", adminHandler.UpdateSettings)
-				settings.GET("/info", adminHandler.GetSystemInfo)
+				apiKeysGroup.GET("", apiKeyHandler.AdminList)
+				apiKeysGroup.DELETE("/:id", apiKeyHandler.AdminRevoke)
 			}
 
+			// 定时任务：领导者节点和最近一次执行
+			admin.GET("/scheduler", schedulerHandler.GetStatus)
+
 			// 统计信息
 			stats := admin.Group("/stats")
 			{
@@ -171,6 +281,15 @@ func NewRouter(
 				stats.GET("/accounts", adminHandler.GetAccountStats)
 			}
 
+			// IP封禁管理，路径参数可以是包含斜杠的CIDR
+			ipBansGroup := admin.Group("/ip-bans")
+			{
+				ipBansGroup.GET("", ipBanHandler.List)
+				ipBansGroup.POST("", ipBanHandler.Create)
+				ipBansGroup.GET("/*ip", ipBanHandler.Get)
+				ipBansGroup.DELETE("/*ip", ipBanHandler.Delete)
+			}
+
 			// 禁用词管理
 			bannedWords := admin.Group("/banned-words")
 			{
@@ -0,0 +1,87 @@
+package entity
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// APIKeyScope API密钥的权限范围
+type APIKeyScope string
+
+const (
+	ScopeSubmit     APIKeyScope = "submit"      // 提交任务（绘图、换脸）
+	ScopeFetch      APIKeyScope = "fetch"       // 查询任务
+	ScopeAdminRead  APIKeyScope = "admin:read"  // 管理接口的查询请求，只能由管理员创建
+	ScopeAdminWrite APIKeyScope = "admin:write" // 管理接口的修改请求，只能由管理员创建
+)
+
+// APIKeyScopes 全部权限范围
+var APIKeyScopes = []APIKeyScope{ScopeSubmit, ScopeFetch, ScopeAdminRead, ScopeAdminWrite}
+
+// APIKey 用户的API密钥，只保存密钥的SHA-256摘要，明文只在创建时返回一次
+type APIKey struct {
+	ID      string `gorm:"column:id;primaryKey" json:"id"`
+	UserID  string `gorm:"column:user_id;index" json:"user_id"`
+	Name    string `gorm:"column:name" json:"name"`
+	Prefix  string `gorm:"column:prefix" json:"prefix"` // 密钥开头的几个字符，用于辨认
+	KeyHash string `gorm:"column:key_hash;uniqueIndex" json:"-"`
+
+	Scopes     []APIKeyScope `gorm:"column:scopes;type:json;serializer:json" json:"scopes"`
+	AllowedIPs []string      `gorm:"column:allowed_ips;type:json;serializer:json" json:"allowed_ips,omitempty"` // IP或CIDR，为空时不限制
+	ExpiresAt  *time.Time    `gorm:"column:expires_at" json:"expires_at,omitempty"`                             // 为空表示永不过期
+
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"column:last_used_ip" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+
+	// 时间戳
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsRevoked 是否已吊销
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// IsExpired 是否已过期
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// HasScope 是否具有指定的权限范围
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP 客户端IP是否在允许列表中，列表为空时允许所有IP
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+	client := net.ParseIP(ip)
+	if client == nil {
+		return false
+	}
+	for _, item := range k.AllowedIPs {
+		if strings.Contains(item, "/") {
+			if _, network, err := net.ParseCIDR(item); err == nil && network.Contains(client) {
+				return true
+			}
+		} else if allowed := net.ParseIP(item); allowed != nil && allowed.Equal(client) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"time"
+)
+
+// 审计操作
+const (
+	AuditRevealAccountSecrets = "account.reveal_secrets" // 查看账号密钥明文
+	AuditCreateAPIKey         = "api_key.create"         // 创建API密钥
+	AuditRevokeAPIKey         = "api_key.revoke"         // 吊销API密钥
+)
+
+// AuditLog 审计记录，记录管理员的敏感操作，只追加不修改
+type AuditLog struct {
+	ID       string `gorm:"column:id;primaryKey" json:"id"`
+	Action   string `gorm:"column:action;index" json:"action"`
+	Target   string `gorm:"column:target;index" json:"target,omitempty"` // 操作对象，如账号ID
+	Operator string `gorm:"column:operator" json:"operator,omitempty"`
+	ClientIP string `gorm:"column:client_ip" json:"client_ip,omitempty"`
+	Detail   string `gorm:"column:detail;type:text" json:"detail,omitempty"`
+
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,45 @@
+package entity
+
+import (
+	"time"
+)
+
+// RefreshToken 刷新令牌，只保存摘要。每次刷新都作废当前令牌并换发新令牌，
+// 同一次登录换发的令牌属于同一个令牌族，已使用的令牌再次出现时吊销整个令牌族
+type RefreshToken struct {
+	ID        string `gorm:"column:id;primaryKey" json:"id"`
+	UserID    string `gorm:"column:user_id;index" json:"user_id"`
+	FamilyID  string `gorm:"column:family_id;index" json:"family_id"`
+	TokenHash string `gorm:"column:token_hash;uniqueIndex" json:"-"`
+	AccessJTI string `gorm:"column:access_jti" json:"-"` // 与该令牌一同签发的访问令牌ID，吊销时一并吊销
+
+	ClientIP  string `gorm:"column:client_ip" json:"client_ip,omitempty"`
+	UserAgent string `gorm:"column:user_agent" json:"user_agent,omitempty"`
+
+	ExpiresAt time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at,omitempty"` // 已换发新令牌的时间
+	RevokedAt *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+
+	// 时间戳
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// RevokedToken 已吊销的访问令牌，保留到令牌本身过期
+type RevokedToken struct {
+	ID        string    `gorm:"column:id;primaryKey" json:"id"` // 访问令牌的jti
+	UserID    string    `gorm:"column:user_id" json:"user_id"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index" json:"expires_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+// TableName 指定表名
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
@@ -0,0 +1,105 @@
+package entity
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidDataURL 无效的base64数据
+var ErrInvalidDataURL = errors.New("无效的base64数据")
+
+// DataURL 内存中的文件内容，base64输入和远程链接下载的结果都转换为此形式后再上传
+type DataURL struct {
+	MimeType string
+	Data     []byte
+}
+
+// ParseDataURL 解析 data:image/png;base64,xxx 格式的字符串，也接受不带前缀的纯base64，此时按内容判断类型
+func ParseDataURL(s string) (*DataURL, error) {
+	s = strings.TrimSpace(s)
+
+	mimeType := ""
+	if strings.HasPrefix(s, "data:") {
+		comma := strings.Index(s, ",")
+		if comma < 0 {
+			return nil, ErrInvalidDataURL
+		}
+		header := s[len("data:"):comma]
+		if !strings.HasSuffix(header, ";base64") {
+			return nil, ErrInvalidDataURL
+		}
+		mimeType = strings.TrimSuffix(header, ";base64")
+		if i := strings.Index(mimeType, ";"); i >= 0 {
+			mimeType = mimeType[:i]
+		}
+		s = s[comma+1:]
+	}
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		// 兼容URL安全编码和缺少填充的输入
+		data, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return nil, ErrInvalidDataURL
+		}
+	}
+	if len(data) == 0 {
+		return nil, ErrInvalidDataURL
+	}
+
+	if mimeType == "" {
+		mimeType = SniffContentType(data)
+	}
+
+	return &DataURL{MimeType: strings.ToLower(mimeType), Data: data}, nil
+}
+
+// String 转换为 data URL 字符串
+func (d *DataURL) String() string {
+	return "data:" + d.MimeType + ";base64," + base64.StdEncoding.EncodeToString(d.Data)
+}
+
+// IsImage 是否为图片
+func (d *DataURL) IsImage() bool {
+	return strings.HasPrefix(d.MimeType, "image/")
+}
+
+// Extension 按类型推断的文件扩展名
+func (d *DataURL) Extension() string {
+	switch d.MimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/bmp":
+		return ".bmp"
+	case "video/mp4":
+		return ".mp4"
+	case "video/webm":
+		return ".webm"
+	case "video/quicktime":
+		return ".mov"
+	}
+	return ""
+}
+
+// SniffContentType 根据文件头判断内容类型
+func SniffContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	// 标准库不识别 mov 容器
+	if contentType == "application/octet-stream" && len(data) >= 12 && string(data[4:12]) == "ftypqt  " {
+		return "video/quicktime"
+	}
+
+	return contentType
+}
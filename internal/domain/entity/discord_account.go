@@ -2,8 +2,12 @@ package entity
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 	"gorm.io/gorm"
+
+	"midjourney-proxy-go/pkg/fieldcrypt"
+	"midjourney-proxy-go/pkg/redact"
 )
 
 // Component Discord组件
@@ -139,7 +143,7 @@ type DiscordAccount struct {
 	// 子频道
 	SubChannelsData   string            `gorm:"column:sub_channels;type:text" json:"-"`
 	SubChannels       []string          `gorm:"-" json:"sub_channels,omitempty"`
-	SubChannelValues  map[string]string `gorm:"column:sub_channel_values;type:json" json:"sub_channel_values,omitempty"`
+	SubChannelValues  map[string]string `gorm:"column:sub_channel_values;type:json;serializer:json" json:"sub_channel_values,omitempty"`
 	
 	// 运行状态（仅用于显示）
 	RunningCount int  `gorm:"-" json:"running_count"`
@@ -147,7 +151,7 @@ type DiscordAccount struct {
 	Running      bool `gorm:"-" json:"running"`
 	
 	// 扩展属性
-	Properties map[string]interface{} `gorm:"column:properties;type:json" json:"properties,omitempty"`
+	Properties map[string]interface{} `gorm:"column:properties;type:json;serializer:json" json:"properties,omitempty"`
 	
 	// 时间戳
 	CreatedAt time.Time      `gorm:"column:created_at" json:"created_at"`
@@ -160,8 +164,10 @@ func (DiscordAccount) TableName() string {
 	return "discord_accounts"
 }
 
-// BeforeSave GORM钩子，保存前序列化复杂字段
+// BeforeSave GORM钩子，保存前序列化复杂字段并加密密钥字段
 func (d *DiscordAccount) BeforeSave(tx *gorm.DB) error {
+	redact.Register(d.Secrets()...)
+
 	// 序列化AllowModes
 	if d.AllowModes != nil {
 		data, err := json.Marshal(d.AllowModes)
@@ -207,11 +213,30 @@ func (d *DiscordAccount) BeforeSave(tx *gorm.DB) error {
 		d.SubChannelsData = string(data)
 	}
 	
+	// 加密Token和登录凭据，保存后由AfterSave还原为明文
+	for _, field := range d.secretFields() {
+		encrypted, err := fieldcrypt.Encrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = encrypted
+	}
+	
 	return nil
 }
 
-// AfterFind GORM钩子，查询后反序列化复杂字段
+// AfterSave GORM钩子，保存后将加密的密钥字段还原为明文，调用方继续使用的实体与保存前一致
+func (d *DiscordAccount) AfterSave(tx *gorm.DB) error {
+	return d.decryptSecrets()
+}
+
+// AfterFind GORM钩子，查询后解密密钥字段并反序列化复杂字段
 func (d *DiscordAccount) AfterFind(tx *gorm.DB) error {
+	if err := d.decryptSecrets(); err != nil {
+		return err
+	}
+	redact.Register(d.Secrets()...)
+
 	// 反序列化AllowModes
 	if d.AllowModesData != "" {
 		var modes []GenerationSpeedMode
@@ -255,6 +280,42 @@ func (d *DiscordAccount) AfterFind(tx *gorm.DB) error {
 	return nil
 }
 
+// secretFields 需要加密保存的字段：用户Token、机器人Token、登录密码和2FA密钥
+func (d *DiscordAccount) secretFields() []*string {
+	return []*string{&d.UserToken, &d.BotToken, &d.LoginPassword, &d.Login2FA}
+}
+
+// decryptSecrets 解密密钥字段，加密前写入的明文保持不变
+func (d *DiscordAccount) decryptSecrets() error {
+	for _, field := range d.secretFields() {
+		plaintext, err := fieldcrypt.Decrypt(*field)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt credentials of account %s: %w", d.ID, err)
+		}
+		*field = plaintext
+	}
+	return nil
+}
+
+// Secrets 账号的密钥字段：用户Token、机器人Token、登录密码和2FA密钥
+func (d *DiscordAccount) Secrets() []string {
+	var secrets []string
+	for _, field := range d.secretFields() {
+		secrets = append(secrets, *field)
+	}
+	return secrets
+}
+
+// Redacted 返回密钥字段替换为掩码的副本，用于API响应
+func (d *DiscordAccount) Redacted() *DiscordAccount {
+	redacted := *d
+	redacted.UserToken = redact.Mask(d.UserToken)
+	redacted.BotToken = redact.Mask(d.BotToken)
+	redacted.LoginPassword = redact.MaskAll(d.LoginPassword)
+	redacted.Login2FA = redact.MaskAll(d.Login2FA)
+	return &redacted
+}
+
 // IsAcceptNewTask 是否接受新任务
 func (d *DiscordAccount) IsAcceptNewTask() bool {
 	if !d.Enabled || d.Lock {
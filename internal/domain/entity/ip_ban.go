@@ -0,0 +1,38 @@
+package entity
+
+import (
+	"time"
+)
+
+// IPBanSource 封禁来源
+type IPBanSource string
+
+const (
+	IPBanSourceManual IPBanSource = "MANUAL" // 管理员添加
+	IPBanSourceAuto   IPBanSource = "AUTO"   // 多次触发限流或禁用词后自动封禁
+)
+
+// IPBan IP封禁记录，ID为IP地址或CIDR。
+// 自动封禁到期后记录保留，BanCount用于计算下次自动封禁的时长，删除记录后重新计算
+type IPBan struct {
+	ID        string      `gorm:"column:id;primaryKey" json:"ip"`
+	Source    IPBanSource `gorm:"column:source" json:"source"`
+	Reason    string      `gorm:"column:reason;type:text" json:"reason"`
+	BanCount  int         `gorm:"column:ban_count;default:0" json:"ban_count"`
+	ExpiresAt *time.Time  `gorm:"column:expires_at;index" json:"expires_at,omitempty"` // 为空表示永久封禁
+	CreatedBy string      `gorm:"column:created_by" json:"created_by,omitempty"`
+
+	// 时间戳
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (IPBan) TableName() string {
+	return "ip_bans"
+}
+
+// IsActive 封禁是否仍在生效
+func (b *IPBan) IsActive(now time.Time) bool {
+	return b.ExpiresAt == nil || now.Before(*b.ExpiresAt)
+}
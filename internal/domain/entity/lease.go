@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"time"
+)
+
+// Lease 租约，多个副本通过数据库行竞争同一租约，持有者需在过期前续期
+type Lease struct {
+	ID        string    `gorm:"column:id;primaryKey" json:"id"`
+	Holder    string    `gorm:"column:holder" json:"holder"`
+	ExpiresAt time.Time `gorm:"column:expires_at" json:"expires_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Lease) TableName() string {
+	return "leases"
+}
+
+// IsExpired 租约是否已过期
+func (l *Lease) IsExpired() bool {
+	return !time.Now().Before(l.ExpiresAt)
+}
+
+// JobRun 定时任务最近一次执行记录，ID为任务名称
+type JobRun struct {
+	ID         string     `gorm:"column:id;primaryKey" json:"id"`
+	Node       string     `gorm:"column:node" json:"node"`
+	StartedAt  time.Time  `gorm:"column:started_at" json:"started_at"`
+	FinishedAt *time.Time `gorm:"column:finished_at" json:"finished_at,omitempty"`
+	DurationMs int64      `gorm:"column:duration_ms" json:"duration_ms"`
+	Error      string     `gorm:"column:error;type:text" json:"error,omitempty"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (JobRun) TableName() string {
+	return "job_runs"
+}
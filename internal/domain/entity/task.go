@@ -18,6 +18,16 @@ const (
 	TaskStatusCancel     TaskStatus = "CANCEL"      // 取消
 )
 
+// UnfinishedTaskStatuses 未完成的任务状态
+var UnfinishedTaskStatuses = []TaskStatus{
+	TaskStatusNotStart,
+	TaskStatusSubmitted,
+	TaskStatusInProgress,
+}
+
+// TaskFailReasonTimeout 任务超时的失败原因
+const TaskFailReasonTimeout = "timeout"
+
 // TaskAction 任务动作枚举
 type TaskAction string
 
@@ -35,6 +45,8 @@ const (
 	TaskActionVary      TaskAction = "VARY"      // 局部重绘
 	TaskActionModal     TaskAction = "MODAL"     // 模态
 	TaskActionAction    TaskAction = "ACTION"    // 行动
+	TaskActionSwapFace  TaskAction = "SWAP_FACE" // 换脸
+	TaskActionSwapVideoFace TaskAction = "SWAP_VIDEO_FACE" // 视频换脸
 )
 
 // BotType 机器人类型枚举
@@ -114,7 +126,7 @@ type Task struct {
 	FailReason   string `gorm:"column:fail_reason;type:text" json:"fail_reason,omitempty"`
 	
 	// 按钮和组件
-	Buttons []CustomComponent `gorm:"column:buttons;type:json" json:"buttons,omitempty"`
+	Buttons []CustomComponent `gorm:"column:buttons;type:json;serializer:json" json:"buttons,omitempty"`
 	
 	// 种子和图片信息
 	Seed          string `gorm:"column:seed" json:"seed,omitempty"`
@@ -122,7 +134,8 @@ type Task struct {
 	JobID         string `gorm:"column:job_id" json:"job_id,omitempty"`
 	
 	// 网络相关
-	ClientIP string `gorm:"column:client_ip;index" json:"client_ip,omitempty"`
+	ClientIP   string `gorm:"column:client_ip;index" json:"client_ip,omitempty"`
+	NotifyHook string `gorm:"column:notify_hook;size:1024" json:"notify_hook,omitempty"`
 	
 	// 换脸相关
 	IsReplicate      bool   `gorm:"column:is_replicate;default:false" json:"is_replicate"`
@@ -145,7 +158,10 @@ type Task struct {
 	ContentType string `gorm:"column:content_type;size:200" json:"content_type,omitempty"`
 	
 	// 扩展属性
-	Properties map[string]interface{} `gorm:"column:properties;type:json" json:"properties,omitempty"`
+	Properties map[string]interface{} `gorm:"column:properties;type:json;serializer:json" json:"properties,omitempty"`
+
+	// 提交时的输入文件（base64或下载的链接），只在内存中传递给执行器，不持久化
+	Inputs []*DataURL `gorm:"-" json:"-"`
 	
 	// 时间戳
 	CreatedAt time.Time      `gorm:"column:created_at" json:"created_at"`
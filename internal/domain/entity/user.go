@@ -23,7 +23,7 @@ type User struct {
 	Role     UserRole `gorm:"column:role;default:'user'" json:"role"`
 	
 	// 令牌信息
-	Token      string `gorm:"column:token;uniqueIndex" json:"token,omitempty"`
+	Token      string `gorm:"column:token;uniqueIndex" json:"-"`
 	TokenType  string `gorm:"column:token_type;default:'bearer'" json:"token_type,omitempty"`
 	
 	// 状态信息
@@ -153,6 +153,23 @@ func (Setting) TableName() string {
 	return "settings"
 }
 
+// SettingChange 系统设置变更记录，OldValue和NewValue为变更前后生效值的JSON
+type SettingChange struct {
+	ID       string `gorm:"column:id;primaryKey" json:"id"`
+	Key      string `gorm:"column:key;index" json:"key"`
+	OldValue string `gorm:"column:old_value;type:text" json:"old_value"`
+	NewValue string `gorm:"column:new_value;type:text" json:"new_value"`
+	Reset    bool   `gorm:"column:reset;default:false" json:"reset"` // 删除覆盖值，恢复为配置文件中的值
+	Operator string `gorm:"column:operator" json:"operator,omitempty"`
+
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (SettingChange) TableName() string {
+	return "setting_changes"
+}
+
 // DomainTag 领域标签实体
 type DomainTag struct {
 	ID      string `gorm:"column:id;primaryKey" json:"id"`
@@ -186,13 +203,13 @@ type Message struct {
 	Hash         string    `gorm:"column:hash;index" json:"hash,omitempty"`
 	
 	// 附件信息
-	Attachments []map[string]interface{} `gorm:"column:attachments;type:json" json:"attachments,omitempty"`
+	Attachments []map[string]interface{} `gorm:"column:attachments;type:json;serializer:json" json:"attachments,omitempty"`
 	
 	// 组件信息
-	Components []Component `gorm:"column:components;type:json" json:"components,omitempty"`
+	Components []Component `gorm:"column:components;type:json;serializer:json" json:"components,omitempty"`
 	
 	// 嵌入信息
-	Embeds []map[string]interface{} `gorm:"column:embeds;type:json" json:"embeds,omitempty"`
+	Embeds []map[string]interface{} `gorm:"column:embeds;type:json;serializer:json" json:"embeds,omitempty"`
 	
 	// 时间戳
 	Timestamp time.Time      `gorm:"column:timestamp" json:"timestamp"`
@@ -0,0 +1,38 @@
+package entity
+
+import (
+	"time"
+)
+
+// WebhookDeliveryStatus 回调投递状态
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending WebhookDeliveryStatus = "PENDING" // 投递中
+	WebhookDeliverySuccess WebhookDeliveryStatus = "SUCCESS" // 成功
+	WebhookDeliveryFailure WebhookDeliveryStatus = "FAILURE" // 失败
+)
+
+// WebhookDelivery 回调投递记录
+type WebhookDelivery struct {
+	ID         string                `gorm:"column:id;primaryKey" json:"id"`
+	TaskID     string                `gorm:"column:task_id;index" json:"task_id"`
+	URL        string                `gorm:"column:url;size:1024" json:"url"`
+	TaskStatus TaskStatus            `gorm:"column:task_status" json:"task_status"`
+	Progress   string                `gorm:"column:progress" json:"progress,omitempty"`
+	Payload    string                `gorm:"column:payload;type:text" json:"payload,omitempty"`
+	Status     WebhookDeliveryStatus `gorm:"column:status;index" json:"status"`
+	Attempts   int                   `gorm:"column:attempts;default:0" json:"attempts"`
+	StatusCode int                   `gorm:"column:status_code" json:"status_code,omitempty"`
+	Error      string                `gorm:"column:error;type:text" json:"error,omitempty"`
+
+	// 时间戳
+	LastAttemptAt *time.Time `gorm:"column:last_attempt_at" json:"last_attempt_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"column:created_at;index" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -0,0 +1,337 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+)
+
+// ErrNotFound 记录不存在
+var ErrNotFound = errors.New("记录不存在")
+
+// Repositories 数据仓储集合，SQL（GORM）和MongoDB后端提供相同的行为
+type Repositories struct {
+	Tasks             TaskRepository
+	Users             UserRepository
+	Accounts          AccountRepository
+	BannedWords       BannedWordRepository
+	Settings          SettingRepository
+	SettingChanges    SettingChangeRepository
+	DomainTags        DomainTagRepository
+	Messages          MessageRepository
+	WebhookDeliveries WebhookDeliveryRepository
+	Leases            LeaseRepository
+	JobRuns           JobRunRepository
+	IPBans            IPBanRepository
+	AuditLogs         AuditLogRepository
+	APIKeys           APIKeyRepository
+	RefreshTokens     RefreshTokenRepository
+	RevokedTokens     RevokedTokenRepository
+
+	// Close 关闭数据库连接
+	Close func() error
+}
+
+// TaskSort 任务排序方式
+type TaskSort int
+
+const (
+	SortCreatedDesc TaskSort = iota // 创建时间倒序（默认）
+	SortSubmitAsc                   // 提交时间正序
+	SortFinishAsc                   // 结束时间正序
+	SortIDAsc                       // ID正序，用于分批遍历
+)
+
+// TaskQuery 任务查询条件，零值字段不参与过滤
+type TaskQuery struct {
+	IDs            []string
+	UserID         string
+	InstanceID     string
+	Statuses       []entity.TaskStatus
+	ExcludeActions []entity.TaskAction
+	// FailReason 失败原因包含的文本
+	FailReason string
+	// FinishedFrom、FinishedTo 结束时间范围（包含两端）
+	FinishedFrom *time.Time
+	FinishedTo   *time.Time
+	// CreatedFrom 创建时间下限（包含）
+	CreatedFrom *time.Time
+	// MissingThumbnail 有结果图但没有缩略图
+	MissingThumbnail bool
+	// Stored 结果已转存到存储：ImageURL已改写为存储地址或已生成缩略图
+	Stored bool
+	// AfterID ID大于该值，配合 SortIDAsc 分批遍历
+	AfterID string
+
+	Sort   TaskSort
+	Offset int
+	Limit  int
+}
+
+// TaskRepository 任务仓储
+type TaskRepository interface {
+	Create(ctx context.Context, task *entity.Task) error
+	// Save 保存任务全部字段，不存在时创建
+	Save(ctx context.Context, task *entity.Task) error
+	Get(ctx context.Context, id string) (*entity.Task, error)
+	Find(ctx context.Context, query TaskQuery) ([]entity.Task, error)
+	Count(ctx context.Context, query TaskQuery) (int64, error)
+	Delete(ctx context.Context, id string) error
+	// SaveIfUnfinished 仅当任务仍未结束时保存全部字段（创建时间除外），返回是否更新
+	SaveIfUnfinished(ctx context.Context, task *entity.Task) (bool, error)
+	// SaveIfStatus 仅当任务在数据库中处于指定状态时保存全部字段（创建时间除外），返回是否更新
+	SaveIfStatus(ctx context.Context, task *entity.Task, status entity.TaskStatus) (bool, error)
+	// UpdateIfUnfinished 仅当任务仍未结束时更新指定列，返回是否更新
+	UpdateIfUnfinished(ctx context.Context, id string, fields map[string]interface{}) (bool, error)
+	// UpdateColumns 保存任务的指定列
+	UpdateColumns(ctx context.Context, task *entity.Task, columns ...string) error
+}
+
+// UserQuery 用户查询条件
+type UserQuery struct {
+	// Keyword 用户名或邮箱包含的文本
+	Keyword string
+	Role    entity.UserRole
+	Enabled *bool
+
+	Offset int
+	Limit  int
+}
+
+// UserRepository 用户仓储
+type UserRepository interface {
+	Create(ctx context.Context, user *entity.User) error
+	Save(ctx context.Context, user *entity.User) error
+	Get(ctx context.Context, id string) (*entity.User, error)
+	GetByUsername(ctx context.Context, username string) (*entity.User, error)
+	GetByToken(ctx context.Context, role entity.UserRole, token string) (*entity.User, error)
+	// FindByUsernameOrEmail 查找用户名或邮箱相同的用户
+	FindByUsernameOrEmail(ctx context.Context, username, email string) (*entity.User, error)
+	// Find 按创建时间倒序查询
+	Find(ctx context.Context, query UserQuery) ([]entity.User, error)
+	Count(ctx context.Context, query UserQuery) (int64, error)
+	Delete(ctx context.Context, id string) error
+	// AdjustDrawCount 调整总绘图次数和日绘图次数，结果不小于0，返回用户是否存在
+	AdjustDrawCount(ctx context.Context, id string, delta int) (bool, error)
+	// ResetDayDrawCount 将所有用户的日绘图次数清零
+	ResetDayDrawCount(ctx context.Context) error
+}
+
+// AccountQuery 账号查询条件
+type AccountQuery struct {
+	// Keyword 频道ID或服务器ID包含的文本
+	Keyword string
+	// IncludeDeleted 包括已删除的账号
+	IncludeDeleted bool
+
+	Offset int
+	Limit  int
+}
+
+// AccountRepository Discord账号仓储
+type AccountRepository interface {
+	Create(ctx context.Context, account *entity.DiscordAccount) error
+	Save(ctx context.Context, account *entity.DiscordAccount) error
+	Get(ctx context.Context, id string) (*entity.DiscordAccount, error)
+	GetByChannelID(ctx context.Context, channelID string) (*entity.DiscordAccount, error)
+	// Find 按创建时间倒序查询
+	Find(ctx context.Context, query AccountQuery) ([]entity.DiscordAccount, error)
+	Count(ctx context.Context, query AccountQuery) (int64, error)
+	Delete(ctx context.Context, id string) error
+	SetEnabled(ctx context.Context, id string, enabled bool) error
+	// SaveCredentials 只保存Token和登录凭据，已删除的账号同样保存，用于加密已有数据和轮换密钥
+	SaveCredentials(ctx context.Context, account *entity.DiscordAccount) error
+	// ResetDayDrawCount 将所有账号的日绘图次数清零
+	ResetDayDrawCount(ctx context.Context) error
+}
+
+// BannedWordRepository 禁用词仓储
+type BannedWordRepository interface {
+	Create(ctx context.Context, word *entity.BannedWord) error
+	Save(ctx context.Context, word *entity.BannedWord) error
+	Get(ctx context.Context, id string) (*entity.BannedWord, error)
+	// Find 按创建时间倒序查询，enabledOnly为true时只返回启用的禁用词
+	Find(ctx context.Context, enabledOnly bool) ([]entity.BannedWord, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// SettingRepository 系统设置仓储
+type SettingRepository interface {
+	Create(ctx context.Context, setting *entity.Setting) error
+	Save(ctx context.Context, setting *entity.Setting) error
+	// Get 按键名查询
+	Get(ctx context.Context, key string) (*entity.Setting, error)
+	// Find 按键名正序查询，group为空时返回全部
+	Find(ctx context.Context, group string) ([]entity.Setting, error)
+	// Delete 按键名永久删除，删除后可以重新创建同名设置
+	Delete(ctx context.Context, key string) error
+}
+
+// SettingChangeQuery 设置变更记录查询条件
+type SettingChangeQuery struct {
+	Key string
+
+	Offset int
+	Limit  int
+}
+
+// SettingChangeRepository 设置变更记录仓储
+type SettingChangeRepository interface {
+	Create(ctx context.Context, change *entity.SettingChange) error
+	// Find 按变更时间倒序查询
+	Find(ctx context.Context, query SettingChangeQuery) ([]entity.SettingChange, error)
+	Count(ctx context.Context, query SettingChangeQuery) (int64, error)
+}
+
+// DomainTagRepository 领域标签仓储
+type DomainTagRepository interface {
+	Create(ctx context.Context, tag *entity.DomainTag) error
+	Save(ctx context.Context, tag *entity.DomainTag) error
+	Get(ctx context.Context, id string) (*entity.DomainTag, error)
+	// Find 按排序值正序、创建时间倒序查询
+	Find(ctx context.Context) ([]entity.DomainTag, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// MessageQuery 消息查询条件
+type MessageQuery struct {
+	ChannelID string
+	MessageID string
+	Hash      string
+
+	Limit int
+}
+
+// MessageRepository Discord消息仓储
+type MessageRepository interface {
+	Create(ctx context.Context, message *entity.Message) error
+	Save(ctx context.Context, message *entity.Message) error
+	Get(ctx context.Context, id string) (*entity.Message, error)
+	// Find 按消息时间倒序查询
+	Find(ctx context.Context, query MessageQuery) ([]entity.Message, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// WebhookDeliveryQuery 回调投递记录查询条件
+type WebhookDeliveryQuery struct {
+	TaskID string
+	Status entity.WebhookDeliveryStatus
+
+	Offset int
+	Limit  int
+}
+
+// WebhookDeliveryRepository 回调投递记录仓储
+type WebhookDeliveryRepository interface {
+	Create(ctx context.Context, delivery *entity.WebhookDelivery) error
+	Get(ctx context.Context, id string) (*entity.WebhookDelivery, error)
+	// Find 按创建时间倒序查询
+	Find(ctx context.Context, query WebhookDeliveryQuery) ([]entity.WebhookDelivery, error)
+	Count(ctx context.Context, query WebhookDeliveryQuery) (int64, error)
+	// Update 更新指定列
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+	// DeleteFinishedBefore 删除before之前创建且不在投递中的记录，返回删除的数量
+	DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// LeaseRepository 租约仓储，多个副本通过同一租约选出唯一的持有者
+type LeaseRepository interface {
+	// TryAcquire 租约不存在、已过期或已由holder持有时获取并续期ttl，返回是否由holder持有
+	TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// Release 释放holder持有的租约，已被其他持有者获取时不做处理
+	Release(ctx context.Context, name, holder string) error
+	Get(ctx context.Context, name string) (*entity.Lease, error)
+}
+
+// JobRunRepository 定时任务执行记录仓储，每个任务只保留最近一次执行
+type JobRunRepository interface {
+	// Save 保存执行记录，不存在时创建
+	Save(ctx context.Context, run *entity.JobRun) error
+	// Find 按任务名称正序查询
+	Find(ctx context.Context) ([]entity.JobRun, error)
+}
+
+// IPBanRepository IP封禁仓储，ID为IP地址或CIDR
+type IPBanRepository interface {
+	// Save 保存封禁记录，不存在时创建
+	Save(ctx context.Context, ban *entity.IPBan) error
+	Get(ctx context.Context, ip string) (*entity.IPBan, error)
+	// Find 按更新时间倒序查询，activeOnly为true时只返回仍在生效的封禁
+	Find(ctx context.Context, activeOnly bool) ([]entity.IPBan, error)
+	Delete(ctx context.Context, ip string) error
+}
+
+// AuditLogQuery 审计记录查询条件
+type AuditLogQuery struct {
+	Action string
+	Target string
+
+	Offset int
+	Limit  int
+}
+
+// AuditLogRepository 审计记录仓储
+type AuditLogRepository interface {
+	Create(ctx context.Context, log *entity.AuditLog) error
+	// Find 按记录时间倒序查询
+	Find(ctx context.Context, query AuditLogQuery) ([]entity.AuditLog, error)
+	Count(ctx context.Context, query AuditLogQuery) (int64, error)
+}
+
+// APIKeyQuery API密钥查询条件
+type APIKeyQuery struct {
+	UserID string
+	// IncludeRevoked 包括已吊销的密钥
+	IncludeRevoked bool
+
+	Offset int
+	Limit  int
+}
+
+// APIKeyRepository API密钥仓储
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *entity.APIKey) error
+	Get(ctx context.Context, id string) (*entity.APIKey, error)
+	// GetByHash 按密钥摘要查询
+	GetByHash(ctx context.Context, hash string) (*entity.APIKey, error)
+	// Find 按创建时间倒序查询
+	Find(ctx context.Context, query APIKeyQuery) ([]entity.APIKey, error)
+	Count(ctx context.Context, query APIKeyQuery) (int64, error)
+	// Update 更新指定列
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+}
+
+// RefreshTokenQuery 刷新令牌查询条件，UserID和FamilyID至少指定一个
+type RefreshTokenQuery struct {
+	UserID   string
+	FamilyID string
+	// CreatedAfter 只包括该时间之后签发的令牌，为零值时不限制
+	CreatedAfter time.Time
+}
+
+// RefreshTokenRepository 刷新令牌仓储
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *entity.RefreshToken) error
+	// GetByHash 按令牌摘要查询
+	GetByHash(ctx context.Context, hash string) (*entity.RefreshToken, error)
+	// MarkUsed 将未使用且未吊销的令牌标记为已使用，返回是否标记成功；
+	// 并发刷新时只有一个请求成功，其余视为重复使用
+	MarkUsed(ctx context.Context, id string, usedAt time.Time) (bool, error)
+	// Find 按签发时间倒序查询，包括已使用和已吊销的令牌
+	Find(ctx context.Context, query RefreshTokenQuery) ([]entity.RefreshToken, error)
+	// Revoke 吊销匹配的未吊销令牌，返回吊销的数量
+	Revoke(ctx context.Context, query RefreshTokenQuery, revokedAt time.Time) (int64, error)
+	// DeleteExpired 删除before之前过期的令牌，返回删除的数量
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RevokedTokenRepository 访问令牌吊销列表仓储，ID为令牌的jti
+type RevokedTokenRepository interface {
+	// Save 保存吊销记录，已存在时覆盖
+	Save(ctx context.Context, token *entity.RevokedToken) error
+	Get(ctx context.Context, id string) (*entity.RevokedToken, error)
+	// DeleteExpired 删除before之前过期的记录，返回删除的数量
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
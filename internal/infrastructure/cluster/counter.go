@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Incr 共享计数器加一并返回新值
+func (n *Node) Incr(ctx context.Context, name string) (int64, error) {
+	return n.client.Incr(ctx, key("counter", name)).Result()
+}
+
+// WindowLimit 滑动窗口内允许的最大次数
+type WindowLimit struct {
+	Window time.Duration
+	Limit  int
+}
+
+// WindowUsage 滑动窗口的使用情况
+type WindowUsage struct {
+	// Count 窗口内的次数，允许时包含本次
+	Count int
+	// Wait 允许时为窗口内最早一次移出窗口的剩余时间；超限时为再次允许前需要等待的时间
+	Wait time.Duration
+}
+
+// slidingWindowScript 检查全部窗口，都未超限时在每个窗口记录本次请求。
+// 每个窗口是一个有序集合，成员的分值为请求时间（毫秒），返回是否允许以及各窗口的次数和关键时间
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+local allowed = 1
+local result = {}
+
+for i, k in ipairs(KEYS) do
+	local window = tonumber(ARGV[1 + i * 2])
+	local limit = tonumber(ARGV[2 + i * 2])
+	redis.call("ZREMRANGEBYSCORE", k, "-inf", now - window)
+	local count = redis.call("ZCARD", k)
+	local index = 0
+	if count >= limit then
+		allowed = 0
+		index = count - limit
+	end
+	local pivot = redis.call("ZRANGE", k, index, index, "WITHSCORES")
+	local score = now
+	if pivot[2] then
+		score = tonumber(pivot[2])
+	end
+	result[#result + 1] = count
+	result[#result + 1] = score
+end
+
+if allowed == 1 then
+	for i, k in ipairs(KEYS) do
+		local window = tonumber(ARGV[1 + i * 2])
+		redis.call("ZADD", k, now, member)
+		redis.call("PEXPIRE", k, window)
+		result[i * 2 - 1] = result[i * 2 - 1] + 1
+	end
+end
+
+table.insert(result, 1, allowed)
+return result
+`)
+
+// TakeSlidingWindow 在所有副本共享的滑动窗口中记录一次请求，任一窗口超限时不记录并返回false。
+// 被拒绝的请求不计入窗口，usage与limits一一对应
+func (n *Node) TakeSlidingWindow(ctx context.Context, name string, limits []WindowLimit) (bool, []WindowUsage, error) {
+	now := time.Now().UnixMilli()
+	keys := make([]string, len(limits))
+	args := []interface{}{now, uuid.New().String()}
+	for i, limit := range limits {
+		window := limit.Window.Milliseconds()
+		keys[i] = key("window", name, strconv.FormatInt(window, 10))
+		args = append(args, window, limit.Limit)
+	}
+
+	values, err := slidingWindowScript.Run(ctx, n.client, keys, args...).Int64Slice()
+	if err != nil {
+		return false, nil, err
+	}
+
+	allowed := values[0] == 1
+	usage := make([]WindowUsage, len(limits))
+	for i, limit := range limits {
+		count, score := values[1+i*2], values[2+i*2]
+		wait := time.Duration(score+limit.Window.Milliseconds()-now) * time.Millisecond
+		if wait < 0 {
+			wait = 0
+		}
+		usage[i] = WindowUsage{Count: int(count), Wait: wait}
+	}
+	return allowed, usage, nil
+}
+
+// ClearSlidingWindow 清空共享滑动窗口中的记录，windows与记录时的窗口一致
+func (n *Node) ClearSlidingWindow(ctx context.Context, name string, windows ...time.Duration) error {
+	keys := make([]string, len(windows))
+	for i, window := range windows {
+		keys[i] = key("window", name, strconv.FormatInt(window.Milliseconds(), 10))
+	}
+	return n.client.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,84 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTakeSlidingWindow(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	ctx := context.Background()
+	name := testName(t)
+
+	limits := []WindowLimit{
+		{Window: 500 * time.Millisecond, Limit: 2},
+		{Window: time.Minute, Limit: 3},
+	}
+	t.Cleanup(func() {
+		a.ClearSlidingWindow(context.Background(), name, time.Minute, 500*time.Millisecond)
+	})
+
+	take := func(node *Node) (bool, []WindowUsage) {
+		t.Helper()
+		allowed, usage, err := node.TakeSlidingWindow(ctx, name, limits)
+		if err != nil {
+			t.Fatalf("TakeSlidingWindow: %v", err)
+		}
+		if len(usage) != len(limits) {
+			t.Fatalf("len(usage) = %d, want %d", len(usage), len(limits))
+		}
+		return allowed, usage
+	}
+
+	// 两个节点共享同一个窗口
+	for i, node := range []*Node{a, b} {
+		allowed, usage := take(node)
+		if !allowed {
+			t.Fatalf("request %d denied", i+1)
+		}
+		if usage[0].Count != i+1 || usage[1].Count != i+1 {
+			t.Fatalf("request %d counts = %d, %d; want %d", i+1, usage[0].Count, usage[1].Count, i+1)
+		}
+	}
+
+	// 短窗口超限，被拒绝的请求不计入任何窗口
+	for i := 0; i < 2; i++ {
+		allowed, usage := take(a)
+		if allowed {
+			t.Fatal("request over the short window limit allowed")
+		}
+		if usage[0].Count != 2 || usage[1].Count != 2 {
+			t.Fatalf("denied counts = %d, %d; want 2, 2", usage[0].Count, usage[1].Count)
+		}
+		if usage[0].Wait <= 0 || usage[0].Wait > 500*time.Millisecond {
+			t.Fatalf("denied wait = %v, want within the short window", usage[0].Wait)
+		}
+	}
+
+	// 短窗口滑过之后再次允许，但长窗口随即达到上限
+	time.Sleep(600 * time.Millisecond)
+	allowed, usage := take(b)
+	if !allowed {
+		t.Fatal("request after the short window passed denied")
+	}
+	if usage[0].Count != 1 || usage[1].Count != 3 {
+		t.Fatalf("counts = %d, %d; want 1, 3", usage[0].Count, usage[1].Count)
+	}
+
+	allowed, usage = take(a)
+	if allowed {
+		t.Fatal("request over the long window limit allowed")
+	}
+	if usage[1].Wait <= 500*time.Millisecond || usage[1].Wait > time.Minute {
+		t.Fatalf("long window wait = %v, want until the oldest request leaves the window", usage[1].Wait)
+	}
+
+	if err := a.ClearSlidingWindow(ctx, name, 500*time.Millisecond, time.Minute); err != nil {
+		t.Fatalf("ClearSlidingWindow: %v", err)
+	}
+	if allowed, usage := take(a); !allowed || usage[1].Count != 1 {
+		t.Fatalf("after clear = %v, count %d; want allowed, 1", allowed, usage[1].Count)
+	}
+}
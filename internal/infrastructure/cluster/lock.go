@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// refreshScript 仅当锁仍由当前节点持有时续期
+var refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript 仅当锁仍由当前节点持有时释放
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Lock 分布式锁，值为持有者的节点ID，持有者需在过期前调用Refresh续期，
+// 持有者宕机后锁自然过期，其他节点即可获取
+type Lock struct {
+	node *Node
+	name string
+	key  string
+	ttl  time.Duration
+}
+
+// NewLock 创建分布式锁
+func (n *Node) NewLock(name string, ttl time.Duration) *Lock {
+	return &Lock{
+		node: n,
+		name: name,
+		key:  key("lock", name),
+		ttl:  ttl,
+	}
+}
+
+// TryAcquire 尝试获取锁，已由当前节点持有时视为获取成功并续期
+func (l *Lock) TryAcquire(ctx context.Context) (bool, error) {
+	acquired, err := l.node.client.SetNX(ctx, l.key, l.node.id, l.ttl).Result()
+	if err != nil || acquired {
+		return acquired, err
+	}
+	return l.Refresh(ctx)
+}
+
+// Acquire 等待直到获取锁，ctx取消时返回错误
+func (l *Lock) Acquire(ctx context.Context, retry time.Duration) error {
+	for {
+		acquired, err := l.TryAcquire(ctx)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// Refresh 续期，返回锁是否仍由当前节点持有
+func (l *Lock) Refresh(ctx context.Context) (bool, error) {
+	result, err := refreshScript.Run(ctx, l.node.client, []string{l.key}, l.node.id, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// Release 释放锁，锁已被其他节点持有时不做处理
+func (l *Lock) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, l.node.client, []string{l.key}, l.node.id).Err()
+}
+
+// Owner 锁的当前持有者节点ID，未被持有时返回空字符串
+func (l *Lock) Owner(ctx context.Context) (string, error) {
+	return l.node.LockOwner(ctx, l.name)
+}
+
+// LockOwner 指定名称的锁的当前持有者节点ID，未被持有时返回空字符串
+func (n *Node) LockOwner(ctx context.Context, name string) (string, error) {
+	owner, err := n.client.Get(ctx, key("lock", name)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return owner, err
+}
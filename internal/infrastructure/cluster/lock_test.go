@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockAcquireRefreshRelease(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	ctx := context.Background()
+	name := testName(t)
+
+	lockA := a.NewLock(name, time.Minute)
+	lockB := b.NewLock(name, time.Minute)
+	t.Cleanup(func() {
+		lockA.Release(context.Background())
+		lockB.Release(context.Background())
+	})
+
+	if acquired, err := lockA.TryAcquire(ctx); err != nil || !acquired {
+		t.Fatalf("a.TryAcquire = %v, %v; want true", acquired, err)
+	}
+	if acquired, err := lockB.TryAcquire(ctx); err != nil || acquired {
+		t.Fatalf("b.TryAcquire while held by a = %v, %v; want false", acquired, err)
+	}
+	// 持有者再次获取视为续期
+	if acquired, err := lockA.TryAcquire(ctx); err != nil || !acquired {
+		t.Fatalf("a.TryAcquire while holding = %v, %v; want true", acquired, err)
+	}
+	if held, err := lockA.Refresh(ctx); err != nil || !held {
+		t.Fatalf("a.Refresh = %v, %v; want true", held, err)
+	}
+	if held, err := lockB.Refresh(ctx); err != nil || held {
+		t.Fatalf("b.Refresh = %v, %v; want false", held, err)
+	}
+
+	if owner, err := b.LockOwner(ctx, name); err != nil || owner != a.ID() {
+		t.Fatalf("LockOwner = %q, %v; want %q", owner, err, a.ID())
+	}
+
+	// 非持有者释放不影响锁
+	if err := lockB.Release(ctx); err != nil {
+		t.Fatalf("b.Release: %v", err)
+	}
+	if owner, err := lockB.Owner(ctx); err != nil || owner != a.ID() {
+		t.Fatalf("Owner after b.Release = %q, %v; want %q", owner, err, a.ID())
+	}
+
+	if err := lockA.Release(ctx); err != nil {
+		t.Fatalf("a.Release: %v", err)
+	}
+	if owner, err := lockA.Owner(ctx); err != nil || owner != "" {
+		t.Fatalf("Owner after a.Release = %q, %v; want empty", owner, err)
+	}
+	if acquired, err := lockB.TryAcquire(ctx); err != nil || !acquired {
+		t.Fatalf("b.TryAcquire after release = %v, %v; want true", acquired, err)
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	ctx := context.Background()
+	name := testName(t)
+
+	lockA := a.NewLock(name, 200*time.Millisecond)
+	lockB := b.NewLock(name, time.Minute)
+	t.Cleanup(func() {
+		lockB.Release(context.Background())
+	})
+
+	if acquired, err := lockA.TryAcquire(ctx); err != nil || !acquired {
+		t.Fatalf("a.TryAcquire = %v, %v; want true", acquired, err)
+	}
+
+	// 持有者未续期，锁过期后其他节点可以获取
+	acquired := waitFor(t, 2*time.Second, func() bool {
+		acquired, err := lockB.TryAcquire(ctx)
+		return err == nil && acquired
+	})
+	if !acquired {
+		t.Fatal("b could not acquire the lock after it expired")
+	}
+	if held, err := lockA.Refresh(ctx); err != nil || held {
+		t.Fatalf("a.Refresh after takeover = %v, %v; want false", held, err)
+	}
+}
+
+func TestLockAcquireWaits(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	name := testName(t)
+
+	lockA := a.NewLock(name, time.Minute)
+	lockB := b.NewLock(name, time.Minute)
+	t.Cleanup(func() {
+		lockA.Release(context.Background())
+		lockB.Release(context.Background())
+	})
+
+	if acquired, err := lockA.TryAcquire(context.Background()); err != nil || !acquired {
+		t.Fatalf("a.TryAcquire = %v, %v; want true", acquired, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := lockB.Acquire(ctx, 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("b.Acquire while held = %v, want deadline exceeded", err)
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() {
+		lockA.Release(context.Background())
+	})
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := lockB.Acquire(ctx, 20*time.Millisecond); err != nil {
+		t.Fatalf("b.Acquire after release: %v", err)
+	}
+	if owner, err := a.LockOwner(context.Background(), name); err != nil || owner != b.ID() {
+		t.Fatalf("LockOwner = %q, %v; want %q", owner, err, b.ID())
+	}
+}
@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// keyPrefix 所有Redis键的前缀，多个部署共用一个Redis时可通过不同的database隔离
+const keyPrefix = "mjp:"
+
+// nodeTTL 节点存活标记的有效期，节点每 nodeTTL/3 续期一次
+const nodeTTL = 30 * time.Second
+
+// Node 当前副本在集群中的节点，基于Redis提供分布式锁、共享队列、计数器和消息广播，
+// 多个副本连接同一个Redis即组成集群
+type Node struct {
+	id     string
+	client *redis.Client
+	logger logger.Logger
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// Connect 连接Redis并创建当前节点
+func Connect(cfg config.RedisConfig, logger logger.Logger) (*Node, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.Database,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &Node{
+		id:     NewNodeID(),
+		client: client,
+		logger: logger,
+		stopCh: make(chan struct{}),
+	}, nil
+}
+
+// NewNodeID 生成节点ID：主机名加随机后缀，同一主机上的多个副本也不会重复
+func NewNodeID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "node"
+	}
+	return hostname + "-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:8]
+}
+
+// ID 当前节点ID
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Client Redis客户端
+func (n *Node) Client() *redis.Client {
+	return n.client
+}
+
+// key 拼接带前缀的Redis键
+func key(parts ...string) string {
+	return keyPrefix + strings.Join(parts, ":")
+}
+
+// Start 开始定期续期节点存活标记
+func (n *Node) Start() {
+	n.touch()
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		ticker := time.NewTicker(nodeTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-n.stopCh:
+				return
+			case <-ticker.C:
+				n.touch()
+			}
+		}
+	}()
+}
+
+// touch 续期节点存活标记
+func (n *Node) touch() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := n.client.Set(ctx, key("node", n.id), time.Now().Unix(), nodeTTL).Err(); err != nil {
+		n.logger.Warnf("Failed to refresh cluster node %s: %v", n.id, err)
+	}
+}
+
+// IsAlive 节点是否存活
+func (n *Node) IsAlive(ctx context.Context, id string) (bool, error) {
+	if id == n.id {
+		return true, nil
+	}
+
+	count, err := n.client.Exists(ctx, key("node", id)).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Close 移除存活标记并关闭Redis连接
+func (n *Node) Close() error {
+	n.once.Do(func() {
+		close(n.stopCh)
+	})
+	n.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n.client.Del(ctx, key("node", n.id))
+
+	return n.client.Close()
+}
@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// newTestNode 连接REDIS_ADDR指定的Redis创建节点，未设置时跳过测试
+func newTestNode(t *testing.T) *Node {
+	t.Helper()
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("invalid REDIS_ADDR %q: %v", addr, err)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		t.Fatalf("invalid REDIS_ADDR %q: %v", addr, err)
+	}
+
+	node, err := Connect(config.RedisConfig{
+		Host:     host,
+		Port:     port,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	}, logger.New("error", "text"))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() {
+		node.Close()
+	})
+	return node
+}
+
+// testName 每个测试使用不同的键，避免与其他测试或残留数据冲突
+func testName(t *testing.T) string {
+	return "test:" + t.Name() + ":" + uuid.New().String()
+}
+
+func TestNodeIsAlive(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	ctx := context.Background()
+
+	alive, err := b.IsAlive(ctx, a.ID())
+	if err != nil || alive {
+		t.Fatalf("IsAlive before Start = %v, %v; want false", alive, err)
+	}
+
+	a.Start()
+	alive, err = b.IsAlive(ctx, a.ID())
+	if err != nil || !alive {
+		t.Fatalf("IsAlive after Start = %v, %v; want true", alive, err)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	alive, err = b.IsAlive(ctx, a.ID())
+	if err != nil || alive {
+		t.Fatalf("IsAlive after Close = %v, %v; want false", alive, err)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	ctx := context.Background()
+	name := testName(t)
+	t.Cleanup(func() {
+		a.client.Del(context.Background(), key("counter", name))
+	})
+
+	for i, node := range []*Node{a, b, a} {
+		value, err := node.Incr(ctx, name)
+		if err != nil {
+			t.Fatalf("Incr: %v", err)
+		}
+		if value != int64(i+1) {
+			t.Fatalf("Incr #%d = %d, want %d", i+1, value, i+1)
+		}
+	}
+}
+
+// waitFor 在timeout内等待条件成立
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) bool {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return condition()
+}
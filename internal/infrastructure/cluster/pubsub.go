@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// envelope 广播消息，携带发送节点ID，订阅方据此跳过自己发出的消息
+type envelope struct {
+	Node string          `json:"node"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Publish 向所有节点广播消息，data按JSON编码
+func (n *Node) Publish(ctx context.Context, channel string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(envelope{Node: n.id, Data: raw})
+	if err != nil {
+		return err
+	}
+
+	return n.client.Publish(ctx, key("channel", channel), payload).Err()
+}
+
+// Subscribe 订阅广播，其他节点发出的消息交给handler处理，直到节点关闭。
+// 连接断开时go-redis会自动重连，期间的消息会丢失
+func (n *Node) Subscribe(channel string, handler func(data json.RawMessage)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := n.client.Subscribe(ctx, key("channel", channel))
+
+	// 等待订阅确认，确保返回后发出的消息都能收到
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		cancel()
+		return err
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer cancel()
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-n.stopCh:
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var env envelope
+				if err := json.Unmarshal([]byte(message.Payload), &env); err != nil {
+					n.logger.Warnf("Failed to decode cluster message on %s: %v", channel, err)
+					continue
+				}
+				if env.Node == n.id {
+					continue
+				}
+				handler(env.Data)
+			}
+		}
+	}()
+
+	return nil
+}
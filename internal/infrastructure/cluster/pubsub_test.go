@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type testMessage struct {
+	Value string `json:"value"`
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	channel := testName(t)
+
+	received := make(chan testMessage, 10)
+	subscribe := func(node *Node) {
+		err := node.Subscribe(channel, func(data json.RawMessage) {
+			var message testMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				t.Errorf("decode: %v", err)
+				return
+			}
+			received <- message
+		})
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+	subscribe(a)
+	subscribe(b)
+
+	// 发送节点自己的订阅收不到，只有b收到
+	if err := a.Publish(context.Background(), channel, testMessage{Value: "hello"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	select {
+	case message := <-received:
+		if message.Value != "hello" {
+			t.Fatalf("received %q, want hello", message.Value)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("subscriber did not receive the message")
+	}
+
+	select {
+	case message := <-received:
+		t.Fatalf("publisher received its own message %q", message.Value)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSubscribeStopsOnClose(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	channel := testName(t)
+
+	received := make(chan struct{}, 10)
+	if err := b.Subscribe(channel, func(json.RawMessage) {
+		received <- struct{}{}
+	}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	// Close等待订阅协程退出
+	done := make(chan struct{})
+	go func() {
+		b.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Close did not stop the subscription")
+	}
+
+	if err := a.Publish(context.Background(), channel, testMessage{Value: "late"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case <-received:
+		t.Fatal("closed node received a message")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Push 追加到共享队列末尾
+func (n *Node) Push(ctx context.Context, queue string, value string) error {
+	return n.client.RPush(ctx, key("queue", queue), value).Err()
+}
+
+// PushFront 放回共享队列头部，用于取出后无法处理的元素
+func (n *Node) PushFront(ctx context.Context, queue string, value string) error {
+	return n.client.LPush(ctx, key("queue", queue), value).Err()
+}
+
+// Pop 按queues的顺序从第一个非空队列取出一个元素，全部为空时最多等待timeout，
+// 超时返回空的队列名
+func (n *Node) Pop(ctx context.Context, timeout time.Duration, queues ...string) (string, string, error) {
+	keys := make([]string, len(queues))
+	for i, queue := range queues {
+		keys[i] = key("queue", queue)
+	}
+
+	result, err := n.client.BLPop(ctx, timeout, keys...).Result()
+	if err == redis.Nil {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	for i, k := range keys {
+		if k == result[0] {
+			return queues[i], result[1], nil
+		}
+	}
+	return "", "", nil
+}
+
+// QueueLen 共享队列长度
+func (n *Node) QueueLen(ctx context.Context, queue string) (int64, error) {
+	return n.client.LLen(ctx, key("queue", queue)).Result()
+}
+
+// RemoveFromQueue 从共享队列中移除元素，返回是否移除
+func (n *Node) RemoveFromQueue(ctx context.Context, queue string, value string) (bool, error) {
+	removed, err := n.client.LRem(ctx, key("queue", queue), 0, value).Result()
+	return removed > 0, err
+}
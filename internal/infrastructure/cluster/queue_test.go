@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// cleanupQueues 测试结束时删除队列
+func cleanupQueues(t *testing.T, node *Node, queues ...string) {
+	t.Cleanup(func() {
+		for _, queue := range queues {
+			node.client.Del(context.Background(), key("queue", queue))
+		}
+	})
+}
+
+func TestQueuePopOrder(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	ctx := context.Background()
+	first, second := testName(t), testName(t)
+	cleanupQueues(t, a, first, second)
+
+	for _, item := range []struct{ queue, value string }{
+		{second, "s1"},
+		{first, "f1"},
+		{first, "f2"},
+	} {
+		if err := a.Push(ctx, item.queue, item.value); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+	if err := a.PushFront(ctx, first, "f0"); err != nil {
+		t.Fatalf("PushFront: %v", err)
+	}
+	if length, err := b.QueueLen(ctx, first); err != nil || length != 3 {
+		t.Fatalf("QueueLen = %d, %v; want 3", length, err)
+	}
+
+	// 按队列顺序取出，前面的队列非空时不取后面的队列
+	want := []struct{ queue, value string }{
+		{first, "f0"},
+		{first, "f1"},
+		{first, "f2"},
+		{second, "s1"},
+	}
+	for _, w := range want {
+		queue, value, err := b.Pop(ctx, time.Second, first, second)
+		if err != nil {
+			t.Fatalf("Pop: %v", err)
+		}
+		if queue != w.queue || value != w.value {
+			t.Fatalf("Pop = %q, %q; want %q, %q", queue, value, w.queue, w.value)
+		}
+	}
+
+	queue, value, err := b.Pop(ctx, time.Second, first, second)
+	if err != nil || queue != "" || value != "" {
+		t.Fatalf("Pop on empty queues = %q, %q, %v; want timeout", queue, value, err)
+	}
+}
+
+func TestQueueHandoff(t *testing.T) {
+	a := newTestNode(t)
+	b := newTestNode(t)
+	queue := testName(t)
+	cleanupQueues(t, a, queue)
+
+	type popped struct {
+		queue, value string
+		err          error
+	}
+	result := make(chan popped, 1)
+	go func() {
+		queue, value, err := b.Pop(context.Background(), 5*time.Second, queue)
+		result <- popped{queue, value, err}
+	}()
+
+	// 等待的节点在其他节点写入后立即取到
+	time.Sleep(100 * time.Millisecond)
+	if err := a.Push(context.Background(), queue, "task-1"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	select {
+	case r := <-result:
+		if r.err != nil || r.queue != queue || r.value != "task-1" {
+			t.Fatalf("Pop = %q, %q, %v; want %q, task-1", r.queue, r.value, r.err, queue)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Pop did not receive the pushed value")
+	}
+}
+
+func TestRemoveFromQueue(t *testing.T) {
+	a := newTestNode(t)
+	ctx := context.Background()
+	queue := testName(t)
+	cleanupQueues(t, a, queue)
+
+	for _, value := range []string{"t1", "t2", "t3"} {
+		if err := a.Push(ctx, queue, value); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+
+	if removed, err := a.RemoveFromQueue(ctx, queue, "t2"); err != nil || !removed {
+		t.Fatalf("RemoveFromQueue(t2) = %v, %v; want true", removed, err)
+	}
+	if removed, err := a.RemoveFromQueue(ctx, queue, "t2"); err != nil || removed {
+		t.Fatalf("RemoveFromQueue(t2) again = %v, %v; want false", removed, err)
+	}
+	if length, err := a.QueueLen(ctx, queue); err != nil || length != 2 {
+		t.Fatalf("QueueLen = %d, %v; want 2", length, err)
+	}
+}
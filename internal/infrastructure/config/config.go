@@ -13,10 +13,14 @@ type Config struct {
 	Log         LogConfig         `mapstructure:"log"`
 	Database    DatabaseConfig    `mapstructure:"database"`
 	Redis       RedisConfig       `mapstructure:"redis"`
+	Leader      LeaderConfig      `mapstructure:"leader"`
 	Discord     DiscordConfig     `mapstructure:"discord"`
 	Translate   TranslateConfig   `mapstructure:"translate"`
+	BannedWords BannedWordConfig  `mapstructure:"banned_words"`
 	FaceSwap    FaceSwapConfig    `mapstructure:"face_swap"`
 	Storage     StorageConfig     `mapstructure:"storage"`
+	ImageProxy  ImageProxyConfig  `mapstructure:"image_proxy"`
+	Fetch       FetchConfig       `mapstructure:"fetch"`
 	RateLimit   RateLimitConfig   `mapstructure:"rate_limiting"`
 	Security    SecurityConfig    `mapstructure:"security"`
 	Notification NotificationConfig `mapstructure:"notification"`
@@ -49,6 +53,9 @@ type DatabaseConfig struct {
 	MySQL    MySQLConfig    `mapstructure:"mysql"`
 	Postgres PostgresConfig `mapstructure:"postgres"`
 	MongoDB  MongoDBConfig  `mapstructure:"mongodb"`
+
+	// SkipMigrate 启动时不自动执行迁移，改为通过 migrate 子命令执行
+	SkipMigrate bool `mapstructure:"skip_migrate"`
 }
 
 // SQLiteConfig SQLite配置
@@ -91,11 +98,19 @@ type RedisConfig struct {
 	Database int    `mapstructure:"database"`
 }
 
+// LeaderConfig 多副本选举配置，每日计数重置、任务超时检查、存储清理等定时任务只在选出的节点上执行
+type LeaderConfig struct {
+	Backend      string `mapstructure:"backend"`       // database, redis，为空时启用Redis则使用redis，否则使用database
+	LeaseSeconds int    `mapstructure:"lease_seconds"` // 租约有效期，持有者每 1/3 有效期续期一次
+}
+
 // DiscordConfig Discord配置
 type DiscordConfig struct {
 	Accounts   []DiscordAccount   `mapstructure:"accounts"`
 	Proxy      ProxyConfig        `mapstructure:"proxy"`
 	NgDiscord  NgDiscordConfig    `mapstructure:"ng_discord"`
+	// AccountSelectMode 账号选择模式：BestWaitIdle、Random、Weight、Polling，为空时使用BestWaitIdle
+	AccountSelectMode string `mapstructure:"account_select_mode"`
 }
 
 // DiscordAccount Discord账号配置
@@ -114,6 +129,7 @@ type DiscordAccount struct {
 	TimeoutMinutes       int    `mapstructure:"timeout_minutes"`
 	Interval             float64 `mapstructure:"interval"`
 	Weight               int    `mapstructure:"weight"`
+	Sort                 int    `mapstructure:"sort"`
 	WorkTime             string `mapstructure:"work_time"`
 	FishingTime          string `mapstructure:"fishing_time"`
 	DayDrawLimit         int    `mapstructure:"day_draw_limit"`
@@ -146,6 +162,12 @@ type TranslateConfig struct {
 	OpenAI OpenAIConfig   `mapstructure:"openai"`
 }
 
+// BannedWordConfig 禁用词检查配置
+type BannedWordConfig struct {
+	Enabled         bool `mapstructure:"enabled"`          // 提交时检查禁用词
+	CheckTranslated bool `mapstructure:"check_translated"` // 同时检查翻译后的提示词
+}
+
 // BaiduConfig 百度翻译配置
 type BaiduConfig struct {
 	AppID     string `mapstructure:"app_id"`
@@ -170,13 +192,47 @@ type FaceSwapConfig struct {
 	QueueSize      int   `mapstructure:"queue_size"`
 	TimeoutMinutes int   `mapstructure:"timeout_minutes"`
 	MaxFileSize    int64 `mapstructure:"max_file_size"`
+
+	BaseURL      string `mapstructure:"base_url"`      // Replicate兼容的服务地址，为空时使用Replicate
+	Version      string `mapstructure:"version"`       // 模型版本
+	SourceField  string `mapstructure:"source_field"`  // 人脸图片的输入字段名
+	TargetField  string `mapstructure:"target_field"`  // 目标图片的输入字段名
+	PollInterval int    `mapstructure:"poll_interval"` // 查询状态间隔（秒）
+
+	Video VideoFaceSwapConfig `mapstructure:"video"`
+}
+
+// VideoFaceSwapConfig 视频换脸配置，服务地址、Token和查询间隔沿用图片换脸
+type VideoFaceSwapConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	CoreSize       int    `mapstructure:"core_size"`
+	QueueSize      int    `mapstructure:"queue_size"`
+	TimeoutMinutes int    `mapstructure:"timeout_minutes"`
+	MaxFileSize    int64  `mapstructure:"max_file_size"` // 目标视频大小上限（字节）
+	MaxDuration    int    `mapstructure:"max_duration"`  // 目标视频时长上限（秒）
+	Version        string `mapstructure:"version"`
+	SourceField    string `mapstructure:"source_field"`
+	TargetField    string `mapstructure:"target_field"`
 }
 
 // StorageConfig 存储配置
 type StorageConfig struct {
-	Type  string      `mapstructure:"type"`
-	Local LocalConfig `mapstructure:"local"`
-	OSS   OSSConfig   `mapstructure:"oss"`
+	Type      string          `mapstructure:"type"`
+	Local     LocalConfig     `mapstructure:"local"`
+	OSS       OSSConfig       `mapstructure:"oss"`
+	S3        S3Config        `mapstructure:"s3"`
+	Thumbnail ThumbnailConfig `mapstructure:"thumbnail"`
+	SplitGrid bool            `mapstructure:"split_grid"` // 默认将2x2网格结果切分为4张图片，可按请求覆盖
+	// RetentionDays 转存结果的保留天数，任务结束超过该天数后删除存储中的文件，0为永久保留
+	RetentionDays int `mapstructure:"retention_days"`
+}
+
+// ThumbnailConfig 缩略图配置
+type ThumbnailConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Sizes   []int  `mapstructure:"sizes"`   // 缩略图最长边像素，第一个尺寸作为ThumbnailURL
+	Format  string `mapstructure:"format"`  // jpeg, png
+	Quality int    `mapstructure:"quality"` // JPEG质量 1-100
 }
 
 // LocalConfig 本地存储配置
@@ -194,12 +250,52 @@ type OSSConfig struct {
 	CustomCDN       string `mapstructure:"custom_cdn"`
 }
 
+// ImageProxyConfig 图片代理配置
+type ImageProxyConfig struct {
+	PublicURL    string   `mapstructure:"public_url"`    // 对外访问地址，如 https://mj.example.com，为空时使用相对路径
+	CacheDir     string   `mapstructure:"cache_dir"`     // Discord图片的磁盘缓存目录
+	CacheSizeMB  int64    `mapstructure:"cache_size_mb"` // 磁盘缓存上限，超出后按最近最少使用淘汰
+	MaxAge       int      `mapstructure:"max_age"`       // Cache-Control max-age（秒）
+	AllowedHosts []string `mapstructure:"allowed_hosts"` // 除Discord CDN外允许下载的图片主机
+}
+
+// FetchConfig 远程文件下载配置（describe链接、垫图、换脸素材等）
+type FetchConfig struct {
+	Timeout             int   `mapstructure:"timeout"`               // 下载超时（秒）
+	MaxSizeMB           int64 `mapstructure:"max_size_mb"`           // 单个文件大小上限
+	MaxRedirects        int   `mapstructure:"max_redirects"`         // 最大重定向次数
+	AllowPrivateNetwork bool  `mapstructure:"allow_private_network"` // 是否允许访问内网地址，默认禁止以防SSRF
+}
+
+// S3Config S3兼容存储配置（AWS S3、MinIO、Cloudflare R2等）
+type S3Config struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	Region          string `mapstructure:"region"`
+	BucketName      string `mapstructure:"bucket_name"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	AccessKeySecret string `mapstructure:"access_key_secret"`
+	PathStyle       bool   `mapstructure:"path_style"`
+	CustomCDN       string `mapstructure:"custom_cdn"`
+}
+
 // RateLimitConfig 限流配置
 type RateLimitConfig struct {
 	Enabled   bool                            `mapstructure:"enabled"`
+	Backend   string                          `mapstructure:"backend"` // local, redis，为空时启用Redis则使用redis
 	Whitelist []string                        `mapstructure:"whitelist"`
 	Blacklist []string                        `mapstructure:"blacklist"`
 	Rules     map[string]map[string]int       `mapstructure:"rules"`
+	AutoBan   AutoBanConfig                   `mapstructure:"auto_ban"`
+}
+
+// AutoBanConfig 自动封禁配置：窗口内触发限流或提交禁用词达到次数的IP会被封禁，
+// 每次封禁依次使用更长的时长，白名单中的IP不会被封禁
+type AutoBanConfig struct {
+	Enabled          bool  `mapstructure:"enabled"`
+	WindowSeconds    int   `mapstructure:"window_seconds"`     // 统计窗口
+	RateLimitHits    int   `mapstructure:"rate_limit_hits"`    // 窗口内被限流（429）的次数，0表示不统计
+	BannedPromptHits int   `mapstructure:"banned_prompt_hits"` // 窗口内提交禁用词的次数，0表示不统计
+	DurationsMinutes []int `mapstructure:"durations_minutes"`  // 第N次封禁的时长，超出后沿用最后一个
 }
 
 // SecurityConfig 安全配置
@@ -207,13 +303,33 @@ type SecurityConfig struct {
 	AdminToken     string `mapstructure:"admin_token"`
 	UserToken      string `mapstructure:"user_token"`
 	JWTSecret      string `mapstructure:"jwt_secret"`
-	JWTExpireHours int    `mapstructure:"jwt_expire_hours"`
+
+	// AccessTokenMinutes 登录签发的访问令牌（JWT）有效期，默认15分钟，过期后使用刷新令牌换发
+	AccessTokenMinutes int `mapstructure:"access_token_minutes"`
+	// RefreshTokenDays 刷新令牌有效期，默认30天，每次刷新都换发新令牌并重新计算
+	RefreshTokenDays int `mapstructure:"refresh_token_days"`
+
+	// TrustedProxies 受信任的反向代理（IP或CIDR），只有直接连接的对端在列表中时才读取转发头
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+
+	// AllowedOrigins 允许跨域访问和建立任务WebSocket的来源（如 https://example.com），"*" 表示任意来源；
+	// 为空时跨域请求不受限制，WebSocket只接受同源连接
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+
+	// EncryptionKeyFile Discord账号密钥字段的加密密钥文件，环境变量 MJ_ENCRYPTION_KEYS 优先
+	EncryptionKeyFile string `mapstructure:"encryption_key_file"`
 }
 
 // NotificationConfig 通知配置
 type NotificationConfig struct {
-	Webhook string     `mapstructure:"webhook"`
-	SMTP    SMTPConfig `mapstructure:"smtp"`
+	Webhook             string     `mapstructure:"webhook"`
+	WebhookSecret       string     `mapstructure:"webhook_secret"`
+	Workers             int        `mapstructure:"workers"`
+	QueueSize           int        `mapstructure:"queue_size"`
+	MaxRetries          int        `mapstructure:"max_retries"`
+	AllowPrivateNetwork bool       `mapstructure:"allow_private_network"` // 是否允许回调内网地址，默认禁止以防SSRF
+	RetentionDays       int        `mapstructure:"retention_days"`        // 投递记录保留天数，0为永久保留
+	SMTP                SMTPConfig `mapstructure:"smtp"`
 }
 
 // SMTPConfig SMTP配置
@@ -249,6 +365,10 @@ func Load() (*Config, error) {
 	v.AutomaticEnv()
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
+	// 配置文件中未出现时默认开启的项
+	v.SetDefault("banned_words.enabled", true)
+	v.SetDefault("banned_words.check_translated", true)
+
 	// 读取配置文件
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -260,4 +380,26 @@ func Load() (*Config, error) {
 	}
 
 	return &config, nil
-}
\ No newline at end of file
+}
+// Secrets 配置中的密钥和口令，启动时登记到日志脱敏
+func (c *Config) Secrets() []string {
+	secrets := []string{
+		c.Database.MySQL.Password,
+		c.Database.Postgres.Password,
+		c.Redis.Password,
+		c.Translate.Baidu.AppSecret,
+		c.Translate.OpenAI.APIKey,
+		c.FaceSwap.Token,
+		c.Storage.OSS.AccessKeySecret,
+		c.Storage.S3.AccessKeySecret,
+		c.Security.AdminToken,
+		c.Security.UserToken,
+		c.Security.JWTSecret,
+		c.Notification.WebhookSecret,
+		c.Notification.SMTP.Password,
+	}
+	for _, account := range c.Discord.Accounts {
+		secrets = append(secrets, account.UserToken, account.BotToken)
+	}
+	return secrets
+}
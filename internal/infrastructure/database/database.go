@@ -1,23 +1,50 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"time"
+
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 	"gorm.io/driver/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
-	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
 	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/pkg/redact"
 )
 
-// New 创建数据库连接
+// Open 按配置的数据库类型创建数据仓储，SQL数据库未配置 skip_migrate 时会先执行未执行的迁移
+func Open(cfg config.DatabaseConfig) (*repository.Repositories, error) {
+	if cfg.Type == "mongodb" {
+		return NewMongoRepositories(cfg.MongoDB)
+	}
+
+	db, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.SkipMigrate {
+		if err := Migrate(db); err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	return NewGormRepositories(db), nil
+}
+
+// New 创建SQL数据库连接
 func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	var db *gorm.DB
 	var err error
 
 	switch cfg.Type {
 	case "sqlite":
-		db, err = gorm.Open(sqlite.Open(cfg.SQLite.Path), &gorm.Config{})
+		db, err = gorm.Open(sqlite.Open(cfg.SQLite.Path), gormConfig())
 	case "mysql":
 		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
 			cfg.MySQL.Username,
@@ -27,7 +54,7 @@ func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
 			cfg.MySQL.Database,
 			cfg.MySQL.Charset,
 		)
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(mysql.Open(dsn), gormConfig())
 	case "postgres":
 		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=Asia/Shanghai",
 			cfg.Postgres.Host,
@@ -37,7 +64,7 @@ func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
 			cfg.Postgres.Port,
 			cfg.Postgres.SSLMode,
 		)
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(postgres.Open(dsn), gormConfig())
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", cfg.Type)
 	}
@@ -49,15 +76,24 @@ func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	return db, nil
 }
 
-// Migrate 执行数据库迁移
+// gormConfig GORM配置，日志与GORM默认一致，但输出的SQL中账号Token等密钥替换为掩码
+func gormConfig() *gorm.Config {
+	return &gorm.Config{
+		Logger: gormlogger.New(log.New(redact.Writer(os.Stdout), "\r\n", log.LstdFlags), gormlogger.Config{
+			SlowThreshold: 200 * time.Millisecond,
+			LogLevel:      gormlogger.Warn,
+			Colorful:      true,
+		}),
+	}
+}
+
+// Migrate 执行全部未执行的数据库迁移
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&entity.User{},
-		&entity.Task{},
-		&entity.DiscordAccount{},
-		&entity.BannedWord{},
-		&entity.Setting{},
-		&entity.DomainTag{},
-		&entity.Message{},
-	)
-}
\ No newline at end of file
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up(context.Background())
+	return err
+}
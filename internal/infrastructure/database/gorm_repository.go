@@ -0,0 +1,628 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+)
+
+// NewGormRepositories 基于GORM创建数据仓储，适用于SQLite、MySQL和PostgreSQL
+func NewGormRepositories(db *gorm.DB) *repository.Repositories {
+	return &repository.Repositories{
+		Tasks:             &gormTaskRepository{gormStore[entity.Task]{db}},
+		Users:             &gormUserRepository{gormStore[entity.User]{db}},
+		Accounts:          &gormAccountRepository{gormStore[entity.DiscordAccount]{db}},
+		BannedWords:       &gormBannedWordRepository{gormStore[entity.BannedWord]{db}},
+		Settings:          &gormSettingRepository{gormStore[entity.Setting]{db}},
+		SettingChanges:    &gormSettingChangeRepository{gormStore[entity.SettingChange]{db}},
+		DomainTags:        &gormDomainTagRepository{gormStore[entity.DomainTag]{db}},
+		Messages:          &gormMessageRepository{gormStore[entity.Message]{db}},
+		WebhookDeliveries: &gormWebhookDeliveryRepository{gormStore[entity.WebhookDelivery]{db}},
+		Leases:            &gormLeaseRepository{gormStore[entity.Lease]{db}},
+		JobRuns:           &gormJobRunRepository{gormStore[entity.JobRun]{db}},
+		IPBans:            &gormIPBanRepository{gormStore[entity.IPBan]{db}},
+		AuditLogs:         &gormAuditLogRepository{gormStore[entity.AuditLog]{db}},
+		APIKeys:           &gormAPIKeyRepository{gormStore[entity.APIKey]{db}},
+		RefreshTokens:     &gormRefreshTokenRepository{gormStore[entity.RefreshToken]{db}},
+		RevokedTokens:     &gormRevokedTokenRepository{gormStore[entity.RevokedToken]{db}},
+		Close: func() error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.Close()
+		},
+	}
+}
+
+// gormStore 按主键id读写单个实体的通用实现
+type gormStore[T any] struct {
+	db *gorm.DB
+}
+
+func (s gormStore[T]) Create(ctx context.Context, value *T) error {
+	return s.db.WithContext(ctx).Create(value).Error
+}
+
+func (s gormStore[T]) Save(ctx context.Context, value *T) error {
+	return s.db.WithContext(ctx).Save(value).Error
+}
+
+func (s gormStore[T]) Get(ctx context.Context, id string) (*T, error) {
+	return s.first(ctx, "id = ?", id)
+}
+
+func (s gormStore[T]) Delete(ctx context.Context, id string) error {
+	var value T
+	return s.db.WithContext(ctx).Where("id = ?", id).Delete(&value).Error
+}
+
+// first 查询第一条记录，不存在时返回 repository.ErrNotFound
+func (s gormStore[T]) first(ctx context.Context, query interface{}, args ...interface{}) (*T, error) {
+	var value T
+	if err := s.db.WithContext(ctx).Where(query, args...).First(&value).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	return &value, nil
+}
+
+// page 应用分页
+func page(db *gorm.DB, offset, limit int) *gorm.DB {
+	if offset > 0 {
+		db = db.Offset(offset)
+	}
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	return db
+}
+
+type gormTaskRepository struct {
+	gormStore[entity.Task]
+}
+
+// taskSortColumns 任务排序方式对应的排序子句
+var taskSortColumns = map[repository.TaskSort]string{
+	repository.SortCreatedDesc: "created_at DESC",
+	repository.SortSubmitAsc:   "submit_time ASC",
+	repository.SortFinishAsc:   "finish_time ASC",
+	repository.SortIDAsc:       "id ASC",
+}
+
+func (r *gormTaskRepository) where(ctx context.Context, q repository.TaskQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.Task{})
+	if len(q.IDs) > 0 {
+		db = db.Where("id IN ?", q.IDs)
+	}
+	if q.UserID != "" {
+		db = db.Where("user_id = ?", q.UserID)
+	}
+	if q.InstanceID != "" {
+		db = db.Where("instance_id = ?", q.InstanceID)
+	}
+	if len(q.Statuses) > 0 {
+		db = db.Where("status IN ?", q.Statuses)
+	}
+	if len(q.ExcludeActions) > 0 {
+		db = db.Where("action NOT IN ?", q.ExcludeActions)
+	}
+	if q.FailReason != "" {
+		db = db.Where("fail_reason LIKE ?", "%"+q.FailReason+"%")
+	}
+	if q.FinishedFrom != nil {
+		db = db.Where("finish_time >= ?", q.FinishedFrom)
+	}
+	if q.FinishedTo != nil {
+		db = db.Where("finish_time <= ?", q.FinishedTo)
+	}
+	if q.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", q.CreatedFrom)
+	}
+	if q.MissingThumbnail {
+		db = db.Where("image_url <> '' AND (thumbnail_url IS NULL OR thumbnail_url = '')")
+	}
+	if q.Stored {
+		db = db.Where("url <> '' AND (image_url <> url OR thumbnail_url <> '')")
+	}
+	if q.AfterID != "" {
+		db = db.Where("id > ?", q.AfterID)
+	}
+	return db
+}
+
+func (r *gormTaskRepository) Find(ctx context.Context, q repository.TaskQuery) ([]entity.Task, error) {
+	var tasks []entity.Task
+	err := page(r.where(ctx, q).Order(taskSortColumns[q.Sort]), q.Offset, q.Limit).Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *gormTaskRepository) Count(ctx context.Context, q repository.TaskQuery) (int64, error) {
+	var total int64
+	err := r.where(ctx, q).Count(&total).Error
+	return total, err
+}
+
+func (r *gormTaskRepository) SaveIfUnfinished(ctx context.Context, task *entity.Task) (bool, error) {
+	result := r.db.WithContext(ctx).Model(task).
+		Where("status IN ?", entity.UnfinishedTaskStatuses).
+		Select("*").
+		Omit("created_at").
+		Updates(task)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *gormTaskRepository) SaveIfStatus(ctx context.Context, task *entity.Task, status entity.TaskStatus) (bool, error) {
+	result := r.db.WithContext(ctx).Model(task).
+		Where("status = ?", status).
+		Select("*").
+		Omit("created_at").
+		Updates(task)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *gormTaskRepository) UpdateIfUnfinished(ctx context.Context, id string, fields map[string]interface{}) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&entity.Task{}).
+		Where("id = ? AND status IN ?", id, entity.UnfinishedTaskStatuses).
+		Updates(fields)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *gormTaskRepository) UpdateColumns(ctx context.Context, task *entity.Task, columns ...string) error {
+	return r.db.WithContext(ctx).Model(task).Select(columns).Updates(task).Error
+}
+
+type gormUserRepository struct {
+	gormStore[entity.User]
+}
+
+func (r *gormUserRepository) GetByUsername(ctx context.Context, username string) (*entity.User, error) {
+	return r.first(ctx, "username = ?", username)
+}
+
+func (r *gormUserRepository) GetByToken(ctx context.Context, role entity.UserRole, token string) (*entity.User, error) {
+	return r.first(ctx, "role = ? AND token = ?", role, token)
+}
+
+func (r *gormUserRepository) FindByUsernameOrEmail(ctx context.Context, username, email string) (*entity.User, error) {
+	return r.first(ctx, "username = ? OR email = ?", username, email)
+}
+
+func (r *gormUserRepository) where(ctx context.Context, q repository.UserQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.User{})
+	if q.Keyword != "" {
+		db = db.Where("username LIKE ? OR email LIKE ?", "%"+q.Keyword+"%", "%"+q.Keyword+"%")
+	}
+	if q.Role != "" {
+		db = db.Where("role = ?", q.Role)
+	}
+	if q.Enabled != nil {
+		db = db.Where("enabled = ?", *q.Enabled)
+	}
+	return db
+}
+
+func (r *gormUserRepository) Find(ctx context.Context, q repository.UserQuery) ([]entity.User, error) {
+	var users []entity.User
+	err := page(r.where(ctx, q).Order("created_at DESC"), q.Offset, q.Limit).Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepository) Count(ctx context.Context, q repository.UserQuery) (int64, error) {
+	var total int64
+	err := r.where(ctx, q).Count(&total).Error
+	return total, err
+}
+
+func (r *gormUserRepository) AdjustDrawCount(ctx context.Context, id string, delta int) (bool, error) {
+	adjust := func(column string) clause.Expr {
+		if delta >= 0 {
+			return gorm.Expr(column+" + ?", delta)
+		}
+		return gorm.Expr("CASE WHEN "+column+" > ? THEN "+column+" - ? ELSE 0 END", -delta, -delta)
+	}
+
+	result := r.db.WithContext(ctx).Model(&entity.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"total_draw_count": adjust("total_draw_count"),
+			"day_draw_count":   adjust("day_draw_count"),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *gormUserRepository) ResetDayDrawCount(ctx context.Context) error {
+	return r.db.WithContext(ctx).Model(&entity.User{}).Where("day_draw_count <> ?", 0).Update("day_draw_count", 0).Error
+}
+
+type gormAccountRepository struct {
+	gormStore[entity.DiscordAccount]
+}
+
+func (r *gormAccountRepository) GetByChannelID(ctx context.Context, channelID string) (*entity.DiscordAccount, error) {
+	return r.first(ctx, "channel_id = ?", channelID)
+}
+
+func (r *gormAccountRepository) where(ctx context.Context, q repository.AccountQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.DiscordAccount{})
+	if q.IncludeDeleted {
+		db = db.Unscoped()
+	}
+	if q.Keyword != "" {
+		db = db.Where("channel_id LIKE ? OR guild_id LIKE ?", "%"+q.Keyword+"%", "%"+q.Keyword+"%")
+	}
+	return db
+}
+
+func (r *gormAccountRepository) Find(ctx context.Context, q repository.AccountQuery) ([]entity.DiscordAccount, error) {
+	var accounts []entity.DiscordAccount
+	err := page(r.where(ctx, q).Order("created_at DESC"), q.Offset, q.Limit).Find(&accounts).Error
+	return accounts, err
+}
+
+func (r *gormAccountRepository) Count(ctx context.Context, q repository.AccountQuery) (int64, error) {
+	var total int64
+	err := r.where(ctx, q).Count(&total).Error
+	return total, err
+}
+
+func (r *gormAccountRepository) SetEnabled(ctx context.Context, id string, enabled bool) error {
+	return r.db.WithContext(ctx).Model(&entity.DiscordAccount{}).Where("id = ?", id).Update("enabled", enabled).Error
+}
+
+// SaveCredentials 按列更新，BeforeSave钩子加密后写入，AfterSave钩子还原为明文
+func (r *gormAccountRepository) SaveCredentials(ctx context.Context, account *entity.DiscordAccount) error {
+	return r.db.WithContext(ctx).Unscoped().Model(account).
+		Select("user_token", "bot_token", "login_password", "login_2fa").
+		Updates(account).Error
+}
+
+func (r *gormAccountRepository) ResetDayDrawCount(ctx context.Context) error {
+	return r.db.WithContext(ctx).Model(&entity.DiscordAccount{}).Where("day_draw_count <> ?", 0).Update("day_draw_count", 0).Error
+}
+
+type gormBannedWordRepository struct {
+	gormStore[entity.BannedWord]
+}
+
+func (r *gormBannedWordRepository) Find(ctx context.Context, enabledOnly bool) ([]entity.BannedWord, error) {
+	db := r.db.WithContext(ctx)
+	if enabledOnly {
+		db = db.Where("enabled = ?", true)
+	}
+
+	var words []entity.BannedWord
+	err := db.Order("created_at DESC").Find(&words).Error
+	return words, err
+}
+
+type gormSettingRepository struct {
+	gormStore[entity.Setting]
+}
+
+// key和group是MySQL的保留字，使用map条件由GORM负责转义列名
+
+func (r *gormSettingRepository) Get(ctx context.Context, key string) (*entity.Setting, error) {
+	return r.first(ctx, map[string]interface{}{"key": key})
+}
+
+func (r *gormSettingRepository) Find(ctx context.Context, group string) ([]entity.Setting, error) {
+	db := r.db.WithContext(ctx)
+	if group != "" {
+		db = db.Where(map[string]interface{}{"group": group})
+	}
+
+	var settings []entity.Setting
+	err := db.Order(clause.OrderByColumn{Column: clause.Column{Name: "key"}}).Find(&settings).Error
+	return settings, err
+}
+
+// Delete 永久删除，键名有唯一索引，软删除的记录会阻止重新创建
+func (r *gormSettingRepository) Delete(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Unscoped().Where(map[string]interface{}{"key": key}).Delete(&entity.Setting{}).Error
+}
+
+type gormSettingChangeRepository struct {
+	gormStore[entity.SettingChange]
+}
+
+func (r *gormSettingChangeRepository) where(ctx context.Context, q repository.SettingChangeQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.SettingChange{})
+	if q.Key != "" {
+		db = db.Where(map[string]interface{}{"key": q.Key})
+	}
+	return db
+}
+
+func (r *gormSettingChangeRepository) Find(ctx context.Context, q repository.SettingChangeQuery) ([]entity.SettingChange, error) {
+	var changes []entity.SettingChange
+	err := page(r.where(ctx, q).Order("created_at DESC"), q.Offset, q.Limit).Find(&changes).Error
+	return changes, err
+}
+
+func (r *gormSettingChangeRepository) Count(ctx context.Context, q repository.SettingChangeQuery) (int64, error) {
+	var count int64
+	err := r.where(ctx, q).Count(&count).Error
+	return count, err
+}
+
+type gormDomainTagRepository struct {
+	gormStore[entity.DomainTag]
+}
+
+func (r *gormDomainTagRepository) Find(ctx context.Context) ([]entity.DomainTag, error) {
+	var tags []entity.DomainTag
+	err := r.db.WithContext(ctx).Order("sort ASC, created_at DESC").Find(&tags).Error
+	return tags, err
+}
+
+type gormMessageRepository struct {
+	gormStore[entity.Message]
+}
+
+func (r *gormMessageRepository) Find(ctx context.Context, q repository.MessageQuery) ([]entity.Message, error) {
+	db := r.db.WithContext(ctx)
+	if q.ChannelID != "" {
+		db = db.Where("channel_id = ?", q.ChannelID)
+	}
+	if q.MessageID != "" {
+		db = db.Where("message_id = ?", q.MessageID)
+	}
+	if q.Hash != "" {
+		db = db.Where("hash = ?", q.Hash)
+	}
+
+	var messages []entity.Message
+	err := page(db.Order(clause.OrderByColumn{Column: clause.Column{Name: "timestamp"}, Desc: true}), 0, q.Limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+type gormWebhookDeliveryRepository struct {
+	gormStore[entity.WebhookDelivery]
+}
+
+func (r *gormWebhookDeliveryRepository) where(ctx context.Context, q repository.WebhookDeliveryQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.WebhookDelivery{})
+	if q.TaskID != "" {
+		db = db.Where("task_id = ?", q.TaskID)
+	}
+	if q.Status != "" {
+		db = db.Where("status = ?", q.Status)
+	}
+	return db
+}
+
+func (r *gormWebhookDeliveryRepository) Find(ctx context.Context, q repository.WebhookDeliveryQuery) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := page(r.where(ctx, q).Order("created_at DESC"), q.Offset, q.Limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *gormWebhookDeliveryRepository) Count(ctx context.Context, q repository.WebhookDeliveryQuery) (int64, error) {
+	var total int64
+	err := r.where(ctx, q).Count(&total).Error
+	return total, err
+}
+
+func (r *gormWebhookDeliveryRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&entity.WebhookDelivery{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *gormWebhookDeliveryRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("created_at < ? AND status <> ?", before, entity.WebhookDeliveryPending).
+		Delete(&entity.WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
+
+type gormLeaseRepository struct {
+	gormStore[entity.Lease]
+}
+
+// TryAcquire 先按条件更新已有的租约，租约不存在时插入，插入冲突说明已被其他持有者抢先获取
+func (r *gormLeaseRepository) TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	result := r.db.WithContext(ctx).Model(&entity.Lease{}).
+		Where("id = ? AND (holder = ? OR expires_at <= ?)", name, holder, now).
+		Updates(map[string]interface{}{
+			"holder":     holder,
+			"expires_at": expiresAt,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// 租约存在且由其他持有者持有
+	if _, err := r.Get(ctx, name); err != repository.ErrNotFound {
+		return false, err
+	}
+
+	err := r.db.WithContext(ctx).Create(&entity.Lease{
+		ID:        name,
+		Holder:    holder,
+		ExpiresAt: expiresAt,
+		UpdatedAt: now,
+	}).Error
+	if err == nil {
+		return true, nil
+	}
+	if _, getErr := r.Get(ctx, name); getErr == nil {
+		return false, nil
+	}
+	return false, err
+}
+
+func (r *gormLeaseRepository) Release(ctx context.Context, name, holder string) error {
+	return r.db.WithContext(ctx).Where("id = ? AND holder = ?", name, holder).Delete(&entity.Lease{}).Error
+}
+
+type gormJobRunRepository struct {
+	gormStore[entity.JobRun]
+}
+
+func (r *gormJobRunRepository) Find(ctx context.Context) ([]entity.JobRun, error) {
+	var runs []entity.JobRun
+	err := r.db.WithContext(ctx).Order("id ASC").Find(&runs).Error
+	return runs, err
+}
+
+type gormIPBanRepository struct {
+	gormStore[entity.IPBan]
+}
+
+func (r *gormIPBanRepository) Find(ctx context.Context, activeOnly bool) ([]entity.IPBan, error) {
+	db := r.db.WithContext(ctx)
+	if activeOnly {
+		db = db.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	}
+
+	var bans []entity.IPBan
+	err := db.Order("updated_at DESC").Find(&bans).Error
+	return bans, err
+}
+
+type gormAuditLogRepository struct {
+	gormStore[entity.AuditLog]
+}
+
+func (r *gormAuditLogRepository) where(ctx context.Context, q repository.AuditLogQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.AuditLog{})
+	if q.Action != "" {
+		db = db.Where(map[string]interface{}{"action": q.Action})
+	}
+	if q.Target != "" {
+		db = db.Where(map[string]interface{}{"target": q.Target})
+	}
+	return db
+}
+
+func (r *gormAuditLogRepository) Find(ctx context.Context, q repository.AuditLogQuery) ([]entity.AuditLog, error) {
+	var logs []entity.AuditLog
+	err := page(r.where(ctx, q).Order("created_at DESC"), q.Offset, q.Limit).Find(&logs).Error
+	return logs, err
+}
+
+func (r *gormAuditLogRepository) Count(ctx context.Context, q repository.AuditLogQuery) (int64, error) {
+	var count int64
+	err := r.where(ctx, q).Count(&count).Error
+	return count, err
+}
+
+type gormAPIKeyRepository struct {
+	gormStore[entity.APIKey]
+}
+
+func (r *gormAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*entity.APIKey, error) {
+	return r.first(ctx, "key_hash = ?", hash)
+}
+
+func (r *gormAPIKeyRepository) where(ctx context.Context, q repository.APIKeyQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.APIKey{})
+	if q.UserID != "" {
+		db = db.Where(map[string]interface{}{"user_id": q.UserID})
+	}
+	if !q.IncludeRevoked {
+		db = db.Where("revoked_at IS NULL")
+	}
+	return db
+}
+
+func (r *gormAPIKeyRepository) Find(ctx context.Context, q repository.APIKeyQuery) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+	err := page(r.where(ctx, q).Order("created_at DESC"), q.Offset, q.Limit).Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormAPIKeyRepository) Count(ctx context.Context, q repository.APIKeyQuery) (int64, error) {
+	var count int64
+	err := r.where(ctx, q).Count(&count).Error
+	return count, err
+}
+
+func (r *gormAPIKeyRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&entity.APIKey{}).Where("id = ?", id).Updates(fields).Error
+}
+
+type gormRefreshTokenRepository struct {
+	gormStore[entity.RefreshToken]
+}
+
+func (r *gormRefreshTokenRepository) GetByHash(ctx context.Context, hash string) (*entity.RefreshToken, error) {
+	return r.first(ctx, "token_hash = ?", hash)
+}
+
+func (r *gormRefreshTokenRepository) MarkUsed(ctx context.Context, id string, usedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&entity.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *gormRefreshTokenRepository) where(ctx context.Context, q repository.RefreshTokenQuery) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&entity.RefreshToken{})
+	if q.UserID != "" {
+		db = db.Where("user_id = ?", q.UserID)
+	}
+	if q.FamilyID != "" {
+		db = db.Where("family_id = ?", q.FamilyID)
+	}
+	if !q.CreatedAfter.IsZero() {
+		db = db.Where("created_at > ?", q.CreatedAfter)
+	}
+	return db
+}
+
+func (r *gormRefreshTokenRepository) Find(ctx context.Context, q repository.RefreshTokenQuery) ([]entity.RefreshToken, error) {
+	var tokens []entity.RefreshToken
+	err := r.where(ctx, q).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *gormRefreshTokenRepository) Revoke(ctx context.Context, q repository.RefreshTokenQuery, revokedAt time.Time) (int64, error) {
+	result := r.where(ctx, q).Where("revoked_at IS NULL").Update("revoked_at", revokedAt)
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormRefreshTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&entity.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+type gormRevokedTokenRepository struct {
+	gormStore[entity.RevokedToken]
+}
+
+func (r *gormRevokedTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&entity.RevokedToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,365 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFileName 迁移文件名格式：<版本号>_<名称>.<up|down>.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+const (
+	// migrationLockName MySQL命名锁名称，PostgreSQL使用其哈希作为咨询锁键
+	migrationLockName = "schema_migrations"
+	// migrationLockTimeout 等待其他实例完成迁移的最长时间
+	migrationLockTimeout = 5 * time.Minute
+)
+
+// ErrMigrationLocked 等待迁移锁超时
+var ErrMigrationLocked = errors.New("其他实例正在执行数据库迁移，等待超时")
+
+// Migration 数据库迁移，每个版本包含升级和回滚语句
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus 迁移状态
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// schemaMigration 已执行的迁移记录
+type schemaMigration struct {
+	Version   int       `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+// TableName 指定表名
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator 按版本号执行 migrations/<数据库类型> 下的迁移文件，执行记录保存在 schema_migrations 表
+type Migrator struct {
+	db         *gorm.DB
+	dialect    string
+	migrations []Migration
+}
+
+// NewMigrator 创建迁移器
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	dialect := db.Dialector.Name()
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// loadMigrations 读取指定数据库类型的迁移文件，按版本号排序
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported migration dialect: %s", dialect)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s/%s", dir, entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names: %s, %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up 执行全部未执行的迁移，返回本次执行的迁移
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func() error {
+		done, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down 按版本号倒序回滚最近执行的steps个迁移，返回本次回滚的迁移
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.withLock(ctx, func() error {
+		done, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if err := m.run(ctx, migration, false); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status 返回全部迁移的执行状态
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	done, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := done[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// run 在事务中执行迁移并更新执行记录（MySQL的DDL语句会隐式提交，失败时需手动处理）
+func (m *Migrator) run(ctx context.Context, migration Migration, up bool) error {
+	script := migration.Down
+	if up {
+		script = migration.Up
+	}
+
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, statement := range splitStatements(script) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		if up {
+			return tx.Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		}
+		return tx.Delete(&schemaMigration{}, "version = ?", migration.Version).Error
+	})
+	if err != nil {
+		direction := "down"
+		if up {
+			direction = "up"
+		}
+		return fmt.Errorf("migration %d_%s %s failed: %w", migration.Version, migration.Name, direction, err)
+	}
+	return nil
+}
+
+// applied 查询已执行的迁移
+func (m *Migrator) applied(ctx context.Context) (map[int]schemaMigration, error) {
+	var records []schemaMigration
+	if err := m.db.WithContext(ctx).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	done := make(map[int]schemaMigration, len(records))
+	for _, record := range records {
+		done[record.Version] = record
+	}
+	return done, nil
+}
+
+// ensureTable 创建迁移记录表
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	return m.db.WithContext(ctx).AutoMigrate(&schemaMigration{})
+}
+
+// withLock 持有迁移锁执行fn，防止多个实例同时迁移
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, migrationLockTimeout)
+	defer cancel()
+
+	switch m.dialect {
+	case "mysql", "postgres":
+		return m.withSessionLock(lockCtx, fn)
+	default:
+		return m.withTableLock(lockCtx, fn)
+	}
+}
+
+// withSessionLock 使用MySQL命名锁或PostgreSQL咨询锁，锁绑定在单独的连接上，连接断开时自动释放
+func (m *Migrator) withSessionLock(ctx context.Context, fn func() error) error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock := "SELECT pg_advisory_unlock(hashtext($1))"
+	if m.dialect == "mysql" {
+		// GET_LOCK自带超时，返回1表示加锁成功
+		var acquired sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, int(migrationLockTimeout.Seconds())).Scan(&acquired); err != nil {
+			return err
+		}
+		if acquired.Int64 != 1 {
+			return ErrMigrationLocked
+		}
+		unlock = "SELECT RELEASE_LOCK(?)"
+	} else if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", migrationLockName); err != nil {
+		if ctx.Err() != nil {
+			return ErrMigrationLocked
+		}
+		return err
+	}
+	defer conn.ExecContext(context.Background(), unlock, migrationLockName)
+
+	return fn()
+}
+
+// migrationLock SQLite迁移锁记录，同一时间只能存在一条
+type migrationLock struct {
+	ID       int       `gorm:"column:id;primaryKey;autoIncrement:false"`
+	LockedAt time.Time `gorm:"column:locked_at"`
+}
+
+// TableName 指定表名
+func (migrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+// withTableLock 通过插入锁记录加锁，用于不支持会话锁的SQLite，超过等待时间的锁视为进程异常退出遗留，直接接管
+func (m *Migrator) withTableLock(ctx context.Context, fn func() error) error {
+	db := m.db.WithContext(ctx)
+	if err := db.AutoMigrate(&migrationLock{}); err != nil {
+		return err
+	}
+
+	for {
+		db.Where("locked_at < ?", time.Now().Add(-migrationLockTimeout)).Delete(&migrationLock{})
+		if err := db.Create(&migrationLock{ID: 1, LockedAt: time.Now()}).Error; err == nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrMigrationLocked
+		case <-time.After(time.Second):
+		}
+	}
+	defer m.db.Delete(&migrationLock{}, "id = ?", 1)
+
+	return fn()
+}
+
+// splitStatements 按行尾分号拆分迁移脚本，忽略注释行和空语句
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+// userTables SQLite中除迁移记录和锁以外的表
+func userTables(t *testing.T, m *Migrator) []string {
+	t.Helper()
+
+	var tables []string
+	err := m.db.Raw(`SELECT name FROM sqlite_master WHERE type = 'table'
+		AND name NOT LIKE 'sqlite_%' AND name NOT IN ('schema_migrations', 'schema_migrations_lock')`).
+		Scan(&tables).Error
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+func TestMigratorUpDownUp(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(config.DatabaseConfig{
+		Type:   "sqlite",
+		SQLite: config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "test.db")},
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	total := len(migrator.migrations)
+
+	applied, err := migrator.Up(ctx)
+	if err != nil || len(applied) != total {
+		t.Fatalf("Up = %d migrations, %v; want %d", len(applied), err, total)
+	}
+	tables := userTables(t, migrator)
+	if len(tables) == 0 {
+		t.Fatal("no tables after up")
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up = %d migrations, %v; want none", len(applied), err)
+	}
+
+	rolledBack, err := migrator.Down(ctx, total)
+	if err != nil || len(rolledBack) != total {
+		t.Fatalf("Down = %d migrations, %v; want %d", len(rolledBack), err, total)
+	}
+	if rolledBack[0].Version != migrator.migrations[total-1].Version {
+		t.Fatalf("Down started at version %d, want latest", rolledBack[0].Version)
+	}
+	if left := userTables(t, migrator); len(left) != 0 {
+		t.Fatalf("tables left after down to zero: %v", left)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Fatalf("migration %d still applied after down", status.Version)
+		}
+	}
+
+	// 回滚后可以重新升级到相同的表结构
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != total {
+		t.Fatalf("Up after down = %d migrations, %v; want %d", len(applied), err, total)
+	}
+	if again := userTables(t, migrator); !reflect.DeepEqual(again, tables) {
+		t.Fatalf("tables after up again = %v, want %v", again, tables)
+	}
+}
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	type version struct {
+		Version int
+		Name    string
+	}
+
+	var want []version
+	for _, dialect := range []string{"sqlite", "mysql", "postgres"} {
+		// loadMigrations 已校验每个版本同时有up和down文件
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatalf("load %s migrations: %v", dialect, err)
+		}
+
+		var got []version
+		for _, migration := range migrations {
+			got = append(got, version{migration.Version, migration.Name})
+		}
+		if want == nil {
+			want = got
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s migrations = %v, want %v", dialect, got, want)
+		}
+	}
+
+	for i, migration := range want {
+		if migration.Version != i+1 {
+			t.Fatalf("migration versions are not contiguous: %v", want)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS `webhook_deliveries`;
+DROP TABLE IF EXISTS `messages`;
+DROP TABLE IF EXISTS `domain_tags`;
+DROP TABLE IF EXISTS `settings`;
+DROP TABLE IF EXISTS `banned_words`;
+DROP TABLE IF EXISTS `discord_accounts`;
+DROP TABLE IF EXISTS `tasks`;
+DROP TABLE IF EXISTS `users`;
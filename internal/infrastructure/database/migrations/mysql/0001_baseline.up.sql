@@ -0,0 +1,250 @@
+-- 初始表结构，与此前 AutoMigrate 创建的表结构一致，已有的表和索引会被跳过
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` varchar(191) NOT NULL,
+  `username` varchar(191),
+  `email` varchar(191),
+  `password` longtext,
+  `role` varchar(191) DEFAULT 'user',
+  `token` varchar(191),
+  `token_type` varchar(191) DEFAULT 'bearer',
+  `enabled` boolean DEFAULT true,
+  `is_white` boolean DEFAULT false,
+  `total_draw_count` bigint DEFAULT 0,
+  `day_draw_count` bigint DEFAULT 0,
+  `day_draw_limit` bigint DEFAULT -1,
+  `total_draw_limit` bigint DEFAULT -1,
+  `expired_at` datetime(3),
+  `remark` text,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_users_username` (`username`),
+  UNIQUE KEY `idx_users_email` (`email`),
+  UNIQUE KEY `idx_users_token` (`token`),
+  KEY `idx_users_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `tasks` (
+  `id` varchar(191) NOT NULL,
+  `parent_id` varchar(191),
+  `user_id` varchar(191),
+  `bot_type` longtext,
+  `real_bot_type` longtext,
+  `is_white` boolean DEFAULT false,
+  `nonce` longtext,
+  `interaction_metadata_id` longtext,
+  `message_id` longtext,
+  `remix_modal_message_id` longtext,
+  `remix_auto_submit` boolean DEFAULT false,
+  `remix_modaling` boolean DEFAULT false,
+  `instance_id` varchar(191),
+  `sub_instance_id` longtext,
+  `action` longtext,
+  `status` varchar(191),
+  `prompt` text,
+  `prompt_en` text,
+  `prompt_full` text,
+  `description` text,
+  `state` longtext,
+  `submit_time` datetime(3),
+  `start_time` datetime(3),
+  `finish_time` datetime(3),
+  `image_url` varchar(1024),
+  `thumbnail_url` varchar(1024),
+  `progress` longtext,
+  `fail_reason` text,
+  `buttons` json,
+  `seed` longtext,
+  `seed_message_id` longtext,
+  `job_id` longtext,
+  `client_ip` varchar(191),
+  `notify_hook` varchar(1024),
+  `is_replicate` boolean DEFAULT false,
+  `replicate_source` varchar(1024),
+  `replicate_target` varchar(1024),
+  `mode` longtext,
+  `account_filter` text,
+  `url` varchar(1024),
+  `proxy_url` varchar(1024),
+  `height` bigint,
+  `width` bigint,
+  `size` bigint,
+  `content_type` varchar(200),
+  `properties` json,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_tasks_parent_id` (`parent_id`),
+  KEY `idx_tasks_user_id` (`user_id`),
+  KEY `idx_tasks_instance_id` (`instance_id`),
+  KEY `idx_tasks_status` (`status`),
+  KEY `idx_tasks_submit_time` (`submit_time`),
+  KEY `idx_tasks_client_ip` (`client_ip`),
+  KEY `idx_tasks_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `discord_accounts` (
+  `id` varchar(191) NOT NULL,
+  `channel_id` varchar(191),
+  `guild_id` longtext,
+  `private_channel_id` longtext,
+  `niji_bot_channel_id` longtext,
+  `user_token` text,
+  `bot_token` text,
+  `user_agent` text,
+  `enabled` boolean DEFAULT true,
+  `enable_mj` boolean DEFAULT true,
+  `enable_niji` boolean DEFAULT false,
+  `enable_fast_to_relax` boolean DEFAULT false,
+  `enable_relax_to_fast` boolean DEFAULT false,
+  `fast_exhausted` boolean DEFAULT false,
+  `lock` boolean DEFAULT false,
+  `disabled_reason` text,
+  `permanent_invitation_link` varchar(2000),
+  `cf_hash_created` datetime(3),
+  `cf_hash_url` text,
+  `cf_url` text,
+  `is_sponsor` boolean DEFAULT false,
+  `sponsor_user_id` longtext,
+  `core_size` bigint DEFAULT 3,
+  `queue_size` bigint DEFAULT 10,
+  `max_queue_size` bigint DEFAULT 100,
+  `timeout_minutes` bigint DEFAULT 5,
+  `interval` double DEFAULT 1.2,
+  `after_interval_min` double DEFAULT 1.2,
+  `after_interval_max` double DEFAULT 1.2,
+  `remark` text,
+  `sponsor` text,
+  `info_updated` datetime(3),
+  `weight` bigint DEFAULT 0,
+  `sort` bigint DEFAULT 0,
+  `work_time` longtext,
+  `fishing_time` longtext,
+  `remix_auto_submit` boolean DEFAULT false,
+  `mode` longtext,
+  `allow_modes` text,
+  `enable_auto_set_relax` boolean DEFAULT false,
+  `components` text,
+  `settings_message_id` longtext,
+  `niji_components` text,
+  `niji_settings_message_id` longtext,
+  `is_blend` boolean DEFAULT true,
+  `is_describe` boolean DEFAULT true,
+  `is_shorten` boolean DEFAULT true,
+  `login_account` longtext,
+  `login_password` longtext,
+  `login_2fa` longtext,
+  `is_auto_logining` boolean DEFAULT false,
+  `login_start` datetime(3),
+  `login_end` datetime(3),
+  `login_message` varchar(2000),
+  `day_draw_limit` bigint DEFAULT -1,
+  `day_draw_count` bigint DEFAULT 0,
+  `is_vertical_domain` boolean DEFAULT false,
+  `vertical_domain_ids` text,
+  `sub_channels` text,
+  `sub_channel_values` json,
+  `properties` json,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_discord_accounts_channel_id` (`channel_id`),
+  KEY `idx_discord_accounts_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `banned_words` (
+  `id` varchar(191) NOT NULL,
+  `word` varchar(191),
+  `group_id` varchar(191),
+  `enabled` boolean DEFAULT true,
+  `remark` text,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_banned_words_word` (`word`),
+  KEY `idx_banned_words_group_id` (`group_id`),
+  KEY `idx_banned_words_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `settings` (
+  `id` varchar(191) NOT NULL,
+  `key` varchar(191),
+  `value` text,
+  `type` varchar(191) DEFAULT 'string',
+  `group` varchar(191),
+  `title` longtext,
+  `description` text,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_settings_key` (`key`),
+  KEY `idx_settings_group` (`group`),
+  KEY `idx_settings_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `domain_tags` (
+  `id` varchar(191) NOT NULL,
+  `name` varchar(191),
+  `enabled` boolean DEFAULT true,
+  `sort` bigint DEFAULT 0,
+  `remark` text,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_domain_tags_name` (`name`),
+  KEY `idx_domain_tags_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `messages` (
+  `id` varchar(191) NOT NULL,
+  `message_id` varchar(191),
+  `channel_id` varchar(191),
+  `guild_id` varchar(191),
+  `author_id` varchar(191),
+  `content` text,
+  `type` bigint,
+  `flags` bigint,
+  `reference` text,
+  `hash` varchar(191),
+  `attachments` json,
+  `components` json,
+  `embeds` json,
+  `timestamp` datetime(3),
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_messages_message_id` (`message_id`),
+  KEY `idx_messages_channel_id` (`channel_id`),
+  KEY `idx_messages_guild_id` (`guild_id`),
+  KEY `idx_messages_author_id` (`author_id`),
+  KEY `idx_messages_hash` (`hash`),
+  KEY `idx_messages_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+  `id` varchar(191) NOT NULL,
+  `task_id` varchar(191),
+  `url` varchar(1024),
+  `task_status` longtext,
+  `progress` longtext,
+  `payload` text,
+  `status` varchar(191),
+  `attempts` bigint DEFAULT 0,
+  `status_code` bigint,
+  `error` text,
+  `last_attempt_at` datetime(3),
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_deliveries_task_id` (`task_id`),
+  KEY `idx_webhook_deliveries_status` (`status`),
+  KEY `idx_webhook_deliveries_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
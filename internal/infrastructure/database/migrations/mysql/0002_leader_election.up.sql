@@ -0,0 +1,19 @@
+-- 多副本选举租约和定时任务执行记录
+
+CREATE TABLE IF NOT EXISTS `leases` (
+  `id` varchar(191) NOT NULL,
+  `holder` longtext,
+  `expires_at` datetime(3),
+  `updated_at` datetime(3),
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE IF NOT EXISTS `job_runs` (
+  `id` varchar(191) NOT NULL,
+  `node` longtext,
+  `started_at` datetime(3),
+  `finished_at` datetime(3),
+  `duration_ms` bigint,
+  `error` text,
+  `updated_at` datetime(3),
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
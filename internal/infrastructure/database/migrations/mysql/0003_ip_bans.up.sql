@@ -0,0 +1,14 @@
+-- 动态IP封禁
+
+CREATE TABLE IF NOT EXISTS `ip_bans` (
+  `id` varchar(191) NOT NULL,
+  `source` longtext,
+  `reason` text,
+  `ban_count` bigint DEFAULT 0,
+  `expires_at` datetime(3),
+  `created_by` longtext,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_ip_bans_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,14 @@
+-- 系统设置变更记录
+
+CREATE TABLE IF NOT EXISTS `setting_changes` (
+  `id` varchar(191) NOT NULL,
+  `key` varchar(191),
+  `old_value` text,
+  `new_value` text,
+  `reset` boolean DEFAULT false,
+  `operator` longtext,
+  `created_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_setting_changes_key` (`key`),
+  KEY `idx_setting_changes_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
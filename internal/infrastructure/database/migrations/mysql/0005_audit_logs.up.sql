@@ -0,0 +1,15 @@
+-- 审计记录
+
+CREATE TABLE IF NOT EXISTS `audit_logs` (
+  `id` varchar(191) NOT NULL,
+  `action` varchar(191),
+  `target` varchar(191),
+  `operator` longtext,
+  `client_ip` longtext,
+  `detail` text,
+  `created_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_audit_logs_action` (`action`),
+  KEY `idx_audit_logs_target` (`target`),
+  KEY `idx_audit_logs_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,20 @@
+-- 用户API密钥
+
+CREATE TABLE IF NOT EXISTS `api_keys` (
+  `id` varchar(191) NOT NULL,
+  `user_id` varchar(191),
+  `name` longtext,
+  `prefix` longtext,
+  `key_hash` varchar(191),
+  `scopes` json,
+  `allowed_ips` json,
+  `expires_at` datetime(3),
+  `last_used_at` datetime(3),
+  `last_used_ip` longtext,
+  `revoked_at` datetime(3),
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_api_keys_user_id` (`user_id`),
+  UNIQUE KEY `idx_api_keys_key_hash` (`key_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,30 @@
+-- 刷新令牌和访问令牌吊销列表
+
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` varchar(191) NOT NULL,
+  `user_id` varchar(191),
+  `family_id` varchar(191),
+  `token_hash` varchar(191),
+  `access_jti` longtext,
+  `client_ip` longtext,
+  `user_agent` longtext,
+  `expires_at` datetime(3),
+  `used_at` datetime(3),
+  `revoked_at` datetime(3),
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_refresh_tokens_user_id` (`user_id`),
+  KEY `idx_refresh_tokens_family_id` (`family_id`),
+  UNIQUE KEY `idx_refresh_tokens_token_hash` (`token_hash`),
+  KEY `idx_refresh_tokens_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `revoked_tokens` (
+  `id` varchar(191) NOT NULL,
+  `user_id` longtext,
+  `expires_at` datetime(3),
+  `created_at` datetime(3),
+  PRIMARY KEY (`id`),
+  KEY `idx_revoked_tokens_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
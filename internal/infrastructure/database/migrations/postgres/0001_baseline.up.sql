@@ -0,0 +1,250 @@
+-- 初始表结构，与此前 AutoMigrate 创建的表结构一致，已有的表和索引会被跳过
+
+CREATE TABLE IF NOT EXISTS "users" (
+  "id" text NOT NULL,
+  "username" text,
+  "email" text,
+  "password" text,
+  "role" text DEFAULT 'user',
+  "token" text,
+  "token_type" text DEFAULT 'bearer',
+  "enabled" boolean DEFAULT true,
+  "is_white" boolean DEFAULT false,
+  "total_draw_count" bigint DEFAULT 0,
+  "day_draw_count" bigint DEFAULT 0,
+  "day_draw_limit" bigint DEFAULT -1,
+  "total_draw_limit" bigint DEFAULT -1,
+  "expired_at" timestamptz,
+  "remark" text,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_token" ON "users" ("token");
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "tasks" (
+  "id" text NOT NULL,
+  "parent_id" text,
+  "user_id" text,
+  "bot_type" text,
+  "real_bot_type" text,
+  "is_white" boolean DEFAULT false,
+  "nonce" text,
+  "interaction_metadata_id" text,
+  "message_id" text,
+  "remix_modal_message_id" text,
+  "remix_auto_submit" boolean DEFAULT false,
+  "remix_modaling" boolean DEFAULT false,
+  "instance_id" text,
+  "sub_instance_id" text,
+  "action" text,
+  "status" text,
+  "prompt" text,
+  "prompt_en" text,
+  "prompt_full" text,
+  "description" text,
+  "state" text,
+  "submit_time" timestamptz,
+  "start_time" timestamptz,
+  "finish_time" timestamptz,
+  "image_url" varchar(1024),
+  "thumbnail_url" varchar(1024),
+  "progress" text,
+  "fail_reason" text,
+  "buttons" json,
+  "seed" text,
+  "seed_message_id" text,
+  "job_id" text,
+  "client_ip" text,
+  "notify_hook" varchar(1024),
+  "is_replicate" boolean DEFAULT false,
+  "replicate_source" varchar(1024),
+  "replicate_target" varchar(1024),
+  "mode" text,
+  "account_filter" text,
+  "url" varchar(1024),
+  "proxy_url" varchar(1024),
+  "height" bigint,
+  "width" bigint,
+  "size" bigint,
+  "content_type" varchar(200),
+  "properties" json,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_tasks_parent_id" ON "tasks" ("parent_id");
+CREATE INDEX IF NOT EXISTS "idx_tasks_user_id" ON "tasks" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_tasks_instance_id" ON "tasks" ("instance_id");
+CREATE INDEX IF NOT EXISTS "idx_tasks_status" ON "tasks" ("status");
+CREATE INDEX IF NOT EXISTS "idx_tasks_submit_time" ON "tasks" ("submit_time");
+CREATE INDEX IF NOT EXISTS "idx_tasks_client_ip" ON "tasks" ("client_ip");
+CREATE INDEX IF NOT EXISTS "idx_tasks_deleted_at" ON "tasks" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "discord_accounts" (
+  "id" text NOT NULL,
+  "channel_id" text,
+  "guild_id" text,
+  "private_channel_id" text,
+  "niji_bot_channel_id" text,
+  "user_token" text,
+  "bot_token" text,
+  "user_agent" text,
+  "enabled" boolean DEFAULT true,
+  "enable_mj" boolean DEFAULT true,
+  "enable_niji" boolean DEFAULT false,
+  "enable_fast_to_relax" boolean DEFAULT false,
+  "enable_relax_to_fast" boolean DEFAULT false,
+  "fast_exhausted" boolean DEFAULT false,
+  "lock" boolean DEFAULT false,
+  "disabled_reason" text,
+  "permanent_invitation_link" varchar(2000),
+  "cf_hash_created" timestamptz,
+  "cf_hash_url" text,
+  "cf_url" text,
+  "is_sponsor" boolean DEFAULT false,
+  "sponsor_user_id" text,
+  "core_size" bigint DEFAULT 3,
+  "queue_size" bigint DEFAULT 10,
+  "max_queue_size" bigint DEFAULT 100,
+  "timeout_minutes" bigint DEFAULT 5,
+  "interval" double precision DEFAULT 1.2,
+  "after_interval_min" double precision DEFAULT 1.2,
+  "after_interval_max" double precision DEFAULT 1.2,
+  "remark" text,
+  "sponsor" text,
+  "info_updated" timestamptz,
+  "weight" bigint DEFAULT 0,
+  "sort" bigint DEFAULT 0,
+  "work_time" text,
+  "fishing_time" text,
+  "remix_auto_submit" boolean DEFAULT false,
+  "mode" text,
+  "allow_modes" text,
+  "enable_auto_set_relax" boolean DEFAULT false,
+  "components" text,
+  "settings_message_id" text,
+  "niji_components" text,
+  "niji_settings_message_id" text,
+  "is_blend" boolean DEFAULT true,
+  "is_describe" boolean DEFAULT true,
+  "is_shorten" boolean DEFAULT true,
+  "login_account" text,
+  "login_password" text,
+  "login_2fa" text,
+  "is_auto_logining" boolean DEFAULT false,
+  "login_start" timestamptz,
+  "login_end" timestamptz,
+  "login_message" varchar(2000),
+  "day_draw_limit" bigint DEFAULT -1,
+  "day_draw_count" bigint DEFAULT 0,
+  "is_vertical_domain" boolean DEFAULT false,
+  "vertical_domain_ids" text,
+  "sub_channels" text,
+  "sub_channel_values" json,
+  "properties" json,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_discord_accounts_channel_id" ON "discord_accounts" ("channel_id");
+CREATE INDEX IF NOT EXISTS "idx_discord_accounts_deleted_at" ON "discord_accounts" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "banned_words" (
+  "id" text NOT NULL,
+  "word" text,
+  "group_id" text,
+  "enabled" boolean DEFAULT true,
+  "remark" text,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_banned_words_word" ON "banned_words" ("word");
+CREATE INDEX IF NOT EXISTS "idx_banned_words_group_id" ON "banned_words" ("group_id");
+CREATE INDEX IF NOT EXISTS "idx_banned_words_deleted_at" ON "banned_words" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "settings" (
+  "id" text NOT NULL,
+  "key" text,
+  "value" text,
+  "type" text DEFAULT 'string',
+  "group" text,
+  "title" text,
+  "description" text,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_settings_key" ON "settings" ("key");
+CREATE INDEX IF NOT EXISTS "idx_settings_group" ON "settings" ("group");
+CREATE INDEX IF NOT EXISTS "idx_settings_deleted_at" ON "settings" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "domain_tags" (
+  "id" text NOT NULL,
+  "name" text,
+  "enabled" boolean DEFAULT true,
+  "sort" bigint DEFAULT 0,
+  "remark" text,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_domain_tags_name" ON "domain_tags" ("name");
+CREATE INDEX IF NOT EXISTS "idx_domain_tags_deleted_at" ON "domain_tags" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "messages" (
+  "id" text NOT NULL,
+  "message_id" text,
+  "channel_id" text,
+  "guild_id" text,
+  "author_id" text,
+  "content" text,
+  "type" bigint,
+  "flags" bigint,
+  "reference" text,
+  "hash" text,
+  "attachments" json,
+  "components" json,
+  "embeds" json,
+  "timestamp" timestamptz,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_messages_message_id" ON "messages" ("message_id");
+CREATE INDEX IF NOT EXISTS "idx_messages_channel_id" ON "messages" ("channel_id");
+CREATE INDEX IF NOT EXISTS "idx_messages_guild_id" ON "messages" ("guild_id");
+CREATE INDEX IF NOT EXISTS "idx_messages_author_id" ON "messages" ("author_id");
+CREATE INDEX IF NOT EXISTS "idx_messages_hash" ON "messages" ("hash");
+CREATE INDEX IF NOT EXISTS "idx_messages_deleted_at" ON "messages" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+  "id" text NOT NULL,
+  "task_id" text,
+  "url" varchar(1024),
+  "task_status" text,
+  "progress" text,
+  "payload" text,
+  "status" text,
+  "attempts" bigint DEFAULT 0,
+  "status_code" bigint,
+  "error" text,
+  "last_attempt_at" timestamptz,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_task_id" ON "webhook_deliveries" ("task_id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_status" ON "webhook_deliveries" ("status");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_created_at" ON "webhook_deliveries" ("created_at");
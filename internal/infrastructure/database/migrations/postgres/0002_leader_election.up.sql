@@ -0,0 +1,19 @@
+-- 多副本选举租约和定时任务执行记录
+
+CREATE TABLE IF NOT EXISTS "leases" (
+  "id" text NOT NULL,
+  "holder" text,
+  "expires_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE TABLE IF NOT EXISTS "job_runs" (
+  "id" text NOT NULL,
+  "node" text,
+  "started_at" timestamptz,
+  "finished_at" timestamptz,
+  "duration_ms" bigint,
+  "error" text,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
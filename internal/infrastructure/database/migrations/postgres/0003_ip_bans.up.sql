@@ -0,0 +1,14 @@
+-- 动态IP封禁
+
+CREATE TABLE IF NOT EXISTS "ip_bans" (
+  "id" text NOT NULL,
+  "source" text,
+  "reason" text,
+  "ban_count" bigint DEFAULT 0,
+  "expires_at" timestamptz,
+  "created_by" text,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_ip_bans_expires_at" ON "ip_bans" ("expires_at");
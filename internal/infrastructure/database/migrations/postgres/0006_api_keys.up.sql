@@ -0,0 +1,20 @@
+-- 用户API密钥
+
+CREATE TABLE IF NOT EXISTS "api_keys" (
+  "id" text NOT NULL,
+  "user_id" text,
+  "name" text,
+  "prefix" text,
+  "key_hash" text,
+  "scopes" json,
+  "allowed_ips" json,
+  "expires_at" timestamptz,
+  "last_used_at" timestamptz,
+  "last_used_ip" text,
+  "revoked_at" timestamptz,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_api_keys_user_id" ON "api_keys" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_key_hash" ON "api_keys" ("key_hash");
@@ -0,0 +1,19 @@
+-- 多副本选举租约和定时任务执行记录
+
+CREATE TABLE IF NOT EXISTS "leases" (
+  "id" text NOT NULL,
+  "holder" text,
+  "expires_at" datetime,
+  "updated_at" datetime,
+  PRIMARY KEY ("id")
+);
+CREATE TABLE IF NOT EXISTS "job_runs" (
+  "id" text NOT NULL,
+  "node" text,
+  "started_at" datetime,
+  "finished_at" datetime,
+  "duration_ms" integer,
+  "error" text,
+  "updated_at" datetime,
+  PRIMARY KEY ("id")
+);
@@ -0,0 +1,14 @@
+-- 系统设置变更记录
+
+CREATE TABLE IF NOT EXISTS "setting_changes" (
+  "id" text NOT NULL,
+  "key" text,
+  "old_value" text,
+  "new_value" text,
+  "reset" numeric DEFAULT false,
+  "operator" text,
+  "created_at" datetime,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_setting_changes_key" ON "setting_changes" ("key");
+CREATE INDEX IF NOT EXISTS "idx_setting_changes_created_at" ON "setting_changes" ("created_at");
@@ -0,0 +1,15 @@
+-- 审计记录
+
+CREATE TABLE IF NOT EXISTS "audit_logs" (
+  "id" text NOT NULL,
+  "action" text,
+  "target" text,
+  "operator" text,
+  "client_ip" text,
+  "detail" text,
+  "created_at" datetime,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_action" ON "audit_logs" ("action");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_target" ON "audit_logs" ("target");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_created_at" ON "audit_logs" ("created_at");
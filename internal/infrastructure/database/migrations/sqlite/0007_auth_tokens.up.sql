@@ -0,0 +1,30 @@
+-- 刷新令牌和访问令牌吊销列表
+
+CREATE TABLE IF NOT EXISTS "refresh_tokens" (
+  "id" text NOT NULL,
+  "user_id" text,
+  "family_id" text,
+  "token_hash" text,
+  "access_jti" text,
+  "client_ip" text,
+  "user_agent" text,
+  "expires_at" datetime,
+  "used_at" datetime,
+  "revoked_at" datetime,
+  "created_at" datetime,
+  "updated_at" datetime,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_user_id" ON "refresh_tokens" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_family_id" ON "refresh_tokens" ("family_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_refresh_tokens_token_hash" ON "refresh_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_refresh_tokens_expires_at" ON "refresh_tokens" ("expires_at");
+
+CREATE TABLE IF NOT EXISTS "revoked_tokens" (
+  "id" text NOT NULL,
+  "user_id" text,
+  "expires_at" datetime,
+  "created_at" datetime,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_revoked_tokens_expires_at" ON "revoked_tokens" ("expires_at");
@@ -0,0 +1,420 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+// NewMongoRepositories 连接MongoDB并创建数据仓储
+// 文档字段名与SQL列名一致（取自实体的gorm标签），启动时按实体的index/uniqueIndex标签创建索引
+func NewMongoRepositories(cfg config.MongoDBConfig) (*repository.Repositories, error) {
+	registry, err := newMongoRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.URI).SetRegistry(registry))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to mongodb: %w", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to connect to mongodb: %w", err)
+	}
+
+	db := client.Database(cfg.Database)
+	tasks, taskErr := newMongoStore[entity.Task](ctx, db, registry)
+	users, userErr := newMongoStore[entity.User](ctx, db, registry)
+	accounts, accountErr := newMongoStore[entity.DiscordAccount](ctx, db, registry)
+	words, wordErr := newMongoStore[entity.BannedWord](ctx, db, registry)
+	settings, settingErr := newMongoStore[entity.Setting](ctx, db, registry)
+	tags, tagErr := newMongoStore[entity.DomainTag](ctx, db, registry)
+	messages, messageErr := newMongoStore[entity.Message](ctx, db, registry)
+	deliveries, deliveryErr := newMongoStore[entity.WebhookDelivery](ctx, db, registry)
+	leases, leaseErr := newMongoStore[entity.Lease](ctx, db, registry)
+	jobRuns, jobRunErr := newMongoStore[entity.JobRun](ctx, db, registry)
+	ipBans, ipBanErr := newMongoStore[entity.IPBan](ctx, db, registry)
+	settingChanges, settingChangeErr := newMongoStore[entity.SettingChange](ctx, db, registry)
+	auditLogs, auditLogErr := newMongoStore[entity.AuditLog](ctx, db, registry)
+	apiKeys, apiKeyErr := newMongoStore[entity.APIKey](ctx, db, registry)
+	refreshTokens, refreshTokenErr := newMongoStore[entity.RefreshToken](ctx, db, registry)
+	revokedTokens, revokedTokenErr := newMongoStore[entity.RevokedToken](ctx, db, registry)
+	if err := errors.Join(taskErr, userErr, accountErr, wordErr, settingErr, tagErr, messageErr, deliveryErr, leaseErr, jobRunErr, ipBanErr, settingChangeErr, auditLogErr, apiKeyErr, refreshTokenErr, revokedTokenErr); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to create mongodb indexes: %w", err)
+	}
+
+	return &repository.Repositories{
+		Tasks:             &mongoTaskRepository{tasks},
+		Users:             &mongoUserRepository{users},
+		Accounts:          &mongoAccountRepository{accounts},
+		BannedWords:       &mongoBannedWordRepository{words},
+		Settings:          &mongoSettingRepository{settings},
+		SettingChanges:    &mongoSettingChangeRepository{settingChanges},
+		DomainTags:        &mongoDomainTagRepository{tags},
+		Messages:          &mongoMessageRepository{messages},
+		WebhookDeliveries: &mongoWebhookDeliveryRepository{deliveries},
+		Leases:            &mongoLeaseRepository{leases},
+		JobRuns:           &mongoJobRunRepository{jobRuns},
+		IPBans:            &mongoIPBanRepository{ipBans},
+		AuditLogs:         &mongoAuditLogRepository{auditLogs},
+		APIKeys:           &mongoAPIKeyRepository{apiKeys},
+		RefreshTokens:     &mongoRefreshTokenRepository{refreshTokens},
+		RevokedTokens:     &mongoRevokedTokenRepository{revokedTokens},
+		Close: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return client.Disconnect(ctx)
+		},
+	}, nil
+}
+
+// newMongoRegistry 创建使用gorm列名作为字段名的编解码注册表
+func newMongoRegistry() (*bsoncodec.Registry, error) {
+	codec, err := bsoncodec.NewStructCodec(bsoncodec.StructTagParserFunc(mongoStructTags))
+	if err != nil {
+		return nil, err
+	}
+
+	registry := bson.NewRegistry()
+	registry.RegisterKindEncoder(reflect.Struct, codec)
+	registry.RegisterKindDecoder(reflect.Struct, codec)
+	// 未知类型的嵌套文档解码为map，与JSON列读取的结构一致
+	registry.RegisterTypeMapEntry(bsontype.EmbeddedDocument, reflect.TypeOf(bson.M{}))
+
+	return registry, nil
+}
+
+// mongoStructTags 字段名优先使用gorm列名，主键映射为_id；没有列名的嵌套结构（如按钮）使用json名称
+func mongoStructTags(sf reflect.StructField) (bsoncodec.StructTags, error) {
+	tag := sf.Tag.Get("gorm")
+	if tag == "-" {
+		return bsoncodec.StructTags{Name: sf.Name, Skip: true}, nil
+	}
+
+	settings := schema.ParseTagSetting(tag, ";")
+	if _, ok := settings["PRIMARYKEY"]; ok {
+		return bsoncodec.StructTags{Name: "_id"}, nil
+	}
+	if column := settings["COLUMN"]; column != "" {
+		return bsoncodec.StructTags{Name: column}, nil
+	}
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" && name != "-" {
+		return bsoncodec.StructTags{Name: name}, nil
+	}
+
+	return bsoncodec.DefaultStructTagParser(sf)
+}
+
+// mongoIndexes 按实体的gorm索引标签生成索引，同名索引合并为复合索引
+// 软删除字段按 deleted_at.valid 建索引，与查询条件对应
+func mongoIndexes(model interface{}) []mongo.IndexModel {
+	var indexes []mongo.IndexModel
+	positions := make(map[string]int)
+
+	modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		settings := schema.ParseTagSetting(field.Tag.Get("gorm"), ";")
+		column := settings["COLUMN"]
+		if column == "" {
+			continue
+		}
+		if field.Type == reflect.TypeOf(gorm.DeletedAt{}) {
+			column = "deleted_at.valid"
+		}
+
+		for _, kind := range []string{"INDEX", "UNIQUEINDEX"} {
+			value, ok := settings[kind]
+			if !ok {
+				continue
+			}
+
+			name, _, _ := strings.Cut(value, ",")
+			if name == kind {
+				name = ""
+			}
+			if pos, exists := positions[name]; exists && name != "" {
+				indexes[pos].Keys = append(indexes[pos].Keys.(bson.D), bson.E{Key: column, Value: 1})
+				continue
+			}
+
+			opts := options.Index().SetUnique(kind == "UNIQUEINDEX")
+			if name != "" {
+				opts.SetName(name)
+				positions[name] = len(indexes)
+			}
+			indexes = append(indexes, mongo.IndexModel{
+				Keys:    bson.D{{Key: column, Value: 1}},
+				Options: opts,
+			})
+		}
+	}
+
+	return indexes
+}
+
+// mongoStore 单个集合的通用读写，软删除与GORM一致：删除时写入deleted_at，查询时过滤已删除的文档
+type mongoStore[T any] struct {
+	coll       *mongo.Collection
+	registry   *bsoncodec.Registry
+	softDelete bool
+}
+
+// newMongoStore 创建集合访问对象并确保索引存在，集合名与表名一致
+func newMongoStore[T any](ctx context.Context, db *mongo.Database, registry *bsoncodec.Registry) (mongoStore[T], error) {
+	var model T
+	s := mongoStore[T]{
+		coll:     db.Collection(any(&model).(schema.Tabler).TableName()),
+		registry: registry,
+	}
+
+	if field, ok := reflect.TypeOf(model).FieldByName("DeletedAt"); ok && field.Type == reflect.TypeOf(gorm.DeletedAt{}) {
+		s.softDelete = true
+	}
+
+	if indexes := mongoIndexes(&model); len(indexes) > 0 {
+		if _, err := s.coll.Indexes().CreateMany(ctx, indexes); err != nil {
+			return s, fmt.Errorf("%s: %w", s.coll.Name(), err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s mongoStore[T]) Create(ctx context.Context, value *T) error {
+	if err := beforeSave(value); err != nil {
+		return err
+	}
+	_, err := s.coll.InsertOne(ctx, value)
+	if hookErr := afterSave(value); err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+func (s mongoStore[T]) Save(ctx context.Context, value *T) error {
+	if err := beforeSave(value); err != nil {
+		return err
+	}
+	_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": entityID(value)}, value, options.Replace().SetUpsert(true))
+	if hookErr := afterSave(value); err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+func (s mongoStore[T]) Get(ctx context.Context, id string) (*T, error) {
+	return s.first(ctx, bson.M{"_id": id})
+}
+
+func (s mongoStore[T]) Delete(ctx context.Context, id string) error {
+	return s.delete(ctx, bson.M{"_id": id})
+}
+
+// filter 追加未删除条件
+func (s mongoStore[T]) filter(filter bson.M) bson.M {
+	if s.softDelete {
+		filter["deleted_at.valid"] = bson.M{"$ne": true}
+	}
+	return filter
+}
+
+// unscoped 返回包括已删除文档的副本
+func (s mongoStore[T]) unscoped() mongoStore[T] {
+	s.softDelete = false
+	return s
+}
+
+// first 查询第一条文档，不存在时返回 repository.ErrNotFound
+func (s mongoStore[T]) first(ctx context.Context, filter bson.M) (*T, error) {
+	var value T
+	if err := s.coll.FindOne(ctx, s.filter(filter)).Decode(&value); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	if err := afterFind(&value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// find 查询文档列表
+func (s mongoStore[T]) find(ctx context.Context, filter bson.M, sort bson.D, offset, limit int) ([]T, error) {
+	opts := options.Find()
+	if len(sort) > 0 {
+		opts.SetSort(sort)
+	}
+	if offset > 0 {
+		opts.SetSkip(int64(offset))
+	}
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := s.coll.Find(ctx, s.filter(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []T
+	if err := cursor.All(ctx, &values); err != nil {
+		return nil, err
+	}
+	for i := range values {
+		if err := afterFind(&values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (s mongoStore[T]) count(ctx context.Context, filter bson.M) (int64, error) {
+	return s.coll.CountDocuments(ctx, s.filter(filter))
+}
+
+// update 更新匹配的第一条文档的指定字段并刷新更新时间，返回是否匹配到文档
+func (s mongoStore[T]) update(ctx context.Context, filter bson.M, fields bson.M) (bool, error) {
+	set := bson.M{"updated_at": time.Now()}
+	for key, value := range fields {
+		set[key] = value
+	}
+
+	result, err := s.coll.UpdateOne(ctx, s.filter(filter), bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (s mongoStore[T]) delete(ctx context.Context, filter bson.M) error {
+	if !s.softDelete {
+		_, err := s.coll.DeleteMany(ctx, filter)
+		return err
+	}
+
+	_, err := s.coll.UpdateMany(ctx, s.filter(filter), bson.M{"$set": bson.M{
+		"deleted_at": gorm.DeletedAt{Time: time.Now(), Valid: true},
+	}})
+	return err
+}
+
+// document 将实体编码为文档，用于按列更新
+func (s mongoStore[T]) document(value *T) (bson.M, error) {
+	var buf bytes.Buffer
+	writer, err := bsonrw.NewBSONValueWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := bson.NewEncoder(writer)
+	if err != nil {
+		return nil, err
+	}
+	if err := encoder.SetRegistry(s.registry); err != nil {
+		return nil, err
+	}
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(buf.Bytes(), &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// beforeSave 执行实体的序列化钩子并设置时间戳，与GORM的行为一致
+func beforeSave(value interface{}) error {
+	if hook, ok := value.(interface{ BeforeSave(*gorm.DB) error }); ok {
+		if err := hook.BeforeSave(nil); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	v := reflect.ValueOf(value).Elem()
+	if field := v.FieldByName("CreatedAt"); field.IsValid() && field.Interface().(time.Time).IsZero() {
+		field.Set(reflect.ValueOf(now))
+	}
+	if field := v.FieldByName("UpdatedAt"); field.IsValid() {
+		field.Set(reflect.ValueOf(now))
+	}
+
+	return nil
+}
+
+// afterSave 执行实体的保存后钩子，如将加密保存的字段还原为明文
+func afterSave(value interface{}) error {
+	if hook, ok := value.(interface{ AfterSave(*gorm.DB) error }); ok {
+		return hook.AfterSave(nil)
+	}
+	return nil
+}
+
+// afterFind 将JSON类字段还原为与SQL后端相同的类型（数字为float64、嵌套对象为map），并执行反序列化钩子
+func afterFind(value interface{}) error {
+	v := reflect.ValueOf(value).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		switch field.Interface().(type) {
+		case map[string]interface{}, []map[string]interface{}:
+			if field.IsNil() {
+				continue
+			}
+			data, err := json.Marshal(field.Interface())
+			if err != nil {
+				return err
+			}
+			normalized := reflect.New(field.Type())
+			if err := json.Unmarshal(data, normalized.Interface()); err != nil {
+				return err
+			}
+			field.Set(normalized.Elem())
+		}
+	}
+
+	if hook, ok := value.(interface{ AfterFind(*gorm.DB) error }); ok {
+		return hook.AfterFind(nil)
+	}
+	return nil
+}
+
+// entityID 读取实体的主键
+func entityID(value interface{}) string {
+	return reflect.ValueOf(value).Elem().FieldByName("ID").String()
+}
+
+// likePattern 与SQL的 LIKE '%keyword%' 对应的不区分大小写匹配
+func likePattern(keyword string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(keyword), "$options": "i"}
+}
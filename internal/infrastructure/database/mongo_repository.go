@@ -0,0 +1,577 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+)
+
+type mongoTaskRepository struct {
+	mongoStore[entity.Task]
+}
+
+// mongoTaskSorts 任务排序方式对应的排序字段
+var mongoTaskSorts = map[repository.TaskSort]bson.D{
+	repository.SortCreatedDesc: {{Key: "created_at", Value: -1}},
+	repository.SortSubmitAsc:   {{Key: "submit_time", Value: 1}},
+	repository.SortFinishAsc:   {{Key: "finish_time", Value: 1}},
+	repository.SortIDAsc:       {{Key: "_id", Value: 1}},
+}
+
+func (r *mongoTaskRepository) where(q repository.TaskQuery) bson.M {
+	filter := bson.M{}
+
+	id := bson.M{}
+	if len(q.IDs) > 0 {
+		id["$in"] = q.IDs
+	}
+	if q.AfterID != "" {
+		id["$gt"] = q.AfterID
+	}
+	if len(id) > 0 {
+		filter["_id"] = id
+	}
+
+	if q.UserID != "" {
+		filter["user_id"] = q.UserID
+	}
+	if q.InstanceID != "" {
+		filter["instance_id"] = q.InstanceID
+	}
+	if len(q.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": q.Statuses}
+	}
+	if len(q.ExcludeActions) > 0 {
+		filter["action"] = bson.M{"$nin": q.ExcludeActions}
+	}
+	if q.FailReason != "" {
+		filter["fail_reason"] = likePattern(q.FailReason)
+	}
+
+	finishTime := bson.M{}
+	if q.FinishedFrom != nil {
+		finishTime["$gte"] = q.FinishedFrom
+	}
+	if q.FinishedTo != nil {
+		finishTime["$lte"] = q.FinishedTo
+	}
+	if len(finishTime) > 0 {
+		filter["finish_time"] = finishTime
+	}
+
+	if q.CreatedFrom != nil {
+		filter["created_at"] = bson.M{"$gte": q.CreatedFrom}
+	}
+	if q.MissingThumbnail {
+		filter["image_url"] = bson.M{"$nin": bson.A{"", nil}}
+		filter["thumbnail_url"] = bson.M{"$in": bson.A{"", nil}}
+	}
+	if q.Stored {
+		filter["url"] = bson.M{"$nin": bson.A{"", nil}}
+		filter["$or"] = bson.A{
+			bson.M{"$expr": bson.M{"$ne": bson.A{"$image_url", "$url"}}},
+			bson.M{"thumbnail_url": bson.M{"$nin": bson.A{"", nil}}},
+		}
+	}
+
+	return filter
+}
+
+func (r *mongoTaskRepository) Find(ctx context.Context, q repository.TaskQuery) ([]entity.Task, error) {
+	return r.find(ctx, r.where(q), mongoTaskSorts[q.Sort], q.Offset, q.Limit)
+}
+
+func (r *mongoTaskRepository) Count(ctx context.Context, q repository.TaskQuery) (int64, error) {
+	return r.count(ctx, r.where(q))
+}
+
+func (r *mongoTaskRepository) SaveIfUnfinished(ctx context.Context, task *entity.Task) (bool, error) {
+	if err := beforeSave(task); err != nil {
+		return false, err
+	}
+	doc, err := r.document(task)
+	if err != nil {
+		return false, err
+	}
+	delete(doc, "_id")
+	delete(doc, "created_at")
+
+	return r.update(ctx, bson.M{
+		"_id":    task.ID,
+		"status": bson.M{"$in": entity.UnfinishedTaskStatuses},
+	}, doc)
+}
+
+func (r *mongoTaskRepository) SaveIfStatus(ctx context.Context, task *entity.Task, status entity.TaskStatus) (bool, error) {
+	if err := beforeSave(task); err != nil {
+		return false, err
+	}
+	doc, err := r.document(task)
+	if err != nil {
+		return false, err
+	}
+	delete(doc, "_id")
+	delete(doc, "created_at")
+
+	return r.update(ctx, bson.M{"_id": task.ID, "status": status}, doc)
+}
+
+func (r *mongoTaskRepository) UpdateIfUnfinished(ctx context.Context, id string, fields map[string]interface{}) (bool, error) {
+	return r.update(ctx, bson.M{
+		"_id":    id,
+		"status": bson.M{"$in": entity.UnfinishedTaskStatuses},
+	}, fields)
+}
+
+func (r *mongoTaskRepository) UpdateColumns(ctx context.Context, task *entity.Task, columns ...string) error {
+	if err := beforeSave(task); err != nil {
+		return err
+	}
+	doc, err := r.document(task)
+	if err != nil {
+		return err
+	}
+
+	fields := bson.M{}
+	for _, column := range columns {
+		fields[column] = doc[column]
+	}
+
+	_, err = r.update(ctx, bson.M{"_id": task.ID}, fields)
+	return err
+}
+
+type mongoUserRepository struct {
+	mongoStore[entity.User]
+}
+
+func (r *mongoUserRepository) GetByUsername(ctx context.Context, username string) (*entity.User, error) {
+	return r.first(ctx, bson.M{"username": username})
+}
+
+func (r *mongoUserRepository) GetByToken(ctx context.Context, role entity.UserRole, token string) (*entity.User, error) {
+	return r.first(ctx, bson.M{"role": role, "token": token})
+}
+
+func (r *mongoUserRepository) FindByUsernameOrEmail(ctx context.Context, username, email string) (*entity.User, error) {
+	return r.first(ctx, bson.M{"$or": bson.A{
+		bson.M{"username": username},
+		bson.M{"email": email},
+	}})
+}
+
+func (r *mongoUserRepository) where(q repository.UserQuery) bson.M {
+	filter := bson.M{}
+	if q.Keyword != "" {
+		filter["$or"] = bson.A{
+			bson.M{"username": likePattern(q.Keyword)},
+			bson.M{"email": likePattern(q.Keyword)},
+		}
+	}
+	if q.Role != "" {
+		filter["role"] = q.Role
+	}
+	if q.Enabled != nil {
+		filter["enabled"] = *q.Enabled
+	}
+	return filter
+}
+
+func (r *mongoUserRepository) Find(ctx context.Context, q repository.UserQuery) ([]entity.User, error) {
+	return r.find(ctx, r.where(q), bson.D{{Key: "created_at", Value: -1}}, q.Offset, q.Limit)
+}
+
+func (r *mongoUserRepository) Count(ctx context.Context, q repository.UserQuery) (int64, error) {
+	return r.count(ctx, r.where(q))
+}
+
+// AdjustDrawCount 使用聚合管道更新，保证结果不小于0（需要MongoDB 4.2及以上）
+func (r *mongoUserRepository) AdjustDrawCount(ctx context.Context, id string, delta int) (bool, error) {
+	adjust := func(field string) bson.M {
+		return bson.M{"$max": bson.A{0, bson.M{"$add": bson.A{"$" + field, delta}}}}
+	}
+
+	result, err := r.coll.UpdateOne(ctx, r.filter(bson.M{"_id": id}), mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"total_draw_count": adjust("total_draw_count"),
+			"day_draw_count":   adjust("day_draw_count"),
+			"updated_at":       time.Now(),
+		}}},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r *mongoUserRepository) ResetDayDrawCount(ctx context.Context) error {
+	_, err := r.coll.UpdateMany(ctx, r.filter(bson.M{"day_draw_count": bson.M{"$ne": 0}}), bson.M{"$set": bson.M{
+		"day_draw_count": 0,
+		"updated_at":     time.Now(),
+	}})
+	return err
+}
+
+type mongoAccountRepository struct {
+	mongoStore[entity.DiscordAccount]
+}
+
+func (r *mongoAccountRepository) GetByChannelID(ctx context.Context, channelID string) (*entity.DiscordAccount, error) {
+	return r.first(ctx, bson.M{"channel_id": channelID})
+}
+
+func (r *mongoAccountRepository) where(q repository.AccountQuery) bson.M {
+	filter := bson.M{}
+	if q.Keyword != "" {
+		filter["$or"] = bson.A{
+			bson.M{"channel_id": likePattern(q.Keyword)},
+			bson.M{"guild_id": likePattern(q.Keyword)},
+		}
+	}
+	return filter
+}
+
+func (r *mongoAccountRepository) store(q repository.AccountQuery) mongoStore[entity.DiscordAccount] {
+	if q.IncludeDeleted {
+		return r.unscoped()
+	}
+	return r.mongoStore
+}
+
+func (r *mongoAccountRepository) Find(ctx context.Context, q repository.AccountQuery) ([]entity.DiscordAccount, error) {
+	return r.store(q).find(ctx, r.where(q), bson.D{{Key: "created_at", Value: -1}}, q.Offset, q.Limit)
+}
+
+func (r *mongoAccountRepository) Count(ctx context.Context, q repository.AccountQuery) (int64, error) {
+	return r.store(q).count(ctx, r.where(q))
+}
+
+func (r *mongoAccountRepository) SaveCredentials(ctx context.Context, account *entity.DiscordAccount) error {
+	if err := beforeSave(account); err != nil {
+		return err
+	}
+	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": account.ID}, bson.M{"$set": bson.M{
+		"user_token":     account.UserToken,
+		"bot_token":      account.BotToken,
+		"login_password": account.LoginPassword,
+		"login_2fa":      account.Login2FA,
+	}})
+	if hookErr := afterSave(account); err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+func (r *mongoAccountRepository) SetEnabled(ctx context.Context, id string, enabled bool) error {
+	_, err := r.update(ctx, bson.M{"_id": id}, bson.M{"enabled": enabled})
+	return err
+}
+
+func (r *mongoAccountRepository) ResetDayDrawCount(ctx context.Context) error {
+	_, err := r.coll.UpdateMany(ctx, r.filter(bson.M{"day_draw_count": bson.M{"$ne": 0}}), bson.M{"$set": bson.M{
+		"day_draw_count": 0,
+		"updated_at":     time.Now(),
+	}})
+	return err
+}
+
+type mongoBannedWordRepository struct {
+	mongoStore[entity.BannedWord]
+}
+
+func (r *mongoBannedWordRepository) Find(ctx context.Context, enabledOnly bool) ([]entity.BannedWord, error) {
+	filter := bson.M{}
+	if enabledOnly {
+		filter["enabled"] = true
+	}
+	return r.find(ctx, filter, bson.D{{Key: "created_at", Value: -1}}, 0, 0)
+}
+
+type mongoSettingRepository struct {
+	mongoStore[entity.Setting]
+}
+
+func (r *mongoSettingRepository) Get(ctx context.Context, key string) (*entity.Setting, error) {
+	return r.first(ctx, bson.M{"key": key})
+}
+
+func (r *mongoSettingRepository) Find(ctx context.Context, group string) ([]entity.Setting, error) {
+	filter := bson.M{}
+	if group != "" {
+		filter["group"] = group
+	}
+	return r.find(ctx, filter, bson.D{{Key: "key", Value: 1}}, 0, 0)
+}
+
+// Delete 永久删除，键名有唯一索引，软删除的记录会阻止重新创建
+func (r *mongoSettingRepository) Delete(ctx context.Context, key string) error {
+	_, err := r.coll.DeleteMany(ctx, bson.M{"key": key})
+	return err
+}
+
+type mongoSettingChangeRepository struct {
+	mongoStore[entity.SettingChange]
+}
+
+func (r *mongoSettingChangeRepository) where(q repository.SettingChangeQuery) bson.M {
+	filter := bson.M{}
+	if q.Key != "" {
+		filter["key"] = q.Key
+	}
+	return filter
+}
+
+func (r *mongoSettingChangeRepository) Find(ctx context.Context, q repository.SettingChangeQuery) ([]entity.SettingChange, error) {
+	return r.find(ctx, r.where(q), bson.D{{Key: "created_at", Value: -1}}, q.Offset, q.Limit)
+}
+
+func (r *mongoSettingChangeRepository) Count(ctx context.Context, q repository.SettingChangeQuery) (int64, error) {
+	return r.count(ctx, r.where(q))
+}
+
+type mongoDomainTagRepository struct {
+	mongoStore[entity.DomainTag]
+}
+
+func (r *mongoDomainTagRepository) Find(ctx context.Context) ([]entity.DomainTag, error) {
+	return r.find(ctx, bson.M{}, bson.D{{Key: "sort", Value: 1}, {Key: "created_at", Value: -1}}, 0, 0)
+}
+
+type mongoMessageRepository struct {
+	mongoStore[entity.Message]
+}
+
+func (r *mongoMessageRepository) Find(ctx context.Context, q repository.MessageQuery) ([]entity.Message, error) {
+	filter := bson.M{}
+	if q.ChannelID != "" {
+		filter["channel_id"] = q.ChannelID
+	}
+	if q.MessageID != "" {
+		filter["message_id"] = q.MessageID
+	}
+	if q.Hash != "" {
+		filter["hash"] = q.Hash
+	}
+	return r.find(ctx, filter, bson.D{{Key: "timestamp", Value: -1}}, 0, q.Limit)
+}
+
+type mongoWebhookDeliveryRepository struct {
+	mongoStore[entity.WebhookDelivery]
+}
+
+func (r *mongoWebhookDeliveryRepository) where(q repository.WebhookDeliveryQuery) bson.M {
+	filter := bson.M{}
+	if q.TaskID != "" {
+		filter["task_id"] = q.TaskID
+	}
+	if q.Status != "" {
+		filter["status"] = q.Status
+	}
+	return filter
+}
+
+func (r *mongoWebhookDeliveryRepository) Find(ctx context.Context, q repository.WebhookDeliveryQuery) ([]entity.WebhookDelivery, error) {
+	return r.find(ctx, r.where(q), bson.D{{Key: "created_at", Value: -1}}, q.Offset, q.Limit)
+}
+
+func (r *mongoWebhookDeliveryRepository) Count(ctx context.Context, q repository.WebhookDeliveryQuery) (int64, error) {
+	return r.count(ctx, r.where(q))
+}
+
+func (r *mongoWebhookDeliveryRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	_, err := r.update(ctx, bson.M{"_id": id}, fields)
+	return err
+}
+
+func (r *mongoWebhookDeliveryRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.coll.DeleteMany(ctx, bson.M{
+		"created_at": bson.M{"$lt": before},
+		"status":     bson.M{"$ne": entity.WebhookDeliveryPending},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+type mongoLeaseRepository struct {
+	mongoStore[entity.Lease]
+}
+
+// TryAcquire 按条件更新租约，不存在时插入；租约由其他持有者持有时插入会因主键冲突失败
+func (r *mongoLeaseRepository) TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"holder": holder},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"holder":     holder,
+		"expires_at": now.Add(ttl),
+		"updated_at": now,
+	}}
+
+	_, err := r.coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *mongoLeaseRepository) Release(ctx context.Context, name, holder string) error {
+	_, err := r.coll.DeleteOne(ctx, bson.M{"_id": name, "holder": holder})
+	return err
+}
+
+type mongoJobRunRepository struct {
+	mongoStore[entity.JobRun]
+}
+
+func (r *mongoJobRunRepository) Find(ctx context.Context) ([]entity.JobRun, error) {
+	return r.find(ctx, bson.M{}, bson.D{{Key: "_id", Value: 1}}, 0, 0)
+}
+
+type mongoIPBanRepository struct {
+	mongoStore[entity.IPBan]
+}
+
+func (r *mongoIPBanRepository) Find(ctx context.Context, activeOnly bool) ([]entity.IPBan, error) {
+	filter := bson.M{}
+	if activeOnly {
+		filter["$or"] = bson.A{
+			bson.M{"expires_at": nil},
+			bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		}
+	}
+	return r.find(ctx, filter, bson.D{{Key: "updated_at", Value: -1}}, 0, 0)
+}
+
+type mongoAuditLogRepository struct {
+	mongoStore[entity.AuditLog]
+}
+
+func (r *mongoAuditLogRepository) where(q repository.AuditLogQuery) bson.M {
+	filter := bson.M{}
+	if q.Action != "" {
+		filter["action"] = q.Action
+	}
+	if q.Target != "" {
+		filter["target"] = q.Target
+	}
+	return filter
+}
+
+func (r *mongoAuditLogRepository) Find(ctx context.Context, q repository.AuditLogQuery) ([]entity.AuditLog, error) {
+	return r.find(ctx, r.where(q), bson.D{{Key: "created_at", Value: -1}}, q.Offset, q.Limit)
+}
+
+func (r *mongoAuditLogRepository) Count(ctx context.Context, q repository.AuditLogQuery) (int64, error) {
+	return r.count(ctx, r.where(q))
+}
+
+type mongoAPIKeyRepository struct {
+	mongoStore[entity.APIKey]
+}
+
+func (r *mongoAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*entity.APIKey, error) {
+	return r.first(ctx, bson.M{"key_hash": hash})
+}
+
+func (r *mongoAPIKeyRepository) where(q repository.APIKeyQuery) bson.M {
+	filter := bson.M{}
+	if q.UserID != "" {
+		filter["user_id"] = q.UserID
+	}
+	if !q.IncludeRevoked {
+		filter["revoked_at"] = nil
+	}
+	return filter
+}
+
+func (r *mongoAPIKeyRepository) Find(ctx context.Context, q repository.APIKeyQuery) ([]entity.APIKey, error) {
+	return r.find(ctx, r.where(q), bson.D{{Key: "created_at", Value: -1}}, q.Offset, q.Limit)
+}
+
+func (r *mongoAPIKeyRepository) Count(ctx context.Context, q repository.APIKeyQuery) (int64, error) {
+	return r.count(ctx, r.where(q))
+}
+
+func (r *mongoAPIKeyRepository) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	_, err := r.update(ctx, bson.M{"_id": id}, fields)
+	return err
+}
+
+type mongoRefreshTokenRepository struct {
+	mongoStore[entity.RefreshToken]
+}
+
+func (r *mongoRefreshTokenRepository) GetByHash(ctx context.Context, hash string) (*entity.RefreshToken, error) {
+	return r.first(ctx, bson.M{"token_hash": hash})
+}
+
+func (r *mongoRefreshTokenRepository) MarkUsed(ctx context.Context, id string, usedAt time.Time) (bool, error) {
+	return r.update(ctx, bson.M{"_id": id, "used_at": nil, "revoked_at": nil}, bson.M{"used_at": usedAt})
+}
+
+func (r *mongoRefreshTokenRepository) where(q repository.RefreshTokenQuery) bson.M {
+	filter := bson.M{}
+	if q.UserID != "" {
+		filter["user_id"] = q.UserID
+	}
+	if q.FamilyID != "" {
+		filter["family_id"] = q.FamilyID
+	}
+	if !q.CreatedAfter.IsZero() {
+		filter["created_at"] = bson.M{"$gt": q.CreatedAfter}
+	}
+	return filter
+}
+
+func (r *mongoRefreshTokenRepository) Find(ctx context.Context, q repository.RefreshTokenQuery) ([]entity.RefreshToken, error) {
+	return r.find(ctx, r.where(q), bson.D{{Key: "created_at", Value: -1}}, 0, 0)
+}
+
+func (r *mongoRefreshTokenRepository) Revoke(ctx context.Context, q repository.RefreshTokenQuery, revokedAt time.Time) (int64, error) {
+	filter := r.where(q)
+	filter["revoked_at"] = nil
+	result, err := r.coll.UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		"revoked_at": revokedAt,
+		"updated_at": time.Now(),
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoRefreshTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.coll.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+type mongoRevokedTokenRepository struct {
+	mongoStore[entity.RevokedToken]
+}
+
+func (r *mongoRevokedTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.coll.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -24,6 +24,7 @@ const (
 type AccountSelector struct {
 	mode         AccountSelectMode
 	pollingIndex int
+	sharedIndex  func() (int64, error)
 	mutex        sync.RWMutex
 	logger       logger.Logger
 }
@@ -195,13 +196,29 @@ func (s *AccountSelector) selectByPolling(instances []*Instance) *Instance {
 		return accountI.ID < accountJ.ID
 	})
 
-	// 轮询选择
-	selected := instances[s.pollingIndex%len(instances)]
+	// 轮询选择，多副本时使用共享的递增计数，共享计数不可用时退回本地索引
+	index := s.pollingIndex
+	if s.sharedIndex != nil {
+		if n, err := s.sharedIndex(); err == nil {
+			index = int(n - 1)
+		} else {
+			s.logger.Warnf("Failed to increase shared polling index: %v", err)
+		}
+	}
+	selected := instances[index%len(instances)]
 	s.pollingIndex++
 
 	return selected
 }
 
+// SetSharedIndex 设置副本间共享的轮询计数函数，返回递增后的计数
+func (s *AccountSelector) SetSharedIndex(next func() (int64, error)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sharedIndex = next
+}
+
 // GetSelectMode 获取选择模式
 func (s *AccountSelector) GetSelectMode() AccountSelectMode {
 	return s.mode
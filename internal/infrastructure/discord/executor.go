@@ -0,0 +1,225 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// ErrQueueFull 队列已满
+var ErrQueueFull = errors.New("任务队列已满")
+
+// ErrExecutorStopped 执行器已停止
+var ErrExecutorStopped = errors.New("任务执行器已停止")
+
+// 账号未配置并发数和队列长度时的默认值
+const (
+	DefaultCoreSize  = 3
+	DefaultQueueSize = 10
+)
+
+// TaskRunner 任务执行函数
+type TaskRunner func(ctx context.Context, instance *Instance, task *entity.Task) error
+
+// Executor 账号任务执行器，按CoreSize并发执行，按QueueSize限制排队数量
+type Executor struct {
+	instance  *Instance
+	coreSize  int
+	queueSize int
+	runner    TaskRunner
+	logger    logger.Logger
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	queue   []*entity.Task
+	running map[string]context.CancelFunc
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// NewExecutor 创建任务执行器
+func NewExecutor(instance *Instance, coreSize, queueSize int, runner TaskRunner, logger logger.Logger) *Executor {
+	if coreSize <= 0 {
+		coreSize = DefaultCoreSize
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	e := &Executor{
+		instance:  instance,
+		coreSize:  coreSize,
+		queueSize: queueSize,
+		runner:    runner,
+		logger:    logger,
+		running:   make(map[string]context.CancelFunc),
+	}
+	e.cond = sync.NewCond(&e.mutex)
+
+	return e
+}
+
+// Start 启动工作协程
+func (e *Executor) Start() {
+	for i := 0; i < e.coreSize; i++ {
+		e.wg.Add(1)
+		go e.worker()
+	}
+}
+
+// Stop 停止执行器，取消正在执行的任务
+func (e *Executor) Stop() {
+	e.mutex.Lock()
+	e.stopped = true
+	for _, cancel := range e.running {
+		cancel()
+	}
+	e.cond.Broadcast()
+	e.mutex.Unlock()
+
+	e.wg.Wait()
+}
+
+// Submit 提交任务到队列
+func (e *Executor) Submit(task *entity.Task) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.stopped {
+		return ErrExecutorStopped
+	}
+	if len(e.queue) >= e.queueSize {
+		return ErrQueueFull
+	}
+
+	e.queue = append(e.queue, task)
+	e.cond.Signal()
+
+	return nil
+}
+
+// Remove 从队列中移除尚未执行的任务
+func (e *Executor) Remove(taskID string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for i, task := range e.queue {
+		if task.ID == taskID {
+			e.queue = append(e.queue[:i], e.queue[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cancel 取消正在执行的任务
+func (e *Executor) Cancel(taskID string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if cancel, exists := e.running[taskID]; exists {
+		cancel()
+		return true
+	}
+
+	return false
+}
+
+// IsQueued 任务是否在队列中
+func (e *Executor) IsQueued(taskID string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, task := range e.queue {
+		if task.ID == taskID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsRunning 任务是否正在执行
+func (e *Executor) IsRunning(taskID string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	_, exists := e.running[taskID]
+	return exists
+}
+
+// QueueCount 排队任务数
+func (e *Executor) QueueCount() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return len(e.queue)
+}
+
+// HasCapacity 队列是否还能接收任务
+func (e *Executor) HasCapacity() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return !e.stopped && len(e.queue) < e.queueSize
+}
+
+// RunningCount 执行中任务数
+func (e *Executor) RunningCount() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return len(e.running)
+}
+
+// worker 工作协程
+func (e *Executor) worker() {
+	defer e.wg.Done()
+
+	for {
+		e.mutex.Lock()
+		for len(e.queue) == 0 && !e.stopped {
+			e.cond.Wait()
+		}
+		if e.stopped {
+			e.mutex.Unlock()
+			return
+		}
+
+		task := e.queue[0]
+		e.queue = e.queue[1:]
+
+		ctx, cancel := context.WithCancel(context.Background())
+		e.running[task.ID] = cancel
+		e.mutex.Unlock()
+
+		e.execute(ctx, task)
+
+		e.mutex.Lock()
+		delete(e.running, task.ID)
+		e.mutex.Unlock()
+		cancel()
+	}
+}
+
+// execute 执行单个任务
+func (e *Executor) execute(ctx context.Context, task *entity.Task) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.logger.Errorf("Task %s panicked on instance %s: %v", task.ID, e.instance.ID, r)
+		}
+	}()
+
+	if e.runner == nil {
+		e.logger.Warnf("No task runner registered, task %s dropped", task.ID)
+		return
+	}
+
+	if err := e.runner(ctx, e.instance, task); err != nil {
+		e.logger.Errorf("Task %s failed on instance %s: %v", task.ID, e.instance.ID, err)
+	}
+}
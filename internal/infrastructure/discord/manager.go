@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 	
 	"github.com/gorilla/websocket"
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
 	"midjourney-proxy-go/internal/infrastructure/config"
 	"midjourney-proxy-go/pkg/logger"
 )
@@ -19,22 +22,47 @@ type Manager struct {
 	logger     logger.Logger
 	instances  map[string]*Instance
 	selector   *AccountSelector
+	httpClient *http.Client
+	runner     atomic.Pointer[TaskRunner] // 执行器的工作协程读取，不经过mutex，避免停止执行器时死锁
+	onMessage  MessageHandler
 	mutex      sync.RWMutex
 	started    bool
 	stopCh     chan struct{}
+
+	// 集群模式：每个账号由持有账号锁的副本连接，accounts为全部已启用的账号
+	node        *cluster.Node
+	accounts    map[string]config.DiscordAccount
+	lastRenewed map[string]time.Time
+}
+
+// accountLockTTL 账号锁有效期，持有者每 accountLockTTL/3 续期一次，
+// 持有者宕机后其他副本最迟在该时间后接管账号
+const accountLockTTL = 30 * time.Second
+
+// AccountLockName 账号锁名称
+func AccountLockName(accountID string) string {
+	return "account:" + accountID
 }
 
 // Instance Discord实例
 type Instance struct {
-	ID        string
-	Account   config.DiscordAccount
-	Connected bool
-	LastPing  time.Time
-	conn      *websocket.Conn
-	ctx       context.Context
-	cancel    context.CancelFunc
-	heartbeat chan struct{}
-	messages  chan DiscordMessage
+	ID         string
+	Account    config.DiscordAccount
+	Connected  bool
+	LastPing   time.Time
+	conn       *websocket.Conn
+	ctx        context.Context
+	cancel     context.CancelFunc
+	heartbeat  chan struct{}
+	messages   chan DiscordMessage
+	executor   *Executor
+	server     string
+	httpClient *http.Client
+	sessionID  string
+
+	// 斜杠命令缓存
+	commandMutex sync.Mutex
+	commands     map[string]*ApplicationCommand
 }
 
 // DiscordMessage Discord消息结构
@@ -45,6 +73,9 @@ type DiscordMessage struct {
 	T    string          `json:"t"`
 }
 
+// MessageHandler 处理Midjourney机器人消息的回调，eventType为 MESSAGE_CREATE 或 MESSAGE_UPDATE
+type MessageHandler func(instance *Instance, eventType string, message *Message)
+
 // HelloPayload Discord Hello消息
 type HelloPayload struct {
 	HeartbeatInterval int `json:"heartbeat_interval"`
@@ -62,47 +93,138 @@ type IdentifyPayload struct {
 }
 
 // NewManager 创建Discord管理器
-func NewManager(config config.DiscordConfig, logger logger.Logger) *Manager {
+func NewManager(cfg config.DiscordConfig, logger logger.Logger) *Manager {
 	return &Manager{
-		config:    config,
+		config:    cfg,
 		logger:    logger,
 		instances: make(map[string]*Instance),
-		selector:  NewAccountSelector(AccountSelectBestWaitIdle, logger),
-		stopCh:    make(chan struct{}),
+		selector:   NewAccountSelector(AccountSelectBestWaitIdle, logger),
+		httpClient: NewHTTPClient(cfg.Proxy),
+		stopCh:     make(chan struct{}),
+		accounts:    make(map[string]config.DiscordAccount),
+		lastRenewed: make(map[string]time.Time),
 	}
 }
 
-// Start 启动Discord管理器
-func (m *Manager) Start() error {
+// accountRemovedChannel 账号移除的集群广播频道
+const accountRemovedChannel = "discord:account-removed"
+
+// SetClusterNode 启用集群模式，需在Start之前调用：
+// 账号只在获取到账号锁后连接，账号移除会广播到所有副本，轮询选择的索引在副本间共享
+func (m *Manager) SetClusterNode(node *cluster.Node) error {
+	err := node.Subscribe(accountRemovedChannel, func(data json.RawMessage) {
+		var id string
+		if err := json.Unmarshal(data, &id); err == nil {
+			m.removeAccount(id)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe %s: %w", accountRemovedChannel, err)
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+
+	m.node = node
+	m.selector.SetSharedIndex(func() (int64, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		return node.Incr(ctx, "selector:polling")
+	})
+
+	return nil
+}
+
+// ClusterNode 集群节点，未启用集群模式时为nil
+func (m *Manager) ClusterNode() *cluster.Node {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.node
+}
+
+// Accounts 全部已启用的账号，集群模式下包括由其他副本连接的账号
+func (m *Manager) Accounts() []config.DiscordAccount {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	accounts := make([]config.DiscordAccount, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// SetTaskRunner 设置任务执行函数，需在Start之前调用
+func (m *Manager) SetTaskRunner(runner TaskRunner) {
+	m.runner.Store(&runner)
+}
+
+// SetMessageHandler 设置Midjourney机器人消息的处理函数
+func (m *Manager) SetMessageHandler(handler MessageHandler) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.onMessage = handler
+}
+
+// newInstance 创建Discord实例及其任务执行器
+func (m *Manager) newInstance(account config.DiscordAccount) *Instance {
+	instance := &Instance{
+		ID:         account.ID,
+		Account:    account,
+		Connected:  false,
+		LastPing:   time.Now(),
+		heartbeat:  make(chan struct{}),
+		messages:   make(chan DiscordMessage, 100),
+		server:     m.config.NgDiscord.Server,
+		httpClient: m.httpClient,
+	}
+	instance.executor = NewExecutor(instance, account.CoreSize, account.QueueSize, m.runTask, m.logger)
+
+	return instance
+}
+
+// runTask 调用已注册的任务执行函数。在执行器的工作协程中调用，不能获取mutex：
+// 停止实例时会等待工作协程退出
+func (m *Manager) runTask(ctx context.Context, instance *Instance, task *entity.Task) error {
+	runner := m.runner.Load()
+	if runner == nil {
+		return fmt.Errorf("task runner not registered")
+	}
+
+	return (*runner)(ctx, instance, task)
+}
+
+// Start 启动Discord管理器，集群模式下返回时已获取到锁的账号均已启动
+func (m *Manager) Start() error {
+	m.mutex.Lock()
 	
 	if m.started {
+		m.mutex.Unlock()
 		return nil
 	}
 	
 	m.logger.Info("Starting Discord manager...")
 	
-	// 初始化Discord实例
+	// 初始化Discord实例，集群模式下由ownershipLoop在获取账号锁后启动
 	for _, account := range m.config.Accounts {
 		if account.Enabled {
-			instance := &Instance{
-				ID:        account.ID,
-				Account:   account,
-				Connected: false,
-				LastPing:  time.Now(),
-				heartbeat: make(chan struct{}),
-				messages:  make(chan DiscordMessage, 100),
+			m.accounts[account.ID] = account
+			if m.node == nil {
+				m.launch(account)
 			}
-			
-			m.instances[account.ID] = instance
-			
-			// 启动WebSocket连接
-			go m.startInstance(instance)
 		}
 	}
 	
 	m.started = true
+	node := m.node
+	m.mutex.Unlock()
+
+	if node != nil {
+		m.syncOwnership()
+		go m.ownershipLoop()
+	}
 	m.logger.Info("Discord manager started")
 	
 	return nil
@@ -111,22 +233,31 @@ func (m *Manager) Start() error {
 // Stop 停止Discord管理器
 func (m *Manager) Stop() {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	
 	if !m.started {
+		m.mutex.Unlock()
 		return
 	}
 	
 	m.logger.Info("Stopping Discord manager...")
 	
 	close(m.stopCh)
-	
-	// 停止所有实例
+	m.started = false
+
+	instances := make([]*Instance, 0, len(m.instances))
 	for _, instance := range m.instances {
+		instances = append(instances, instance)
+	}
+	m.lastRenewed = make(map[string]time.Time)
+	node := m.node
+	m.mutex.Unlock()
+
+	// 停止所有实例，集群模式下释放账号锁以便其他副本立即接管。
+	// 停止执行器会等待正在执行的任务退出，必须在释放mutex之后进行
+	for _, instance := range instances {
 		m.stopInstance(instance)
+		m.releaseLock(node, instance.ID)
 	}
 	
-	m.started = false
 	m.logger.Info("Discord manager stopped")
 }
 
@@ -151,6 +282,51 @@ func (m *Manager) GetAvailableInstanceWithFilter(filter *entity.AccountFilter) *
 	return m.selector.SelectAccount(m.instances, filter)
 }
 
+// GetAvailableInstanceExcluding 根据过滤器获取可用的Discord实例，并排除指定实例
+func (m *Manager) GetAvailableInstanceExcluding(filter *entity.AccountFilter, excludeIDs []string) *Instance {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	excluded := make(map[string]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		excluded[id] = true
+	}
+
+	candidates := make(map[string]*Instance, len(m.instances))
+	for id, instance := range m.instances {
+		if !excluded[id] {
+			candidates[id] = instance
+		}
+	}
+
+	return m.selector.SelectAccount(candidates, filter)
+}
+
+// WaitConnected 等待所有实例完成连接，超时或ctx取消时返回
+func (m *Manager) WaitConnected(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		allConnected := true
+		for _, instance := range m.GetAllInstances() {
+			if !instance.IsConnected() {
+				allConnected = false
+				break
+			}
+		}
+		if allConnected {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // GetAllInstances 获取所有Discord实例
 func (m *Manager) GetAllInstances() map[string]*Instance {
 	m.mutex.RLock()
@@ -170,19 +346,23 @@ func (m *Manager) AddAccount(account config.DiscordAccount) error {
 	defer m.mutex.Unlock()
 	
 	if account.Enabled {
-		instance := &Instance{
-			ID:        account.ID,
-			Account:   account,
-			Connected: false,
-			LastPing:  time.Now(),
-			heartbeat: make(chan struct{}),
-			messages:  make(chan DiscordMessage, 100),
+		m.accounts[account.ID] = account
+
+		// 集群模式下由获取到账号锁的副本启动
+		if m.node != nil {
+			if m.started {
+				go m.syncOwnership()
+			}
+			return nil
 		}
+
+		instance := m.newInstance(account)
 		
 		m.instances[account.ID] = instance
 		
 		// 如果管理器已启动，立即启动新实例
 		if m.started {
+			instance.executor.Start()
 			go m.startInstance(instance)
 		}
 	}
@@ -190,19 +370,140 @@ func (m *Manager) AddAccount(account config.DiscordAccount) error {
 	return nil
 }
 
-// RemoveAccount 移除Discord账号
+// RemoveAccount 移除Discord账号，集群模式下通知连接该账号的副本断开
 func (m *Manager) RemoveAccount(id string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	
-	if instance, exists := m.instances[id]; exists {
-		m.stopInstance(instance)
-		delete(m.instances, id)
+	m.removeAccount(id)
+
+	if node := m.ClusterNode(); node != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return node.Publish(ctx, accountRemovedChannel, id)
 	}
 	
 	return nil
 }
 
+// removeAccount 移除本副本的账号和实例，实例在释放mutex之后停止
+func (m *Manager) removeAccount(id string) {
+	m.mutex.Lock()
+	delete(m.accounts, id)
+	instance, exists := m.instances[id]
+	if exists {
+		delete(m.instances, id)
+		delete(m.lastRenewed, id)
+	}
+	node := m.node
+	m.mutex.Unlock()
+
+	if exists {
+		m.stopInstance(instance)
+		m.releaseLock(node, id)
+	}
+}
+
+// launch 创建并启动实例，调用方需持有写锁
+func (m *Manager) launch(account config.DiscordAccount) {
+	instance := m.newInstance(account)
+	m.instances[account.ID] = instance
+
+	// 启动任务执行器和WebSocket连接
+	instance.executor.Start()
+	go m.startInstance(instance)
+}
+
+// ownershipLoop 集群模式下定期续期已持有的账号锁，并尝试获取无人持有的账号锁，
+// 保证每个账号只由一个副本连接
+func (m *Manager) ownershipLoop() {
+	ticker := time.NewTicker(accountLockTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			m.syncOwnership()
+		}
+	}
+}
+
+// syncOwnership 获取或续期每个账号的锁：新获取的账号启动实例，失去锁的账号停止实例
+func (m *Manager) syncOwnership() {
+	m.mutex.RLock()
+	node := m.node
+	accounts := make([]config.DiscordAccount, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	m.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), accountLockTTL/3)
+	defer cancel()
+
+	for _, account := range accounts {
+		acquired, err := node.NewLock(AccountLockName(account.ID), accountLockTTL).TryAcquire(ctx)
+
+		// 需要停止的实例和释放的锁在释放mutex之后处理
+		var stopping *Instance
+		release := false
+
+		m.mutex.Lock()
+		if !m.started {
+			m.mutex.Unlock()
+			return
+		}
+		instance, owned := m.instances[account.ID]
+		_, known := m.accounts[account.ID]
+
+		switch {
+		case err != nil:
+			// Redis不可用时保持现状，但超过锁有效期仍未续期成功时其他副本可能已接管，必须断开
+			m.logger.Warnf("Failed to renew lock of Discord account %s: %v", account.ID, err)
+			if owned && time.Since(m.lastRenewed[account.ID]) > accountLockTTL {
+				m.logger.Warnf("Lock of Discord account %s expired, disconnecting", account.ID)
+				stopping = instance
+				delete(m.instances, account.ID)
+			}
+		case acquired && !known:
+			// 获取锁期间账号已被移除
+			release = true
+			delete(m.lastRenewed, account.ID)
+		case acquired:
+			m.lastRenewed[account.ID] = time.Now()
+			if !owned {
+				m.logger.Infof("Acquired Discord account %s on node %s", account.ID, node.ID())
+				m.launch(account)
+			}
+		case owned:
+			m.logger.Warnf("Lost lock of Discord account %s, disconnecting", account.ID)
+			stopping = instance
+			delete(m.instances, account.ID)
+		}
+		m.mutex.Unlock()
+
+		if stopping != nil {
+			m.stopInstance(stopping)
+		}
+		if release {
+			m.releaseLock(node, account.ID)
+		}
+	}
+}
+
+// releaseLock 集群模式下释放账号锁，会访问Redis，不能在持有mutex时调用
+func (m *Manager) releaseLock(node *cluster.Node, id string) {
+	if node == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := node.NewLock(AccountLockName(id), accountLockTTL).Release(ctx); err != nil {
+		m.logger.Warnf("Failed to release lock of Discord account %s: %v", id, err)
+	}
+}
+
 // startInstance 启动Discord实例
 func (m *Manager) startInstance(instance *Instance) {
 	m.logger.Infof("Starting Discord instance: %s", instance.ID)
@@ -323,6 +624,12 @@ func (m *Manager) handleDispatch(instance *Instance, msg DiscordMessage) {
 	switch msg.T {
 	case "READY":
 		m.logger.Infof("Instance %s is ready", instance.ID)
+		var ready struct {
+			SessionID string `json:"session_id"`
+		}
+		if err := json.Unmarshal(msg.D, &ready); err == nil {
+			instance.sessionID = ready.SessionID
+		}
 		instance.Connected = true
 	case "MESSAGE_CREATE", "MESSAGE_UPDATE":
 		// 处理Midjourney机器人消息
@@ -335,8 +642,27 @@ func (m *Manager) handleDispatch(instance *Instance, msg DiscordMessage) {
 
 // handleMidjourneyMessage 处理Midjourney消息
 func (m *Manager) handleMidjourneyMessage(instance *Instance, msg DiscordMessage) {
-	// TODO: 解析Midjourney机器人消息，更新任务状态
-	m.logger.Debugf("Received Midjourney message in instance %s", instance.ID)
+	var message Message
+	if err := json.Unmarshal(msg.D, &message); err != nil {
+		m.logger.Warnf("Failed to parse %s in instance %s: %v", msg.T, instance.ID, err)
+		return
+	}
+
+	// 仅处理本实例频道中Midjourney/Niji机器人的消息
+	if message.Author.ID != MidjourneyApplicationID && message.Author.ID != NijiApplicationID {
+		return
+	}
+	if instance.Account.ChannelID != "" && message.ChannelID != instance.Account.ChannelID {
+		return
+	}
+
+	m.mutex.RLock()
+	handler := m.onMessage
+	m.mutex.RUnlock()
+
+	if handler != nil {
+		handler(instance, msg.T, &message)
+	}
 }
 
 // handleInteraction 处理交互
@@ -373,7 +699,7 @@ func (m *Manager) sendHeartbeat(instance *Instance) {
 	}
 }
 
-// stopInstance 停止Discord实例
+// stopInstance 停止Discord实例，等待执行器的工作协程退出，调用方不能持有mutex
 func (m *Manager) stopInstance(instance *Instance) {
 	m.logger.Infof("Stopping Discord instance: %s", instance.ID)
 	
@@ -386,6 +712,7 @@ func (m *Manager) stopInstance(instance *Instance) {
 	}
 	
 	instance.Connected = false
+	instance.executor.Stop()
 	
 	m.logger.Infof("Discord instance stopped: %s", instance.ID)
 }
@@ -411,15 +738,9 @@ func (i *Instance) SendMessage(channelID, content string) error {
 	return nil
 }
 
-// SubmitImagine 提交Imagine任务
-func (i *Instance) SubmitImagine(prompt string) error {
-	if !i.Connected {
-		return fmt.Errorf("instance not connected")
-	}
-	
-	// TODO: 实现提交Imagine任务逻辑
-	// 这需要构造Discord交互负载并通过HTTP API发送
-	return nil
+// Executor 获取任务执行器
+func (i *Instance) Executor() *Executor {
+	return i.executor
 }
 
 // SetAccountSelectMode 设置账号选择模式
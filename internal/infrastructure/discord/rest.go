@@ -0,0 +1,312 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+// DefaultServer Discord默认API地址
+const DefaultServer = "https://discord.com"
+
+// ErrUnauthorized Discord拒绝了账号Token，通常是Token失效或账号被封禁
+var ErrUnauthorized = errors.New("discord token is unauthorized")
+
+// Attachment Discord消息附件
+type Attachment struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	URL         string `json:"url"`
+	ProxyURL    string `json:"proxy_url"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+}
+
+// MessageAuthor Discord消息作者
+type MessageAuthor struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot,omitempty"`
+}
+
+// Message Discord消息
+type Message struct {
+	ID          string          `json:"id"`
+	ChannelID   string          `json:"channel_id"`
+	Content     string          `json:"content"`
+	Nonce       string          `json:"nonce,omitempty"`
+	Author      MessageAuthor   `json:"author"`
+	Attachments []Attachment    `json:"attachments"`
+	Components  json.RawMessage `json:"components,omitempty"`
+	Timestamp   time.Time       `json:"timestamp"`
+}
+
+// NewHTTPClient 创建HTTP客户端，按配置启用代理
+func NewHTTPClient(proxy config.ProxyConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy.Enabled && proxy.Host != "" {
+		proxyURL := &url.URL{
+			Scheme: "http",
+			Host:   fmt.Sprintf("%s:%d", proxy.Host, proxy.Port),
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+	}
+}
+
+// apiURL 拼接Discord API地址
+func (i *Instance) apiURL(path string) string {
+	server := strings.TrimRight(i.server, "/")
+	if server == "" {
+		server = DefaultServer
+	}
+	return server + "/api/v10" + path
+}
+
+// doRequest 发送Discord REST请求
+func (i *Instance) doRequest(ctx context.Context, method, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, i.apiURL(path), body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", i.Account.UserToken)
+	req.Header.Set("Content-Type", "application/json")
+	if i.Account.UserAgent != "" {
+		req.Header.Set("User-Agent", i.Account.UserAgent)
+	}
+
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("%w: %s", ErrUnauthorized, string(data))
+		}
+		return fmt.Errorf("discord api returned %d: %s", resp.StatusCode, string(data))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// FetchMessages 获取频道最近的消息
+func (i *Instance) FetchMessages(ctx context.Context, limit int) ([]Message, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	var messages []Message
+	path := fmt.Sprintf("/channels/%s/messages?limit=%d", i.Account.ChannelID, limit)
+	if err := i.doRequest(ctx, http.MethodGet, path, nil, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// discordEpoch Discord雪花ID纪元（毫秒）
+const discordEpoch = 1420070400000
+
+// NewNonce 生成Discord交互使用的nonce
+func NewNonce() string {
+	return strconv.FormatInt((time.Now().UnixMilli()-discordEpoch)<<22, 10)
+}
+
+// Midjourney机器人应用ID
+const (
+	MidjourneyApplicationID = "936929561302675456"
+	NijiApplicationID       = "1022952195194359889"
+)
+
+// applicationID 机器人类型对应的应用ID
+func applicationID(botType entity.BotType) string {
+	if botType == entity.BotTypeNijijourney {
+		return NijiApplicationID
+	}
+	return MidjourneyApplicationID
+}
+
+// ClickButton 点击机器人消息上的按钮组件
+func (i *Instance) ClickButton(ctx context.Context, messageID, customID, nonce string, botType entity.BotType) error {
+	return i.interact(ctx, map[string]interface{}{
+		"type":           3,
+		"nonce":          nonce,
+		"guild_id":       i.Account.GuildID,
+		"channel_id":     i.Account.ChannelID,
+		"message_flags":  0,
+		"message_id":     messageID,
+		"application_id": applicationID(botType),
+		"session_id":     i.sessionID,
+		"data": map[string]interface{}{
+			"component_type": 2,
+			"custom_id":      customID,
+		},
+	})
+}
+
+// ApplicationCommand 服务器中可用的斜杠命令
+type ApplicationCommand struct {
+	ID            string `json:"id"`
+	ApplicationID string `json:"application_id"`
+	Version       string `json:"version"`
+	Name          string `json:"name"`
+	Type          int    `json:"type"`
+}
+
+// applicationCommand 查询机器人的斜杠命令。命令ID和版本随机器人更新变化，
+// 不写死在代码中，首次使用时查询并缓存，交互失败时清除缓存以便重新查询
+func (i *Instance) applicationCommand(ctx context.Context, applicationID, name string) (*ApplicationCommand, error) {
+	cacheKey := applicationID + ":" + name
+
+	i.commandMutex.Lock()
+	defer i.commandMutex.Unlock()
+
+	if command, exists := i.commands[cacheKey]; exists {
+		return command, nil
+	}
+
+	var index struct {
+		ApplicationCommands []ApplicationCommand `json:"application_commands"`
+	}
+	path := fmt.Sprintf("/guilds/%s/application-command-index", i.Account.GuildID)
+	if err := i.doRequest(ctx, http.MethodGet, path, nil, &index); err != nil {
+		return nil, fmt.Errorf("failed to query application commands: %w", err)
+	}
+
+	for idx := range index.ApplicationCommands {
+		command := &index.ApplicationCommands[idx]
+		if command.ApplicationID == applicationID && command.Name == name && command.Type == 1 {
+			if i.commands == nil {
+				i.commands = make(map[string]*ApplicationCommand)
+			}
+			i.commands[cacheKey] = command
+			return command, nil
+		}
+	}
+	return nil, fmt.Errorf("command /%s of application %s not found in guild %s", name, applicationID, i.Account.GuildID)
+}
+
+// forgetCommand 清除缓存的斜杠命令
+func (i *Instance) forgetCommand(applicationID, name string) {
+	i.commandMutex.Lock()
+	defer i.commandMutex.Unlock()
+
+	delete(i.commands, applicationID+":"+name)
+}
+
+// SubmitImagine 在账号频道中执行 /imagine 命令
+func (i *Instance) SubmitImagine(ctx context.Context, prompt, nonce string, botType entity.BotType) error {
+	if !i.Connected || i.sessionID == "" {
+		return fmt.Errorf("instance not connected")
+	}
+
+	appID := applicationID(botType)
+	command, err := i.applicationCommand(ctx, appID, "imagine")
+	if err != nil {
+		return err
+	}
+
+	err = i.interact(ctx, map[string]interface{}{
+		"type":           2,
+		"nonce":          nonce,
+		"guild_id":       i.Account.GuildID,
+		"channel_id":     i.Account.ChannelID,
+		"application_id": appID,
+		"session_id":     i.sessionID,
+		"data": map[string]interface{}{
+			"version": command.Version,
+			"id":      command.ID,
+			"name":    command.Name,
+			"type":    command.Type,
+			"options": []map[string]interface{}{
+				{"type": 3, "name": "prompt", "value": prompt},
+			},
+			"attachments": []interface{}{},
+		},
+	})
+	if err != nil {
+		// 命令版本可能已过期
+		i.forgetCommand(appID, "imagine")
+		return err
+	}
+	return nil
+}
+
+// interact 发送交互请求
+func (i *Instance) interact(ctx context.Context, payload map[string]interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal interaction: %w", err)
+	}
+
+	return i.doRequest(ctx, http.MethodPost, "/interactions", bytes.NewReader(data), nil)
+}
+
+// AccountInfo 使用账号Token从Discord读取的账号信息
+type AccountInfo struct {
+	UserID   string
+	Username string
+	// GuildID 账号频道所在的服务器
+	GuildID string
+}
+
+// FetchAccountInfo 读取账号Token对应的用户和账号频道，不需要连接Gateway，
+// 账号不必由本副本运行。Token失效时返回 ErrUnauthorized
+func (m *Manager) FetchAccountInfo(ctx context.Context, account config.DiscordAccount) (*AccountInfo, error) {
+	instance := &Instance{
+		ID:         account.ID,
+		Account:    account,
+		server:     m.config.NgDiscord.Server,
+		httpClient: m.httpClient,
+	}
+
+	var user struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := instance.doRequest(ctx, http.MethodGet, "/users/@me", nil, &user); err != nil {
+		return nil, err
+	}
+
+	var channel struct {
+		GuildID string `json:"guild_id"`
+	}
+	if err := instance.doRequest(ctx, http.MethodGet, "/channels/"+url.PathEscape(account.ChannelID), nil, &channel); err != nil {
+		return nil, err
+	}
+
+	return &AccountInfo{
+		UserID:   user.ID,
+		Username: user.Username,
+		GuildID:  channel.GuildID,
+	}, nil
+}
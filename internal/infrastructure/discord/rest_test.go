@@ -0,0 +1,53 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+func TestFetchAccountInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "good-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "401: Unauthorized", "code": 0}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v10/users/@me":
+			w.Write([]byte(`{"id": "42", "username": "painter"}`))
+		case "/api/v10/channels/channel-1":
+			w.Write([]byte(`{"id": "channel-1", "guild_id": "guild-1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	manager := NewManager(config.DiscordConfig{NgDiscord: config.NgDiscordConfig{Server: server.URL}}, logger.New("error", "text"))
+	account := config.DiscordAccount{ID: "account-1", ChannelID: "channel-1", UserToken: "good-token"}
+
+	info, err := manager.FetchAccountInfo(context.Background(), account)
+	if err != nil {
+		t.Fatalf("FetchAccountInfo: %v", err)
+	}
+	if info.UserID != "42" || info.Username != "painter" || info.GuildID != "guild-1" {
+		t.Fatalf("info = %+v", info)
+	}
+
+	account.UserToken = "revoked-token"
+	if _, err := manager.FetchAccountInfo(context.Background(), account); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("FetchAccountInfo with revoked token = %v, want ErrUnauthorized", err)
+	}
+
+	account.UserToken = "good-token"
+	account.ChannelID = "missing"
+	if _, err := manager.FetchAccountInfo(context.Background(), account); err == nil || errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("FetchAccountInfo with missing channel = %v, want a non-auth error", err)
+	}
+}
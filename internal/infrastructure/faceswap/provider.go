@@ -0,0 +1,50 @@
+package faceswap
+
+import (
+	"context"
+	"errors"
+
+	"midjourney-proxy-go/internal/domain/entity"
+)
+
+// 预测状态，与Replicate一致
+const (
+	StatusStarting   = "starting"
+	StatusProcessing = "processing"
+	StatusSucceeded  = "succeeded"
+	StatusFailed     = "failed"
+	StatusCanceled   = "canceled"
+)
+
+// ErrPredictionNotFound 服务提供方不存在该预测
+var ErrPredictionNotFound = errors.New("换脸任务不存在")
+
+// Input 换脸输入，Source为人脸图片，Target为被替换的图片或视频
+type Input struct {
+	Source *entity.DataURL
+	Target *entity.DataURL
+}
+
+// Prediction 换脸任务在服务提供方的状态
+type Prediction struct {
+	ID       string
+	Status   string
+	Output   []string
+	Error    string
+	Progress int // 0-100，服务提供方未返回进度时为-1
+}
+
+// IsFinished 是否已结束
+func (p *Prediction) IsFinished() bool {
+	return p.Status == StatusSucceeded || p.Status == StatusFailed || p.Status == StatusCanceled
+}
+
+// Provider 换脸服务提供方
+type Provider interface {
+	// Create 创建换脸任务
+	Create(ctx context.Context, input Input) (*Prediction, error)
+	// Get 查询换脸任务状态
+	Get(ctx context.Context, id string) (*Prediction, error)
+	// Cancel 取消换脸任务
+	Cancel(ctx context.Context, id string) error
+}
@@ -0,0 +1,179 @@
+package faceswap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultReplicateURL Replicate API地址
+const DefaultReplicateURL = "https://api.replicate.com"
+
+// logProgressPattern 日志中的进度条，如 " 45%|████"
+var logProgressPattern = regexp.MustCompile(`(\d{1,3})%\|`)
+
+// ReplicateConfig Replicate兼容服务配置
+type ReplicateConfig struct {
+	BaseURL     string // 服务地址，可指向本地兼容服务
+	Token       string // API Token
+	Version     string // 模型版本
+	SourceField string // 人脸图片的输入字段名
+	TargetField string // 目标文件的输入字段名
+}
+
+// ReplicateProvider Replicate兼容的换脸服务，文件以data URL形式随请求提交
+type ReplicateProvider struct {
+	cfg    ReplicateConfig
+	client *http.Client
+}
+
+// replicatePrediction Replicate预测响应
+type replicatePrediction struct {
+	ID     string          `json:"id"`
+	Status string          `json:"status"`
+	Output json.RawMessage `json:"output"`
+	Error  interface{}     `json:"error"`
+	Logs   string          `json:"logs"`
+}
+
+// NewReplicateProvider 创建Replicate兼容的换脸服务
+func NewReplicateProvider(cfg ReplicateConfig) *ReplicateProvider {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultReplicateURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+
+	return &ReplicateProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Create 创建换脸任务
+func (p *ReplicateProvider) Create(ctx context.Context, input Input) (*Prediction, error) {
+	body := map[string]interface{}{
+		"version": p.cfg.Version,
+		"input": map[string]interface{}{
+			p.cfg.SourceField: input.Source.String(),
+			p.cfg.TargetField: input.Target.String(),
+		},
+	}
+
+	var prediction replicatePrediction
+	if err := p.do(ctx, http.MethodPost, "/v1/predictions", body, &prediction); err != nil {
+		return nil, err
+	}
+
+	return prediction.convert(), nil
+}
+
+// Get 查询换脸任务状态
+func (p *ReplicateProvider) Get(ctx context.Context, id string) (*Prediction, error) {
+	var prediction replicatePrediction
+	if err := p.do(ctx, http.MethodGet, "/v1/predictions/"+id, nil, &prediction); err != nil {
+		return nil, err
+	}
+
+	return prediction.convert(), nil
+}
+
+// Cancel 取消换脸任务
+func (p *ReplicateProvider) Cancel(ctx context.Context, id string) error {
+	return p.do(ctx, http.MethodPost, "/v1/predictions/"+id+"/cancel", nil, nil)
+}
+
+// do 发送请求并解析响应
+func (p *ReplicateProvider) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.cfg.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("face swap request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read face swap response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrPredictionNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var problem struct {
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(data, &problem) == nil && problem.Detail != "" {
+			return fmt.Errorf("face swap provider returned status %d: %s", resp.StatusCode, problem.Detail)
+		}
+		return fmt.Errorf("face swap provider returned status %d", resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse face swap response: %w", err)
+	}
+
+	return nil
+}
+
+// convert 转换为通用的预测状态，输出可能是单个地址或地址数组
+func (r *replicatePrediction) convert() *Prediction {
+	prediction := &Prediction{
+		ID:       r.ID,
+		Status:   r.Status,
+		Progress: -1,
+	}
+
+	if len(r.Output) > 0 {
+		var single string
+		if err := json.Unmarshal(r.Output, &single); err == nil {
+			if single != "" {
+				prediction.Output = []string{single}
+			}
+		} else {
+			json.Unmarshal(r.Output, &prediction.Output)
+		}
+	}
+
+	if r.Error != nil {
+		prediction.Error = fmt.Sprint(r.Error)
+	}
+
+	if matches := logProgressPattern.FindAllStringSubmatch(r.Logs, -1); len(matches) > 0 {
+		if progress, err := strconv.Atoi(matches[len(matches)-1][1]); err == nil && progress <= 100 {
+			prediction.Progress = progress
+		}
+	}
+	if prediction.Status == StatusSucceeded {
+		prediction.Progress = 100
+	}
+
+	return prediction
+}
@@ -0,0 +1,300 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+const (
+	defaultTimeout      = 30
+	defaultMaxSizeMB    = 20
+	defaultMaxRedirects = 3
+	userAgent           = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+var (
+	// ErrInvalidURL 不支持的链接
+	ErrInvalidURL = errors.New("无效的链接")
+	// ErrPrivateAddress 链接指向内网地址
+	ErrPrivateAddress = errors.New("不允许访问内网地址")
+	// ErrTooManyRedirects 重定向次数过多
+	ErrTooManyRedirects = errors.New("重定向次数过多")
+	// ErrTooLarge 文件超过大小限制
+	ErrTooLarge = errors.New("文件超过大小限制")
+	// ErrUnsupportedType 文件类型不允许
+	ErrUnsupportedType = errors.New("不支持的文件类型")
+)
+
+// 默认禁止访问的保留地址段，标准库未覆盖的部分
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // 本网络
+	"100.64.0.0/10", // 运营商级NAT
+	"192.0.0.0/24",  // IETF协议分配
+	"198.18.0.0/15", // 基准测试
+	"240.0.0.0/4",   // 保留
+	"64:ff9b::/96",  // NAT64，可映射到内网IPv4
+)
+
+// Fetcher 远程文件下载器，限制超时、大小、重定向次数，并按内容判断类型
+type Fetcher struct {
+	client       *http.Client
+	maxSize      int64
+	allowPrivate bool
+}
+
+// New 创建下载器
+func New(cfg config.FetchConfig) *Fetcher {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	maxSizeMB := cfg.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultMaxSizeMB
+	}
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects < 0 {
+		maxRedirects = 0
+	} else if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	f := &Fetcher{
+		maxSize:      maxSizeMB << 20,
+		allowPrivate: cfg.AllowPrivateNetwork,
+	}
+
+	dialer := NewDialer(f.allowPrivate)
+
+	f.client = &http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+		Transport: &http.Transport{
+			// 不使用环境变量中的代理，否则无法校验实际访问的地址
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: time.Duration(timeout) * time.Second,
+			MaxIdleConns:          20,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return ErrTooManyRedirects
+			}
+			return CheckURL(req.URL, f.allowPrivate)
+		},
+	}
+
+	return f
+}
+
+// MaxSize 单个文件大小上限（字节）
+func (f *Fetcher) MaxSize() int64 {
+	return f.maxSize
+}
+
+// FetchImage 下载图片
+func (f *Fetcher) FetchImage(ctx context.Context, rawURL string) (*entity.DataURL, error) {
+	return f.Fetch(ctx, rawURL, "image/")
+}
+
+// Fetch 下载文件并转换为内存形式，allowed为允许的类型前缀（如 image/、video/mp4）
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, allowed ...string) (*entity.DataURL, error) {
+	return f.FetchWithLimit(ctx, rawURL, f.maxSize, allowed...)
+}
+
+// FetchWithLimit 按指定的大小上限下载文件，用于上限与全局配置不同的场景（如视频）
+func (f *Fetcher) FetchWithLimit(ctx context.Context, rawURL string, maxSize int64, allowed ...string) (*entity.DataURL, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	if err := CheckURL(u, f.allowPrivate); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// 重定向和拨号校验返回的错误会被包装，还原为原始错误便于调用方判断
+		for _, target := range []error{ErrPrivateAddress, ErrTooManyRedirects, ErrInvalidURL} {
+			if errors.Is(err, target) {
+				return nil, target
+			}
+		}
+		return nil, fmt.Errorf("下载失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载失败: 状态码 %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	// 响应头声明了明确的类型时先行校验，避免下载无关内容
+	declared, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if declared != "" && declared != "application/octet-stream" && declared != "binary/octet-stream" && !typeAllowed(declared, allowed) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, declared)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("下载失败: %w", err)
+	}
+
+	file := &entity.DataURL{Data: data}
+	if err := f.ValidateWithLimit(file, maxSize, allowed...); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Validate 校验内存中的文件大小，并按文件头重新判断类型；base64输入与下载结果使用同一规则
+func (f *Fetcher) Validate(file *entity.DataURL, allowed ...string) error {
+	return f.ValidateWithLimit(file, f.maxSize, allowed...)
+}
+
+// ValidateWithLimit 按指定的大小上限校验文件
+func (f *Fetcher) ValidateWithLimit(file *entity.DataURL, maxSize int64, allowed ...string) error {
+	if int64(len(file.Data)) > maxSize {
+		return ErrTooLarge
+	}
+	if len(file.Data) == 0 {
+		return fmt.Errorf("%w: 空文件", ErrUnsupportedType)
+	}
+
+	sniffed := entity.SniffContentType(file.Data)
+	if !typeAllowed(sniffed, allowed) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, sniffed)
+	}
+	file.MimeType = sniffed
+
+	return nil
+}
+
+// NewDialer 创建拨号器，不允许内网地址时在连接时检查实际解析出的地址，防止DNS重绑定绕过
+func NewDialer(allowPrivate bool) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || IsPrivateIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	return dialer
+}
+
+// CheckURL 校验协议和主机，主机为IP时直接检查是否为内网地址
+func CheckURL(u *url.URL, allowPrivate bool) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalidURL
+	}
+	host := u.Hostname()
+	if host == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && IsPrivateIP(ip) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
+
+// CheckHost 解析主机名，任一地址为内网地址时返回 ErrPrivateAddress；
+// 用于保存配置时提前拒绝，实际连接仍由 NewDialer 的检查兜底
+func CheckHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if IsPrivateIP(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if IsPrivateIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// IsPrivateIP 是否为回环、内网、链路本地等不应从服务端访问的地址
+func IsPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeAllowed 类型是否匹配允许的前缀，未指定前缀时只允许图片
+func typeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		allowed = []string{"image/"}
+	}
+	for _, prefix := range allowed {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustParseCIDRs 解析地址段
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
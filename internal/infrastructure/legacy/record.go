@@ -0,0 +1,324 @@
+package legacy
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Record .NET版的一条记录。MongoDB中字段为PascalCase、枚举为序号，
+// JSON导出可能为camelCase、枚举为名称，JSON字段（如FreeSql的JsonMap列）可能是字符串，
+// 因此字段名不区分大小写，取值时统一转换
+type Record map[string]interface{}
+
+// newRecord 将BSON文档转换为记录，嵌套文档和数组转换为普通的map和切片
+func newRecord(doc bson.M) Record {
+	record := make(Record, len(doc))
+	for key, value := range doc {
+		record[strings.ToLower(key)] = normalize(value)
+	}
+	return record
+}
+
+// normalize 将BSON类型转换为JSON兼容的Go类型
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		return normalize(map[string]interface{}(v))
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = normalize(item)
+		}
+		return m
+	case bson.D:
+		m := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			m[item.Key] = normalize(item.Value)
+		}
+		return m
+	case bson.A:
+		return normalize([]interface{}(v))
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalize(item)
+		}
+		return list
+	case primitive.DateTime:
+		return v.Time().Local()
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.Decimal128:
+		f, _ := strconv.ParseFloat(v.String(), 64)
+		return f
+	case primitive.Binary:
+		return v.Data
+	default:
+		return v
+	}
+}
+
+// ID 记录ID，MongoDB和LiteDB为 _id，其他导出为 Id
+func (r Record) ID() string {
+	if id := r.String("_id"); id != "" {
+		return id
+	}
+	return r.String("id")
+}
+
+func (r Record) get(name string) interface{} {
+	return r[strings.ToLower(name)]
+}
+
+// String 字符串字段
+func (r Record) String(name string) string {
+	switch v := r.get(name).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		if n, ok := toInt64(v); ok {
+			return strconv.FormatInt(n, 10)
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// Int 整数字段，不存在或无法转换时返回def
+func (r Record) Int(name string, def int) int {
+	value := r.get(name)
+	if n, ok := toInt64(value); ok {
+		return int(n)
+	}
+	if f, ok := toFloat64(value); ok {
+		return int(f)
+	}
+	return def
+}
+
+// Int64 可空整数字段
+func (r Record) Int64(name string) *int64 {
+	value := r.get(name)
+	if n, ok := toInt64(value); ok {
+		return &n
+	}
+	if f, ok := toFloat64(value); ok {
+		n := int64(f)
+		return &n
+	}
+	return nil
+}
+
+// Float 小数字段，C#的decimal在MongoDB中可能存为字符串或Decimal128
+func (r Record) Float(name string, def float64) float64 {
+	if f, ok := toFloat64(r.get(name)); ok {
+		return f
+	}
+	return def
+}
+
+// Bool 布尔字段，不存在时返回def
+func (r Record) Bool(name string, def bool) bool {
+	switch v := r.get(name).(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	default:
+		if n, ok := toInt64(v); ok {
+			return n != 0
+		}
+	}
+	return def
+}
+
+// timeLayouts JSON导出中日期时间字符串的格式
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.9999999",
+	"2006-01-02 15:04:05.9999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Time 日期时间字段（C#的DateTime）
+func (r Record) Time(name string) *time.Time {
+	switch v := r.get(name).(type) {
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		return &v
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil && !t.IsZero() {
+				return &t
+			}
+		}
+	}
+	return nil
+}
+
+// Millis 毫秒时间戳字段（TaskInfo的提交、开始、结束时间）
+func (r Record) Millis(name string) *time.Time {
+	ms := r.Int64(name)
+	if ms == nil || *ms <= 0 {
+		return r.Time(name)
+	}
+	t := time.UnixMilli(*ms)
+	return &t
+}
+
+// Enum 枚举字段，names按C#枚举序号排列（序号不连续时用空字符串占位），
+// 序号或名称均可识别，无法识别时返回空字符串
+func (r Record) Enum(name string, names []string) string {
+	return enumName(r.get(name), names)
+}
+
+func enumName(value interface{}, names []string) string {
+	if s, ok := value.(string); ok {
+		if n, err := strconv.Atoi(s); err == nil {
+			value = n
+		} else {
+			for _, item := range names {
+				if item != "" && strings.EqualFold(item, s) {
+					return item
+				}
+			}
+			return ""
+		}
+	}
+	if n, ok := toInt64(value); ok && n >= 0 && int(n) < len(names) {
+		return names[n]
+	}
+	return ""
+}
+
+// Enums 枚举数组字段
+func (r Record) Enums(name string, names []string) []string {
+	var result []string
+	for _, item := range r.List(name) {
+		if s := enumName(item, names); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Strings 字符串数组字段
+func (r Record) Strings(name string) []string {
+	var result []string
+	for _, item := range r.List(name) {
+		if s, ok := item.(string); ok && s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// List 数组字段，JSON字符串会先解析
+func (r Record) List(name string) []interface{} {
+	switch v := r.json(name).(type) {
+	case []interface{}:
+		return v
+	default:
+		return nil
+	}
+}
+
+// Map 对象字段，JSON字符串会先解析
+func (r Record) Map(name string) map[string]interface{} {
+	switch v := r.json(name).(type) {
+	case map[string]interface{}:
+		return v
+	default:
+		return nil
+	}
+}
+
+// Records 对象数组字段，元素同样按不区分大小写的方式取值
+func (r Record) Records(name string) []Record {
+	var result []Record
+	for _, item := range r.List(name) {
+		if m, ok := item.(map[string]interface{}); ok {
+			result = append(result, newRecord(bson.M(m)))
+		}
+	}
+	return result
+}
+
+// Object 对象字段
+func (r Record) Object(name string) Record {
+	if m := r.Map(name); m != nil {
+		return newRecord(bson.M(m))
+	}
+	return nil
+}
+
+// json 取值，字符串形式的JSON数组或对象会被解析
+func (r Record) json(name string) interface{} {
+	value := r.get(name)
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") && !strings.HasPrefix(s, "{") {
+		return nil
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+		return nil
+	}
+	return parsed
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), v == math.Trunc(v)
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		if n, ok := toInt64(v); ok {
+			return float64(n), true
+		}
+		return 0, false
+	}
+}
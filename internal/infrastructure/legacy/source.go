@@ -0,0 +1,173 @@
+package legacy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// .NET版的集合名称，与其MongoDB集合名（BsonCollection）一致
+const (
+	CollectionTask    = "task"
+	CollectionUser    = "user"
+	CollectionAccount = "account"
+	CollectionWord    = "word"
+)
+
+// Source .NET版数据来源
+type Source interface {
+	// Each 按顺序遍历集合中的全部记录，集合不存在时直接返回
+	Each(ctx context.Context, collection string, fn func(Record) error) error
+	// Close 关闭数据来源
+	Close(ctx context.Context) error
+}
+
+// jsonSource 从导出目录读取，每个集合一个文件：<集合名>.json 或 <集合名>.jsonl，
+// 内容为JSON数组或逐行的JSON文档，支持MongoDB扩展JSON（mongoexport、LiteDB导出）
+type jsonSource struct {
+	dir string
+}
+
+// NewJSONSource 创建JSON导出目录数据来源
+func NewJSONSource(dir string) (Source, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &jsonSource{dir: dir}, nil
+}
+
+func (s *jsonSource) Each(ctx context.Context, collection string, fn func(Record) error) error {
+	var file *os.File
+	for _, ext := range []string{".json", ".jsonl"} {
+		f, err := os.Open(filepath.Join(s.dir, collection+ext))
+		if err == nil {
+			file = f
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if file == nil {
+		return nil
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	decoder := json.NewDecoder(reader)
+
+	// JSON数组需要先读取开头的 [
+	if first, err := peekNonSpace(reader); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	} else if first == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	for index := 1; decoder.More(); index++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("%s: document %d: %w", file.Name(), index, err)
+		}
+		var doc bson.M
+		if err := bson.UnmarshalExtJSON(raw, false, &doc); err != nil {
+			return fmt.Errorf("%s: document %d: %w", file.Name(), index, err)
+		}
+		if err := fn(newRecord(doc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonSource) Close(ctx context.Context) error {
+	return nil
+}
+
+// peekNonSpace 跳过空白（包括UTF-8 BOM），返回第一个有效字符但不读取它
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		r, size, err := reader.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r == '\uFEFF' || strings.ContainsRune(" \t\r\n", r) {
+			continue
+		}
+		if err := reader.UnreadRune(); err != nil {
+			return 0, err
+		}
+		if size != 1 {
+			return 0, nil
+		}
+		return byte(r), nil
+	}
+}
+
+// mongoSource 直接读取.NET版使用的MongoDB数据库
+type mongoSource struct {
+	client   *mongo.Client
+	database *mongo.Database
+}
+
+// NewMongoSource 创建MongoDB数据来源
+func NewMongoSource(ctx context.Context, uri, database string) (Source, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to mongodb: %w", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("failed to ping mongodb: %w", err)
+	}
+
+	return &mongoSource{
+		client:   client,
+		database: client.Database(database),
+	}, nil
+}
+
+func (s *mongoSource) Each(ctx context.Context, collection string, fn func(Record) error) error {
+	cursor, err := s.database.Collection(collection).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(newRecord(doc)); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (s *mongoSource) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
+}
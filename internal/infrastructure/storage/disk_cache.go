@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiskCache 按总大小限制的磁盘LRU缓存，键需为可作文件名的字符串（如哈希）
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+	entries  map[string]*list.Element
+	order    *list.List // 最近使用的在前
+	size     int64
+	mutex    sync.Mutex
+}
+
+// cacheEntry 缓存条目
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewDiskCache 创建磁盘缓存，并按修改时间载入目录中已有的文件
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+
+	type existing struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var files []existing
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if filepath.Ext(path) == ".tmp" {
+			os.Remove(path)
+			return nil
+		}
+		files = append(files, existing{key: info.Name(), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for _, file := range files {
+		c.entries[file.key] = c.order.PushBack(&cacheEntry{key: file.key, size: file.size})
+		c.size += file.size
+	}
+	c.evict()
+
+	return c, nil
+}
+
+// Open 打开缓存文件并标记为最近使用，不存在时返回 ErrNotFound
+func (c *DiskCache) Open(key string) (*os.File, int64, error) {
+	c.mutex.Lock()
+	element, exists := c.entries[key]
+	if exists {
+		c.order.MoveToFront(element)
+	}
+	c.mutex.Unlock()
+
+	if !exists {
+		return nil, 0, ErrNotFound
+	}
+
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.remove(key)
+			return nil, 0, ErrNotFound
+		}
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+
+	return file, info.Size(), nil
+}
+
+// Put 写入缓存，超过上限时淘汰最久未使用的文件
+func (c *DiskCache) Put(key string, reader io.Reader) (int64, error) {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.size -= element.Value.(*cacheEntry).size
+		c.order.Remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, size: size})
+	c.size += size
+	c.evict()
+
+	return size, nil
+}
+
+// Size 当前缓存总大小
+func (c *DiskCache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.size
+}
+
+// evict 淘汰至不超过上限，调用方需持有锁；上限不大于0时不限制
+func (c *DiskCache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		element := c.order.Back()
+		entry := element.Value.(*cacheEntry)
+		c.order.Remove(element)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		os.Remove(c.path(entry.key))
+	}
+}
+
+// remove 移除条目，调用方不需持有锁
+func (c *DiskCache) remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.size -= element.Value.(*cacheEntry).size
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// path 缓存文件路径，按键的前两个字符分目录
+func (c *DiskCache) path(key string) string {
+	if len(key) > 2 {
+		return filepath.Join(c.dir, key[:2], key)
+	}
+	return filepath.Join(c.dir, key)
+}
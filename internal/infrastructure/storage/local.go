@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+const (
+	// LocalURLPrefix 未配置CDN时本地文件的访问路径前缀，由路由提供静态文件服务
+	LocalURLPrefix = "/attachments"
+	// DefaultLocalPath 默认本地存储目录
+	DefaultLocalPath = "./data/attachments"
+)
+
+// LocalStorage 本地文件存储
+type LocalStorage struct {
+	root string
+	cdn  string
+}
+
+// NewLocalStorage 创建本地文件存储
+func NewLocalStorage(cfg config.LocalConfig) (*LocalStorage, error) {
+	root := cfg.Path
+	if root == "" {
+		root = DefaultLocalPath
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	cdn := cfg.CDN
+	if cdn == "" {
+		cdn = LocalURLPrefix
+	}
+
+	return &LocalStorage{root: root, cdn: cdn}, nil
+}
+
+// Root 本地存储根目录
+func (s *LocalStorage) Root() string {
+	return s.root
+}
+
+// Save 保存文件，先写临时文件再重命名，避免读到不完整的文件
+func (s *LocalStorage) Save(ctx context.Context, key string, reader io.Reader, contentType string) (*UploadResult, error) {
+	filePath, key, err := s.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return nil, fmt.Errorf("failed to move file: %w", err)
+	}
+
+	if contentType == "" {
+		contentType = ContentTypeByKey(key)
+	}
+
+	return &UploadResult{
+		Key:         key,
+		URL:         s.URL(key),
+		Size:        size,
+		ContentType: contentType,
+	}, nil
+}
+
+// Get 读取文件
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	filePath, _, err := s.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Exists 文件是否存在
+func (s *LocalStorage) Exists(ctx context.Context, key string) (bool, error) {
+	filePath, _, err := s.filePath(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete 删除文件
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	filePath, _, err := s.filePath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// URL 文件访问地址
+func (s *LocalStorage) URL(key string) string {
+	return joinURL(s.cdn, key)
+}
+
+// filePath 对象键对应的文件路径
+func (s *LocalStorage) filePath(key string) (string, string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), key, nil
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+const (
+	s3Service   = "s3"
+	s3Algorithm = "AWS4-HMAC-SHA256"
+	amzDateFmt  = "20060102T150405Z"
+	amzDayFmt   = "20060102"
+)
+
+// S3Storage S3兼容对象存储，使用AWS Signature V4签名，支持AWS S3、MinIO、R2、阿里云OSS等
+type S3Storage struct {
+	config   config.S3Config
+	endpoint *url.URL
+	region   string
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Storage 创建S3兼容对象存储
+func NewS3Storage(cfg config.S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" || cfg.BucketName == "" {
+		return nil, fmt.Errorf("s3 storage requires endpoint and bucket_name")
+	}
+
+	endpoint := cfg.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	parsed, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3Storage{
+		config:   cfg,
+		endpoint: parsed,
+		region:   region,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+// Save 上传对象
+func (s *S3Storage) Save(ctx context.Context, key string, reader io.Reader, contentType string) (*UploadResult, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// 签名需要负载的哈希，因此先读入内存
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	if contentType == "" {
+		contentType = ContentTypeByKey(key)
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+
+	resp, err := s.do(ctx, http.MethodPut, key, data, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp)
+	}
+
+	return &UploadResult{
+		Key:         key,
+		URL:         s.URL(key),
+		Size:        int64(len(data)),
+		ContentType: contentType,
+	}, nil
+}
+
+// Get 下载对象
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+}
+
+// Exists 对象是否存在
+func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3Error(resp)
+	}
+}
+
+// Delete 删除对象
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// URL 对象访问地址，优先使用自定义CDN
+func (s *S3Storage) URL(key string) string {
+	if s.config.CustomCDN != "" {
+		return joinURL(s.config.CustomCDN, key)
+	}
+	return s.objectURL(key).String()
+}
+
+// objectURL 对象的请求地址
+func (s *S3Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.config.PathStyle {
+		u.Path = "/" + s.config.BucketName + "/" + key
+	} else {
+		u.Host = s.config.BucketName + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = ""
+	return &u
+}
+
+// do 发送签名请求
+func (s *S3Storage) do(ctx context.Context, method, key string, body []byte, headers http.Header) (*http.Response, error) {
+	u := s.objectURL(key)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s failed: %w", method, key, err)
+	}
+	return resp, nil
+}
+
+// sign 使用AWS Signature V4签名请求
+func (s *S3Storage) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format(amzDateFmt)
+	day := now.Format(amzDayFmt)
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedNames := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signedNames = append(signedNames, "content-type")
+	}
+	sort.Strings(signedNames)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedNames {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signedNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.region + "/" + s3Service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.AccessKeySecret), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalURI 按RFC 3986对路径各段编码，保留分隔符
+func canonicalURI(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// uriEncode 仅保留非保留字符 A-Z a-z 0-9 - _ . ~
+func uriEncode(value string) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			builder.WriteByte(b)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+// s3Error 读取S3错误响应
+func s3Error(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("s3 request returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
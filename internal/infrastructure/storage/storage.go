@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("storage: object not found")
+
+// UploadResult 上传结果
+type UploadResult struct {
+	Key         string `json:"key"`
+	URL         string `json:"url"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// Storage 对象存储接口
+type Storage interface {
+	// Save 保存对象，同名对象会被覆盖
+	Save(ctx context.Context, key string, reader io.Reader, contentType string) (*UploadResult, error)
+	// Get 读取对象，不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists 对象是否存在
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// URL 对象的访问地址
+	URL(key string) string
+}
+
+// New 根据配置创建存储
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", "local":
+		return NewLocalStorage(cfg.Local)
+	case "s3", "minio", "r2":
+		return NewS3Storage(cfg.S3)
+	case "oss":
+		// 阿里云OSS兼容S3协议，使用虚拟主机风格访问
+		return NewS3Storage(config.S3Config{
+			Endpoint:        cfg.OSS.Endpoint,
+			Region:          ossRegion(cfg.OSS.Endpoint),
+			BucketName:      cfg.OSS.BucketName,
+			AccessKeyID:     cfg.OSS.AccessKeyID,
+			AccessKeySecret: cfg.OSS.AccessKeySecret,
+			CustomCDN:       cfg.OSS.CustomCDN,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Type)
+	}
+}
+
+// WithDefaultCDN 未单独配置CDN的存储使用cdn作为访问地址前缀，对应 ng_discord.custom_cdn
+func WithDefaultCDN(cfg config.StorageConfig, cdn string) config.StorageConfig {
+	if cdn == "" {
+		return cfg
+	}
+	if cfg.Local.CDN == "" {
+		cfg.Local.CDN = cdn
+	}
+	if cfg.OSS.CustomCDN == "" {
+		cfg.OSS.CustomCDN = cdn
+	}
+	if cfg.S3.CustomCDN == "" {
+		cfg.S3.CustomCDN = cdn
+	}
+	return cfg
+}
+
+// ContentTypeByKey 根据对象键的扩展名推断内容类型
+func ContentTypeByKey(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// cleanKey 规范化对象键，去除前导斜杠并拒绝跳出根目录的路径
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return cleaned, nil
+}
+
+// joinURL 拼接访问地址
+func joinURL(base, key string) string {
+	return strings.TrimRight(base, "/") + "/" + key
+}
+
+// ossRegion 从OSS endpoint解析区域，如 oss-cn-hangzhou.aliyuncs.com -> oss-cn-hangzhou
+func ossRegion(endpoint string) string {
+	host := endpoint
+	if index := strings.Index(host, "://"); index >= 0 {
+		host = host[index+3:]
+	}
+	if index := strings.Index(host, "."); index > 0 {
+		return strings.TrimSuffix(host[:index], "-internal")
+	}
+	return "us-east-1"
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"testing"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+func TestWithDefaultCDN(t *testing.T) {
+	cfg := config.StorageConfig{
+		Local: config.LocalConfig{Path: "./data"},
+		S3:    config.S3Config{CustomCDN: "https://s3.example.com"},
+	}
+
+	got := WithDefaultCDN(cfg, "https://cdn.example.com")
+	if got.Local.CDN != "https://cdn.example.com" || got.OSS.CustomCDN != "https://cdn.example.com" {
+		t.Fatalf("default cdn not applied: %+v", got)
+	}
+	// 存储单独配置的CDN优先
+	if got.S3.CustomCDN != "https://s3.example.com" {
+		t.Fatalf("s3 cdn = %s, want https://s3.example.com", got.S3.CustomCDN)
+	}
+	if got := WithDefaultCDN(cfg, ""); got.Local.CDN != "" || got.OSS.CustomCDN != "" {
+		t.Fatalf("empty cdn changed config: %+v", got)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// accountSyncTimeout 同步单个账号的超时时间
+const accountSyncTimeout = 30 * time.Second
+
+// accountDisabledUnauthorized Token失效时记录的禁用原因
+const accountDisabledUnauthorized = "Discord Token已失效"
+
+// AccountInfoFetcher 读取Discord账号信息，由 discord.Manager 实现
+type AccountInfoFetcher interface {
+	FetchAccountInfo(ctx context.Context, account config.DiscordAccount) (*discord.AccountInfo, error)
+}
+
+// AccountSyncService 账号信息同步：使用账号Token读取Discord用户和账号频道，更新服务器ID和同步时间，
+// Token失效的账号会被禁用。快速模式剩余时长等需要解析机器人 /info 回复的信息不在同步范围内
+type AccountSyncService struct {
+	accounts repository.AccountRepository
+	fetcher  AccountInfoFetcher
+	logger   logger.Logger
+}
+
+// NewAccountSyncService 创建账号信息同步服务
+func NewAccountSyncService(accounts repository.AccountRepository, fetcher AccountInfoFetcher, logger logger.Logger) *AccountSyncService {
+	return &AccountSyncService{
+		accounts: accounts,
+		fetcher:  fetcher,
+		logger:   logger,
+	}
+}
+
+// Sync 同步一个账号并保存。Token失效时禁用账号，返回的错误包装 discord.ErrUnauthorized
+func (s *AccountSyncService) Sync(ctx context.Context, account *entity.DiscordAccount) error {
+	ctx, cancel := context.WithTimeout(ctx, accountSyncTimeout)
+	defer cancel()
+
+	info, err := s.fetcher.FetchAccountInfo(ctx, config.DiscordAccount{
+		ID:        account.ID,
+		ChannelID: account.ChannelID,
+		GuildID:   account.GuildID,
+		UserToken: account.UserToken,
+		UserAgent: account.UserAgent,
+	})
+	if errors.Is(err, discord.ErrUnauthorized) {
+		account.Enabled = false
+		account.DisabledReason = accountDisabledUnauthorized
+		if saveErr := s.accounts.Save(ctx, account); saveErr != nil {
+			return fmt.Errorf("failed to disable account %s: %w", account.ID, saveErr)
+		}
+		s.logger.Warnf("Discord account %s disabled: token unauthorized", account.ChannelID)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if info.GuildID != "" {
+		account.GuildID = info.GuildID
+	}
+	account.InfoUpdated = &now
+	if err := s.accounts.Save(ctx, account); err != nil {
+		return fmt.Errorf("failed to save account %s: %w", account.ID, err)
+	}
+
+	s.logger.Debugf("Discord account %s synced as %s", account.ChannelID, info.Username)
+	return nil
+}
+
+// SyncAll 同步所有启用的账号，单个账号失败不影响其他账号，返回第一个非Token失效的错误
+func (s *AccountSyncService) SyncAll(ctx context.Context) error {
+	accounts, err := s.accounts.Find(ctx, repository.AccountQuery{})
+	if err != nil {
+		return fmt.Errorf("failed to query accounts: %w", err)
+	}
+
+	var firstErr error
+	synced := 0
+	for i := range accounts {
+		account := &accounts[i]
+		if !account.Enabled {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := s.Sync(ctx, account)
+		if err == nil {
+			synced++
+			continue
+		}
+		if errors.Is(err, discord.ErrUnauthorized) {
+			continue
+		}
+		s.logger.Warnf("Failed to sync Discord account %s: %v", account.ChannelID, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if synced > 0 {
+		s.logger.Infof("Synced info of %d Discord accounts", synced)
+	}
+	return firstErr
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+)
+
+// fakeAccountInfoFetcher 按Token返回预设的结果
+type fakeAccountInfoFetcher struct {
+	results map[string]error
+	calls   int
+}
+
+func (f *fakeAccountInfoFetcher) FetchAccountInfo(ctx context.Context, account config.DiscordAccount) (*discord.AccountInfo, error) {
+	f.calls++
+	if err := f.results[account.UserToken]; err != nil {
+		return nil, err
+	}
+	return &discord.AccountInfo{UserID: "42", Username: "painter", GuildID: "guild-" + account.ChannelID}, nil
+}
+
+// createAccount 创建账号，token决定同步结果
+func createAccount(t *testing.T, repos *repository.Repositories, token string, enabled bool) *entity.DiscordAccount {
+	t.Helper()
+
+	account := &entity.DiscordAccount{
+		ID:        uuid.New().String(),
+		ChannelID: uuid.New().String()[:8],
+		UserToken: token,
+		Enabled:   true,
+	}
+	if err := repos.Accounts.Create(context.Background(), account); err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	// 默认值为true的字段需要在创建后修改
+	if !enabled {
+		if err := repos.Accounts.SetEnabled(context.Background(), account.ID, false); err != nil {
+			t.Fatalf("disable account: %v", err)
+		}
+	}
+	return account
+}
+
+func getAccount(t *testing.T, repos *repository.Repositories, id string) *entity.DiscordAccount {
+	t.Helper()
+
+	account, err := repos.Accounts.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("get account: %v", err)
+	}
+	return account
+}
+
+func TestAccountSyncAll(t *testing.T) {
+	repos := newTestRepositories(t)
+	fetcher := &fakeAccountInfoFetcher{results: map[string]error{
+		"revoked": discord.ErrUnauthorized,
+		"flaky":   errors.New("connection reset"),
+	}}
+	sync := NewAccountSyncService(repos.Accounts, fetcher, testLogger())
+
+	healthy := createAccount(t, repos, "good", true)
+	revoked := createAccount(t, repos, "revoked", true)
+	flaky := createAccount(t, repos, "flaky", true)
+	disabled := createAccount(t, repos, "good", false)
+
+	if err := sync.SyncAll(context.Background()); err == nil {
+		t.Fatal("SyncAll ignored the failed account")
+	}
+	if fetcher.calls != 3 {
+		t.Fatalf("fetched %d accounts, want 3 enabled accounts", fetcher.calls)
+	}
+
+	stored := getAccount(t, repos, healthy.ID)
+	if stored.InfoUpdated == nil || stored.GuildID != "guild-"+healthy.ChannelID {
+		t.Fatalf("healthy account not synced: info_updated %v, guild %q", stored.InfoUpdated, stored.GuildID)
+	}
+
+	// Token失效的账号被禁用，不视为任务失败
+	stored = getAccount(t, repos, revoked.ID)
+	if stored.Enabled || stored.DisabledReason != accountDisabledUnauthorized {
+		t.Fatalf("revoked account = enabled %v, reason %q", stored.Enabled, stored.DisabledReason)
+	}
+
+	// 临时错误不修改账号
+	stored = getAccount(t, repos, flaky.ID)
+	if !stored.Enabled || stored.InfoUpdated != nil {
+		t.Fatalf("flaky account changed: enabled %v, info_updated %v", stored.Enabled, stored.InfoUpdated)
+	}
+
+	if stored := getAccount(t, repos, disabled.ID); stored.InfoUpdated != nil {
+		t.Fatal("disabled account was synced")
+	}
+}
+
+func TestAccountSyncReportsUnauthorized(t *testing.T) {
+	repos := newTestRepositories(t)
+	fetcher := &fakeAccountInfoFetcher{results: map[string]error{"revoked": discord.ErrUnauthorized}}
+	sync := NewAccountSyncService(repos.Accounts, fetcher, testLogger())
+
+	account := createAccount(t, repos, "revoked", true)
+	if err := sync.Sync(context.Background(), account); !errors.Is(err, discord.ErrUnauthorized) {
+		t.Fatalf("Sync = %v, want ErrUnauthorized", err)
+	}
+	if account.Enabled {
+		t.Fatal("account returned to the caller is still enabled")
+	}
+
+	// 只有Token失效的账号时，定时任务本身成功
+	another := createAccount(t, repos, "revoked", true)
+	if err := sync.SyncAll(context.Background()); err != nil {
+		t.Fatalf("SyncAll: %v", err)
+	}
+	if stored := getAccount(t, repos, another.ID); stored.Enabled {
+		t.Fatal("revoked account is still enabled after SyncAll")
+	}
+}
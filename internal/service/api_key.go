@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// APIKeyPrefix API密钥的固定前缀，认证时据此与JWT区分
+const APIKeyPrefix = "mjk_"
+
+const (
+	// apiKeyDisplayLength 保存用于辨认的密钥开头字符数（包括前缀）
+	apiKeyDisplayLength = 12
+	// apiKeyTouchInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+	apiKeyTouchInterval = time.Minute
+	// maxAPIKeysPerUser 每个用户未吊销的密钥数量上限
+	maxAPIKeysPerUser = 20
+)
+
+var (
+	// ErrAPIKeyInvalid 密钥不存在或已吊销
+	ErrAPIKeyInvalid = errors.New("invalid API key")
+	// ErrAPIKeyExpired 密钥已过期
+	ErrAPIKeyExpired = errors.New("API key expired")
+	// ErrAPIKeyIPNotAllowed 客户端IP不在密钥的允许列表中
+	ErrAPIKeyIPNotAllowed = errors.New("client IP is not allowed for this API key")
+)
+
+// APIKeyError 创建密钥的参数无效
+type APIKeyError struct {
+	Message string
+}
+
+func (e *APIKeyError) Error() string {
+	return e.Message
+}
+
+// APIKeyInput 创建密钥的参数
+type APIKeyInput struct {
+	Name       string
+	Scopes     []entity.APIKeyScope
+	AllowedIPs []string
+	ExpiresAt  *time.Time
+}
+
+// APIKeyService API密钥服务。每次认证都查询数据库，吊销后在所有副本上立即生效
+type APIKeyService struct {
+	repo   repository.APIKeyRepository
+	logger logger.Logger
+}
+
+// NewAPIKeyService 创建API密钥服务
+func NewAPIKeyService(repo repository.APIKeyRepository, logger logger.Logger) *APIKeyService {
+	return &APIKeyService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// IsAPIKey 认证凭据是否为API密钥
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// hashToken API密钥和刷新令牌的摘要，两者都是32字节随机数，无需加盐和慢哈希
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create 为用户创建密钥，返回密钥记录和只在此时可见的明文
+func (s *APIKeyService) Create(ctx context.Context, owner *entity.User, input APIKeyInput) (*entity.APIKey, string, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return nil, "", &APIKeyError{Message: "密钥名称不能为空"}
+	}
+	scopes, err := normalizeScopes(input.Scopes, owner.Role == entity.RoleAdmin)
+	if err != nil {
+		return nil, "", err
+	}
+	allowedIPs, err := normalizeAllowedIPs(input.AllowedIPs)
+	if err != nil {
+		return nil, "", err
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", &APIKeyError{Message: "过期时间必须晚于当前时间"}
+	}
+
+	count, err := s.repo.Count(ctx, repository.APIKeyQuery{UserID: owner.ID})
+	if err != nil {
+		return nil, "", err
+	}
+	if count >= maxAPIKeysPerUser {
+		return nil, "", &APIKeyError{Message: fmt.Sprintf("每个用户最多创建 %d 个密钥", maxAPIKeysPerUser)}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	raw := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &entity.APIKey{
+		ID:         uuid.New().String(),
+		UserID:     owner.ID,
+		Name:       input.Name,
+		Prefix:     raw[:apiKeyDisplayLength],
+		KeyHash:    hashToken(raw),
+		Scopes:     scopes,
+		AllowedIPs: allowedIPs,
+		ExpiresAt:  input.ExpiresAt,
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	s.logger.Infof("API key %s (%s) created for user %s", key.ID, key.Prefix, owner.Username)
+	return key, raw, nil
+}
+
+// normalizeScopes 校验并去重权限范围，只有管理员可以创建管理接口的密钥
+func normalizeScopes(scopes []entity.APIKeyScope, isAdmin bool) ([]entity.APIKeyScope, error) {
+	if len(scopes) == 0 {
+		return nil, &APIKeyError{Message: "至少需要一个权限范围"}
+	}
+
+	seen := make(map[entity.APIKeyScope]bool)
+	var result []entity.APIKeyScope
+	for _, scope := range scopes {
+		valid := false
+		for _, known := range entity.APIKeyScopes {
+			valid = valid || scope == known
+		}
+		if !valid {
+			return nil, &APIKeyError{Message: fmt.Sprintf("未知的权限范围: %s", scope)}
+		}
+		if (scope == entity.ScopeAdminRead || scope == entity.ScopeAdminWrite) && !isAdmin {
+			return nil, &APIKeyError{Message: fmt.Sprintf("只有管理员可以创建 %s 权限的密钥", scope)}
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// normalizeAllowedIPs 校验IP和CIDR
+func normalizeAllowedIPs(items []string) ([]string, error) {
+	var result []string
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			_, network, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, &APIKeyError{Message: fmt.Sprintf("无效的CIDR: %s", item)}
+			}
+			item = network.String()
+		} else if ip := net.ParseIP(item); ip != nil {
+			item = ip.String()
+		} else {
+			return nil, &APIKeyError{Message: fmt.Sprintf("无效的IP地址: %s", item)}
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// Authenticate 校验密钥，返回密钥记录；密钥所属用户的状态由调用方检查
+func (s *APIKeyService) Authenticate(ctx context.Context, raw, clientIP string) (*entity.APIKey, error) {
+	key, err := s.repo.GetByHash(ctx, hashToken(raw))
+	if err == repository.ErrNotFound {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.IsRevoked() {
+		return nil, ErrAPIKeyInvalid
+	}
+	if key.IsExpired(now) {
+		return nil, ErrAPIKeyExpired
+	}
+	if !key.AllowsIP(clientIP) {
+		return nil, ErrAPIKeyIPNotAllowed
+	}
+
+	// 最近使用时间按分钟更新，更新失败不影响本次请求
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP != clientIP {
+		if err := s.repo.Update(ctx, key.ID, map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		}); err != nil {
+			s.logger.Warnf("Failed to update last use of API key %s: %v", key.ID, err)
+		}
+	}
+	return key, nil
+}
+
+// List 查询密钥，userID为空时返回所有用户的密钥
+func (s *APIKeyService) List(ctx context.Context, userID string, includeRevoked bool, page, size int) ([]entity.APIKey, int64, error) {
+	query := repository.APIKeyQuery{
+		UserID:         userID,
+		IncludeRevoked: includeRevoked,
+		Offset:         (page - 1) * size,
+		Limit:          size,
+	}
+	keys, err := s.repo.Find(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.repo.Count(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return keys, total, nil
+}
+
+// Revoke 吊销密钥，userID非空时只能吊销该用户自己的密钥，其他用户的密钥视为不存在
+func (s *APIKeyService) Revoke(ctx context.Context, id, userID string) (*entity.APIKey, error) {
+	key, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if userID != "" && key.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	if key.IsRevoked() {
+		return key, nil
+	}
+
+	now := time.Now()
+	if err := s.repo.Update(ctx, key.ID, map[string]interface{}{"revoked_at": now}); err != nil {
+		return nil, err
+	}
+	key.RevokedAt = &now
+
+	s.logger.Infof("API key %s (%s) revoked", key.ID, key.Prefix)
+	return key, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// AuditService 审计服务，记录查看密钥等敏感操作
+type AuditService struct {
+	repo   repository.AuditLogRepository
+	logger logger.Logger
+}
+
+// NewAuditService 创建审计服务
+func NewAuditService(repo repository.AuditLogRepository, logger logger.Logger) *AuditService {
+	return &AuditService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Record 保存审计记录，保存失败时返回错误，调用方应拒绝执行对应的操作
+func (s *AuditService) Record(ctx context.Context, action, target, operator, clientIP, detail string) error {
+	log := &entity.AuditLog{
+		ID:       uuid.New().String(),
+		Action:   action,
+		Target:   target,
+		Operator: operator,
+		ClientIP: clientIP,
+		Detail:   detail,
+	}
+	if err := s.repo.Create(ctx, log); err != nil {
+		return fmt.Errorf("failed to record audit log: %w", err)
+	}
+
+	s.logger.Infof("Audit: %s on %s by %s from %s", action, target, operator, clientIP)
+	return nil
+}
+
+// List 按时间倒序查询审计记录，action和target为空时不过滤
+func (s *AuditService) List(ctx context.Context, action, target string, page, size int) ([]entity.AuditLog, int64, error) {
+	query := repository.AuditLogQuery{
+		Action: action,
+		Target: target,
+		Offset: (page - 1) * size,
+		Limit:  size,
+	}
+	logs, err := s.repo.Find(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.repo.Count(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// 未配置时访问令牌和刷新令牌的有效期
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrTokenInvalid 令牌无效或已过期
+	ErrTokenInvalid = errors.New("invalid token")
+	// ErrTokenRevoked 令牌已吊销（登出、退出所有设备或刷新令牌被重复使用）
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrRefreshTokenReused 已使用的刷新令牌再次出现，整个令牌族已吊销
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrUserUnavailable 用户已禁用或已过期
+	ErrUserUnavailable = errors.New("user is disabled or expired")
+)
+
+// AccessClaims 访问令牌载荷，jti用于吊销，sid为签发时所属的刷新令牌族
+type AccessClaims struct {
+	UserID    string `json:"user_id"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair 登录和刷新时签发的令牌
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresIn  int // 秒
+	RefreshToken     string
+	RefreshExpiresIn int // 秒
+}
+
+// TokenService 登录令牌服务：短期的访问令牌（JWT）配合服务端保存的刷新令牌，
+// 刷新令牌每次使用后作废并在同一令牌族中换发新令牌；吊销的访问令牌记录在吊销列表中，
+// 认证时逐个请求检查，所有副本立即生效
+type TokenService struct {
+	secret        []byte
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+	refreshTokens repository.RefreshTokenRepository
+	revokedTokens repository.RevokedTokenRepository
+	users         repository.UserRepository
+	logger        logger.Logger
+}
+
+// NewTokenService 创建登录令牌服务
+func NewTokenService(cfg config.SecurityConfig, repos *repository.Repositories, logger logger.Logger) *TokenService {
+	s := &TokenService{
+		secret:        []byte(cfg.JWTSecret),
+		accessTTL:     time.Duration(cfg.AccessTokenMinutes) * time.Minute,
+		refreshTTL:    time.Duration(cfg.RefreshTokenDays) * 24 * time.Hour,
+		refreshTokens: repos.RefreshTokens,
+		revokedTokens: repos.RevokedTokens,
+		users:         repos.Users,
+		logger:        logger,
+	}
+	if s.accessTTL <= 0 {
+		s.accessTTL = defaultAccessTokenTTL
+	}
+	if s.refreshTTL <= 0 {
+		s.refreshTTL = defaultRefreshTokenTTL
+	}
+	return s
+}
+
+// Issue 登录时签发令牌，开始一个新的令牌族
+func (s *TokenService) Issue(ctx context.Context, user *entity.User, clientIP, userAgent string) (*TokenPair, error) {
+	return s.issue(ctx, user, uuid.New().String(), clientIP, userAgent)
+}
+
+// issue 签发访问令牌和刷新令牌
+func (s *TokenService) issue(ctx context.Context, user *entity.User, familyID, clientIP, userAgent string) (*TokenPair, error) {
+	now := time.Now()
+	jti := uuid.New().String()
+	claims := AccessClaims{
+		UserID:    user.ID,
+		Role:      string(user.Role),
+		SessionID: familyID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(secret)
+
+	if err := s.refreshTokens.Create(ctx, &entity.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		AccessJTI: jti,
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+		ExpiresAt: now.Add(s.refreshTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresIn:  int(s.accessTTL.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int(s.refreshTTL.Seconds()),
+	}, nil
+}
+
+// Refresh 使用刷新令牌换发新的令牌，原刷新令牌作废。已作废的令牌再次使用时吊销整个令牌族
+func (s *TokenService) Refresh(ctx context.Context, raw, clientIP, userAgent string) (*TokenPair, *entity.User, error) {
+	token, err := s.refreshTokens.GetByHash(ctx, hashToken(raw))
+	if err == repository.ErrNotFound {
+		return nil, nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil {
+		return nil, nil, ErrTokenRevoked
+	}
+	if !now.Before(token.ExpiresAt) {
+		return nil, nil, ErrTokenInvalid
+	}
+	if token.UsedAt != nil {
+		return nil, nil, s.revokeReusedFamily(ctx, token, clientIP)
+	}
+	// 并发使用同一个令牌时只有一个请求能标记成功
+	marked, err := s.refreshTokens.MarkUsed(ctx, token.ID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !marked {
+		return nil, nil, s.revokeReusedFamily(ctx, token, clientIP)
+	}
+
+	user, err := s.users.Get(ctx, token.UserID)
+	if err == repository.ErrNotFound {
+		return nil, nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.Enabled || user.IsExpired() {
+		if _, err := s.revoke(ctx, repository.RefreshTokenQuery{FamilyID: token.FamilyID}); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrUserUnavailable
+	}
+
+	pair, err := s.issue(ctx, user, token.FamilyID, clientIP, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+// revokeReusedFamily 刷新令牌被重复使用，可能已经泄露，吊销整个令牌族
+func (s *TokenService) revokeReusedFamily(ctx context.Context, token *entity.RefreshToken, clientIP string) error {
+	s.logger.Warnf("Refresh token of user %s reused from %s, revoking token family %s", token.UserID, clientIP, token.FamilyID)
+	if _, err := s.revoke(ctx, repository.RefreshTokenQuery{FamilyID: token.FamilyID}); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Logout 登出：吊销当前访问令牌及其所属的令牌族
+func (s *TokenService) Logout(ctx context.Context, claims *AccessClaims) error {
+	if err := s.revokeAccessToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+	if claims.SessionID == "" {
+		return nil
+	}
+	_, err := s.revoke(ctx, repository.RefreshTokenQuery{UserID: claims.UserID, FamilyID: claims.SessionID})
+	return err
+}
+
+// RevokeUser 退出所有设备：吊销用户的所有刷新令牌和仍在有效期内的访问令牌，返回吊销的刷新令牌数量
+func (s *TokenService) RevokeUser(ctx context.Context, userID string) (int64, error) {
+	count, err := s.revoke(ctx, repository.RefreshTokenQuery{UserID: userID})
+	if err != nil {
+		return 0, err
+	}
+
+	s.logger.Infof("Revoked %d refresh tokens of user %s", count, userID)
+	return count, nil
+}
+
+// revoke 吊销匹配的刷新令牌，并将与其一同签发、仍在有效期内的访问令牌加入吊销列表
+func (s *TokenService) revoke(ctx context.Context, query repository.RefreshTokenQuery) (int64, error) {
+	now := time.Now()
+
+	// 访问令牌与刷新令牌同时签发，签发时间早于一个访问令牌有效期的已经过期
+	live := query
+	live.CreatedAfter = now.Add(-s.accessTTL)
+	tokens, err := s.refreshTokens.Find(ctx, live)
+	if err != nil {
+		return 0, err
+	}
+	for _, token := range tokens {
+		if token.AccessJTI == "" {
+			continue
+		}
+		if err := s.revokeAccessToken(ctx, token.AccessJTI, token.UserID, token.CreatedAt.Add(s.accessTTL)); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.refreshTokens.Revoke(ctx, query, now)
+}
+
+// revokeAccessToken 将访问令牌加入吊销列表，记录保留到令牌过期
+func (s *TokenService) revokeAccessToken(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	if jti == "" || !time.Now().Before(expiresAt) {
+		return nil
+	}
+	return s.revokedTokens.Save(ctx, &entity.RevokedToken{
+		ID:        jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Parse 校验访问令牌的签名、有效期和吊销列表
+func (s *TokenService) Parse(ctx context.Context, tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, ErrTokenInvalid
+	}
+	// 没有jti的令牌无法吊销，不再接受
+	if claims.ID == "" {
+		return nil, ErrTokenInvalid
+	}
+
+	_, err = s.revokedTokens.Get(ctx, claims.ID)
+	if err == nil {
+		return nil, ErrTokenRevoked
+	}
+	if err != repository.ErrNotFound {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Cleanup 删除已过期的刷新令牌和吊销记录
+func (s *TokenService) Cleanup(ctx context.Context) error {
+	now := time.Now()
+	refreshCount, err := s.refreshTokens.DeleteExpired(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	revokedCount, err := s.revokedTokens.DeleteExpired(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired revoked tokens: %w", err)
+	}
+
+	if refreshCount > 0 || revokedCount > 0 {
+		s.logger.Infof("Token cleanup removed %d refresh tokens and %d revoked tokens", refreshCount, revokedCount)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+// newTestTokenService 创建使用临时数据库的令牌服务和一个已启用的用户
+func newTestTokenService(t *testing.T) (*TokenService, *repository.Repositories, *entity.User) {
+	t.Helper()
+
+	repos := newTestRepositories(t)
+	user := &entity.User{
+		ID:       uuid.New().String(),
+		Username: "user-" + uuid.New().String()[:8],
+		Role:     entity.RoleUser,
+		Enabled:  true,
+	}
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	tokens := NewTokenService(config.SecurityConfig{JWTSecret: "test-secret"}, repos, testLogger())
+	return tokens, repos, user
+}
+
+// assertAccessToken 检查访问令牌的解析结果
+func assertAccessToken(t *testing.T, tokens *TokenService, accessToken string, want error) {
+	t.Helper()
+
+	if _, err := tokens.Parse(context.Background(), accessToken); err != want {
+		t.Fatalf("Parse = %v, want %v", err, want)
+	}
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	tokens, _, user := newTestTokenService(t)
+	ctx := context.Background()
+
+	first, err := tokens.Issue(ctx, user, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	assertAccessToken(t, tokens, first.AccessToken, nil)
+
+	second, refreshed, err := tokens.Refresh(ctx, first.RefreshToken, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.ID != user.ID {
+		t.Fatalf("refreshed user = %s, want %s", refreshed.ID, user.ID)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Fatal("refresh did not issue new tokens")
+	}
+
+	claims, err := tokens.Parse(ctx, second.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse refreshed token: %v", err)
+	}
+	firstClaims, _ := tokens.Parse(ctx, first.AccessToken)
+	if claims.SessionID == "" || claims.SessionID != firstClaims.SessionID {
+		t.Fatalf("session = %q, want the login's family %q", claims.SessionID, firstClaims.SessionID)
+	}
+
+	if _, _, err := tokens.Refresh(ctx, "not-a-token", "127.0.0.1", "test"); err != ErrTokenInvalid {
+		t.Fatalf("Refresh unknown token = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	tokens, _, user := newTestTokenService(t)
+	ctx := context.Background()
+
+	stolen, err := tokens.Issue(ctx, user, "127.0.0.1", "browser")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	other, err := tokens.Issue(ctx, user, "127.0.0.1", "phone")
+	if err != nil {
+		t.Fatalf("Issue other session: %v", err)
+	}
+
+	// 合法客户端先刷新，之后攻击者使用已作废的令牌
+	current, _, err := tokens.Refresh(ctx, stolen.RefreshToken, "127.0.0.1", "browser")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, _, err := tokens.Refresh(ctx, stolen.RefreshToken, "203.0.113.7", "attacker"); err != ErrRefreshTokenReused {
+		t.Fatalf("reused Refresh = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// 整个令牌族被吊销：最新的刷新令牌和两次签发的访问令牌都失效
+	if _, _, err := tokens.Refresh(ctx, current.RefreshToken, "127.0.0.1", "browser"); err != ErrTokenRevoked {
+		t.Fatalf("Refresh after reuse = %v, want ErrTokenRevoked", err)
+	}
+	assertAccessToken(t, tokens, stolen.AccessToken, ErrTokenRevoked)
+	assertAccessToken(t, tokens, current.AccessToken, ErrTokenRevoked)
+
+	// 其他登录不受影响
+	assertAccessToken(t, tokens, other.AccessToken, nil)
+	if _, _, err := tokens.Refresh(ctx, other.RefreshToken, "127.0.0.1", "phone"); err != nil {
+		t.Fatalf("Refresh other session: %v", err)
+	}
+}
+
+func TestRefreshRejectsDisabledUser(t *testing.T) {
+	tokens, repos, user := newTestTokenService(t)
+	ctx := context.Background()
+
+	pair, err := tokens.Issue(ctx, user, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	user.Enabled = false
+	if err := repos.Users.Save(ctx, user); err != nil {
+		t.Fatalf("disable user: %v", err)
+	}
+	if _, _, err := tokens.Refresh(ctx, pair.RefreshToken, "127.0.0.1", "test"); err != ErrUserUnavailable {
+		t.Fatalf("Refresh = %v, want ErrUserUnavailable", err)
+	}
+	assertAccessToken(t, tokens, pair.AccessToken, ErrTokenRevoked)
+}
+
+func TestLogoutAndRevokeUser(t *testing.T) {
+	tokens, _, user := newTestTokenService(t)
+	ctx := context.Background()
+
+	first, _ := tokens.Issue(ctx, user, "127.0.0.1", "browser")
+	second, _ := tokens.Issue(ctx, user, "127.0.0.1", "phone")
+	third, _ := tokens.Issue(ctx, user, "127.0.0.1", "tablet")
+
+	claims, err := tokens.Parse(ctx, first.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := tokens.Logout(ctx, claims); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	assertAccessToken(t, tokens, first.AccessToken, ErrTokenRevoked)
+	if _, _, err := tokens.Refresh(ctx, first.RefreshToken, "127.0.0.1", "browser"); err != ErrTokenRevoked {
+		t.Fatalf("Refresh after logout = %v, want ErrTokenRevoked", err)
+	}
+	assertAccessToken(t, tokens, second.AccessToken, nil)
+
+	count, err := tokens.RevokeUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("RevokeUser revoked %d refresh tokens, want 2", count)
+	}
+	assertAccessToken(t, tokens, second.AccessToken, ErrTokenRevoked)
+	assertAccessToken(t, tokens, third.AccessToken, ErrTokenRevoked)
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/faceswap"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+const (
+	// PredictionIDProperty 任务属性：服务提供方的预测ID，用于重启后继续查询
+	PredictionIDProperty = "predictionId"
+
+	defaultFaceSwapTimeout      = 10
+	defaultVideoSwapTimeout     = 30
+	defaultVideoMaxFileSize     = 50 << 20
+	defaultVideoMaxDuration     = 60
+	defaultFaceSwapPollInterval = 3
+	maxPollFailures             = 5
+)
+
+var (
+	// ErrFaceSwapDisabled 换脸功能未启用
+	ErrFaceSwapDisabled = errors.New("换脸功能未启用")
+	// ErrVideoFaceSwapDisabled 视频换脸功能未启用
+	ErrVideoFaceSwapDisabled = errors.New("视频换脸功能未启用")
+)
+
+// faceSwapLane 一类换脸任务的执行配置，图片和视频各自使用独立的执行器
+type faceSwapLane struct {
+	enabled  bool
+	disabled error
+	provider faceswap.Provider
+	executor *JobExecutor
+	timeout  time.Duration
+}
+
+// FaceSwapService 换脸服务，任务在独立的执行器中提交到服务提供方并轮询结果
+type FaceSwapService struct {
+	tasks            *TaskService
+	lanes            map[entity.TaskAction]*faceSwapLane
+	pollInterval     time.Duration
+	videoMaxSize     int64
+	videoMaxDuration time.Duration
+	startedAt        time.Time
+	logger           logger.Logger
+}
+
+// NewFaceSwapService 创建换脸服务，并注册为换脸任务的恢复函数
+func NewFaceSwapService(cfg config.FaceSwapConfig, tasks *TaskService, provider, videoProvider faceswap.Provider, logger logger.Logger) *FaceSwapService {
+	pollInterval := cfg.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultFaceSwapPollInterval
+	}
+	videoMaxSize := cfg.Video.MaxFileSize
+	if videoMaxSize <= 0 {
+		videoMaxSize = defaultVideoMaxFileSize
+	}
+	videoMaxDuration := cfg.Video.MaxDuration
+	if videoMaxDuration <= 0 {
+		videoMaxDuration = defaultVideoMaxDuration
+	}
+
+	s := &FaceSwapService{
+		tasks:            tasks,
+		pollInterval:     time.Duration(pollInterval) * time.Second,
+		videoMaxSize:     videoMaxSize,
+		videoMaxDuration: time.Duration(videoMaxDuration) * time.Second,
+		startedAt:        time.Now(),
+		logger:           logger,
+	}
+
+	s.lanes = map[entity.TaskAction]*faceSwapLane{
+		entity.TaskActionSwapFace: s.newLane("face swap", cfg.Enabled, ErrFaceSwapDisabled, provider,
+			cfg.CoreSize, cfg.QueueSize, cfg.TimeoutMinutes, defaultFaceSwapTimeout),
+		entity.TaskActionSwapVideoFace: s.newLane("video face swap", cfg.Video.Enabled, ErrVideoFaceSwapDisabled, videoProvider,
+			cfg.Video.CoreSize, cfg.Video.QueueSize, cfg.Video.TimeoutMinutes, defaultVideoSwapTimeout),
+	}
+	tasks.SetReplicateHandler(s.resume)
+
+	return s
+}
+
+// newLane 创建一类换脸任务的执行器
+func (s *FaceSwapService) newLane(name string, enabled bool, disabled error, provider faceswap.Provider, coreSize, queueSize, timeoutMinutes, defaultTimeout int) *faceSwapLane {
+	if timeoutMinutes <= 0 {
+		timeoutMinutes = defaultTimeout
+	}
+
+	lane := &faceSwapLane{
+		enabled:  enabled,
+		disabled: disabled,
+		provider: provider,
+		timeout:  time.Duration(timeoutMinutes) * time.Minute,
+	}
+	lane.executor = NewJobExecutor(name, coreSize, queueSize, func(ctx context.Context, task *entity.Task) error {
+		return s.run(ctx, lane, task)
+	}, s.logger)
+
+	return lane
+}
+
+// Enabled 是否启用图片换脸
+func (s *FaceSwapService) Enabled() bool {
+	return s.lanes[entity.TaskActionSwapFace].enabled
+}
+
+// VideoEnabled 是否启用视频换脸
+func (s *FaceSwapService) VideoEnabled() bool {
+	return s.lanes[entity.TaskActionSwapVideoFace].enabled
+}
+
+// VideoLimits 目标视频的大小（字节）和时长上限
+func (s *FaceSwapService) VideoLimits() (int64, time.Duration) {
+	return s.videoMaxSize, s.videoMaxDuration
+}
+
+// Start 启动执行器
+func (s *FaceSwapService) Start() {
+	for _, lane := range s.lanes {
+		lane.executor.Start()
+	}
+}
+
+// Stop 停止执行器
+func (s *FaceSwapService) Stop() {
+	for _, lane := range s.lanes {
+		lane.executor.Stop()
+	}
+}
+
+// Submit 启动任务并提交到对应的执行器，task.Inputs 依次为人脸图片和目标图片或视频
+func (s *FaceSwapService) Submit(task *entity.Task) error {
+	lane, exists := s.lanes[task.Action]
+	if !exists {
+		return fmt.Errorf("不支持的换脸任务类型: %s", task.Action)
+	}
+	if !lane.enabled {
+		return lane.disabled
+	}
+	if len(task.Inputs) != 2 {
+		return fmt.Errorf("换脸需要人脸图片和目标文件")
+	}
+
+	task.IsReplicate = true
+	task.Start()
+	s.tasks.markNode(task)
+	s.tasks.chargeQuota(task)
+
+	if err := s.tasks.Save(task); err != nil {
+		return fmt.Errorf("failed to save task: %w", err)
+	}
+	s.tasks.changed(task)
+
+	if err := lane.executor.Submit(task); err != nil {
+		if _, failErr := s.tasks.FailTask(task, err.Error()); failErr != nil {
+			s.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// resume 恢复上次运行遗留的换脸任务：已提交到服务提供方的继续查询，否则输入已丢失只能标记失败
+func (s *FaceSwapService) resume(ctx context.Context, task *entity.Task) (bool, error) {
+	// 本次启动后提交的任务已在执行器中
+	if task.StartTime != nil && task.StartTime.After(s.startedAt) {
+		return true, nil
+	}
+
+	lane, exists := s.lanes[task.Action]
+	if !exists || !lane.enabled {
+		_, err := s.tasks.FailTask(task, "服务重启后换脸功能未启用")
+		return false, err
+	}
+
+	if id, _ := task.GetProperty(PredictionIDProperty); id == nil || id == "" {
+		_, err := s.tasks.FailTask(task, "服务重启后换脸输入文件已丢失")
+		return false, err
+	}
+
+	if err := lane.executor.Submit(task); err != nil {
+		_, failErr := s.tasks.FailTask(task, err.Error())
+		if failErr != nil {
+			return false, failErr
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// run 提交换脸任务并轮询直到结束
+func (s *FaceSwapService) run(ctx context.Context, lane *faceSwapLane, task *entity.Task) error {
+	// 排队期间已结束的任务（如被取消）不再提交
+	if current, err := s.tasks.currentStatus(task.ID); err == nil && isFinishedStatus(current) {
+		return nil
+	}
+
+	deadline := taskStartedAt(task).Add(lane.timeout)
+	if time.Now().After(deadline) {
+		_, err := s.tasks.FailTask(task, entity.TaskFailReasonTimeout)
+		return err
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	id, _ := task.GetProperty(PredictionIDProperty)
+	predictionID, _ := id.(string)
+	if predictionID == "" {
+		if len(task.Inputs) != 2 {
+			_, err := s.tasks.FailTask(task, "换脸输入文件已丢失")
+			return err
+		}
+
+		prediction, err := lane.provider.Create(ctx, faceswap.Input{Source: task.Inputs[0], Target: task.Inputs[1]})
+		if err != nil {
+			if _, failErr := s.tasks.FailTask(task, err.Error()); failErr != nil {
+				s.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+			}
+			return err
+		}
+
+		predictionID = prediction.ID
+		task.Inputs = nil
+		task.SetProperty(PredictionIDProperty, predictionID)
+		task.Status = entity.TaskStatusInProgress
+		task.Progress = "0%"
+		if updated, err := s.tasks.SaveIfUnfinished(task); err != nil || !updated {
+			s.cancelPrediction(lane, predictionID)
+			return err
+		}
+
+		s.logger.Infof("Face swap task %s submitted as prediction %s", task.ID, predictionID)
+	}
+
+	return s.poll(ctx, lane, task, predictionID)
+}
+
+// poll 轮询预测状态，任务在本地被取消或超时时取消预测
+func (s *FaceSwapService) poll(ctx context.Context, lane *faceSwapLane, task *entity.Task, predictionID string) error {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				s.cancelPrediction(lane, predictionID)
+				_, err := s.tasks.FailTask(task, entity.TaskFailReasonTimeout)
+				return err
+			}
+			// 服务停止，保留任务状态等待下次启动时恢复
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if current, err := s.tasks.currentStatus(task.ID); err == nil && isFinishedStatus(current) {
+			s.cancelPrediction(lane, predictionID)
+			return nil
+		}
+
+		prediction, err := lane.provider.Get(ctx, predictionID)
+		if err != nil {
+			failures++
+			if failures < maxPollFailures && !errors.Is(err, faceswap.ErrPredictionNotFound) {
+				s.logger.Warnf("Failed to query prediction %s of task %s: %v", predictionID, task.ID, err)
+				continue
+			}
+			_, failErr := s.tasks.FailTask(task, err.Error())
+			return failErr
+		}
+		failures = 0
+
+		switch prediction.Status {
+		case faceswap.StatusSucceeded:
+			return s.complete(ctx, task, prediction)
+		case faceswap.StatusFailed, faceswap.StatusCanceled:
+			reason := prediction.Error
+			if reason == "" {
+				reason = "换脸任务" + prediction.Status
+			}
+			_, err := s.tasks.FailTask(task, reason)
+			return err
+		}
+
+		if prediction.Progress >= 0 {
+			progress := strconv.Itoa(prediction.Progress) + "%"
+			if progress != task.Progress {
+				task.Progress = progress
+				if _, err := s.tasks.SaveIfUnfinished(task); err != nil {
+					s.logger.Warnf("Failed to save progress of task %s: %v", task.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// complete 保存换脸结果，服务提供方的地址会过期，启用存储时转存
+func (s *FaceSwapService) complete(ctx context.Context, task *entity.Task, prediction *faceswap.Prediction) error {
+	if len(prediction.Output) == 0 {
+		_, err := s.tasks.FailTask(task, "换脸服务未返回结果")
+		return err
+	}
+
+	store := s.tasks.storeResult
+	if task.Action == entity.TaskActionSwapVideoFace {
+		video, snapshot := splitVideoOutput(prediction.Output)
+		task.ImageURL = video
+		task.URL = video
+		task.ContentType = "video/mp4"
+		store = func(ctx context.Context, task *entity.Task) {
+			if err := s.tasks.results.StoreVideo(ctx, task, snapshot); err != nil {
+				s.logger.Warnf("Failed to store video of task %s: %v", task.ID, err)
+			}
+		}
+	} else {
+		task.ImageURL = prediction.Output[0]
+		task.URL = prediction.Output[0]
+	}
+	task.Success()
+	s.tasks.setProxyURL(task)
+
+	_, err := s.tasks.saveSuccess(ctx, task, store)
+	return err
+}
+
+// cancelPrediction 取消服务提供方的预测，失败时只记录日志
+func (s *FaceSwapService) cancelPrediction(lane *faceSwapLane, predictionID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := lane.provider.Cancel(ctx, predictionID); err != nil {
+		s.logger.Debugf("Failed to cancel prediction %s: %v", predictionID, err)
+	}
+}
+
+// splitVideoOutput 从视频换脸的输出中区分视频和截图，按扩展名判断，无法判断时第一个为视频
+func splitVideoOutput(outputs []string) (string, string) {
+	video, snapshot := "", ""
+	for _, output := range outputs {
+		ext := strings.ToLower(path.Ext(strings.SplitN(output, "?", 2)[0]))
+		switch ext {
+		case ".png", ".jpg", ".jpeg", ".webp":
+			if snapshot == "" {
+				snapshot = output
+			}
+		default:
+			if video == "" {
+				video = output
+			}
+		}
+	}
+	if video == "" {
+		video = outputs[0]
+	}
+	return video, snapshot
+}
+
+// isFinishedStatus 状态是否为已结束
+func isFinishedStatus(status entity.TaskStatus) bool {
+	for _, unfinished := range entity.UnfinishedTaskStatuses {
+		if status == unfinished {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+
+	"midjourney-proxy-go/internal/domain/entity"
+)
+
+const (
+	// SplitGridProperty 任务属性：是否切分网格结果，未设置时使用全局配置
+	SplitGridProperty = "splitGrid"
+	// GridImagesProperty 任务属性：切分后的图片
+	GridImagesProperty = "gridImages"
+)
+
+// gridActions 结果为2x2网格的任务类型
+var gridActions = map[entity.TaskAction]bool{
+	entity.TaskActionImagine:   true,
+	entity.TaskActionVariation: true,
+	entity.TaskActionReroll:    true,
+}
+
+// GridImage 网格切分后的单张图片，Index从1开始，与U1-U4顺序一致
+type GridImage struct {
+	Index        int                    `json:"index"`
+	URL          string                 `json:"url"`
+	ThumbnailURL string                 `json:"thumbnailUrl,omitempty"`
+	Thumbnails   map[string]interface{} `json:"thumbnails,omitempty"`
+	Width        int                    `json:"width"`
+	Height       int                    `json:"height"`
+}
+
+// shouldSplit 任务结果是否需要切分
+func (r *ResultStore) shouldSplit(task *entity.Task) bool {
+	if !gridActions[task.Action] {
+		return false
+	}
+
+	if value, exists := task.GetProperty(SplitGridProperty); exists {
+		if split, ok := value.(bool); ok {
+			return split
+		}
+	}
+
+	return r.splitGrid
+}
+
+// storeGrid 将网格结果切分为4张图片，按左上、右上、左下、右下顺序保存
+func (r *ResultStore) storeGrid(ctx context.Context, task *entity.Task, img image.Image) error {
+	rgba := toRGBA(img)
+	width, height := rgba.Rect.Dx()/2, rgba.Rect.Dy()/2
+	if width == 0 || height == 0 {
+		return fmt.Errorf("image too small to split: %dx%d", rgba.Rect.Dx(), rgba.Rect.Dy())
+	}
+
+	images := make([]GridImage, 0, 4)
+	for i := 0; i < 4; i++ {
+		x, y := (i%2)*width, (i/2)*height
+		quadrant := rgba.SubImage(image.Rect(x, y, x+width, y+height))
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, quadrant); err != nil {
+			return fmt.Errorf("failed to encode grid image %d: %w", i+1, err)
+		}
+
+		prefix := fmt.Sprintf("tasks/%s/grid_%d", task.ID, i+1)
+		result, err := r.storage.Save(ctx, prefix+".png", &buf, "image/png")
+		if err != nil {
+			return fmt.Errorf("failed to save grid image %d: %w", i+1, err)
+		}
+
+		gridImage := GridImage{
+			Index:  i + 1,
+			URL:    result.URL,
+			Width:  width,
+			Height: height,
+		}
+
+		thumbnail, urls, err := r.storeThumbnails(ctx, prefix+"_thumb", quadrant)
+		if err != nil {
+			return err
+		}
+		gridImage.ThumbnailURL = thumbnail.URL
+		gridImage.Thumbnails = urls
+
+		images = append(images, gridImage)
+	}
+
+	task.SetProperty(GridImagesProperty, images)
+	return nil
+}
+
+// GridImages 获取任务切分后的图片，从数据库读取的属性需重新解析
+func GridImages(task *entity.Task) []GridImage {
+	value, exists := task.GetProperty(GridImagesProperty)
+	if !exists {
+		return nil
+	}
+
+	if images, ok := value.([]GridImage); ok {
+		return images
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+
+	var images []GridImage
+	if err := json.Unmarshal(data, &images); err != nil {
+		return nil
+	}
+	return images
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/database"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// testLogger 只输出错误日志
+func testLogger() logger.Logger {
+	return logger.New("error", "text")
+}
+
+// newTestRepositories 在临时目录中创建并迁移SQLite数据库
+func newTestRepositories(t *testing.T) *repository.Repositories {
+	t.Helper()
+
+	repos, err := database.Open(config.DatabaseConfig{
+		Type:   "sqlite",
+		SQLite: config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "test.db")},
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	return repos
+}
+
+// newTestTaskService 创建使用临时数据库、未启动的Discord管理器的任务服务
+func newTestTaskService(t *testing.T, repos *repository.Repositories) (*TaskService, *discord.Manager) {
+	t.Helper()
+
+	log := testLogger()
+	manager := discord.NewManager(config.DiscordConfig{}, log)
+	notify := NewNotifyService(repos.WebhookDeliveries, config.NotificationConfig{}, log)
+	service := NewTaskService(repos, manager, notify, nil, nil, nil, log)
+	return service, manager
+}
+
+// newTestClusterNode 连接REDIS_ADDR指定的Redis创建集群节点，未设置时跳过测试
+func newTestClusterNode(t *testing.T) *cluster.Node {
+	t.Helper()
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("invalid REDIS_ADDR %q: %v", addr, err)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		t.Fatalf("invalid REDIS_ADDR %q: %v", addr, err)
+	}
+
+	node, err := cluster.Connect(config.RedisConfig{
+		Host:     host,
+		Port:     port,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() {
+		node.Close()
+	})
+	return node
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/storage"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+const (
+	// ImageProxyPath 图片代理路由前缀
+	ImageProxyPath = "/api/mj/image/"
+
+	defaultImageCacheDir  = "./data/image-cache"
+	defaultImageCacheSize = 1024
+	defaultImageMaxAge    = 7 * 24 * 3600
+
+	// imageDownloadTimeout 单次下载的超时时间，下载与请求的上下文无关
+	imageDownloadTimeout = 2 * time.Minute
+)
+
+// discordImageHosts Discord附件的CDN主机，代理只从这些主机和配置的 allowed_hosts 下载
+var discordImageHosts = []string{"cdn.discordapp.com", "media.discordapp.net"}
+
+var (
+	// ErrImageNotFound 任务没有可用的图片
+	ErrImageNotFound = errors.New("图片不存在")
+	// errImageTooLarge 远程图片超过大小上限
+	errImageTooLarge = errors.New("image too large")
+)
+
+// ProxyImage 代理的图片内容，调用方负责关闭Body
+type ProxyImage struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	ETag        string
+}
+
+// ImageProxy 图片代理，优先读取已转存的结果，否则经代理从Discord CDN获取并缓存到磁盘
+type ImageProxy struct {
+	results   *ResultStore
+	cache     *storage.DiskCache
+	client    *http.Client
+	publicURL string
+	maxAge    int
+	maxSize   int64
+	hosts     map[string]bool
+	logger    logger.Logger
+
+	inflight map[string]*imageDownload
+	mutex    sync.Mutex
+}
+
+// imageDownload 进行中的下载，done关闭后err为下载结果
+type imageDownload struct {
+	done chan struct{}
+	err  error
+}
+
+// NewImageProxy 创建图片代理
+func NewImageProxy(cfg config.ImageProxyConfig, results *ResultStore, client *http.Client, logger logger.Logger) (*ImageProxy, error) {
+	dir := cfg.CacheDir
+	if dir == "" {
+		dir = defaultImageCacheDir
+	}
+	sizeMB := cfg.CacheSizeMB
+	if sizeMB <= 0 {
+		sizeMB = defaultImageCacheSize
+	}
+	maxAge := cfg.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultImageMaxAge
+	}
+
+	cache, err := storage.NewDiskCache(dir, sizeMB<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make(map[string]bool)
+	for _, host := range append(discordImageHosts, cfg.AllowedHosts...) {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts[host] = true
+		}
+	}
+
+	p := &ImageProxy{
+		results:   results,
+		cache:     cache,
+		publicURL: strings.TrimRight(cfg.PublicURL, "/"),
+		maxAge:    maxAge,
+		maxSize:   maxResultSize,
+		hosts:     hosts,
+		logger:    logger,
+		inflight:  make(map[string]*imageDownload),
+	}
+
+	// 重定向同样只允许到允许的主机
+	proxyClient := *client
+	proxyClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return fmt.Errorf("too many redirects")
+		}
+		if !p.hostAllowed(req.URL) {
+			return fmt.Errorf("redirect to %s is not allowed", req.URL.Host)
+		}
+		return nil
+	}
+	p.client = &proxyClient
+
+	return p, nil
+}
+
+// hostAllowed 地址是否指向允许代理的主机，任务地址可能来自导入的数据，不能任意访问
+func (p *ImageProxy) hostAllowed(u *url.URL) bool {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	return p.hosts[strings.ToLower(u.Hostname())]
+}
+
+// URL 任务图片的代理地址
+func (p *ImageProxy) URL(taskID string) string {
+	return p.publicURL + ImageProxyPath + taskID
+}
+
+// MaxAge 已完成任务图片的缓存时间（秒）
+func (p *ImageProxy) MaxAge() int {
+	return p.maxAge
+}
+
+// Open 打开任务图片，thumbnail为true时优先返回缩略图，没有缩略图时返回原图
+func (p *ImageProxy) Open(ctx context.Context, task *entity.Task, thumbnail bool) (*ProxyImage, error) {
+	if thumbnail {
+		if image, err := p.openStored(ctx, task, "thumbnailKey"); image != nil || err != nil {
+			return image, err
+		}
+	}
+
+	if image, err := p.openStored(ctx, task, "storageKey"); image != nil || err != nil {
+		return image, err
+	}
+
+	source := task.URL
+	if source == "" {
+		source = task.ImageURL
+	}
+	if source == "" {
+		return nil, ErrImageNotFound
+	}
+	if u, err := url.Parse(source); err != nil || !p.hostAllowed(u) {
+		p.logger.Debugf("Image of task %s is not on an allowed host: %s", task.ID, source)
+		return nil, ErrImageNotFound
+	}
+
+	return p.openRemote(ctx, source)
+}
+
+// openStored 从存储读取属性中记录的对象，属性不存在时返回nil
+func (p *ImageProxy) openStored(ctx context.Context, task *entity.Task, property string) (*ProxyImage, error) {
+	if !p.results.Enabled() {
+		return nil, nil
+	}
+
+	value, exists := task.GetProperty(property)
+	key, _ := value.(string)
+	if !exists || key == "" {
+		return nil, nil
+	}
+
+	body, err := p.results.Storage().Get(ctx, key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			p.logger.Warnf("Stored object %s of task %s is missing", key, task.ID)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	contentType := storage.ContentTypeByKey(key)
+	if property == "storageKey" && task.ContentType != "" {
+		contentType = task.ContentType
+	}
+
+	image := &ProxyImage{
+		Body:        body,
+		ContentType: contentType,
+		Size:        -1,
+		ETag:        etag(key),
+	}
+	if property == "storageKey" && task.Size != nil {
+		image.Size = *task.Size
+	}
+
+	return image, nil
+}
+
+// openRemote 从磁盘缓存读取远程图片，未缓存时下载，同一地址的并发请求只下载一次；
+// 下载在后台进行，请求方断开只会停止自己的等待
+func (p *ImageProxy) openRemote(ctx context.Context, source string) (*ProxyImage, error) {
+	key := cacheKey(source)
+
+	if image, err := p.openCached(key, source); err != storage.ErrNotFound {
+		return image, err
+	}
+
+	p.mutex.Lock()
+	download, loading := p.inflight[key]
+	if !loading {
+		download = &imageDownload{done: make(chan struct{})}
+		p.inflight[key] = download
+		go p.runDownload(key, source, download)
+	}
+	p.mutex.Unlock()
+
+	select {
+	case <-download.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if download.err != nil {
+		return nil, download.err
+	}
+
+	image, err := p.openCached(key, source)
+	if err == storage.ErrNotFound {
+		return nil, ErrImageNotFound
+	}
+	return image, err
+}
+
+// runDownload 使用独立的上下文下载，完成后通知所有等待者
+func (p *ImageProxy) runDownload(key, source string, download *imageDownload) {
+	ctx, cancel := context.WithTimeout(context.Background(), imageDownloadTimeout)
+	defer cancel()
+
+	download.err = p.download(ctx, key, source)
+	if download.err != nil && download.err != ErrImageNotFound {
+		p.logger.Warnf("Failed to download image %s: %v", source, download.err)
+	}
+
+	p.mutex.Lock()
+	delete(p.inflight, key)
+	p.mutex.Unlock()
+	close(download.done)
+}
+
+// openCached 打开磁盘缓存中的图片
+func (p *ImageProxy) openCached(key, source string) (*ProxyImage, error) {
+	file, size, err := p.cache.Open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// 读取文件头判断内容类型
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &ProxyImage{
+		Body:        file,
+		ContentType: http.DetectContentType(head[:n]),
+		Size:        size,
+		ETag:        etag(source),
+	}, nil
+}
+
+// download 下载远程图片到磁盘缓存
+func (p *ImageProxy) download(ctx context.Context, key, source string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+		return ErrImageNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch image returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > p.maxSize {
+		return fmt.Errorf("%w: %d bytes", errImageTooLarge, resp.ContentLength)
+	}
+
+	// 超过上限时读取报错，缓存会丢弃已写入的部分，不会保存截断的图片
+	body := &maxBytesReader{reader: resp.Body, remaining: p.maxSize}
+	if _, err := p.cache.Put(key, body); err != nil {
+		if errors.Is(err, errImageTooLarge) {
+			return fmt.Errorf("%w: more than %d bytes", errImageTooLarge, p.maxSize)
+		}
+		return fmt.Errorf("failed to cache image: %w", err)
+	}
+
+	return nil
+}
+
+// maxBytesReader 最多读取上限加一个字节，超过上限时返回 errImageTooLarge 而不是静默截断
+type maxBytesReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *maxBytesReader) Read(b []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, errImageTooLarge
+	}
+	if int64(len(b)) > r.remaining+1 {
+		b = b[:r.remaining+1]
+	}
+
+	n, err := r.reader.Read(b)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, errImageTooLarge
+	}
+	return n, err
+}
+
+// cacheKey 远程地址对应的缓存键
+func cacheKey(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// etag 根据对象标识生成强ETag，存储键和Discord附件地址对应的内容不会变化
+func etag(identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/storage"
+)
+
+// pngHeader 让缓存的内容被识别为图片
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func newTestImageProxy(t *testing.T, maxSize int64) *ImageProxy {
+	t.Helper()
+
+	proxy, err := NewImageProxy(config.ImageProxyConfig{
+		CacheDir:     t.TempDir(),
+		AllowedHosts: []string{"127.0.0.1"},
+	}, nil, http.DefaultClient, testLogger())
+	if err != nil {
+		t.Fatalf("NewImageProxy: %v", err)
+	}
+	proxy.maxSize = maxSize
+	return proxy
+}
+
+// imageBody 生成size字节、以PNG文件头开头的内容
+func imageBody(size int) []byte {
+	return append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, size-len(pngHeader))...)
+}
+
+func TestImageProxyRejectsOversizedImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 分块发送，不声明Content-Length
+		w.Write(imageBody(1024))
+		w.(http.Flusher).Flush()
+		w.Write(make([]byte, 1024))
+	}))
+	defer server.Close()
+
+	proxy := newTestImageProxy(t, 1024)
+	if _, err := proxy.openRemote(context.Background(), server.URL); !errors.Is(err, errImageTooLarge) {
+		t.Fatalf("openRemote = %v, want errImageTooLarge", err)
+	}
+	if _, _, err := proxy.cache.Open(cacheKey(server.URL)); err != storage.ErrNotFound {
+		t.Fatalf("truncated image was cached: %v", err)
+	}
+}
+
+func TestImageProxyAcceptsImageAtLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		w.Write(imageBody(1024))
+	}))
+	defer server.Close()
+
+	proxy := newTestImageProxy(t, 1024)
+	image, err := proxy.openRemote(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("openRemote: %v", err)
+	}
+	defer image.Body.Close()
+	if image.Size != 1024 || image.ContentType != "image/png" {
+		t.Fatalf("image = %d bytes %s, want 1024 bytes image/png", image.Size, image.ContentType)
+	}
+}
+
+func TestImageProxyDownloadSurvivesFirstRequesterCancel(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write(imageBody(512))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	proxy := newTestImageProxy(t, 1024)
+
+	// 第一个请求发起下载后断开
+	firstCtx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := proxy.openRemote(firstCtx, server.URL)
+		firstErr <- err
+	}()
+	for atomic.LoadInt32(&hits) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	second := make(chan error, 1)
+	var body []byte
+	go func() {
+		image, err := proxy.openRemote(context.Background(), server.URL)
+		if err == nil {
+			body, err = io.ReadAll(image.Body)
+			image.Body.Close()
+		}
+		second <- err
+	}()
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first openRemote = %v, want context.Canceled", err)
+	}
+
+	release <- struct{}{}
+	select {
+	case err := <-second:
+		if err != nil {
+			t.Fatalf("second openRemote: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second openRemote did not return")
+	}
+	if len(body) != 512 {
+		t.Fatalf("body = %d bytes, want 512", len(body))
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("downloads = %d, want 1", got)
+	}
+}
+
+func TestImageProxyOnlyFetchesAllowedHosts(t *testing.T) {
+	var hits int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write(imageBody(64))
+	}))
+	defer internal.Close()
+	// 同一个服务以localhost访问时不在允许列表中
+	disallowed := strings.Replace(internal.URL, "127.0.0.1", "localhost", 1)
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, disallowed+"/image.png", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	proxy := newTestImageProxy(t, 1024)
+
+	for _, source := range []string{disallowed + "/image.png", "file:///etc/passwd"} {
+		task := &entity.Task{ID: "task-1", URL: source}
+		if _, err := proxy.Open(context.Background(), task, false); err != ErrImageNotFound {
+			t.Fatalf("Open(%s) = %v, want ErrImageNotFound", source, err)
+		}
+	}
+
+	task := &entity.Task{ID: "task-2", URL: redirect.URL + "/image.png"}
+	if image, err := proxy.Open(context.Background(), task, false); err == nil {
+		image.Body.Close()
+		t.Fatal("redirect to a disallowed host was followed")
+	}
+	if got := atomic.LoadInt32(&hits); got != 0 {
+		t.Fatalf("disallowed host received %d requests", got)
+	}
+
+	task = &entity.Task{ID: "task-3", URL: internal.URL + "/image.png"}
+	image, err := proxy.Open(context.Background(), task, false)
+	if err != nil {
+		t.Fatalf("Open allowed host: %v", err)
+	}
+	image.Body.Close()
+}
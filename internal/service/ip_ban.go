@@ -0,0 +1,439 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// ViolationKind 计入自动封禁的违规类型
+type ViolationKind string
+
+const (
+	ViolationRateLimit    ViolationKind = "rate_limit"    // 触发限流
+	ViolationBannedPrompt ViolationKind = "banned_prompt" // 提交禁用词
+)
+
+// violationNames 违规类型在封禁原因中的描述
+var violationNames = map[ViolationKind]string{
+	ViolationRateLimit:    "触发限流",
+	ViolationBannedPrompt: "提交禁用词",
+}
+
+// ipBanChannel 封禁变更的广播频道，收到后各副本重新加载封禁缓存
+const ipBanChannel = "ipban:changed"
+
+// ipBanRefreshInterval 定期重新加载封禁缓存的间隔，未启用Redis的多个副本依靠它同步
+const ipBanRefreshInterval = time.Minute
+
+// violationSweepInterval 清理本地违规计数的间隔
+const violationSweepInterval = time.Minute
+
+// defaultBanWindow、defaultBanDurations 未配置时的统计窗口和封禁时长
+var (
+	defaultBanWindow    = 10 * time.Minute
+	defaultBanDurations = []time.Duration{10 * time.Minute, time.Hour, 24 * time.Hour}
+)
+
+// ErrInvalidBanTarget 封禁对象不是有效的IP地址或CIDR
+var ErrInvalidBanTarget = errors.New("无效的IP地址或CIDR")
+
+// ipBanNetwork 按CIDR封禁的网段
+type ipBanNetwork struct {
+	network *net.IPNet
+	ban     *entity.IPBan
+}
+
+// IPBanService IP封禁：生效中的封禁缓存在内存中，封禁变更后重新加载并通知其他副本；
+// 窗口内违规次数达到阈值的IP自动封禁，封禁时长随封禁次数递增
+type IPBanService struct {
+	repo      repository.IPBanRepository
+	config    config.AutoBanConfig
+	window    time.Duration
+	durations []time.Duration
+	exempt    []*net.IPNet
+	node      *cluster.Node
+	logger    logger.Logger
+
+	mu       sync.RWMutex
+	ips      map[string]*entity.IPBan
+	networks []ipBanNetwork
+
+	// 未启用Redis或Redis不可用时的本地违规计数
+	counterMu  sync.Mutex
+	violations map[string][]time.Time
+	lastSweep  time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewIPBanService 创建IP封禁服务，限流白名单中的IP不会被封禁；
+// node不为空时订阅封禁变更并在副本间共享违规计数
+func NewIPBanService(repo repository.IPBanRepository, cfg config.RateLimitConfig, node *cluster.Node, logger logger.Logger) (*IPBanService, error) {
+	s := &IPBanService{
+		repo:       repo,
+		config:     cfg.AutoBan,
+		window:     time.Duration(cfg.AutoBan.WindowSeconds) * time.Second,
+		node:       node,
+		logger:     logger,
+		ips:        make(map[string]*entity.IPBan),
+		violations: make(map[string][]time.Time),
+		lastSweep:  time.Now(),
+		stopCh:     make(chan struct{}),
+	}
+	if s.window <= 0 {
+		s.window = defaultBanWindow
+	}
+	for _, minutes := range cfg.AutoBan.DurationsMinutes {
+		if minutes > 0 {
+			s.durations = append(s.durations, time.Duration(minutes)*time.Minute)
+		}
+	}
+	if len(s.durations) == 0 {
+		s.durations = defaultBanDurations
+	}
+	for _, item := range cfg.Whitelist {
+		network, err := parseBanTarget(item)
+		if err != nil {
+			logger.Warnf("Invalid whitelist entry %q, ignored for IP bans", item)
+			continue
+		}
+		s.exempt = append(s.exempt, network)
+	}
+
+	if node != nil {
+		if err := node.Subscribe(ipBanChannel, func(json.RawMessage) { s.reload() }); err != nil {
+			return nil, fmt.Errorf("failed to subscribe %s: %w", ipBanChannel, err)
+		}
+	}
+	return s, nil
+}
+
+// Start 加载封禁缓存并开始定期刷新
+func (s *IPBanService) Start() {
+	s.reload()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(ipBanRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.reload()
+			}
+		}
+	}()
+}
+
+// Stop 停止定期刷新
+func (s *IPBanService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// Reload 从数据库重新加载生效中的封禁
+func (s *IPBanService) Reload(ctx context.Context) error {
+	bans, err := s.repo.Find(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	ips := make(map[string]*entity.IPBan, len(bans))
+	var networks []ipBanNetwork
+	for i := range bans {
+		ban := &bans[i]
+		if !strings.Contains(ban.ID, "/") {
+			ips[ban.ID] = ban
+			continue
+		}
+		_, network, err := net.ParseCIDR(ban.ID)
+		if err != nil {
+			s.logger.Warnf("Invalid IP ban %q, ignored", ban.ID)
+			continue
+		}
+		networks = append(networks, ipBanNetwork{network: network, ban: ban})
+	}
+
+	s.mu.Lock()
+	s.ips = ips
+	s.networks = networks
+	s.mu.Unlock()
+	return nil
+}
+
+// reload 重新加载封禁缓存，失败时保留原有缓存
+func (s *IPBanService) reload() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.Reload(ctx); err != nil {
+		s.logger.Errorf("Failed to reload IP bans: %v", err)
+	}
+}
+
+// Check 返回IP生效中的封禁，未封禁或在白名单中时返回nil
+func (s *IPBanService) Check(ip string) *entity.IPBan {
+	addr := net.ParseIP(ip)
+	if addr == nil || s.isExempt(addr) {
+		return nil
+	}
+
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if ban, exists := s.ips[addr.String()]; exists && ban.IsActive(now) {
+		return ban
+	}
+	for _, item := range s.networks {
+		if item.network.Contains(addr) && item.ban.IsActive(now) {
+			return item.ban
+		}
+	}
+	return nil
+}
+
+// isExempt IP是否在白名单中
+func (s *IPBanService) isExempt(addr net.IP) bool {
+	for _, network := range s.exempt {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordViolation 记录一次违规，窗口内次数达到阈值时自动封禁该IP，detail为最近一次违规的说明
+func (s *IPBanService) RecordViolation(ip string, kind ViolationKind, detail string) {
+	if !s.config.Enabled {
+		return
+	}
+
+	hits := s.config.RateLimitHits
+	if kind == ViolationBannedPrompt {
+		hits = s.config.BannedPromptHits
+	}
+	addr := net.ParseIP(ip)
+	if hits <= 0 || addr == nil || s.isExempt(addr) {
+		return
+	}
+	ip = addr.String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !s.countViolation(ctx, string(kind)+":"+ip, hits) {
+		return
+	}
+
+	reason := fmt.Sprintf("%d秒内%s%d次", int(s.window/time.Second), violationNames[kind], hits)
+	if detail != "" {
+		reason += "，最近一次: " + detail
+	}
+	if err := s.autoBan(ctx, ip, reason); err != nil {
+		s.logger.Errorf("Failed to ban IP %s: %v", ip, err)
+	}
+}
+
+// countViolation 在窗口内计数，达到hits次时清空计数并返回true。
+// 启用Redis时所有副本共享计数，不可用时使用本地计数
+func (s *IPBanService) countViolation(ctx context.Context, name string, hits int) bool {
+	if s.node != nil {
+		name = "ipban:" + name
+		limits := []cluster.WindowLimit{{Window: s.window, Limit: hits - 1}}
+		allowed, _, err := s.node.TakeSlidingWindow(ctx, name, limits)
+		if err == nil {
+			if allowed {
+				return false
+			}
+			if err := s.node.ClearSlidingWindow(ctx, name, s.window); err != nil {
+				s.logger.Warnf("Failed to clear violation counter %s: %v", name, err)
+			}
+			return true
+		}
+		s.logger.Warnf("Shared violation counter unavailable, using local counter: %v", err)
+	}
+
+	now := time.Now()
+	s.counterMu.Lock()
+	defer s.counterMu.Unlock()
+
+	if now.Sub(s.lastSweep) >= violationSweepInterval {
+		s.lastSweep = now
+		for key, times := range s.violations {
+			if len(times) == 0 || now.Sub(times[len(times)-1]) >= s.window {
+				delete(s.violations, key)
+			}
+		}
+	}
+
+	times := s.violations[name]
+	expired := 0
+	for expired < len(times) && now.Sub(times[expired]) >= s.window {
+		expired++
+	}
+	times = append(times[expired:], now)
+	if len(times) >= hits {
+		delete(s.violations, name)
+		return true
+	}
+	s.violations[name] = times
+	return false
+}
+
+// autoBan 自动封禁IP，时长按此前的封禁次数递增；已被封禁（如其他副本同时封禁）时不做处理
+func (s *IPBanService) autoBan(ctx context.Context, ip, reason string) error {
+	now := time.Now()
+	ban, err := s.repo.Get(ctx, ip)
+	if err == repository.ErrNotFound {
+		ban = &entity.IPBan{ID: ip}
+	} else if err != nil {
+		return err
+	} else if ban.IsActive(now) {
+		return nil
+	}
+
+	level := ban.BanCount
+	if level >= len(s.durations) {
+		level = len(s.durations) - 1
+	}
+	duration := s.durations[level]
+	expiresAt := now.Add(duration)
+
+	ban.Source = entity.IPBanSourceAuto
+	ban.Reason = reason
+	ban.BanCount++
+	ban.ExpiresAt = &expiresAt
+	ban.CreatedBy = ""
+	if err := s.repo.Save(ctx, ban); err != nil {
+		return err
+	}
+
+	s.logger.Warnf("IP %s banned for %s (ban #%d): %s", ip, duration, ban.BanCount, reason)
+	s.changed(ctx)
+	return nil
+}
+
+// Ban 手动封禁IP或CIDR，duration不大于0时永久封禁；已有记录时保留此前的封禁次数
+func (s *IPBanService) Ban(ctx context.Context, target, reason string, duration time.Duration, operator string) (*entity.IPBan, error) {
+	network, err := parseBanTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	id := banTargetID(target, network)
+
+	ban, err := s.repo.Get(ctx, id)
+	if err == repository.ErrNotFound {
+		ban = &entity.IPBan{ID: id}
+	} else if err != nil {
+		return nil, err
+	}
+
+	ban.Source = entity.IPBanSourceManual
+	ban.Reason = reason
+	ban.CreatedBy = operator
+	ban.ExpiresAt = nil
+	if duration > 0 {
+		expiresAt := time.Now().Add(duration)
+		ban.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.Save(ctx, ban); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("IP %s banned by %s: %s", id, operator, reason)
+	s.changed(ctx)
+	return ban, nil
+}
+
+// Unban 删除封禁记录，之后再次自动封禁时从最短的时长开始
+func (s *IPBanService) Unban(ctx context.Context, target string) error {
+	network, err := parseBanTarget(target)
+	if err != nil {
+		return err
+	}
+	id := banTargetID(target, network)
+
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.logger.Infof("IP ban %s removed", id)
+	s.changed(ctx)
+	return nil
+}
+
+// Get 查询封禁记录，包括已到期的自动封禁
+func (s *IPBanService) Get(ctx context.Context, target string) (*entity.IPBan, error) {
+	network, err := parseBanTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, banTargetID(target, network))
+}
+
+// List 查询封禁记录，includeExpired为false时只返回生效中的封禁
+func (s *IPBanService) List(ctx context.Context, includeExpired bool) ([]entity.IPBan, error) {
+	return s.repo.Find(ctx, !includeExpired)
+}
+
+// changed 封禁变更后重新加载本地缓存并通知其他副本
+func (s *IPBanService) changed(ctx context.Context) {
+	if err := s.Reload(ctx); err != nil {
+		s.logger.Errorf("Failed to reload IP bans: %v", err)
+	}
+	if s.node != nil {
+		if err := s.node.Publish(ctx, ipBanChannel, struct{}{}); err != nil {
+			s.logger.Warnf("Failed to broadcast IP ban change: %v", err)
+		}
+	}
+}
+
+// parseBanTarget 解析IP地址或CIDR，单个IP视为只包含自身的网段
+func parseBanTarget(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, ErrInvalidBanTarget
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, ErrInvalidBanTarget
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// banTargetID 封禁记录的ID：单个IP为规范化的地址，网段为规范化的CIDR
+func banTargetID(value string, network *net.IPNet) string {
+	if strings.Contains(value, "/") {
+		return network.String()
+	}
+	return network.IP.String()
+}
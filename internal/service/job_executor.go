@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// JobRunner 任务执行函数
+type JobRunner func(ctx context.Context, task *entity.Task) error
+
+// JobExecutor 不依赖Discord实例的任务执行器（如换脸），按coreSize并发执行，按queueSize限制排队数量
+type JobExecutor struct {
+	name     string
+	coreSize int
+	queue    chan *entity.Task
+	runner   JobRunner
+	logger   logger.Logger
+
+	ctx     context.Context
+	stop    context.CancelFunc
+	mutex   sync.Mutex
+	running map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewJobExecutor 创建任务执行器
+func NewJobExecutor(name string, coreSize, queueSize int, runner JobRunner, logger logger.Logger) *JobExecutor {
+	if coreSize <= 0 {
+		coreSize = 3
+	}
+	if queueSize <= 0 {
+		queueSize = 10
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	return &JobExecutor{
+		name:     name,
+		coreSize: coreSize,
+		queue:    make(chan *entity.Task, queueSize),
+		runner:   runner,
+		logger:   logger,
+		ctx:      ctx,
+		stop:     stop,
+		running:  make(map[string]context.CancelFunc),
+	}
+}
+
+// Start 启动工作协程
+func (e *JobExecutor) Start() {
+	for i := 0; i < e.coreSize; i++ {
+		e.wg.Add(1)
+		go e.worker()
+	}
+}
+
+// Stop 停止执行器，取消正在执行的任务，排队中的任务留待下次启动时恢复
+func (e *JobExecutor) Stop() {
+	e.stop()
+	e.wg.Wait()
+}
+
+// Submit 提交任务到队列
+func (e *JobExecutor) Submit(task *entity.Task) error {
+	if e.ctx.Err() != nil {
+		return discord.ErrExecutorStopped
+	}
+
+	select {
+	case e.queue <- task:
+		return nil
+	default:
+		return discord.ErrQueueFull
+	}
+}
+
+// Cancel 取消正在执行的任务
+func (e *JobExecutor) Cancel(taskID string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if cancel, exists := e.running[taskID]; exists {
+		cancel()
+		return true
+	}
+
+	return false
+}
+
+// QueueCount 排队任务数
+func (e *JobExecutor) QueueCount() int {
+	return len(e.queue)
+}
+
+// RunningCount 执行中任务数
+func (e *JobExecutor) RunningCount() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return len(e.running)
+}
+
+// worker 工作协程
+func (e *JobExecutor) worker() {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case task := <-e.queue:
+			ctx, cancel := context.WithCancel(e.ctx)
+			e.mutex.Lock()
+			e.running[task.ID] = cancel
+			e.mutex.Unlock()
+
+			e.execute(ctx, task)
+
+			e.mutex.Lock()
+			delete(e.running, task.ID)
+			e.mutex.Unlock()
+			cancel()
+		}
+	}
+}
+
+// execute 执行单个任务
+func (e *JobExecutor) execute(ctx context.Context, task *entity.Task) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.logger.Errorf("Task %s panicked on %s executor: %v", task.ID, e.name, r)
+		}
+	}()
+
+	if err := e.runner(ctx, task); err != nil {
+		e.logger.Errorf("Task %s failed on %s executor: %v", task.ID, e.name, err)
+	}
+}
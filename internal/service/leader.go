@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+const (
+	// leaderLeaseName 选举使用的租约名称
+	leaderLeaseName = "leader"
+	// defaultLeaseSeconds 未配置租约有效期时的默认值
+	defaultLeaseSeconds = 30
+
+	// LeaderBackendDatabase 使用数据库租约选举
+	LeaderBackendDatabase = "database"
+	// LeaderBackendRedis 使用Redis锁选举
+	LeaderBackendRedis = "redis"
+)
+
+// leaderBackend 选举的存储后端
+type leaderBackend interface {
+	// acquire 获取或续期租约，返回是否由当前节点持有
+	acquire(ctx context.Context) (bool, error)
+	// release 释放当前节点持有的租约
+	release(ctx context.Context) error
+	// holder 当前持有者的节点ID，没有持有者时返回空字符串
+	holder(ctx context.Context) (string, error)
+}
+
+// databaseLeaderBackend 数据库行租约
+type databaseLeaderBackend struct {
+	leases repository.LeaseRepository
+	nodeID string
+	ttl    time.Duration
+}
+
+func (b *databaseLeaderBackend) acquire(ctx context.Context) (bool, error) {
+	return b.leases.TryAcquire(ctx, leaderLeaseName, b.nodeID, b.ttl)
+}
+
+func (b *databaseLeaderBackend) release(ctx context.Context) error {
+	return b.leases.Release(ctx, leaderLeaseName, b.nodeID)
+}
+
+func (b *databaseLeaderBackend) holder(ctx context.Context) (string, error) {
+	lease, err := b.leases.Get(ctx, leaderLeaseName)
+	if err == repository.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if lease.IsExpired() {
+		return "", nil
+	}
+	return lease.Holder, nil
+}
+
+// redisLeaderBackend Redis分布式锁
+type redisLeaderBackend struct {
+	lock *cluster.Lock
+}
+
+func (b *redisLeaderBackend) acquire(ctx context.Context) (bool, error) {
+	return b.lock.TryAcquire(ctx)
+}
+
+func (b *redisLeaderBackend) release(ctx context.Context) error {
+	return b.lock.Release(ctx)
+}
+
+func (b *redisLeaderBackend) holder(ctx context.Context) (string, error) {
+	return b.lock.Owner(ctx)
+}
+
+// LeaderElector 多副本选举：各副本定期竞争同一租约，持有租约的副本为领导者，
+// 负责执行只能在一个节点上运行的定时任务。领导者每 1/3 有效期续期一次，
+// 宕机后租约过期由其他副本接替，正常退出时主动释放租约以便立即交接
+type LeaderElector struct {
+	backend     leaderBackend
+	backendName string
+	nodeID      string
+	ttl         time.Duration
+	logger      logger.Logger
+
+	mu        sync.RWMutex
+	leader    bool
+	renewedAt time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewLeaderElector 创建选举器，未配置后端时启用Redis则使用Redis锁，否则使用数据库租约
+func NewLeaderElector(cfg config.LeaderConfig, leases repository.LeaseRepository, node *cluster.Node, logger logger.Logger) (*LeaderElector, error) {
+	seconds := cfg.LeaseSeconds
+	if seconds <= 0 {
+		seconds = defaultLeaseSeconds
+	}
+	ttl := time.Duration(seconds) * time.Second
+
+	backendName := cfg.Backend
+	if backendName == "" {
+		backendName = LeaderBackendDatabase
+		if node != nil {
+			backendName = LeaderBackendRedis
+		}
+	}
+
+	e := &LeaderElector{
+		backendName: backendName,
+		ttl:         ttl,
+		logger:      logger,
+		stopCh:      make(chan struct{}),
+	}
+
+	switch backendName {
+	case LeaderBackendRedis:
+		if node == nil {
+			return nil, fmt.Errorf("leader backend redis requires redis to be enabled")
+		}
+		e.nodeID = node.ID()
+		e.backend = &redisLeaderBackend{lock: node.NewLock(leaderLeaseName, ttl)}
+	case LeaderBackendDatabase:
+		e.nodeID = cluster.NewNodeID()
+		if node != nil {
+			e.nodeID = node.ID()
+		}
+		e.backend = &databaseLeaderBackend{leases: leases, nodeID: e.nodeID, ttl: ttl}
+	default:
+		return nil, fmt.Errorf("unsupported leader backend: %s", backendName)
+	}
+
+	return e, nil
+}
+
+// NodeID 当前节点ID
+func (e *LeaderElector) NodeID() string {
+	return e.nodeID
+}
+
+// Backend 选举后端名称
+func (e *LeaderElector) Backend() string {
+	return e.backendName
+}
+
+// Start 立即参与一次选举，之后定期续期或竞争租约
+func (e *LeaderElector) Start() {
+	e.elect()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.stopCh:
+				return
+			case <-ticker.C:
+				e.elect()
+			}
+		}
+	}()
+}
+
+// Stop 停止选举，当前节点为领导者时释放租约，由其他副本立即接替
+func (e *LeaderElector) Stop() {
+	close(e.stopCh)
+	e.wg.Wait()
+
+	e.mu.Lock()
+	wasLeader := e.leader
+	e.leader = false
+	e.mu.Unlock()
+
+	if !wasLeader {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.backend.release(ctx); err != nil {
+		e.logger.Warnf("Failed to release leadership: %v", err)
+		return
+	}
+	e.logger.Infof("Node %s released leadership", e.nodeID)
+}
+
+// elect 获取或续期租约；后端暂时不可用时，已持有的租约在有效期内仍视为有效
+func (e *LeaderElector) elect() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+	defer cancel()
+
+	acquired, err := e.backend.acquire(ctx)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err != nil {
+		e.logger.Warnf("Failed to renew leader lease: %v", err)
+		if e.leader && time.Since(e.renewedAt) >= e.ttl {
+			e.leader = false
+			e.logger.Warnf("Node %s lost leadership: lease expired", e.nodeID)
+		}
+		return
+	}
+
+	switch {
+	case acquired && !e.leader:
+		e.logger.Infof("Node %s became leader (%s)", e.nodeID, e.backendName)
+	case !acquired && e.leader:
+		e.logger.Warnf("Node %s lost leadership", e.nodeID)
+	}
+	e.leader = acquired
+	if acquired {
+		e.renewedAt = time.Now()
+	}
+}
+
+// IsLeader 当前节点是否为领导者，超过有效期未能续期时视为不是
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader && time.Since(e.renewedAt) < e.ttl
+}
+
+// Leader 当前领导者的节点ID，没有领导者时返回空字符串
+func (e *LeaderElector) Leader(ctx context.Context) (string, error) {
+	return e.backend.holder(ctx)
+}
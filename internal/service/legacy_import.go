@@ -0,0 +1,433 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/legacy"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// .NET版枚举，按C#枚举序号排列，序号不连续处为空字符串
+var (
+	legacyTaskStatuses = []string{"NOT_START", "SUBMITTED", "", "IN_PROGRESS", "FAILURE", "SUCCESS", "MODAL", "CANCEL"}
+	legacyTaskActions  = []string{"IMAGINE", "UPSCALE", "VARIATION", "REROLL", "DESCRIBE", "BLEND", "ACTION", "PAN", "OUTPAINT", "INPAINT", "ZOOM", "SHOW", "SHORTEN", "SWAP_FACE", "SWAP_VIDEO_FACE"}
+	legacyBotTypes     = []string{"MID_JOURNEY", "NIJI_JOURNEY", "INSIGHT_FACE"}
+	legacySpeedModes   = []string{"RELAX", "FAST", "TURBO"}
+	legacyUserRoles    = []string{"USER", "ADMIN"}
+	legacyUserStatuses = []string{"NORMAL", "DISABLED"}
+)
+
+// legacyStatusMapping 没有对应状态的.NET版任务状态：MODAL为等待弹窗提交，按执行中导入，由超时看门狗处理
+var legacyStatusMapping = map[string]entity.TaskStatus{
+	"MODAL": entity.TaskStatusInProgress,
+}
+
+// legacyActionMapping 名称不同的.NET版任务动作：OUTPAINT为变焦，INPAINT为局部重绘
+var legacyActionMapping = map[string]entity.TaskAction{
+	"OUTPAINT": entity.TaskActionZoom,
+	"INPAINT":  entity.TaskActionVary,
+}
+
+// LegacyImportSkip 未导入的记录
+type LegacyImportSkip struct {
+	ID     string
+	Reason string
+}
+
+// LegacyImportReport 单个集合的导入结果
+type LegacyImportReport struct {
+	Collection string
+	// Imported 本次导入的记录数
+	Imported int
+	// Existing ID已存在（之前已导入）而跳过的记录数
+	Existing int
+	// Skipped 无法导入的记录及原因
+	Skipped []LegacyImportSkip
+}
+
+// LegacyImporter 从.NET版midjourney-proxy导入任务、账号、用户和禁用词。
+// 保留原有ID，ID已存在的记录不会被覆盖，因此可以重复执行
+type LegacyImporter struct {
+	repos  *repository.Repositories
+	logger logger.Logger
+}
+
+// NewLegacyImporter 创建导入服务
+func NewLegacyImporter(repos *repository.Repositories, logger logger.Logger) *LegacyImporter {
+	return &LegacyImporter{
+		repos:  repos,
+		logger: logger,
+	}
+}
+
+// Import 依次导入账号、用户、禁用词和任务
+func (i *LegacyImporter) Import(ctx context.Context, source legacy.Source) ([]*LegacyImportReport, error) {
+	steps := []struct {
+		collection string
+		fn         func(context.Context, legacy.Record) (bool, error)
+	}{
+		{legacy.CollectionAccount, i.importAccount},
+		{legacy.CollectionUser, i.importUser},
+		{legacy.CollectionWord, i.importBannedWord},
+		{legacy.CollectionTask, i.importTask},
+	}
+
+	var reports []*LegacyImportReport
+	for _, step := range steps {
+		report := &LegacyImportReport{Collection: step.collection}
+		reports = append(reports, report)
+
+		err := source.Each(ctx, step.collection, func(record legacy.Record) error {
+			id := record.ID()
+			if id == "" {
+				report.Skipped = append(report.Skipped, LegacyImportSkip{Reason: "缺少ID"})
+				return nil
+			}
+
+			created, err := step.fn(ctx, record)
+			switch {
+			case err != nil:
+				report.Skipped = append(report.Skipped, LegacyImportSkip{ID: id, Reason: err.Error()})
+			case created:
+				report.Imported++
+			default:
+				report.Existing++
+			}
+			return ctx.Err()
+		})
+		if err != nil {
+			return reports, fmt.Errorf("failed to read %s: %w", step.collection, err)
+		}
+
+		i.logger.Infof("Imported legacy %s: %d imported, %d existing, %d skipped",
+			step.collection, report.Imported, report.Existing, len(report.Skipped))
+	}
+	return reports, nil
+}
+
+// exists 判断ID是否已存在
+func exists[T any](ctx context.Context, get func(context.Context, string) (*T, error), id string) (bool, error) {
+	if _, err := get(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// insert 创建记录后再完整保存一次：GORM创建时会忽略带默认值字段的零值（如enabled=false、day_draw_limit=0），
+// 并把数据库默认值回填到传入的结构体，因此用副本创建，再保存原值。value的创建时间需要事先设置
+func insert[T any](ctx context.Context, create, save func(context.Context, *T) error, value *T) error {
+	created := *value
+	if err := create(ctx, &created); err != nil {
+		return err
+	}
+	return save(ctx, value)
+}
+
+// legacyCreatedAt 原记录的创建时间，没有时使用当前时间
+func legacyCreatedAt(record legacy.Record, name string) time.Time {
+	if createdAt := record.Time(name); createdAt != nil {
+		return *createdAt
+	}
+	return time.Now()
+}
+
+func (i *LegacyImporter) importTask(ctx context.Context, record legacy.Record) (bool, error) {
+	task := &entity.Task{
+		ID:                    record.ID(),
+		ParentID:              record.String("ParentId"),
+		UserID:                record.String("UserId"),
+		BotType:               legacyBotType(record.Enum("BotType", legacyBotTypes)),
+		IsWhite:               record.Bool("IsWhite", false),
+		Nonce:                 record.String("Nonce"),
+		InteractionMetadataID: record.String("InteractionMetadataId"),
+		MessageID:             record.String("MessageId"),
+		RemixModalMessageID:   record.String("RemixModalMessageId"),
+		RemixAutoSubmit:       record.Bool("RemixAutoSubmit", false),
+		RemixModaling:         record.Bool("RemixModaling", false),
+		InstanceID:            record.String("InstanceId"),
+		SubInstanceID:         record.String("SubInstanceId"),
+		Prompt:                record.String("Prompt"),
+		PromptEn:              record.String("PromptEn"),
+		PromptFull:            record.String("PromptFull"),
+		Description:           record.String("Description"),
+		State:                 record.String("State"),
+		SubmitTime:            record.Millis("SubmitTime"),
+		StartTime:             record.Millis("StartTime"),
+		FinishTime:            record.Millis("FinishTime"),
+		ImageURL:              record.String("ImageUrl"),
+		ThumbnailURL:          record.String("ThumbnailUrl"),
+		Progress:              record.String("Progress"),
+		FailReason:            record.String("FailReason"),
+		Seed:                  record.String("Seed"),
+		SeedMessageID:         record.String("SeedMessageId"),
+		JobID:                 record.String("JobId"),
+		ClientIP:              record.String("ClientIp"),
+		IsReplicate:           record.Bool("IsReplicate", false),
+		ReplicateSource:       record.String("ReplicateSource"),
+		ReplicateTarget:       record.String("ReplicateTarget"),
+		Mode:                  entity.GenerationSpeedMode(record.Enum("Mode", legacySpeedModes)),
+		URL:                   record.String("Url"),
+		ProxyURL:              record.String("ProxyUrl"),
+		ContentType:           record.String("ContentType"),
+		Size:                  record.Int64("Size"),
+		Properties:            record.Map("Properties"),
+	}
+
+	status := record.Enum("Status", legacyTaskStatuses)
+	if status == "" {
+		return false, fmt.Errorf("未知的任务状态: %s", record.String("Status"))
+	}
+	task.Status = entity.TaskStatus(status)
+	if mapped, ok := legacyStatusMapping[status]; ok {
+		task.Status = mapped
+	}
+
+	action := record.Enum("Action", legacyTaskActions)
+	if action == "" {
+		return false, fmt.Errorf("未知的任务动作: %s", record.String("Action"))
+	}
+	task.Action = entity.TaskAction(action)
+	if mapped, ok := legacyActionMapping[action]; ok {
+		task.Action = mapped
+	}
+
+	if realBotType := record.Enum("RealBotType", legacyBotTypes); realBotType != "" {
+		botType := legacyBotType(realBotType)
+		task.RealBotType = &botType
+	}
+	if height := record.Int64("Height"); height != nil {
+		value := int(*height)
+		task.Height = &value
+	}
+	if width := record.Int64("Width"); width != nil {
+		value := int(*width)
+		task.Width = &value
+	}
+
+	for _, button := range record.Records("Buttons") {
+		task.Buttons = append(task.Buttons, entity.CustomComponent{
+			Type:     button.Int("Type", 0),
+			Style:    button.Int("Style", 0),
+			Label:    button.String("Label"),
+			Emoji:    button.String("Emoji"),
+			CustomID: button.String("CustomId"),
+		})
+	}
+
+	if filter := record.Object("AccountFilter"); filter != nil {
+		task.AccountFilter = &entity.AccountFilter{
+			InstanceID:   filter.String("InstanceId"),
+			RemixEnabled: filter.Bool("Remix", false),
+		}
+		for _, mode := range filter.Enums("Modes", legacySpeedModes) {
+			task.AccountFilter.Modes = append(task.AccountFilter.Modes, entity.GenerationSpeedMode(mode))
+		}
+	}
+
+	// 任务没有单独的创建时间，使用提交时间
+	if task.SubmitTime != nil {
+		task.CreatedAt = *task.SubmitTime
+	}
+
+	found, err := exists(ctx, i.repos.Tasks.Get, task.ID)
+	if err != nil || found {
+		return false, err
+	}
+	return true, i.repos.Tasks.Create(ctx, task)
+}
+
+// legacyBotType 换脸任务在.NET版中为INSIGHT_FACE，此处没有对应的机器人类型
+func legacyBotType(botType string) entity.BotType {
+	if botType == "INSIGHT_FACE" {
+		return ""
+	}
+	return entity.BotType(botType)
+}
+
+func (i *LegacyImporter) importUser(ctx context.Context, record legacy.Record) (bool, error) {
+	user := &entity.User{
+		ID:             record.ID(),
+		Username:       record.String("Name"),
+		Email:          record.String("Email"),
+		Role:           entity.RoleUser,
+		Token:          record.String("Token"),
+		TokenType:      "bearer",
+		Enabled:        record.Enum("Status", legacyUserStatuses) != "DISABLED",
+		IsWhite:        record.Bool("IsWhite", false),
+		TotalDrawCount: record.Int("TotalDrawCount", 0),
+		DayDrawCount:   record.Int("DayDrawCount", 0),
+		DayDrawLimit:   record.Int("DayDrawLimit", -1),
+		TotalDrawLimit: record.Int("TotalDrawLimit", -1),
+		ExpiredAt:      record.Time("ValidEndTime"),
+		CreatedAt:      legacyCreatedAt(record, "CreateTime"),
+	}
+	if record.Enum("Role", legacyUserRoles) == "ADMIN" {
+		user.Role = entity.RoleAdmin
+	}
+
+	if user.Username == "" {
+		return false, errors.New("缺少用户名")
+	}
+	if user.Email == "" {
+		return false, errors.New("缺少邮箱")
+	}
+
+	found, err := exists(ctx, i.repos.Users.Get, user.ID)
+	if err != nil || found {
+		return false, err
+	}
+	if other, err := i.repos.Users.FindByUsernameOrEmail(ctx, user.Username, user.Email); err == nil {
+		return false, fmt.Errorf("用户名或邮箱已被用户 %s 使用", other.ID)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return false, err
+	}
+	return true, insert(ctx, i.repos.Users.Create, i.repos.Users.Save, user)
+}
+
+func (i *LegacyImporter) importAccount(ctx context.Context, record legacy.Record) (bool, error) {
+	account := &entity.DiscordAccount{
+		ID:                      record.ID(),
+		ChannelID:               record.String("ChannelId"),
+		GuildID:                 record.String("GuildId"),
+		PrivateChannelID:        record.String("PrivateChannelId"),
+		NijiBotChannelID:        record.String("NijiBotChannelId"),
+		UserToken:               record.String("UserToken"),
+		BotToken:                record.String("BotToken"),
+		UserAgent:               record.String("UserAgent"),
+		Enabled:                 record.Bool("Enable", true),
+		EnableMJ:                record.Bool("EnableMj", true),
+		EnableNiji:              record.Bool("EnableNiji", false),
+		EnableFastToRelax:       record.Bool("EnableFastToRelax", false),
+		EnableRelaxToFast:       record.Bool("EnableRelaxToFast", false),
+		FastExhausted:           record.Bool("FastExhausted", false),
+		Lock:                    record.Bool("Lock", false),
+		DisabledReason:          record.String("DisabledReason"),
+		PermanentInvitationLink: record.String("PermanentInvitationLink"),
+		CfHashCreated:           record.Time("CfHashCreated"),
+		CfHashURL:               record.String("CfHashUrl"),
+		CfURL:                   record.String("CfUrl"),
+		IsSponsor:               record.Bool("IsSponsor", false),
+		SponsorUserID:           record.String("SponsorUserId"),
+		CoreSize:                record.Int("CoreSize", 3),
+		QueueSize:               record.Int("QueueSize", 10),
+		MaxQueueSize:            record.Int("MaxQueueSize", 100),
+		TimeoutMinutes:          record.Int("TimeoutMinutes", 5),
+		Interval:                record.Float("Interval", 1.2),
+		AfterIntervalMin:        record.Float("AfterIntervalMin", 1.2),
+		AfterIntervalMax:        record.Float("AfterIntervalMax", 1.2),
+		Remark:                  record.String("Remark"),
+		Sponsor:                 record.String("Sponsor"),
+		InfoUpdated:             record.Time("InfoUpdated"),
+		Weight:                  record.Int("Weight", 0),
+		Sort:                    record.Int("Sort", 0),
+		WorkTime:                record.String("WorkTime"),
+		FishingTime:             record.String("FishingTime"),
+		RemixAutoSubmit:         record.Bool("RemixAutoSubmit", false),
+		Mode:                    entity.GenerationSpeedMode(record.Enum("Mode", legacySpeedModes)),
+		EnableAutoSetRelax:      record.Bool("EnableAutoSetRelax", false),
+		SettingsMessageID:       record.String("SettingsMessageId"),
+		NijiSettingsMessageID:   record.String("NijiSettingsMessageId"),
+		IsBlend:                 record.Bool("IsBlend", true),
+		IsDescribe:              record.Bool("IsDescribe", true),
+		IsShorten:               record.Bool("IsShorten", true),
+		LoginAccount:            record.String("LoginAccount"),
+		LoginPassword:           record.String("LoginPassword"),
+		Login2FA:                record.String("Login2fa"),
+		LoginMessage:            record.String("LoginMessage"),
+		DayDrawLimit:            record.Int("DayDrawLimit", -1),
+		DayDrawCount:            record.Int("DayDrawCount", 0),
+		IsVerticalDomain:        record.Bool("IsVerticalDomain", false),
+		VerticalDomainIDs:       record.Strings("VerticalDomainIds"),
+		SubChannels:             record.Strings("SubChannels"),
+		Properties:              record.Map("Properties"),
+		CreatedAt:               legacyCreatedAt(record, "DateCreated"),
+	}
+	// 设置组件（Components）结构与.NET版不同，账号连接后会重新获取，不导入
+	for _, mode := range record.Enums("AllowModes", legacySpeedModes) {
+		account.AllowModes = append(account.AllowModes, entity.GenerationSpeedMode(mode))
+	}
+	if values := record.Map("SubChannelValues"); len(values) > 0 {
+		account.SubChannelValues = make(map[string]string, len(values))
+		for key, value := range values {
+			if s, ok := value.(string); ok {
+				account.SubChannelValues[key] = s
+			}
+		}
+	}
+
+	if account.ChannelID == "" {
+		return false, errors.New("缺少频道ID")
+	}
+
+	found, err := exists(ctx, i.repos.Accounts.Get, account.ID)
+	if err != nil || found {
+		return false, err
+	}
+	if other, err := i.repos.Accounts.GetByChannelID(ctx, account.ChannelID); err == nil {
+		return false, fmt.Errorf("频道ID已被账号 %s 使用", other.ID)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return false, err
+	}
+	return true, insert(ctx, i.repos.Accounts.Create, i.repos.Accounts.Save, account)
+}
+
+// importBannedWord .NET版一条禁用词记录包含多个关键词，拆分为多条禁用词，
+// 分组ID为原记录ID，禁用词ID为“原记录ID-序号”，重复执行时保持不变
+func (i *LegacyImporter) importBannedWord(ctx context.Context, record legacy.Record) (bool, error) {
+	keywords := record.Strings("Keywords")
+	if len(keywords) == 0 {
+		return false, errors.New("没有关键词")
+	}
+
+	remark := record.String("Name")
+	if description := record.String("Description"); description != "" {
+		remark += ": " + description
+	}
+
+	existing, err := i.repos.BannedWords.Find(ctx, false)
+	if err != nil {
+		return false, err
+	}
+	words := make(map[string]string, len(existing))
+	for _, word := range existing {
+		words[word.Word] = word.ID
+	}
+
+	created := false
+	var duplicates []string
+	for index, keyword := range keywords {
+		word := &entity.BannedWord{
+			ID:        fmt.Sprintf("%s-%d", record.ID(), index+1),
+			Word:      keyword,
+			GroupID:   record.ID(),
+			Enabled:   record.Bool("Enable", true),
+			Remark:    remark,
+			CreatedAt: legacyCreatedAt(record, "CreateTime"),
+		}
+
+		if id, ok := words[keyword]; ok {
+			if id != word.ID {
+				duplicates = append(duplicates, keyword)
+			}
+			continue
+		}
+		if err := insert(ctx, i.repos.BannedWords.Create, i.repos.BannedWords.Save, word); err != nil {
+			return created, err
+		}
+		words[keyword] = word.ID
+		created = true
+	}
+
+	if len(duplicates) > 0 && !created {
+		return false, fmt.Errorf("关键词已存在: %v", duplicates)
+	}
+	return created, nil
+}
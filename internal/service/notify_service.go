@@ -0,0 +1,530 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/fetcher"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+const (
+	// SignatureHeader 回调签名头，值为 "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+	SignatureHeader = "X-Signature"
+	// TimestampHeader 回调签名时间戳头（Unix秒）
+	TimestampHeader = "X-Timestamp"
+	// DeliveryHeader 回调投递记录ID头，接收方可用于去重
+	DeliveryHeader = "X-Delivery-Id"
+
+	defaultNotifyWorkers    = 4
+	defaultNotifyQueueSize  = 1000
+	defaultNotifyMaxRetries = 5
+	notifyBaseBackoff       = time.Second
+	notifyMaxBackoff        = time.Minute
+	notifyMaxRedirects      = 3
+)
+
+var (
+	// ErrDeliveryNotFound 投递记录不存在
+	ErrDeliveryNotFound = errors.New("投递记录不存在")
+	// errDeliverySuperseded 同一任务已有更新的回调，过期的进度回调不再投递
+	errDeliverySuperseded = errors.New("任务已有更新的状态，跳过过期的进度回调")
+)
+
+// notifyJob 待投递的回调
+type notifyJob struct {
+	delivery *entity.WebhookDelivery
+	attempt  int    // 本轮投递的第几次重试，0为首次投递
+	seq      uint64 // 加入队列的序号，同一任务序号更大的回调更新
+}
+
+// taskDeliveries 一个任务未结束的投递
+type taskDeliveries struct {
+	latest uint64 // 最新一次回调的序号
+	count  int
+}
+
+// NotifyService 任务回调通知服务，使用有界队列和固定数量的worker投递。
+// 同一任务的回调固定由同一个worker按顺序投递，已有更新状态时丢弃过期的进度回调；
+// 失败按指数退避重试，退避期间由定时器等待，不占用worker
+type NotifyService struct {
+	deliveries repository.WebhookDeliveryRepository
+	client     *http.Client
+	config     config.NotificationConfig
+	logger     logger.Logger
+	queues     []chan notifyJob // 每个worker一个队列
+	stopCh     chan struct{}
+	wg         sync.WaitGroup
+	startOnce  sync.Once
+	stopOnce   sync.Once
+	maxRetries int
+
+	// 各任务未结束的投递，键为任务ID
+	taskMutex sync.Mutex
+	seq       uint64
+	tasks     map[string]*taskDeliveries
+
+	// 等待重试的投递，键为投递记录ID
+	retryMutex sync.Mutex
+	retries    map[string]*time.Timer
+	stopped    bool
+
+	// 全局默认回调地址，可在运行时修改
+	hookMutex   sync.RWMutex
+	defaultHook string
+}
+
+// NewNotifyService 创建回调通知服务
+func NewNotifyService(deliveries repository.WebhookDeliveryRepository, cfg config.NotificationConfig, logger logger.Logger) *NotifyService {
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultNotifyQueueSize
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultNotifyMaxRetries
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultNotifyWorkers
+	}
+
+	// 队列总长度不变，平均分给各worker
+	queues := make([]chan notifyJob, workers)
+	for i := range queues {
+		queues[i] = make(chan notifyJob, (queueSize+workers-1)/workers)
+	}
+
+	return &NotifyService{
+		deliveries: deliveries,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				// 与下载器相同，不使用环境变量中的代理，连接时检查实际访问的地址
+				Proxy:               nil,
+				DialContext:         fetcher.NewDialer(cfg.AllowPrivateNetwork).DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+				MaxIdleConns:        20,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > notifyMaxRedirects {
+					return fetcher.ErrTooManyRedirects
+				}
+				return fetcher.CheckURL(req.URL, cfg.AllowPrivateNetwork)
+			},
+		},
+		config:     cfg,
+		logger:     logger,
+		queues:     queues,
+		stopCh:     make(chan struct{}),
+		maxRetries: maxRetries,
+		tasks:      make(map[string]*taskDeliveries),
+		retries:    make(map[string]*time.Timer),
+
+		defaultHook: cfg.Webhook,
+	}
+}
+
+// SetDefaultWebhook 设置任务未指定回调地址时使用的全局默认地址
+func (n *NotifyService) SetDefaultWebhook(hook string) {
+	n.hookMutex.Lock()
+	defer n.hookMutex.Unlock()
+	n.defaultHook = hook
+}
+
+// Start 启动投递worker
+func (n *NotifyService) Start() {
+	n.startOnce.Do(func() {
+		for _, queue := range n.queues {
+			n.wg.Add(1)
+			go n.worker(queue)
+		}
+
+		n.logger.Infof("Notify service started with %d workers", len(n.queues))
+	})
+}
+
+// Stop 停止投递worker，等待重试的投递会被取消并保留为失败记录，可稍后重放
+func (n *NotifyService) Stop() {
+	n.stopOnce.Do(func() {
+		close(n.stopCh)
+		n.wg.Wait()
+
+		n.retryMutex.Lock()
+		n.stopped = true
+		retries := n.retries
+		n.retries = make(map[string]*time.Timer)
+		n.retryMutex.Unlock()
+
+		for _, timer := range retries {
+			timer.Stop()
+		}
+		for id := range retries {
+			if err := n.deliveries.Update(context.Background(), id, map[string]interface{}{
+				"status": entity.WebhookDeliveryFailure,
+				"error":  "服务停止，投递中断",
+			}); err != nil {
+				n.logger.Errorf("Failed to save webhook delivery %s: %v", id, err)
+			}
+		}
+
+		n.logger.Info("Notify service stopped")
+	})
+}
+
+// Notify 将任务当前状态加入回调队列，任务未设置回调地址时使用全局默认地址
+func (n *NotifyService) Notify(task *entity.Task) {
+	hook := task.NotifyHook
+	if hook == "" {
+		n.hookMutex.RLock()
+		hook = n.defaultHook
+		n.hookMutex.RUnlock()
+	}
+	if hook == "" {
+		return
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		n.logger.Errorf("Failed to marshal task %s for notify: %v", task.ID, err)
+		return
+	}
+
+	delivery := &entity.WebhookDelivery{
+		ID:         uuid.New().String(),
+		TaskID:     task.ID,
+		URL:        hook,
+		TaskStatus: task.Status,
+		Progress:   task.Progress,
+		Payload:    string(data),
+		Status:     entity.WebhookDeliveryPending,
+	}
+	if err := n.deliveries.Create(context.Background(), delivery); err != nil {
+		n.logger.Errorf("Failed to create webhook delivery for task %s: %v", task.ID, err)
+		return
+	}
+
+	n.enqueue(delivery)
+}
+
+// ListDeliveries 分页查询投递记录
+func (n *NotifyService) ListDeliveries(taskID string, status entity.WebhookDeliveryStatus, page, size int) ([]entity.WebhookDelivery, int64, error) {
+	query := repository.WebhookDeliveryQuery{TaskID: taskID, Status: status}
+
+	total, err := n.deliveries.Count(context.Background(), query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query.Offset = (page - 1) * size
+	query.Limit = size
+	deliveries, err := n.deliveries.Find(context.Background(), query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
+
+// GetDelivery 获取投递记录
+func (n *NotifyService) GetDelivery(id string) (*entity.WebhookDelivery, error) {
+	delivery, err := n.deliveries.Get(context.Background(), id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// Replay 重新投递记录中保存的原始负载
+func (n *NotifyService) Replay(id string) (*entity.WebhookDelivery, error) {
+	delivery, err := n.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Status = entity.WebhookDeliveryPending
+	delivery.Error = ""
+	if err := n.deliveries.Update(context.Background(), delivery.ID, map[string]interface{}{
+		"status": delivery.Status,
+		"error":  delivery.Error,
+	}); err != nil {
+		return nil, err
+	}
+
+	// 正在等待重试的投递改为立即投递，避免重复
+	n.retryMutex.Lock()
+	timer, waiting := n.retries[delivery.ID]
+	if waiting {
+		timer.Stop()
+		delete(n.retries, delivery.ID)
+	}
+	n.retryMutex.Unlock()
+	if waiting {
+		n.release(delivery.TaskID)
+	}
+
+	n.enqueue(delivery)
+	return delivery, nil
+}
+
+// CleanupDeliveries 删除创建超过retention且已结束的投递记录，返回删除的数量
+func (n *NotifyService) CleanupDeliveries(ctx context.Context, retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	cutoff := time.Now().Add(-retention)
+	count, err := n.deliveries.DeleteFinishedBefore(ctx, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+
+	if count > 0 {
+		n.logger.Infof("Deleted %d webhook deliveries created before %s", count, cutoff.Format(time.RFC3339))
+	}
+	return count, nil
+}
+
+// enqueue 记录为任务最新的回调并加入投递队列
+func (n *NotifyService) enqueue(delivery *entity.WebhookDelivery) {
+	n.push(notifyJob{delivery: delivery, seq: n.track(delivery.TaskID)})
+}
+
+// push 将投递加入任务对应的队列，队列已满时直接标记为失败，避免阻塞任务流程
+func (n *NotifyService) push(job notifyJob) {
+	hash := fnv.New32a()
+	hash.Write([]byte(job.delivery.TaskID))
+	queue := n.queues[hash.Sum32()%uint32(len(n.queues))]
+
+	select {
+	case queue <- job:
+	default:
+		n.logger.Warnf("Notify queue is full, dropping delivery %s of task %s", job.delivery.ID, job.delivery.TaskID)
+		n.finish(job, job.delivery.StatusCode, errors.New("回调队列已满"))
+	}
+}
+
+// track 记录任务新的回调，返回其序号
+func (n *NotifyService) track(taskID string) uint64 {
+	n.taskMutex.Lock()
+	defer n.taskMutex.Unlock()
+
+	n.seq++
+	state, exists := n.tasks[taskID]
+	if !exists {
+		state = &taskDeliveries{}
+		n.tasks[taskID] = state
+	}
+	state.latest = n.seq
+	state.count++
+	return n.seq
+}
+
+// release 任务的一个投递已结束，没有未结束的投递时清除记录
+func (n *NotifyService) release(taskID string) {
+	n.taskMutex.Lock()
+	defer n.taskMutex.Unlock()
+
+	if state, exists := n.tasks[taskID]; exists {
+		state.count--
+		if state.count <= 0 {
+			delete(n.tasks, taskID)
+		}
+	}
+}
+
+// superseded 进度回调之后是否已有同一任务更新的回调，结束状态的回调总是投递
+func (n *NotifyService) superseded(job notifyJob) bool {
+	if isFinishedStatus(job.delivery.TaskStatus) {
+		return false
+	}
+
+	n.taskMutex.Lock()
+	defer n.taskMutex.Unlock()
+
+	state, exists := n.tasks[job.delivery.TaskID]
+	return exists && state.latest > job.seq
+}
+
+// worker 投递worker，按顺序处理自己队列中的回调
+func (n *NotifyService) worker(queue chan notifyJob) {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case job := <-queue:
+			n.deliver(job)
+		}
+	}
+}
+
+// deliver 投递一次回调，失败时按指数退避安排重试直至达到最大次数
+func (n *NotifyService) deliver(job notifyJob) {
+	delivery := job.delivery
+	if n.superseded(job) {
+		n.finish(job, delivery.StatusCode, errDeliverySuperseded)
+		return
+	}
+
+	statusCode, err := n.send(delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+
+	if err == nil {
+		n.finish(job, statusCode, nil)
+		return
+	}
+
+	n.logger.Warnf("Webhook delivery %s of task %s to %s failed (attempt %d): %v",
+		delivery.ID, delivery.TaskID, delivery.URL, delivery.Attempts, err)
+
+	// 4xx（除429外）视为接收方拒绝，地址不合法或指向内网时同样不重试
+	rejected := statusCode >= 400 && statusCode < 500 && statusCode != http.StatusTooManyRequests
+	rejected = rejected || errors.Is(err, fetcher.ErrPrivateAddress) || errors.Is(err, fetcher.ErrInvalidURL)
+	if rejected || job.attempt >= n.maxRetries {
+		n.finish(job, statusCode, err)
+		return
+	}
+
+	n.retry(notifyJob{delivery: delivery, attempt: job.attempt + 1}, statusCode, err)
+}
+
+// retry 保存本次失败并在退避时间后重新入队，服务已停止时标记为失败
+func (n *NotifyService) retry(job notifyJob, statusCode int, err error) {
+	delivery := job.delivery
+	delivery.StatusCode = statusCode
+	delivery.Error = err.Error()
+	n.save(delivery)
+
+	n.retryMutex.Lock()
+	defer n.retryMutex.Unlock()
+
+	if n.stopped {
+		delivery.Status = entity.WebhookDeliveryFailure
+		delivery.Error = "服务停止，投递中断"
+		n.save(delivery)
+		n.release(delivery.TaskID)
+		return
+	}
+
+	n.retries[delivery.ID] = time.AfterFunc(notifyBackoff(job.attempt), func() {
+		n.retryMutex.Lock()
+		_, waiting := n.retries[delivery.ID]
+		delete(n.retries, delivery.ID)
+		n.retryMutex.Unlock()
+
+		// 已被Stop取消
+		if !waiting {
+			return
+		}
+		n.push(job)
+	})
+}
+
+// send 发送一次回调请求
+func (n *NotifyService) send(delivery *entity.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fetcher.ErrInvalidURL
+	}
+	if err := fetcher.CheckURL(req.URL, n.config.AllowPrivateNetwork); err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery.ID)
+
+	if n.config.WebhookSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+SignPayload(n.config.WebhookSecret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// finish 保存投递结果，投递结束
+func (n *NotifyService) finish(job notifyJob, statusCode int, err error) {
+	defer n.release(job.delivery.TaskID)
+
+	delivery := job.delivery
+	delivery.StatusCode = statusCode
+	if err != nil {
+		delivery.Status = entity.WebhookDeliveryFailure
+		delivery.Error = err.Error()
+	} else {
+		delivery.Status = entity.WebhookDeliverySuccess
+		delivery.Error = ""
+	}
+
+	n.save(delivery)
+}
+
+// save 保存投递状态和最近一次尝试的结果
+func (n *NotifyService) save(delivery *entity.WebhookDelivery) {
+	if err := n.deliveries.Update(context.Background(), delivery.ID, map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"status_code":     delivery.StatusCode,
+		"error":           delivery.Error,
+		"last_attempt_at": delivery.LastAttemptAt,
+	}); err != nil {
+		n.logger.Errorf("Failed to save webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// SignPayload 计算回调签名，接收方使用相同密钥校验
+func SignPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyBackoff 第attempt次重试前的等待时间
+func notifyBackoff(attempt int) time.Duration {
+	backoff := notifyBaseBackoff << uint(attempt-1)
+	if backoff <= 0 || backoff > notifyMaxBackoff {
+		backoff = notifyMaxBackoff
+	}
+	return backoff
+}
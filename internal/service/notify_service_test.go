@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+// newTestNotifyService 创建只有一个worker的回调服务，测试服务器在本机，需要允许内网地址
+func newTestNotifyService(t *testing.T, maxRetries int) *NotifyService {
+	t.Helper()
+
+	return startNotifyService(t, config.NotificationConfig{
+		Workers:             1,
+		MaxRetries:          maxRetries,
+		AllowPrivateNetwork: true,
+	})
+}
+
+func startNotifyService(t *testing.T, cfg config.NotificationConfig) *NotifyService {
+	t.Helper()
+
+	repos := newTestRepositories(t)
+	n := NewNotifyService(repos.WebhookDeliveries, cfg, testLogger())
+	n.Start()
+	t.Cleanup(n.Stop)
+	return n
+}
+
+// notifyTask 向hook投递一个任务回调，返回任务ID
+func notifyTask(n *NotifyService, hook string) string {
+	task := &entity.Task{
+		ID:         uuid.New().String(),
+		Status:     entity.TaskStatusSuccess,
+		NotifyHook: hook,
+	}
+	n.Notify(task)
+	return task.ID
+}
+
+// waitDelivery 等待任务的投递记录达到指定状态
+func waitDelivery(t *testing.T, n *NotifyService, taskID string, status entity.WebhookDeliveryStatus, timeout time.Duration) *entity.WebhookDelivery {
+	t.Helper()
+
+	var last *entity.WebhookDelivery
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		deliveries, _, err := n.ListDeliveries(taskID, "", 1, 10)
+		if err != nil {
+			t.Fatalf("ListDeliveries: %v", err)
+		}
+		if len(deliveries) == 1 {
+			last = &deliveries[0]
+			if last.Status == status {
+				return last
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("delivery of task %s did not reach %s, last: %+v", taskID, status, last)
+	return nil
+}
+
+func TestNotifyRetryDoesNotBlockWorker(t *testing.T) {
+	var flakyCalls int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flakyCalls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer flaky.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	n := newTestNotifyService(t, 3)
+
+	flakyTask := notifyTask(n, flaky.URL)
+	waiting := waitDelivery(t, n, flakyTask, entity.WebhookDeliveryPending, time.Second)
+	started := time.Now()
+
+	// 唯一的worker没有被退避等待占用，后面的投递立即完成
+	healthyTask := notifyTask(n, healthy.URL)
+	waitDelivery(t, n, healthyTask, entity.WebhookDeliverySuccess, notifyBaseBackoff/2)
+	if elapsed := time.Since(started); elapsed >= notifyBaseBackoff {
+		t.Fatalf("second delivery took %v, worker was blocked by the retry backoff", elapsed)
+	}
+	if waiting.Attempts > 1 {
+		t.Fatalf("attempts before backoff = %d, want at most 1", waiting.Attempts)
+	}
+
+	delivered := waitDelivery(t, n, flakyTask, entity.WebhookDeliverySuccess, 3*notifyBaseBackoff)
+	if delivered.Attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", delivered.Attempts)
+	}
+}
+
+func TestNotifyRejectedIsNotRetried(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	n := newTestNotifyService(t, 3)
+	taskID := notifyTask(n, server.URL)
+
+	delivery := waitDelivery(t, n, taskID, entity.WebhookDeliveryFailure, time.Second)
+	if delivery.Attempts != 1 || delivery.StatusCode != http.StatusBadRequest {
+		t.Fatalf("delivery = %d attempts, status %d; want 1 attempt, 400", delivery.Attempts, delivery.StatusCode)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("calls = %d, want 1", got)
+	}
+}
+
+func TestNotifyStopCancelsPendingRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	n := newTestNotifyService(t, 3)
+	taskID := notifyTask(n, server.URL)
+	waitDelivery(t, n, taskID, entity.WebhookDeliveryPending, time.Second)
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	n.Stop()
+	delivery := waitDelivery(t, n, taskID, entity.WebhookDeliveryFailure, time.Second)
+	if delivery.Error == "" {
+		t.Fatal("stopped delivery has no error")
+	}
+
+	time.Sleep(notifyBaseBackoff + 200*time.Millisecond)
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("calls after stop = %d, want 1", got)
+	}
+}
+
+func TestNotifyRejectsPrivateAddress(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := startNotifyService(t, config.NotificationConfig{Workers: 1, MaxRetries: 3})
+
+	// 直接回调本机地址，在拨号时被拒绝且不重试
+	taskID := notifyTask(n, server.URL)
+	delivery := waitDelivery(t, n, taskID, entity.WebhookDeliveryFailure, time.Second)
+	if delivery.Attempts != 1 {
+		t.Fatalf("attempts = %d, want 1", delivery.Attempts)
+	}
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Fatalf("private hook received %d requests", got)
+	}
+
+	// 主机名为localhost时在发送前拒绝
+	taskID = notifyTask(n, "http://localhost:1/hook")
+	waitDelivery(t, n, taskID, entity.WebhookDeliveryFailure, time.Second)
+}
+
+// waitDeliveryStatus 等待任务出现指定状态的投递记录
+func waitDeliveryStatus(t *testing.T, n *NotifyService, taskID string, status entity.WebhookDeliveryStatus, timeout time.Duration) *entity.WebhookDelivery {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		deliveries, _, err := n.ListDeliveries(taskID, status, 1, 10)
+		if err != nil {
+			t.Fatalf("ListDeliveries: %v", err)
+		}
+		if len(deliveries) > 0 {
+			return &deliveries[0]
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("task %s has no %s delivery", taskID, status)
+	return nil
+}
+
+func TestNotifyDropsStaleProgress(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var task entity.Task
+		json.NewDecoder(r.Body).Decode(&task)
+
+		mu.Lock()
+		received = append(received, string(task.Status)+" "+task.Progress)
+		first := len(received) == 1
+		mu.Unlock()
+
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := startNotifyService(t, config.NotificationConfig{Workers: 4, MaxRetries: 3, AllowPrivateNetwork: true})
+	task := &entity.Task{
+		ID:         uuid.New().String(),
+		Status:     entity.TaskStatusInProgress,
+		Progress:   "50%",
+		NotifyHook: server.URL,
+	}
+	n.Notify(task)
+	for {
+		mu.Lock()
+		count := len(received)
+		mu.Unlock()
+		if count > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 进度回调等待重试期间任务完成，重试时不再投递过期的进度
+	task.Status = entity.TaskStatusSuccess
+	task.Progress = "100%"
+	n.Notify(task)
+
+	waitDeliveryStatus(t, n, task.ID, entity.WebhookDeliverySuccess, notifyBaseBackoff/2)
+	stale := waitDeliveryStatus(t, n, task.ID, entity.WebhookDeliveryFailure, 3*notifyBaseBackoff)
+	if stale.TaskStatus != entity.TaskStatusInProgress || stale.Error != errDeliverySuperseded.Error() {
+		t.Fatalf("stale delivery = %s %q", stale.TaskStatus, stale.Error)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 || received[1] != "SUCCESS 100%" {
+		t.Fatalf("received = %q, want progress then success only", received)
+	}
+}
+
+func TestCleanupDeliveries(t *testing.T) {
+	repos := newTestRepositories(t)
+	n := NewNotifyService(repos.WebhookDeliveries, config.NotificationConfig{}, testLogger())
+	ctx := context.Background()
+
+	old := time.Now().Add(-48 * time.Hour)
+	deliveries := []*entity.WebhookDelivery{
+		{ID: "old-success", Status: entity.WebhookDeliverySuccess, CreatedAt: old},
+		{ID: "old-failure", Status: entity.WebhookDeliveryFailure, CreatedAt: old},
+		{ID: "old-pending", Status: entity.WebhookDeliveryPending, CreatedAt: old},
+		{ID: "recent", Status: entity.WebhookDeliverySuccess},
+	}
+	for _, delivery := range deliveries {
+		delivery.TaskID = "task-1"
+		if err := repos.WebhookDeliveries.Create(ctx, delivery); err != nil {
+			t.Fatalf("create delivery: %v", err)
+		}
+	}
+
+	count, err := n.CleanupDeliveries(ctx, 24*time.Hour)
+	if err != nil || count != 2 {
+		t.Fatalf("CleanupDeliveries = %d, %v; want 2", count, err)
+	}
+	for _, id := range []string{"old-pending", "recent"} {
+		if _, err := n.GetDelivery(id); err != nil {
+			t.Fatalf("delivery %s was deleted: %v", id, err)
+		}
+	}
+	if _, err := n.GetDelivery("old-success"); err != ErrDeliveryNotFound {
+		t.Fatalf("old delivery = %v, want ErrDeliveryNotFound", err)
+	}
+}
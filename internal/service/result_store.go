@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/storage"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// maxResultSize 转存结果的最大字节数
+const maxResultSize = 100 << 20
+
+// unsafeKeyChars 对象键中不允许的字符
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// ResultStore 任务结果转存，将Discord CDN上的结果下载到配置的存储，避免链接过期
+type ResultStore struct {
+	storage     storage.Storage
+	thumbnailer *Thumbnailer
+	splitGrid   bool
+	client      *http.Client
+	logger      logger.Logger
+}
+
+// NewResultStore 创建任务结果转存服务，storage为nil时不转存，thumbnailer为nil时不生成缩略图
+// splitGrid为网格结果是否默认切分，可由任务的splitGrid属性覆盖
+func NewResultStore(storage storage.Storage, thumbnailer *Thumbnailer, splitGrid bool, client *http.Client, logger logger.Logger) *ResultStore {
+	return &ResultStore{
+		storage:     storage,
+		thumbnailer: thumbnailer,
+		splitGrid:   splitGrid,
+		client:      client,
+		logger:      logger,
+	}
+}
+
+// Enabled 是否启用转存
+func (r *ResultStore) Enabled() bool {
+	return r != nil && r.storage != nil
+}
+
+// ThumbnailsEnabled 是否启用缩略图
+func (r *ResultStore) ThumbnailsEnabled() bool {
+	return r.Enabled() && r.thumbnailer != nil
+}
+
+// Storage 获取底层存储
+func (r *ResultStore) Storage() storage.Storage {
+	return r.storage
+}
+
+// Store 下载任务结果并保存，ImageURL改写为存储地址，原始地址保留在URL，并生成缩略图
+func (r *ResultStore) Store(ctx context.Context, task *entity.Task) error {
+	_, err := r.store(ctx, task)
+	return err
+}
+
+// store 下载并保存任务结果，返回下载的内容，未下载时返回nil
+func (r *ResultStore) store(ctx context.Context, task *entity.Task) ([]byte, error) {
+	if !r.Enabled() {
+		return nil, nil
+	}
+
+	source := task.URL
+	if source == "" {
+		source = task.ImageURL
+	}
+	if source == "" {
+		return nil, nil
+	}
+
+	// 已转存的结果不重复下载
+	if key, exists := task.GetProperty("storageKey"); exists && key != "" && task.ImageURL != source {
+		return nil, nil
+	}
+
+	data, contentType, err := r.download(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ResultKey(task, source, contentType)
+	if contentType == "" {
+		contentType = storage.ContentTypeByKey(key)
+	}
+
+	result, err := r.storage.Save(ctx, key, bytes.NewReader(data), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save result: %w", err)
+	}
+
+	task.URL = source
+	task.ImageURL = result.URL
+	task.ContentType = result.ContentType
+	size := result.Size
+	task.Size = &size
+	task.SetProperty("storageKey", result.Key)
+
+	r.logger.Infof("Task %s result stored as %s", task.ID, result.Key)
+
+	// 视频的缩略图由截图生成
+	if strings.HasPrefix(result.ContentType, "video/") {
+		return data, nil
+	}
+
+	if err := r.describe(ctx, task, data); err != nil {
+		r.logger.Warnf("Failed to generate thumbnails for task %s: %v", task.ID, err)
+	}
+
+	return data, nil
+}
+
+// Thumbnail 为已有任务生成缩略图，原图优先从存储读取，否则从ImageURL下载
+func (r *ResultStore) Thumbnail(ctx context.Context, task *entity.Task) error {
+	if !r.ThumbnailsEnabled() {
+		return nil
+	}
+
+	var data []byte
+	if key, _ := task.GetProperty("storageKey"); key != nil && key != "" {
+		reader, err := r.storage.Get(ctx, fmt.Sprint(key))
+		if err == nil {
+			data, err = io.ReadAll(io.LimitReader(reader, maxResultSize))
+			reader.Close()
+		}
+		if err != nil {
+			r.logger.Warnf("Failed to read stored result of task %s, downloading instead: %v", task.ID, err)
+			data = nil
+		}
+	}
+
+	if data == nil {
+		downloaded, contentType, err := r.download(ctx, task.ImageURL)
+		if err != nil {
+			return err
+		}
+		data = downloaded
+
+		if task.ContentType == "" {
+			task.ContentType = contentType
+		}
+		if task.Size == nil {
+			size := int64(len(data))
+			task.Size = &size
+		}
+	}
+
+	return r.describe(ctx, task, data)
+}
+
+// describe 记录原图尺寸，生成缩略图并按需切分网格
+func (r *ResultStore) describe(ctx context.Context, task *entity.Task, data []byte) error {
+	width, height, err := DecodeImageConfig(data)
+	if err != nil {
+		return err
+	}
+	task.Width = &width
+	task.Height = &height
+
+	split := r.shouldSplit(task)
+	if r.thumbnailer == nil && !split {
+		return nil
+	}
+
+	img, err := DecodeImage(data)
+	if err != nil {
+		return err
+	}
+
+	if r.thumbnailer != nil {
+		thumbnail, urls, err := r.storeThumbnails(ctx, "tasks/"+task.ID+"/thumb", img)
+		if err != nil {
+			return err
+		}
+		task.ThumbnailURL = thumbnail.URL
+		task.SetProperty("thumbnailKey", thumbnail.Key)
+		task.SetProperty("thumbnails", urls)
+	}
+
+	if split {
+		return r.storeGrid(ctx, task, img)
+	}
+
+	return nil
+}
+
+// storeThumbnails 生成并保存缩略图，返回第一个尺寸的上传结果和全部尺寸的地址
+func (r *ResultStore) storeThumbnails(ctx context.Context, prefix string, img image.Image) (*storage.UploadResult, map[string]interface{}, error) {
+	if r.thumbnailer == nil {
+		return &storage.UploadResult{}, nil, nil
+	}
+
+	thumbnails, err := r.thumbnailer.Generate(img)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var first *storage.UploadResult
+	urls := make(map[string]interface{}, len(thumbnails))
+	for _, thumbnail := range thumbnails {
+		key := fmt.Sprintf("%s_%d%s", prefix, thumbnail.Size, thumbnail.Ext)
+		result, err := r.storage.Save(ctx, key, bytes.NewReader(thumbnail.Data), thumbnail.ContentType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to save thumbnail: %w", err)
+		}
+
+		urls[strconv.Itoa(thumbnail.Size)] = result.URL
+		if first == nil {
+			first = result
+		}
+	}
+
+	return first, urls, nil
+}
+
+// storedProperties 记录转存结果的任务属性
+var storedProperties = []string{"storageKey", "thumbnailKey", "snapshotKey", "thumbnails", GridImagesProperty}
+
+// Purge 删除任务转存的结果、截图、缩略图和切分图，ImageURL恢复为原始地址并清除缩略图地址
+func (r *ResultStore) Purge(ctx context.Context, task *entity.Task) error {
+	if !r.Enabled() {
+		return nil
+	}
+
+	keys := make(map[string]bool)
+	for _, property := range []string{"storageKey", "thumbnailKey", "snapshotKey"} {
+		if key, _ := task.GetProperty(property); key != nil && key != "" {
+			keys[fmt.Sprint(key)] = true
+		}
+	}
+
+	// 其他尺寸的缩略图和切分图只记录了地址，从地址中还原对象键
+	urls := []string{task.ImageURL, task.ThumbnailURL}
+	if thumbnails, ok := task.Properties["thumbnails"].(map[string]interface{}); ok {
+		for _, u := range thumbnails {
+			urls = append(urls, fmt.Sprint(u))
+		}
+	}
+	for _, image := range GridImages(task) {
+		urls = append(urls, image.URL, image.ThumbnailURL)
+		for _, u := range image.Thumbnails {
+			urls = append(urls, fmt.Sprint(u))
+		}
+	}
+	prefix := "tasks/" + task.ID + "/"
+	for _, u := range urls {
+		if i := strings.Index(u, prefix); i >= 0 {
+			key, _, _ := strings.Cut(u[i:], "?")
+			keys[key] = true
+		}
+	}
+
+	for key := range keys {
+		if err := r.storage.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+	}
+
+	if task.URL != "" {
+		task.ImageURL = task.URL
+	}
+	task.ThumbnailURL = ""
+	for _, property := range storedProperties {
+		delete(task.Properties, property)
+	}
+
+	r.logger.Infof("Stored results of task %s purged (%d objects)", task.ID, len(keys))
+	return nil
+}
+
+// download 下载远程文件
+func (r *ResultStore) download(ctx context.Context, source string) ([]byte, string, error) {
+	if source == "" {
+		return nil, "", fmt.Errorf("empty source url")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download result: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("download result returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxResultSize {
+		return nil, "", fmt.Errorf("result too large: %d bytes", resp.ContentLength)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResultSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read result: %w", err)
+	}
+	if len(data) > maxResultSize {
+		return nil, "", fmt.Errorf("result too large: more than %d bytes", maxResultSize)
+	}
+
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// ResultKey 任务结果的对象键，由任务ID和原始文件名确定，重复转存会覆盖同一对象
+func ResultKey(task *entity.Task, source, contentType string) string {
+	name := "result"
+	if parsed, err := url.Parse(source); err == nil {
+		if base := path.Base(parsed.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+	name = unsafeKeyChars.ReplaceAllString(name, "_")
+
+	if path.Ext(name) == "" {
+		name += extensionByContentType(contentType)
+	}
+
+	return "tasks/" + task.ID + "/" + name
+}
+
+// extensionByContentType 根据内容类型获取扩展名，未知类型默认为.png
+func extensionByContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "video/mp4":
+		return ".mp4"
+	default:
+		return ".png"
+	}
+}
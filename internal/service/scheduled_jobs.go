@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+)
+
+// 只在领导者节点上执行的定时任务
+const (
+	JobTaskTimeout    = "task-timeout"    // 任务超时检查
+	JobDailyReset     = "daily-reset"     // 每日绘图次数重置
+	JobStorageCleanup = "storage-cleanup" // 过期转存结果清理
+	JobTokenCleanup   = "token-cleanup"   // 过期的刷新令牌和吊销记录清理
+	JobAccountSync    = "account-sync"    // Discord账号信息同步
+	JobWebhookCleanup = "webhook-cleanup" // 过期回调投递记录清理
+)
+
+// TaskTimeoutInterval 任务超时检查间隔
+const TaskTimeoutInterval = 30 * time.Second
+
+// AccountSyncInterval 账号信息同步间隔
+const AccountSyncInterval = time.Hour
+
+// storageCleanupBatchSize 存储清理每批查询的任务数
+const storageCleanupBatchSize = 100
+
+// ResetDailyCounts 将用户和账号的日绘图次数清零
+func (s *TaskService) ResetDailyCounts(ctx context.Context) error {
+	if err := s.repos.Users.ResetDayDrawCount(ctx); err != nil {
+		return fmt.Errorf("failed to reset user draw counts: %w", err)
+	}
+	if err := s.repos.Accounts.ResetDayDrawCount(ctx); err != nil {
+		return fmt.Errorf("failed to reset account draw counts: %w", err)
+	}
+
+	s.logger.Info("Daily draw counts reset")
+	return nil
+}
+
+// CleanupStoredResults 删除结束超过retention的任务转存在存储中的文件，返回清理的任务数。
+// 任务记录保留，图片地址恢复为原始地址
+func (s *TaskService) CleanupStoredResults(ctx context.Context, retention time.Duration) (int, error) {
+	if !s.results.Enabled() || retention <= 0 {
+		return 0, nil
+	}
+
+	cutoff := time.Now().Add(-retention)
+	count := 0
+	lastID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		tasks, err := s.repos.Tasks.Find(ctx, repository.TaskQuery{
+			Statuses:   []entity.TaskStatus{entity.TaskStatusSuccess},
+			FinishedTo: &cutoff,
+			Stored:     true,
+			AfterID:    lastID,
+			Sort:       repository.SortIDAsc,
+			Limit:      storageCleanupBatchSize,
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to query tasks: %w", err)
+		}
+		if len(tasks) == 0 {
+			break
+		}
+
+		for i := range tasks {
+			task := &tasks[i]
+			lastID = task.ID
+
+			if err := s.results.Purge(ctx, task); err != nil {
+				s.logger.Warnf("Failed to purge stored results of task %s: %v", task.ID, err)
+				continue
+			}
+			if err := s.repos.Tasks.UpdateColumns(ctx, task, "image_url", "thumbnail_url", "properties"); err != nil {
+				return count, fmt.Errorf("failed to save task %s: %w", task.ID, err)
+			}
+			count++
+		}
+	}
+
+	if count > 0 {
+		s.logger.Infof("Stored results of %d tasks finished before %s cleaned up", count, cutoff.Format(time.RFC3339))
+	}
+	return count, nil
+}
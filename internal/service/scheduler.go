@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// schedulerTick 调度器检查到期任务的间隔
+const schedulerTick = time.Second
+
+// Schedule 定时任务的执行计划
+type Schedule interface {
+	// Next 在after之后的下一次执行时间
+	Next(after time.Time) time.Time
+	String() string
+}
+
+// everySchedule 固定间隔执行
+type everySchedule struct {
+	interval time.Duration
+}
+
+// Every 每隔interval执行一次
+func Every(interval time.Duration) Schedule {
+	return everySchedule{interval: interval}
+}
+
+func (s everySchedule) Next(after time.Time) time.Time {
+	return after.Add(s.interval)
+}
+
+func (s everySchedule) String() string {
+	return "every " + s.interval.String()
+}
+
+// dailySchedule 每天固定时间执行
+type dailySchedule struct {
+	hour   int
+	minute int
+}
+
+// Daily 每天的hour:minute（本地时间）执行一次
+func Daily(hour, minute int) Schedule {
+	return dailySchedule{hour: hour, minute: minute}
+}
+
+func (s dailySchedule) Next(after time.Time) time.Time {
+	next := time.Date(after.Year(), after.Month(), after.Day(), s.hour, s.minute, 0, 0, after.Location())
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (s dailySchedule) String() string {
+	return fmt.Sprintf("daily %02d:%02d", s.hour, s.minute)
+}
+
+// scheduledJob 已注册的定时任务
+type scheduledJob struct {
+	name     string
+	schedule Schedule
+	run      func(ctx context.Context) error
+	next     time.Time
+	running  bool
+}
+
+// JobStatus 定时任务状态
+type JobStatus struct {
+	Name     string         `json:"name"`
+	Schedule string         `json:"schedule"`
+	Running  bool           `json:"running"`            // 是否正在当前节点上执行
+	NextRun  *time.Time     `json:"next_run,omitempty"` // 仅领导者节点有计划时间
+	LastRun  *entity.JobRun `json:"last_run,omitempty"` // 任意节点最近一次执行
+}
+
+// SchedulerStatus 调度器状态
+type SchedulerStatus struct {
+	Leader   string      `json:"leader"`
+	NodeID   string      `json:"node_id"`
+	IsLeader bool        `json:"is_leader"`
+	Backend  string      `json:"backend"`
+	Jobs     []JobStatus `json:"jobs"`
+}
+
+// Scheduler 单例定时任务调度器，只有选举出的领导者执行任务。
+// 执行记录保存在数据库，新的领导者按上一次执行时间继续计划，交接期间错过的任务会补执行一次。
+// 任务的ctx在本节点失去领导者身份时取消，避免与新的领导者同时执行
+type Scheduler struct {
+	elector *LeaderElector
+	runs    repository.JobRunRepository
+	logger  logger.Logger
+
+	mu      sync.Mutex
+	jobs    []*scheduledJob
+	leading bool
+	// term 本次担任领导者期间的上下文，失去领导者身份时取消
+	term    context.Context
+	endTerm context.CancelFunc
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewScheduler 创建调度器
+func NewScheduler(elector *LeaderElector, runs repository.JobRunRepository, logger logger.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		elector: elector,
+		runs:    runs,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Register 注册定时任务，需在Start之前调用
+func (s *Scheduler) Register(name string, schedule Schedule, run func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = append(s.jobs, &scheduledJob{
+		name:     name,
+		schedule: schedule,
+		run:      run,
+	})
+}
+
+// Elector 调度器使用的选举器
+func (s *Scheduler) Elector() *LeaderElector {
+	return s.elector
+}
+
+// Start 启动调度器
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case now := <-ticker.C:
+				s.tick(now)
+			}
+		}
+	}()
+}
+
+// Stop 停止调度并等待正在执行的任务结束，任务通过ctx收到取消通知
+func (s *Scheduler) Stop() {
+	close(s.stopCh)
+	s.cancel()
+	s.wg.Wait()
+}
+
+// tick 领导者执行到期的任务，刚成为领导者时按执行记录重新计划，失去领导者身份时取消正在执行的任务
+func (s *Scheduler) tick(now time.Time) {
+	leader := s.elector.IsLeader()
+
+	s.mu.Lock()
+	becameLeader := leader && !s.leading
+	s.leading = leader
+	if becameLeader {
+		s.term, s.endTerm = context.WithCancel(s.ctx)
+	}
+	if !leader && s.endTerm != nil {
+		s.endTerm()
+		s.endTerm = nil
+		for _, job := range s.jobs {
+			if job.running {
+				s.logger.Warnf("Lost leadership, cancelling scheduled job %s", job.name)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if !leader {
+		return
+	}
+	if becameLeader {
+		s.plan(now)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.running || now.Before(job.next) {
+			continue
+		}
+
+		job.running = true
+		job.next = job.schedule.Next(now)
+
+		s.wg.Add(1)
+		go func(ctx context.Context, job *scheduledJob) {
+			defer s.wg.Done()
+			s.execute(ctx, job)
+		}(s.term, job)
+	}
+}
+
+// plan 按最近一次执行时间计算下一次执行时间，从未执行过的任务从现在开始计划
+func (s *Scheduler) plan(now time.Time) {
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	defer cancel()
+
+	lastRuns := make(map[string]time.Time)
+	runs, err := s.runs.Find(ctx)
+	if err != nil {
+		s.logger.Warnf("Failed to load job runs, scheduling from now: %v", err)
+	}
+	for _, run := range runs {
+		lastRuns[run.ID] = run.StartedAt
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if last, exists := lastRuns[job.name]; exists {
+			job.next = job.schedule.Next(last)
+		} else {
+			job.next = job.schedule.Next(now)
+		}
+	}
+}
+
+// execute 执行任务并保存执行记录，ctx在失去领导者身份或调度器停止时取消
+func (s *Scheduler) execute(ctx context.Context, job *scheduledJob) {
+	defer func() {
+		s.mu.Lock()
+		job.running = false
+		s.mu.Unlock()
+	}()
+
+	run := &entity.JobRun{
+		ID:        job.name,
+		Node:      s.elector.NodeID(),
+		StartedAt: time.Now(),
+	}
+	s.saveRun(run)
+
+	err := job.run(ctx)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.DurationMs = finishedAt.Sub(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Error = err.Error()
+		s.logger.Errorf("Scheduled job %s failed: %v", job.name, err)
+	}
+	s.saveRun(run)
+}
+
+// saveRun 保存执行记录，失败时只记录日志
+func (s *Scheduler) saveRun(run *entity.JobRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.runs.Save(ctx, run); err != nil {
+		s.logger.Warnf("Failed to save run of job %s: %v", run.ID, err)
+	}
+}
+
+// Status 当前领导者和各任务最近一次执行情况
+func (s *Scheduler) Status(ctx context.Context) (*SchedulerStatus, error) {
+	leader, err := s.elector.Leader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leader: %w", err)
+	}
+	runs, err := s.runs.Find(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job runs: %w", err)
+	}
+
+	lastRuns := make(map[string]*entity.JobRun, len(runs))
+	for i := range runs {
+		lastRuns[runs[i].ID] = &runs[i]
+	}
+
+	status := &SchedulerStatus{
+		Leader:   leader,
+		NodeID:   s.elector.NodeID(),
+		IsLeader: s.elector.IsLeader(),
+		Backend:  s.elector.Backend(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		jobStatus := JobStatus{
+			Name:     job.name,
+			Schedule: job.schedule.String(),
+			Running:  job.running,
+			LastRun:  lastRuns[job.name],
+		}
+		if s.leading && !job.next.IsZero() {
+			next := job.next
+			jobStatus.NextRun = &next
+		}
+		status.Jobs = append(status.Jobs, jobStatus)
+	}
+
+	return status, nil
+}
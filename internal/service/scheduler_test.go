@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// stubLeaderBackend 总是获取成功的选举后端
+type stubLeaderBackend struct{}
+
+func (stubLeaderBackend) acquire(context.Context) (bool, error) { return true, nil }
+func (stubLeaderBackend) release(context.Context) error         { return nil }
+func (stubLeaderBackend) holder(context.Context) (string, error) {
+	return "node-1", nil
+}
+
+// setLeader 直接设置选举器的领导者状态
+func setLeader(e *LeaderElector, leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leader
+	e.renewedAt = time.Now()
+}
+
+func TestSchedulerCancelsJobsOnLostLeadership(t *testing.T) {
+	repos := newTestRepositories(t)
+	elector := &LeaderElector{
+		backend: stubLeaderBackend{},
+		nodeID:  "node-1",
+		ttl:     time.Minute,
+		logger:  testLogger(),
+		stopCh:  make(chan struct{}),
+	}
+	scheduler := NewScheduler(elector, repos.JobRuns, testLogger())
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	scheduler.Register("blocking", Every(time.Hour), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	t.Cleanup(scheduler.Stop)
+
+	setLeader(elector, true)
+	now := time.Now()
+	scheduler.tick(now)
+	scheduler.tick(now.Add(time.Hour))
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not start")
+	}
+
+	// 仍是领导者时任务继续执行
+	scheduler.tick(now.Add(time.Hour + time.Second))
+	select {
+	case <-cancelled:
+		t.Fatal("job cancelled while still leader")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	setLeader(elector, false)
+	scheduler.tick(now.Add(time.Hour + 2*time.Second))
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not cancelled after losing leadership")
+	}
+}
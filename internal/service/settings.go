@@ -0,0 +1,573 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/internal/infrastructure/fetcher"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// 可在运行时修改的设置项，键名与配置文件中的路径一致
+const (
+	SettingAccountSelectMode          = "discord.account_select_mode"
+	SettingTranslateWay               = "translate.way"
+	SettingNotifyHook                 = "notification.webhook"
+	SettingRateLimitRules             = "rate_limiting.rules"
+	SettingEnableGuest                = "app.enable_guest"
+	SettingEnableRegister             = "app.enable_register"
+	SettingBannedWordsEnabled         = "banned_words.enabled"
+	SettingBannedWordsCheckTranslated = "banned_words.check_translated"
+)
+
+// 设置值的类型，与 entity.Setting 的Type一致
+const (
+	settingTypeString  = "string"
+	settingTypeBoolean = "boolean"
+	settingTypeJSON    = "json"
+)
+
+// settingsChannel 设置变更的广播频道，收到后各副本重新加载设置
+const settingsChannel = "settings:changed"
+
+// settingsRefreshInterval 定期重新加载设置的间隔，未启用Redis的多个副本依靠它同步
+const settingsRefreshInterval = time.Minute
+
+// RuntimeSettings 运行时生效的设置：配置文件中的值叠加数据库中的覆盖值。
+// 实例创建后不再修改，设置变更时整体替换
+type RuntimeSettings struct {
+	AccountSelectMode          string
+	TranslateWay               string
+	NotifyHook                 string
+	RateLimitRules             map[string]map[string]int
+	EnableGuest                bool
+	EnableRegister             bool
+	BannedWordsEnabled         bool
+	BannedWordsCheckTranslated bool
+}
+
+// SettingError 设置项不存在或值校验失败
+type SettingError struct {
+	Key     string
+	Message string
+}
+
+func (e *SettingError) Error() string {
+	return fmt.Sprintf("设置项 %s 无效: %s", e.Key, e.Message)
+}
+
+// SettingView 设置项及当前生效的值
+type SettingView struct {
+	Key         string      `json:"key"`
+	Type        string      `json:"type"`
+	Group       string      `json:"group"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	Value       interface{} `json:"value"`
+	Default     interface{} `json:"default"`    // 配置文件中的值
+	Overridden  bool        `json:"overridden"` // 是否被数据库中的值覆盖
+	UpdatedAt   *time.Time  `json:"updated_at,omitempty"`
+}
+
+// settingDefinition 设置项定义
+type settingDefinition struct {
+	key         string
+	typ         string
+	group       string
+	title       string
+	description string
+	// get 读取设置的值
+	get func(s *RuntimeSettings) interface{}
+	// set 解码JSON值并校验，通过后写入设置
+	set func(s *RuntimeSettings, raw json.RawMessage) error
+}
+
+// defineSetting 定义类型为T的设置项，field返回设置在 RuntimeSettings 中的字段，validate可以规范化值
+func defineSetting[T any](key, typ, group, title, description string, field func(s *RuntimeSettings) *T, validate func(value *T) error) settingDefinition {
+	return settingDefinition{
+		key:         key,
+		typ:         typ,
+		group:       group,
+		title:       title,
+		description: description,
+		get: func(s *RuntimeSettings) interface{} {
+			return *field(s)
+		},
+		set: func(s *RuntimeSettings, raw json.RawMessage) error {
+			var value T
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return fmt.Errorf("值的类型应为%s", typ)
+			}
+			if validate != nil {
+				if err := validate(&value); err != nil {
+					return err
+				}
+			}
+			*field(s) = value
+			return nil
+		},
+	}
+}
+
+// settingDefinitions 可在运行时修改的设置项，翻译方式的校验需要配置文件中的翻译服务凭据
+func settingDefinitions(cfg *config.Config) []settingDefinition {
+	return []settingDefinition{
+		defineSetting(SettingAccountSelectMode, settingTypeString, "discord", "账号选择模式",
+			"BestWaitIdle、Random、Weight、Polling",
+			func(s *RuntimeSettings) *string { return &s.AccountSelectMode },
+			validateAccountSelectMode),
+		defineSetting(SettingTranslateWay, settingTypeString, "translate", "翻译方式",
+			"NULL（不翻译）、BAIDU、GPT，翻译服务的凭据在配置文件中设置",
+			func(s *RuntimeSettings) *string { return &s.TranslateWay },
+			func(value *string) error { return validateTranslateWay(cfg.Translate, value) }),
+		defineSetting(SettingNotifyHook, settingTypeString, "notification", "默认回调地址",
+			"任务未指定notifyHook时使用，为空时不回调",
+			func(s *RuntimeSettings) *string { return &s.NotifyHook },
+			func(value *string) error { return validateNotifyHook(cfg.Notification.AllowPrivateNetwork, value) }),
+		defineSetting(SettingRateLimitRules, settingTypeJSON, "rate_limiting", "限流规则",
+			`键为"方法 路径"，*匹配任意字符；值为 窗口秒数: 次数上限`,
+			func(s *RuntimeSettings) *map[string]map[string]int { return &s.RateLimitRules },
+			validateRateLimitRules),
+		defineSetting(SettingEnableGuest, settingTypeBoolean, "app", "游客模式",
+			"开启后提交和查询任务不需要登录",
+			func(s *RuntimeSettings) *bool { return &s.EnableGuest },
+			nil),
+		defineSetting(SettingEnableRegister, settingTypeBoolean, "app", "开放注册",
+			"",
+			func(s *RuntimeSettings) *bool { return &s.EnableRegister },
+			nil),
+		defineSetting(SettingBannedWordsEnabled, settingTypeBoolean, "banned_words", "禁用词检查",
+			"提交任务时检查提示词是否包含禁用词",
+			func(s *RuntimeSettings) *bool { return &s.BannedWordsEnabled },
+			nil),
+		defineSetting(SettingBannedWordsCheckTranslated, settingTypeBoolean, "banned_words", "检查翻译后的提示词",
+			"提示词被翻译时同时检查译文",
+			func(s *RuntimeSettings) *bool { return &s.BannedWordsCheckTranslated },
+			nil),
+	}
+}
+
+// validateAccountSelectMode 校验账号选择模式，不区分大小写
+func validateAccountSelectMode(value *string) error {
+	modes := []discord.AccountSelectMode{
+		discord.AccountSelectBestWaitIdle,
+		discord.AccountSelectRandom,
+		discord.AccountSelectWeight,
+		discord.AccountSelectPolling,
+	}
+	for _, mode := range modes {
+		if strings.EqualFold(*value, string(mode)) {
+			*value = string(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的账号选择模式 %q", *value)
+}
+
+// validateTranslateWay 校验翻译方式，选择的翻译服务需要已配置凭据
+func validateTranslateWay(cfg config.TranslateConfig, value *string) error {
+	*value = strings.ToUpper(strings.TrimSpace(*value))
+	switch *value {
+	case "", "NULL":
+		*value = "NULL"
+	case "BAIDU":
+		if cfg.Baidu.AppID == "" || cfg.Baidu.AppSecret == "" {
+			return fmt.Errorf("未配置百度翻译的app_id和app_secret")
+		}
+	case "GPT":
+		if cfg.OpenAI.APIKey == "" {
+			return fmt.Errorf("未配置OpenAI的api_key")
+		}
+	default:
+		return fmt.Errorf("不支持的翻译方式 %q", *value)
+	}
+	return nil
+}
+
+// validateNotifyHook 校验回调地址，为空或http(s)地址；不允许回调内网时解析主机并拒绝内网地址，
+// 解析失败时不拒绝，投递时的拨号检查仍会兜底
+func validateNotifyHook(allowPrivate bool, value *string) error {
+	*value = strings.TrimSpace(*value)
+	if *value == "" {
+		return nil
+	}
+
+	u, err := url.Parse(*value)
+	if err != nil {
+		return fmt.Errorf("回调地址应为http或https地址")
+	}
+	if err := fetcher.CheckURL(u, allowPrivate); err != nil {
+		if errors.Is(err, fetcher.ErrPrivateAddress) {
+			return fmt.Errorf("回调地址不能指向内网地址")
+		}
+		return fmt.Errorf("回调地址应为http或https地址")
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := fetcher.CheckHost(ctx, u.Hostname()); errors.Is(err, fetcher.ErrPrivateAddress) {
+		return fmt.Errorf("回调地址 %s 解析到内网地址", u.Hostname())
+	}
+	return nil
+}
+
+// validateRateLimitRules 校验限流规则：窗口为正整数秒，次数上限不小于0
+func validateRateLimitRules(value *map[string]map[string]int) error {
+	if *value == nil {
+		*value = map[string]map[string]int{}
+	}
+	for pattern, windows := range *value {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("规则不能为空")
+		}
+		if len(windows) == 0 {
+			return fmt.Errorf("规则 %q 没有窗口", pattern)
+		}
+		for window, limit := range windows {
+			if seconds, err := strconv.Atoi(window); err != nil || seconds <= 0 {
+				return fmt.Errorf("规则 %q 的窗口 %q 应为正整数秒", pattern, window)
+			}
+			if limit < 0 {
+				return fmt.Errorf("规则 %q 的次数上限不能为负数", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// SettingsService 运行时设置：在配置文件之上叠加数据库中的覆盖值，修改经过类型校验后立即应用到运行中的组件，
+// 每次修改记录变更历史。启用Redis时修改会通知其他副本重新加载
+type SettingsService struct {
+	repo        repository.SettingRepository
+	changes     repository.SettingChangeRepository
+	base        RuntimeSettings
+	definitions []settingDefinition
+	node        *cluster.Node
+	logger      logger.Logger
+
+	current atomic.Pointer[RuntimeSettings]
+
+	mu        sync.Mutex
+	overrides map[string]entity.Setting
+	listeners []func(old, current *RuntimeSettings)
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewSettingsService 创建运行时设置服务，加载数据库中的覆盖值前使用配置文件中的值
+func NewSettingsService(repo repository.SettingRepository, changes repository.SettingChangeRepository, cfg *config.Config, node *cluster.Node, logger logger.Logger) (*SettingsService, error) {
+	s := &SettingsService{
+		repo:        repo,
+		changes:     changes,
+		definitions: settingDefinitions(cfg),
+		node:        node,
+		logger:      logger,
+		overrides:   make(map[string]entity.Setting),
+		stopCh:      make(chan struct{}),
+	}
+
+	s.base = RuntimeSettings{
+		AccountSelectMode:          cfg.Discord.AccountSelectMode,
+		TranslateWay:               cfg.Translate.Way,
+		NotifyHook:                 cfg.Notification.Webhook,
+		RateLimitRules:             cfg.RateLimit.Rules,
+		EnableGuest:                cfg.App.EnableGuest,
+		EnableRegister:             cfg.App.EnableRegister,
+		BannedWordsEnabled:         cfg.BannedWords.Enabled,
+		BannedWordsCheckTranslated: cfg.BannedWords.CheckTranslated,
+	}
+	if s.base.AccountSelectMode == "" || validateAccountSelectMode(&s.base.AccountSelectMode) != nil {
+		s.base.AccountSelectMode = string(discord.AccountSelectBestWaitIdle)
+	}
+	current := s.base
+	s.current.Store(&current)
+
+	if node != nil {
+		if err := node.Subscribe(settingsChannel, func(json.RawMessage) { s.reload() }); err != nil {
+			return nil, fmt.Errorf("failed to subscribe %s: %w", settingsChannel, err)
+		}
+	}
+	return s, nil
+}
+
+// Start 加载数据库中的覆盖值并开始定期刷新
+func (s *SettingsService) Start() {
+	s.reload()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(settingsRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.reload()
+			}
+		}
+	}()
+}
+
+// Stop 停止定期刷新
+func (s *SettingsService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// Current 当前生效的设置，返回的实例不可修改
+func (s *SettingsService) Current() *RuntimeSettings {
+	return s.current.Load()
+}
+
+// OnChange 注册设置变更回调，注册时立即以当前设置调用一次（old为nil），之后每次设置变化时调用
+func (s *SettingsService) OnChange(fn func(old, current *RuntimeSettings)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listeners = append(s.listeners, fn)
+	fn(nil, s.current.Load())
+}
+
+// Reload 从数据库重新加载覆盖值，无效的值会被忽略并使用配置文件中的值
+func (s *SettingsService) Reload(ctx context.Context) error {
+	rows, err := s.repo.Find(ctx, "")
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]entity.Setting, len(rows))
+	for _, row := range rows {
+		stored[row.Key] = row
+	}
+
+	next := s.base
+	overrides := make(map[string]entity.Setting)
+	for _, def := range s.definitions {
+		row, exists := stored[def.key]
+		if !exists {
+			continue
+		}
+		if err := def.set(&next, storedSettingJSON(def, row.Value)); err != nil {
+			s.logger.Warnf("Invalid stored setting %s, using config value: %v", def.key, err)
+			continue
+		}
+		overrides[def.key] = row
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.overrides = overrides
+	old := s.current.Load()
+	if reflect.DeepEqual(*old, next) {
+		return nil
+	}
+	s.current.Store(&next)
+	for _, fn := range s.listeners {
+		fn(old, &next)
+	}
+	return nil
+}
+
+// reload 重新加载设置，失败时保留当前设置
+func (s *SettingsService) reload() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.Reload(ctx); err != nil {
+		s.logger.Errorf("Failed to reload settings: %v", err)
+	}
+}
+
+// List 所有可修改的设置项及当前生效的值
+func (s *SettingsService) List() []SettingView {
+	current := s.Current()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	views := make([]SettingView, 0, len(s.definitions))
+	for _, def := range s.definitions {
+		view := SettingView{
+			Key:         def.key,
+			Type:        def.typ,
+			Group:       def.group,
+			Title:       def.title,
+			Description: def.description,
+			Value:       def.get(current),
+			Default:     def.get(&s.base),
+		}
+		if row, exists := s.overrides[def.key]; exists {
+			updatedAt := row.UpdatedAt
+			view.Overridden = true
+			view.UpdatedAt = &updatedAt
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// Update 修改设置，values的键为设置项，值为JSON，null表示删除覆盖值、恢复为配置文件中的值。
+// 全部校验通过后才会保存，保存后立即生效并记录变更历史
+func (s *SettingsService) Update(ctx context.Context, values map[string]json.RawMessage, operator string) error {
+	definitions := make(map[string]settingDefinition, len(s.definitions))
+	for _, def := range s.definitions {
+		definitions[def.key] = def
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if _, exists := definitions[key]; !exists {
+			return &SettingError{Key: key, Message: "不支持在运行时修改"}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	current := s.Current()
+	next := *current
+	for _, key := range keys {
+		def := definitions[key]
+		raw := values[key]
+		if isJSONNull(raw) {
+			raw, _ = json.Marshal(def.get(&s.base))
+		}
+		if err := def.set(&next, raw); err != nil {
+			return &SettingError{Key: key, Message: err.Error()}
+		}
+	}
+
+	s.mu.Lock()
+	overrides := s.overrides
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		def := definitions[key]
+		reset := isJSONNull(values[key])
+		_, overridden := overrides[key]
+
+		oldValue, _ := json.Marshal(def.get(current))
+		newValue, _ := json.Marshal(def.get(&next))
+		if string(oldValue) == string(newValue) && overridden != reset {
+			continue
+		}
+
+		if reset {
+			if err := s.repo.Delete(ctx, key); err != nil {
+				return fmt.Errorf("failed to delete setting %s: %w", key, err)
+			}
+		} else if err := s.save(ctx, def, encodeSettingValue(def, def.get(&next))); err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", key, err)
+		}
+
+		change := &entity.SettingChange{
+			ID:       uuid.New().String(),
+			Key:      key,
+			OldValue: string(oldValue),
+			NewValue: string(newValue),
+			Reset:    reset,
+			Operator: operator,
+		}
+		if err := s.changes.Create(ctx, change); err != nil {
+			s.logger.Errorf("Failed to record change of setting %s: %v", key, err)
+		}
+		s.logger.Infof("Setting %s changed by %s: %s -> %s", key, operator, oldValue, newValue)
+	}
+
+	if err := s.Reload(ctx); err != nil {
+		return fmt.Errorf("failed to reload settings: %w", err)
+	}
+	if s.node != nil {
+		if err := s.node.Publish(ctx, settingsChannel, struct{}{}); err != nil {
+			s.logger.Warnf("Failed to broadcast settings change: %v", err)
+		}
+	}
+	return nil
+}
+
+// save 保存设置项的覆盖值，不存在时创建
+func (s *SettingsService) save(ctx context.Context, def settingDefinition, value string) error {
+	row, err := s.repo.Get(ctx, def.key)
+	if err == repository.ErrNotFound {
+		return s.repo.Create(ctx, &entity.Setting{
+			ID:          uuid.New().String(),
+			Key:         def.key,
+			Value:       value,
+			Type:        def.typ,
+			Group:       def.group,
+			Title:       def.title,
+			Description: def.description,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	row.Value = value
+	row.Type = def.typ
+	return s.repo.Save(ctx, row)
+}
+
+// History 查询设置变更历史，key为空时返回全部
+func (s *SettingsService) History(ctx context.Context, key string, page, size int) ([]entity.SettingChange, int64, error) {
+	query := repository.SettingChangeQuery{
+		Key:    key,
+		Offset: (page - 1) * size,
+		Limit:  size,
+	}
+	changes, err := s.changes.Find(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.changes.Count(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return changes, total, nil
+}
+
+// encodeSettingValue 设置值在数据库中的形式：字符串直接保存，其他类型保存为JSON
+func encodeSettingValue(def settingDefinition, value interface{}) string {
+	if text, ok := value.(string); ok && def.typ == settingTypeString {
+		return text
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// storedSettingJSON 将数据库中保存的值还原为JSON
+func storedSettingJSON(def settingDefinition, value string) json.RawMessage {
+	if def.typ == settingTypeString {
+		data, _ := json.Marshal(value)
+		return data
+	}
+	return json.RawMessage(value)
+}
+
+// isJSONNull 是否为JSON null
+func isJSONNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || strings.TrimSpace(string(raw)) == "null"
+}
@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// NodeProperty 任务属性：执行任务的集群节点ID
+const NodeProperty = "node"
+
+// taskCancelChannel 跨副本取消任务的广播频道
+const taskCancelChannel = "task:cancel"
+
+// queuePopTimeout 从共享队列取任务的最长等待时间，到期后重新检查本副本持有的账号
+const queuePopTimeout = 2 * time.Second
+
+// accountQueuePrefix 账号共享任务队列名称的前缀
+const accountQueuePrefix = "account:"
+
+// accountQueue 账号的共享任务队列名称
+func accountQueue(accountID string) string {
+	return accountQueuePrefix + accountID
+}
+
+// taskCancelMessage 跨副本取消任务的消息
+type taskCancelMessage struct {
+	TaskID     string `json:"taskId"`
+	InstanceID string `json:"instanceId"`
+	// Abort 只从执行器中移除，不点击Discord的取消按钮，用于超时的任务
+	Abort bool `json:"abort,omitempty"`
+}
+
+// TaskCluster 多副本任务协调：
+// 本副本没有可用账号时，任务分配给其他副本连接的账号并写入该账号在Redis中的共享队列，
+// 持有账号的副本从队列取出任务交给本地执行器；取消请求和任务事件广播到所有副本
+type TaskCluster struct {
+	service *TaskService
+	node    *cluster.Node
+	logger  logger.Logger
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewTaskCluster 创建多副本任务协调，并注册到任务服务
+func NewTaskCluster(service *TaskService, node *cluster.Node, logger logger.Logger) (*TaskCluster, error) {
+	c := &TaskCluster{
+		service: service,
+		node:    node,
+		logger:  logger,
+		stopCh:  make(chan struct{}),
+	}
+
+	if err := service.events.Bridge(node, logger); err != nil {
+		return nil, fmt.Errorf("failed to bridge task events: %w", err)
+	}
+	if err := node.Subscribe(taskCancelChannel, c.handleCancel); err != nil {
+		return nil, fmt.Errorf("failed to subscribe %s: %w", taskCancelChannel, err)
+	}
+
+	service.cluster = c
+	return c, nil
+}
+
+// Start 开始消费本副本持有账号的共享队列
+func (c *TaskCluster) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.consume()
+	}()
+}
+
+// Stop 停止消费共享队列，队列中的任务保留给其他副本
+func (c *TaskCluster) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+}
+
+// consume 从本副本持有且执行器未满的账号队列中取出任务
+func (c *TaskCluster) consume() {
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		default:
+		}
+
+		queues := c.readyQueues()
+		if len(queues) == 0 {
+			select {
+			case <-c.stopCh:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), queuePopTimeout+5*time.Second)
+		queue, taskID, err := c.node.Pop(ctx, queuePopTimeout, queues...)
+		cancel()
+		if err != nil {
+			c.logger.Warnf("Failed to pop shared task queue: %v", err)
+			select {
+			case <-c.stopCh:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if queue == "" {
+			continue
+		}
+
+		c.execute(strings.TrimPrefix(queue, accountQueuePrefix), taskID)
+	}
+}
+
+// readyQueues 本副本已连接且执行器还能接收任务的账号队列
+func (c *TaskCluster) readyQueues() []string {
+	var queues []string
+	for id, instance := range c.service.discordManager.GetAllInstances() {
+		if instance.IsConnected() && instance.Executor().HasCapacity() {
+			queues = append(queues, accountQueue(id))
+		}
+	}
+	return queues
+}
+
+// execute 将共享队列中的任务交给本地执行器
+func (c *TaskCluster) execute(accountID, taskID string) {
+	ctx := context.Background()
+
+	task, err := c.service.repos.Tasks.Get(ctx, taskID)
+	if err != nil {
+		c.logger.Errorf("Failed to load queued task %s: %v", taskID, err)
+		return
+	}
+	// 排队期间已取消、超时或被重新分配的任务不再执行
+	if task.IsFinished() || task.InstanceID != accountID {
+		return
+	}
+
+	instance := c.service.discordManager.GetInstance(accountID)
+	if instance == nil {
+		// 取出后失去了账号锁，放回队列由新的持有者执行
+		if err := c.node.PushFront(ctx, accountQueue(accountID), taskID); err != nil {
+			c.logger.Errorf("Failed to return task %s to shared queue: %v", taskID, err)
+		}
+		return
+	}
+
+	task.SetProperty(NodeProperty, c.node.ID())
+	if err := c.service.repos.Tasks.UpdateColumns(ctx, task, "properties"); err != nil {
+		c.logger.Warnf("Failed to save task %s properties: %v", task.ID, err)
+	}
+
+	if err := instance.Executor().Submit(task); err != nil {
+		if _, failErr := c.service.FailTask(task, err.Error()); failErr != nil {
+			c.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+		}
+	}
+}
+
+// selectRemote 选择由其他副本连接、共享队列未满且排队最少的账号，没有时返回空字符串
+func (c *TaskCluster) selectRemote(ctx context.Context, filter *entity.AccountFilter, excludeIDs []string) string {
+	local := c.service.discordManager.GetAllInstances()
+	excluded := make(map[string]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		excluded[id] = true
+	}
+
+	var selected *config.DiscordAccount
+	var selectedLength int64
+	for _, account := range c.service.discordManager.Accounts() {
+		if _, exists := local[account.ID]; exists || excluded[account.ID] {
+			continue
+		}
+		if filter != nil && filter.InstanceID != "" && filter.InstanceID != account.ID {
+			continue
+		}
+
+		owner, err := c.node.LockOwner(ctx, discord.AccountLockName(account.ID))
+		if err != nil || owner == "" {
+			continue
+		}
+		length, err := c.node.QueueLen(ctx, accountQueue(account.ID))
+		if err != nil {
+			continue
+		}
+		queueSize := account.QueueSize
+		if queueSize <= 0 {
+			queueSize = discord.DefaultQueueSize
+		}
+		if length >= int64(queueSize) {
+			continue
+		}
+
+		if selected == nil || length < selectedLength ||
+			(length == selectedLength && (account.Sort < selected.Sort || (account.Sort == selected.Sort && account.ID < selected.ID))) {
+			account := account
+			selected = &account
+			selectedLength = length
+		}
+	}
+
+	if selected == nil {
+		return ""
+	}
+	return selected.ID
+}
+
+// submit 启动任务并写入账号的共享队列
+func (c *TaskCluster) submit(task *entity.Task, accountID string) error {
+	s := c.service
+
+	task.Start()
+	task.InstanceID = accountID
+	if task.Nonce == "" {
+		task.Nonce = discord.NewNonce()
+	}
+	s.chargeQuota(task)
+
+	if err := s.repos.Tasks.Save(context.Background(), task); err != nil {
+		return fmt.Errorf("failed to save task: %w", err)
+	}
+	s.changed(task)
+
+	if err := c.node.Push(context.Background(), accountQueue(accountID), task.ID); err != nil {
+		if _, failErr := s.FailTask(task, "任务入队失败"); failErr != nil {
+			s.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+		}
+		return fmt.Errorf("failed to push task to shared queue: %w", err)
+	}
+
+	return nil
+}
+
+// dequeue 从共享队列中移除任务
+func (c *TaskCluster) dequeue(ctx context.Context, task *entity.Task) {
+	if task.InstanceID == "" {
+		return
+	}
+	if _, err := c.node.RemoveFromQueue(ctx, accountQueue(task.InstanceID), task.ID); err != nil {
+		c.logger.Warnf("Failed to remove task %s from shared queue: %v", task.ID, err)
+	}
+}
+
+// cancel 通知连接任务所在账号的副本取消任务
+func (c *TaskCluster) cancel(ctx context.Context, task *entity.Task) {
+	c.broadcastCancel(ctx, task, false)
+}
+
+// abort 通知连接任务所在账号的副本将任务移出执行器
+func (c *TaskCluster) abort(ctx context.Context, task *entity.Task) {
+	c.broadcastCancel(ctx, task, true)
+}
+
+// broadcastCancel 从共享队列移除任务并广播取消请求
+func (c *TaskCluster) broadcastCancel(ctx context.Context, task *entity.Task, abort bool) {
+	c.dequeue(ctx, task)
+
+	err := c.node.Publish(ctx, taskCancelChannel, taskCancelMessage{
+		TaskID:     task.ID,
+		InstanceID: task.InstanceID,
+		Abort:      abort,
+	})
+	if err != nil {
+		c.logger.Warnf("Failed to broadcast cancellation of task %s: %v", task.ID, err)
+	}
+}
+
+// handleCancel 处理其他副本发来的取消请求，仅持有对应账号的副本处理
+func (c *TaskCluster) handleCancel(data json.RawMessage) {
+	var message taskCancelMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return
+	}
+
+	instance := c.service.discordManager.GetInstance(message.InstanceID)
+	if instance == nil {
+		return
+	}
+	if message.Abort {
+		instance.Executor().Remove(message.TaskID)
+		instance.Executor().Cancel(message.TaskID)
+		return
+	}
+
+	ctx := context.Background()
+	task, err := c.service.repos.Tasks.Get(ctx, message.TaskID)
+	if err != nil {
+		c.logger.Warnf("Failed to load cancelled task %s: %v", message.TaskID, err)
+		return
+	}
+	c.service.cancelOnInstance(ctx, instance, task)
+}
+
+// runningElsewhere 任务是否仍由其他存活的副本执行：
+// 已记录执行节点的按节点存活判断，尚在共享队列中的按账号锁的持有者判断
+func (c *TaskCluster) runningElsewhere(ctx context.Context, task *entity.Task) bool {
+	if node, _ := task.GetProperty(NodeProperty); node != nil && node != "" {
+		id, _ := node.(string)
+		if id == c.node.ID() {
+			return false
+		}
+		alive, err := c.node.IsAlive(ctx, id)
+		return err == nil && alive
+	}
+
+	if task.IsReplicate || task.InstanceID == "" {
+		return false
+	}
+	owner, err := c.node.LockOwner(ctx, discord.AccountLockName(task.InstanceID))
+	return err == nil && owner != "" && owner != c.node.ID()
+}
+
+// lockRecovery 获取启动恢复锁，避免多个副本同时启动时重复恢复同一批任务
+func (c *TaskCluster) lockRecovery(ctx context.Context) (func(), error) {
+	lock := c.node.NewLock("task-recovery", 5*time.Minute)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := lock.Acquire(ctx, time.Second); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := lock.Release(context.Background()); err != nil {
+			c.logger.Warnf("Failed to release task recovery lock: %v", err)
+		}
+	}, nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+)
+
+// newTestTaskCluster 创建集群模式的任务服务，Discord管理器未启动，账号都由其他副本连接
+func newTestTaskCluster(t *testing.T, node *cluster.Node, accounts ...config.DiscordAccount) *TaskCluster {
+	t.Helper()
+
+	service, manager := newTestTaskService(t, newTestRepositories(t))
+	if err := manager.SetClusterNode(node); err != nil {
+		t.Fatalf("SetClusterNode: %v", err)
+	}
+	for _, account := range accounts {
+		if err := manager.AddAccount(account); err != nil {
+			t.Fatalf("AddAccount: %v", err)
+		}
+	}
+
+	c, err := NewTaskCluster(service, node, testLogger())
+	if err != nil {
+		t.Fatalf("NewTaskCluster: %v", err)
+	}
+	return c
+}
+
+// testAccount 启用的测试账号，ID随机避免与其他测试共用锁和队列
+func testAccount(sort int) config.DiscordAccount {
+	return config.DiscordAccount{
+		ID:        "test-" + uuid.New().String(),
+		Enabled:   true,
+		QueueSize: 2,
+		Sort:      sort,
+	}
+}
+
+// holdAccount 由node持有账号锁，测试结束时释放锁并清空账号队列
+func holdAccount(t *testing.T, node *cluster.Node, accountID string) {
+	t.Helper()
+
+	lock := node.NewLock(discord.AccountLockName(accountID), time.Minute)
+	if acquired, err := lock.TryAcquire(context.Background()); err != nil || !acquired {
+		t.Fatalf("TryAcquire(%s) = %v, %v", accountID, acquired, err)
+	}
+	t.Cleanup(func() {
+		lock.Release(context.Background())
+		drainQueue(node, accountID)
+	})
+}
+
+// drainQueue 清空账号的共享队列
+func drainQueue(node *cluster.Node, accountID string) {
+	node.Client().Del(context.Background(), "mjp:queue:"+accountQueue(accountID))
+}
+
+func TestTaskClusterSelectRemote(t *testing.T) {
+	local := newTestClusterNode(t)
+	remote := newTestClusterNode(t)
+	ctx := context.Background()
+
+	first, second, orphan := testAccount(1), testAccount(2), testAccount(0)
+	c := newTestTaskCluster(t, local, first, second, orphan)
+	holdAccount(t, remote, first.ID)
+	holdAccount(t, remote, second.ID)
+	t.Cleanup(func() {
+		drainQueue(remote, orphan.ID)
+	})
+
+	// 无人持有的账号不会被选中；排队数相同时按排序选择
+	if selected := c.selectRemote(ctx, nil, nil); selected != first.ID {
+		t.Fatalf("selectRemote = %q, want %q", selected, first.ID)
+	}
+	if selected := c.selectRemote(ctx, nil, []string{first.ID}); selected != second.ID {
+		t.Fatalf("selectRemote excluding first = %q, want %q", selected, second.ID)
+	}
+	if selected := c.selectRemote(ctx, &entity.AccountFilter{InstanceID: orphan.ID}, nil); selected != "" {
+		t.Fatalf("selectRemote pinned to orphan = %q, want none", selected)
+	}
+
+	// 选择排队最少的账号，队列已满的账号不会被选中
+	if err := remote.Push(ctx, accountQueue(first.ID), "t1"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if selected := c.selectRemote(ctx, nil, nil); selected != second.ID {
+		t.Fatalf("selectRemote = %q, want less loaded %q", selected, second.ID)
+	}
+	for _, taskID := range []string{"t2", "t3"} {
+		if err := remote.Push(ctx, accountQueue(second.ID), taskID); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+	if selected := c.selectRemote(ctx, nil, nil); selected != first.ID {
+		t.Fatalf("selectRemote = %q, want %q while second is full", selected, first.ID)
+	}
+	if err := remote.Push(ctx, accountQueue(first.ID), "t4"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if selected := c.selectRemote(ctx, nil, nil); selected != "" {
+		t.Fatalf("selectRemote = %q, want none when all queues are full", selected)
+	}
+}
+
+func TestTaskClusterSubmitAndCancel(t *testing.T) {
+	local := newTestClusterNode(t)
+	remote := newTestClusterNode(t)
+	ctx := context.Background()
+
+	account := testAccount(0)
+	c := newTestTaskCluster(t, local, account)
+	holdAccount(t, remote, account.ID)
+
+	task := &entity.Task{
+		ID:     uuid.New().String(),
+		Action: entity.TaskActionImagine,
+		Prompt: "a cat",
+	}
+	if err := c.service.Dispatch(ctx, task, DispatchOptions{}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if task.InstanceID != account.ID || task.Status != entity.TaskStatusSubmitted {
+		t.Fatalf("task = %s on %q, want SUBMITTED on %q", task.Status, task.InstanceID, account.ID)
+	}
+
+	// 持有账号的副本从共享队列取到任务
+	queue, taskID, err := remote.Pop(ctx, time.Second, accountQueue(account.ID))
+	if err != nil || queue != accountQueue(account.ID) || taskID != task.ID {
+		t.Fatalf("Pop = %q, %q, %v; want %s", queue, taskID, err, task.ID)
+	}
+
+	// 取消时从共享队列移除，并广播给持有账号的副本
+	if err := remote.Push(ctx, accountQueue(account.ID), task.ID); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if err := c.service.Cancel(ctx, task); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if length, err := remote.QueueLen(ctx, accountQueue(account.ID)); err != nil || length != 0 {
+		t.Fatalf("QueueLen after cancel = %d, %v; want 0", length, err)
+	}
+	stored, err := c.service.repos.Tasks.Get(ctx, task.ID)
+	if err != nil || stored.Status != entity.TaskStatusCancel {
+		t.Fatalf("stored task = %+v, %v; want CANCEL", stored, err)
+	}
+}
+
+func TestTaskClusterRunningElsewhere(t *testing.T) {
+	local := newTestClusterNode(t)
+	remote := newTestClusterNode(t)
+	ctx := context.Background()
+
+	account := testAccount(0)
+	c := newTestTaskCluster(t, local, account)
+
+	// 尚在共享队列中的任务按账号锁的持有者判断
+	task := &entity.Task{ID: uuid.New().String(), InstanceID: account.ID}
+	if c.runningElsewhere(ctx, task) {
+		t.Fatal("task on an unowned account reported as running elsewhere")
+	}
+	holdAccount(t, remote, account.ID)
+	if !c.runningElsewhere(ctx, task) {
+		t.Fatal("task on an account owned by another node not reported as running elsewhere")
+	}
+
+	// 已记录执行节点的任务按节点存活判断
+	task.SetProperty(NodeProperty, local.ID())
+	if c.runningElsewhere(ctx, task) {
+		t.Fatal("task executed by the local node reported as running elsewhere")
+	}
+	remote.Start()
+	task.SetProperty(NodeProperty, remote.ID())
+	if !c.runningElsewhere(ctx, task) {
+		t.Fatal("task executed by a live node not reported as running elsewhere")
+	}
+	remote.Close()
+	if c.runningElsewhere(ctx, task) {
+		t.Fatal("task executed by a stopped node reported as running elsewhere")
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/infrastructure/cluster"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// taskEventBuffer 每个订阅者的事件缓冲区大小
+const taskEventBuffer = 32
+
+// taskEventChannel 任务事件的集群广播频道
+const taskEventChannel = "task:events"
+
+// TaskEvent 任务状态变更事件
+type TaskEvent struct {
+	TaskID     string            `json:"id"`
+	UserID     string            `json:"-"`
+	Action     entity.TaskAction `json:"action"`
+	Status     entity.TaskStatus `json:"status"`
+	Progress   string            `json:"progress"`
+	ImageURL   string            `json:"imageUrl,omitempty"`
+	FailReason string            `json:"failReason,omitempty"`
+	Finished   bool              `json:"finished"`
+	Timestamp  int64             `json:"timestamp"`
+}
+
+// NewTaskEvent 根据任务当前状态创建事件
+func NewTaskEvent(task *entity.Task) TaskEvent {
+	return TaskEvent{
+		TaskID:     task.ID,
+		UserID:     task.UserID,
+		Action:     task.Action,
+		Status:     task.Status,
+		Progress:   task.Progress,
+		ImageURL:   task.ImageURL,
+		FailReason: task.FailReason,
+		Finished:   task.IsFinished(),
+		Timestamp:  time.Now().UnixMilli(),
+	}
+}
+
+// clusterTaskEvent 广播到其他副本的任务事件，TaskEvent.UserID 不参与序列化，需要单独携带
+type clusterTaskEvent struct {
+	TaskEvent
+	UserID string `json:"userId"`
+}
+
+// TaskEventHub 任务事件分发中心，将任务状态变更推送给订阅者
+type TaskEventHub struct {
+	subscribers map[*TaskSubscription]struct{}
+	mutex       sync.RWMutex
+
+	// 集群模式下事件同时广播给其他副本的订阅者
+	node   *cluster.Node
+	logger logger.Logger
+}
+
+// NewTaskEventHub 创建任务事件分发中心
+func NewTaskEventHub() *TaskEventHub {
+	return &TaskEventHub{
+		subscribers: make(map[*TaskSubscription]struct{}),
+	}
+}
+
+// Subscribe 为用户创建订阅，订阅的任务需调用Watch/WatchOwn添加
+func (h *TaskEventHub) Subscribe(userID string) *TaskSubscription {
+	events := make(chan TaskEvent, taskEventBuffer)
+	sub := &TaskSubscription{
+		C:       events,
+		events:  events,
+		hub:     h,
+		userID:  userID,
+		taskIDs: make(map[string]struct{}),
+	}
+
+	h.mutex.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mutex.Unlock()
+
+	return sub
+}
+
+// Bridge 启用集群模式：本副本的事件广播给其他副本，其他副本的事件推送给本副本的订阅者
+func (h *TaskEventHub) Bridge(node *cluster.Node, logger logger.Logger) error {
+	err := node.Subscribe(taskEventChannel, func(data json.RawMessage) {
+		var message clusterTaskEvent
+		if err := json.Unmarshal(data, &message); err != nil {
+			logger.Warnf("Failed to decode task event from cluster: %v", err)
+			return
+		}
+
+		event := message.TaskEvent
+		event.UserID = message.UserID
+		h.deliver(event)
+	})
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	h.node = node
+	h.logger = logger
+	h.mutex.Unlock()
+
+	return nil
+}
+
+// Publish 向匹配的订阅者推送任务事件，不阻塞任务流程；订阅者缓冲区已满时关闭该订阅
+func (h *TaskEventHub) Publish(task *entity.Task) {
+	event := NewTaskEvent(task)
+	h.deliver(event)
+
+	h.mutex.RLock()
+	node, logger := h.node, h.logger
+	h.mutex.RUnlock()
+
+	if node != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		if err := node.Publish(ctx, taskEventChannel, clusterTaskEvent{TaskEvent: event, UserID: event.UserID}); err != nil {
+			logger.Warnf("Failed to broadcast event of task %s: %v", event.TaskID, err)
+		}
+	}
+}
+
+// deliver 推送给本副本中匹配的订阅者。缓冲区已满说明订阅者跟不上事件，
+// 直接丢弃会让客户端错过任务结束事件而一直等待，因此关闭订阅，由客户端重新连接获取最新状态
+func (h *TaskEventHub) deliver(event TaskEvent) {
+	var slow []*TaskSubscription
+
+	h.mutex.RLock()
+	logger := h.logger
+	for sub := range h.subscribers {
+		if !sub.matches(event) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, sub := range slow {
+		if logger != nil {
+			logger.Warnf("Closing slow task event subscriber of user %s", sub.userID)
+		}
+		sub.Close()
+	}
+}
+
+// SubscriberCount 当前订阅者数量
+func (h *TaskEventHub) SubscriberCount() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.subscribers)
+}
+
+// TaskSubscription 任务事件订阅
+type TaskSubscription struct {
+	// C 事件通道，订阅被关闭后关闭
+	C <-chan TaskEvent
+
+	events  chan TaskEvent
+	hub     *TaskEventHub
+	userID  string
+	own     bool
+	taskIDs map[string]struct{}
+	closed  bool
+	mutex   sync.RWMutex
+}
+
+// Watch 订阅指定任务，调用方需先校验任务归属
+func (s *TaskSubscription) Watch(taskID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.taskIDs[taskID] = struct{}{}
+}
+
+// Unwatch 取消订阅指定任务
+func (s *TaskSubscription) Unwatch(taskID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.taskIDs, taskID)
+}
+
+// WatchOwn 设置是否订阅该用户的全部任务
+func (s *TaskSubscription) WatchOwn(enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.own = enabled
+}
+
+// Close 取消订阅并关闭事件通道，可重复调用；订阅者过慢时由事件中心关闭
+func (s *TaskSubscription) Close() {
+	s.hub.mutex.Lock()
+	defer s.hub.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(s.hub.subscribers, s)
+	close(s.events)
+}
+
+// matches 事件是否属于该订阅
+func (s *TaskSubscription) matches(event TaskEvent) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.own && event.UserID == s.userID {
+		return true
+	}
+
+	_, exists := s.taskIDs[event.TaskID]
+	return exists
+}
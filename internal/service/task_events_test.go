@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+
+	"midjourney-proxy-go/internal/domain/entity"
+)
+
+func TestTaskEventHubDeliversToWatchers(t *testing.T) {
+	hub := NewTaskEventHub()
+
+	watcher := hub.Subscribe("user-1")
+	defer watcher.Close()
+	watcher.Watch("task-1")
+	owner := hub.Subscribe("user-2")
+	defer owner.Close()
+	owner.WatchOwn(true)
+	other := hub.Subscribe("user-3")
+	defer other.Close()
+
+	hub.Publish(&entity.Task{ID: "task-1", UserID: "user-2", Status: entity.TaskStatusInProgress})
+
+	for name, sub := range map[string]*TaskSubscription{"watcher": watcher, "owner": owner} {
+		select {
+		case event := <-sub.C:
+			if event.TaskID != "task-1" || event.Finished {
+				t.Fatalf("%s got %+v", name, event)
+			}
+		default:
+			t.Fatalf("%s received no event", name)
+		}
+	}
+	select {
+	case event := <-other.C:
+		t.Fatalf("unrelated subscriber got %+v", event)
+	default:
+	}
+}
+
+func TestTaskEventHubClosesSlowSubscriber(t *testing.T) {
+	hub := NewTaskEventHub()
+
+	slow := hub.Subscribe("user-1")
+	defer slow.Close()
+	slow.Watch("task-1")
+	fast := hub.Subscribe("user-1")
+	defer fast.Close()
+	fast.Watch("task-1")
+
+	task := &entity.Task{ID: "task-1", UserID: "user-1", Status: entity.TaskStatusInProgress}
+	for i := 0; i < taskEventBuffer; i++ {
+		hub.Publish(task)
+		<-fast.C
+	}
+
+	// 缓冲区已满时任务结束，慢订阅者被关闭而不是静默错过结束事件
+	task.Status = entity.TaskStatusSuccess
+	hub.Publish(task)
+
+	if event := <-fast.C; !event.Finished {
+		t.Fatalf("fast subscriber got %+v, want finished event", event)
+	}
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != taskEventBuffer {
+		t.Fatalf("slow subscriber drained %d events, want %d", received, taskEventBuffer)
+	}
+	if count := hub.SubscriberCount(); count != 1 {
+		t.Fatalf("SubscriberCount = %d, want 1", count)
+	}
+
+	// 关闭后再次发布和重复关闭都不会出错
+	hub.Publish(task)
+	slow.Close()
+}
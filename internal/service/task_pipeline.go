@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"midjourney-proxy-go/internal/domain/entity"
+)
+
+// ErrNoAvailableInstance 没有可用的Discord实例
+var ErrNoAvailableInstance = errors.New("没有可用的Discord实例")
+
+// ErrUnsupportedAction 任务类型暂不支持提交到Discord
+var ErrUnsupportedAction = errors.New("暂不支持的任务类型")
+
+// supportedActions 可以提交到Discord执行的任务类型，与run中处理的类型一致
+var supportedActions = map[entity.TaskAction]bool{
+	entity.TaskActionImagine: true,
+}
+
+// unsupportedActionError 带任务类型的ErrUnsupportedAction
+func unsupportedActionError(action entity.TaskAction) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedAction, action)
+}
+
+// BannedPromptError 提示词包含禁用词
+type BannedPromptError struct {
+	Word string
+}
+
+func (e *BannedPromptError) Error() string {
+	return fmt.Sprintf("提示词包含禁用词: %s", e.Word)
+}
+
+// DispatchOptions 提交流程选项
+type DispatchOptions struct {
+	InstanceID         string   // 指定实例
+	ExcludeInstanceIDs []string // 排除的实例
+}
+
+// Dispatch 执行完整的提交流程：检查任务类型、禁用词检查、提示词翻译、选择账号并入队
+// 任何一步失败都会将任务标记为失败并返回错误，入队之前失败的任务不扣减绘图次数
+func (s *TaskService) Dispatch(ctx context.Context, task *entity.Task, opts DispatchOptions) error {
+	if !supportedActions[task.Action] {
+		err := unsupportedActionError(task.Action)
+		if _, failErr := s.FailTask(task, err.Error()); failErr != nil {
+			s.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+		}
+		return err
+	}
+
+	if err := s.prepare(ctx, task); err != nil {
+		if _, failErr := s.FailTask(task, err.Error()); failErr != nil {
+			s.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+		}
+		return err
+	}
+
+	filter := task.AccountFilter
+	if opts.InstanceID != "" {
+		pinned := entity.AccountFilter{}
+		if filter != nil {
+			pinned = *filter
+		}
+		pinned.InstanceID = opts.InstanceID
+		filter = &pinned
+	}
+
+	instance := s.discordManager.GetAvailableInstanceExcluding(filter, opts.ExcludeInstanceIDs)
+	if instance == nil && s.cluster != nil {
+		// 本副本没有可用账号时交给其他副本连接的账号
+		if accountID := s.cluster.selectRemote(ctx, filter, opts.ExcludeInstanceIDs); accountID != "" {
+			return s.cluster.submit(task, accountID)
+		}
+	}
+	if instance == nil {
+		if _, failErr := s.FailTask(task, ErrNoAvailableInstance.Error()); failErr != nil {
+			s.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+		}
+		return ErrNoAvailableInstance
+	}
+
+	return s.Submit(task, instance)
+}
+
+// prepare 按运行时设置检查禁用词并翻译提示词
+func (s *TaskService) prepare(ctx context.Context, task *entity.Task) error {
+	if task.Prompt == "" {
+		return nil
+	}
+
+	s.promptMutex.RLock()
+	translator, checkBanned, checkTranslated := s.translator, s.checkBanned, s.checkTranslated
+	s.promptMutex.RUnlock()
+
+	if checkBanned {
+		if err := s.checkBannedWords(task.Prompt); err != nil {
+			return err
+		}
+	}
+
+	promptEn, err := TranslatePrompt(ctx, translator, task.Prompt)
+	if err != nil {
+		s.logger.Warnf("Failed to translate prompt of task %s: %v", task.ID, err)
+		promptEn = task.Prompt
+	}
+
+	if checkBanned && checkTranslated && promptEn != task.Prompt {
+		if err := s.checkBannedWords(promptEn); err != nil {
+			return err
+		}
+	}
+
+	task.PromptEn = promptEn
+	task.PromptFull = promptEn
+
+	return nil
+}
+
+// checkBannedWords 检查文本是否包含启用的禁用词，忽略大小写
+func (s *TaskService) checkBannedWords(text string) error {
+	words, err := s.repos.BannedWords.Find(context.Background(), true)
+	if err != nil {
+		return fmt.Errorf("failed to load banned words: %w", err)
+	}
+
+	lower := strings.ToLower(text)
+	for _, word := range words {
+		if word.Word != "" && strings.Contains(lower, strings.ToLower(word.Word)) {
+			return &BannedPromptError{Word: word.Word}
+		}
+	}
+
+	return nil
+}
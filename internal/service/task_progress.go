@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+)
+
+// handleMessage 处理Midjourney机器人消息，更新对应任务的进度、预览图或完成状态
+func (s *TaskService) handleMessage(instance *discord.Instance, eventType string, message *discord.Message) {
+	tasks, err := s.repos.Tasks.Find(context.Background(), repository.TaskQuery{
+		InstanceID: instance.ID,
+		Statuses:   entity.UnfinishedTaskStatuses,
+		Sort:       repository.SortSubmitAsc,
+	})
+	if err != nil {
+		s.logger.Errorf("Failed to query unfinished tasks of instance %s: %v", instance.ID, err)
+		return
+	}
+
+	messages := []discord.Message{*message}
+	for i := range tasks {
+		task := &tasks[i]
+		if matchMessage(task, messages) == nil {
+			continue
+		}
+
+		if !applyMessage(task, message) {
+			return
+		}
+		s.setProxyURL(task)
+
+		// 完成的任务需要转存结果，不阻塞网关消息处理
+		if task.Status == entity.TaskStatusSuccess {
+			go s.complete(task)
+			return
+		}
+
+		if _, err := s.SaveIfUnfinished(task); err != nil {
+			s.logger.Errorf("Failed to save task %s on %s: %v", task.ID, eventType, err)
+		}
+		return
+	}
+}
+
+// complete 保存成功的任务并转存结果
+func (s *TaskService) complete(task *entity.Task) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if _, err := s.saveSuccess(ctx, task, s.storeResult); err != nil {
+		s.logger.Errorf("Failed to save completed task %s: %v", task.ID, err)
+	}
+}
+
+// storedColumns 转存结果时更新的任务列
+var storedColumns = []string{"url", "image_url", "thumbnail_url", "content_type", "size", "width", "height", "properties"}
+
+// saveSuccess 先以原始地址保存成功状态，再调用store转存结果并只更新转存相关的列。
+// 转存可能耗时数分钟，先保存避免期间被超时检查判定失败并退还额度，之后真实的结果又被丢弃。
+// 任务已在数据库中结束（取消或超时）时不转存，返回false
+func (s *TaskService) saveSuccess(ctx context.Context, task *entity.Task, store func(context.Context, *entity.Task)) (bool, error) {
+	updated, err := s.SaveIfUnfinished(task)
+	if err != nil || !updated {
+		return false, err
+	}
+
+	imageURL, thumbnailURL := task.ImageURL, task.ThumbnailURL
+	store(ctx, task)
+	if task.ImageURL == imageURL && task.ThumbnailURL == thumbnailURL {
+		return true, nil
+	}
+
+	if err := s.repos.Tasks.UpdateColumns(context.Background(), task, storedColumns...); err != nil {
+		return true, fmt.Errorf("failed to save stored result: %w", err)
+	}
+	s.changed(task)
+	return true, nil
+}
+
+// storeResult 转存任务结果，失败时保留Discord地址
+func (s *TaskService) storeResult(ctx context.Context, task *entity.Task) {
+	if !s.results.Enabled() {
+		return
+	}
+
+	if err := s.results.Store(ctx, task); err != nil {
+		s.logger.Warnf("Failed to store result of task %s: %v", task.ID, err)
+	}
+}
+
+// setProxyURL 将ProxyURL设置为本服务的图片代理地址，客户端无需直接访问Discord CDN
+func (s *TaskService) setProxyURL(task *entity.Task) {
+	if s.images != nil && task.ImageURL != "" {
+		task.ProxyURL = s.images.URL(task.ID)
+	}
+}
+
+// applyMessage 根据Discord消息更新任务，返回任务是否发生变化
+// 带进度的消息更新进度和中间预览图，不带进度且有附件的消息视为最终结果
+func applyMessage(task *entity.Task, message *discord.Message) bool {
+	status, progress, imageURL := task.Status, task.Progress, task.ImageURL
+	task.MessageID = message.ID
+
+	switch {
+	case strings.Contains(message.Content, "(Waiting to start)"):
+		task.Status = entity.TaskStatusInProgress
+	case progressPattern.MatchString(message.Content):
+		task.Status = entity.TaskStatusInProgress
+		task.Progress = progressPattern.FindStringSubmatch(message.Content)[1] + "%"
+		if len(message.Attachments) > 0 {
+			task.ImageURL = message.Attachments[0].URL
+		}
+	case len(message.Attachments) > 0:
+		attachment := message.Attachments[0]
+		task.ImageURL = attachment.URL
+		task.URL = attachment.URL
+		task.Success()
+	}
+
+	return task.Status != status || task.Progress != progress || task.ImageURL != imageURL
+}
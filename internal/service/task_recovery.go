@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+)
+
+// progressPattern Midjourney消息中的进度，如 "(31%)"
+var progressPattern = regexp.MustCompile(`\((\d{1,3})%\)`)
+
+// RecoverySummary 启动时未完成任务的恢复结果
+type RecoverySummary struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Total      int       `json:"total"`
+	Requeued   int       `json:"requeued"`
+	Reconciled int       `json:"reconciled"`
+	Failed     int       `json:"failed"`
+	Skipped    int       `json:"skipped,omitempty"` // 集群模式下仍由其他副本执行的任务
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// Recover 恢复上次运行遗留的未完成任务：
+// 未提交到Discord的任务重新入队，已提交的任务根据频道最近消息对账，无法对账的标记为失败
+// 换脸任务交由换脸服务恢复。集群模式下多个副本依次恢复，跳过仍由其他存活副本执行的任务
+func (s *TaskService) Recover(ctx context.Context) *RecoverySummary {
+	summary := &RecoverySummary{StartedAt: time.Now()}
+
+	if s.cluster != nil {
+		unlock, err := s.cluster.lockRecovery(ctx)
+		if err != nil {
+			s.logger.Errorf("Failed to acquire task recovery lock: %v", err)
+			summary.Errors = append(summary.Errors, err.Error())
+			return s.finishRecovery(summary)
+		}
+		defer unlock()
+	}
+
+	tasks, err := s.repos.Tasks.Find(ctx, repository.TaskQuery{
+		Statuses: entity.UnfinishedTaskStatuses,
+		Sort:     repository.SortSubmitAsc,
+	})
+	if err != nil {
+		s.logger.Errorf("Failed to query unfinished tasks: %v", err)
+		summary.Errors = append(summary.Errors, err.Error())
+		return s.finishRecovery(summary)
+	}
+
+	summary.Total = len(tasks)
+	messages := make(map[string][]discord.Message)
+
+	for i := range tasks {
+		task := &tasks[i]
+
+		if s.cluster != nil && s.cluster.runningElsewhere(ctx, task) {
+			summary.Skipped++
+			continue
+		}
+
+		var err error
+		if task.IsReplicate {
+			err = s.recoverReplicate(ctx, task, summary)
+		} else if isSentToDiscord(task) {
+			err = s.reconcile(ctx, task, messages, summary)
+		} else {
+			err = s.requeue(task, summary)
+		}
+
+		if err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %v", task.ID, err))
+		}
+	}
+
+	return s.finishRecovery(summary)
+}
+
+// LastRecovery 获取最近一次恢复结果
+func (s *TaskService) LastRecovery() *RecoverySummary {
+	s.recoveryMutex.RLock()
+	defer s.recoveryMutex.RUnlock()
+
+	return s.lastRecovery
+}
+
+// finishRecovery 记录并输出恢复结果
+func (s *TaskService) finishRecovery(summary *RecoverySummary) *RecoverySummary {
+	summary.FinishedAt = time.Now()
+
+	s.recoveryMutex.Lock()
+	s.lastRecovery = summary
+	s.recoveryMutex.Unlock()
+
+	s.logger.WithFields(map[string]interface{}{
+		"total":      summary.Total,
+		"requeued":   summary.Requeued,
+		"reconciled": summary.Reconciled,
+		"failed":     summary.Failed,
+		"skipped":    summary.Skipped,
+		"errors":     len(summary.Errors),
+	}).Info("Unfinished task recovery completed")
+
+	return summary
+}
+
+// requeue 将尚未提交到Discord的任务重新入队
+func (s *TaskService) requeue(task *entity.Task, summary *RecoverySummary) error {
+	// 集群模式下任务可能仍留在已失效副本的共享队列中，先移除避免重复执行
+	if s.cluster != nil {
+		s.cluster.dequeue(context.Background(), task)
+	}
+
+	instance := s.discordManager.GetInstance(task.InstanceID)
+	if instance == nil || !instance.IsConnected() {
+		instance = s.discordManager.GetAvailableInstanceWithFilter(task.AccountFilter)
+	}
+
+	if instance == nil && s.cluster != nil {
+		if accountID := s.cluster.selectRemote(context.Background(), task.AccountFilter, nil); accountID != "" {
+			if err := s.cluster.submit(task, accountID); err != nil {
+				summary.Failed++
+				return err
+			}
+			summary.Requeued++
+			return nil
+		}
+	}
+
+	if instance == nil {
+		summary.Failed++
+		_, err := s.FailTask(task, "服务重启后没有可用的Discord实例")
+		return err
+	}
+
+	if err := s.Submit(task, instance); err != nil {
+		summary.Failed++
+		return err
+	}
+
+	summary.Requeued++
+	return nil
+}
+
+// recoverReplicate 交由换脸服务恢复任务
+func (s *TaskService) recoverReplicate(ctx context.Context, task *entity.Task, summary *RecoverySummary) error {
+	if s.replicate == nil {
+		summary.Failed++
+		_, err := s.FailTask(task, "服务重启后换脸功能未启用")
+		return err
+	}
+
+	requeued, err := s.replicate(ctx, task)
+	if requeued {
+		summary.Requeued++
+	} else {
+		summary.Failed++
+	}
+	return err
+}
+
+// reconcile 根据频道最近消息对账已提交到Discord的任务
+func (s *TaskService) reconcile(ctx context.Context, task *entity.Task, cache map[string][]discord.Message, summary *RecoverySummary) error {
+	instance := s.discordManager.GetInstance(task.InstanceID)
+	if instance == nil {
+		summary.Failed++
+		_, err := s.FailTask(task, "服务重启后Discord实例不存在")
+		return err
+	}
+
+	messages, exists := cache[instance.ID]
+	if !exists {
+		fetched, err := instance.FetchMessages(ctx, 100)
+		if err != nil {
+			s.logger.Warnf("Failed to fetch messages for instance %s: %v", instance.ID, err)
+		}
+		messages = fetched
+		cache[instance.ID] = messages
+	}
+
+	message := matchMessage(task, messages)
+	if message == nil {
+		summary.Failed++
+		_, err := s.FailTask(task, "服务重启后未找到对应的Discord消息")
+		return err
+	}
+
+	applyMessage(task, message)
+	s.setProxyURL(task)
+
+	var err error
+	if task.Status == entity.TaskStatusSuccess {
+		_, err = s.saveSuccess(ctx, task, s.storeResult)
+	} else {
+		_, err = s.SaveIfUnfinished(task)
+	}
+	if err != nil {
+		summary.Failed++
+		return err
+	}
+
+	summary.Reconciled++
+	return nil
+}
+
+// isSentToDiscord 任务是否已提交到Discord
+func isSentToDiscord(task *entity.Task) bool {
+	return task.Status == entity.TaskStatusInProgress || task.MessageID != ""
+}
+
+// matchMessage 在频道消息中查找任务对应的消息，消息按时间倒序排列
+func matchMessage(task *entity.Task, messages []discord.Message) *discord.Message {
+	prompt := task.PromptEn
+	if prompt == "" {
+		prompt = task.Prompt
+	}
+
+	for i := range messages {
+		message := &messages[i]
+		if task.MessageID != "" && message.ID == task.MessageID {
+			return message
+		}
+		if task.Nonce != "" && message.Nonce == task.Nonce {
+			return message
+		}
+		if prompt != "" && strings.Contains(message.Content, "**"+prompt) {
+			return message
+		}
+	}
+
+	return nil
+}
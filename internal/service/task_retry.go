@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+)
+
+// ErrTaskNotRetryable 任务状态不允许重试
+var ErrTaskNotRetryable = errors.New("仅失败的任务可以重试")
+
+// RetryOptions 重试选项
+type RetryOptions struct {
+	ExcludeFailedInstance bool   // 排除上次失败的实例
+	InstanceID            string // 指定实例
+}
+
+// BulkRetryFilter 批量重试的筛选条件
+type BulkRetryFilter struct {
+	Start  time.Time
+	End    time.Time
+	Reason string // 失败原因包含的内容，为空则不限
+	Limit  int
+}
+
+// BulkRetryResult 批量重试结果
+type BulkRetryResult struct {
+	Total   int               `json:"total"`
+	Retried int               `json:"retried"`
+	Failed  map[string]string `json:"failed,omitempty"`
+}
+
+// Retry 在原任务上重新执行完整提交流程，保留任务ID并记录重试历史
+func (s *TaskService) Retry(ctx context.Context, task *entity.Task, opts RetryOptions) error {
+	if task.Status != entity.TaskStatusFailure {
+		return ErrTaskNotRetryable
+	}
+
+	failedInstanceID := task.InstanceID
+	retryCount := 0
+	if value, exists := task.GetProperty("retryCount"); exists {
+		if count, ok := value.(float64); ok {
+			retryCount = int(count)
+		} else if count, ok := value.(int); ok {
+			retryCount = count
+		}
+	}
+
+	var history []interface{}
+	if value, exists := task.GetProperty("retryHistory"); exists {
+		if items, ok := value.([]interface{}); ok {
+			history = items
+		}
+	}
+
+	now := time.Now()
+	history = append(history, map[string]interface{}{
+		"attempt":     retryCount + 1,
+		"instance_id": failedInstanceID,
+		"fail_reason": task.FailReason,
+		"failed_at":   task.FinishTime,
+		"retried_at":  now,
+	})
+	task.SetProperty("retryCount", retryCount+1)
+	task.SetProperty("retryHistory", history)
+
+	// 重置任务状态
+	task.Status = entity.TaskStatusNotStart
+	task.Progress = ""
+	task.FailReason = ""
+	task.StartTime = nil
+	task.FinishTime = nil
+	task.SubmitTime = &now
+	task.InstanceID = ""
+	task.Nonce = ""
+	task.MessageID = ""
+	task.JobID = ""
+	task.InteractionMetadataID = ""
+	task.RemixModalMessageID = ""
+	task.Seed = ""
+	task.SeedMessageID = ""
+	task.Buttons = nil
+
+	// 清除上次执行的结果和转存记录，转存对象按任务ID存放，重新执行成功后会被覆盖
+	task.ImageURL = ""
+	task.ThumbnailURL = ""
+	task.URL = ""
+	task.ProxyURL = ""
+	task.Height = nil
+	task.Width = nil
+	task.Size = nil
+	task.ContentType = ""
+	for _, property := range storedProperties {
+		delete(task.Properties, property)
+	}
+
+	// 以数据库中的失败状态为条件重置，并发的重试只有一个能成功
+	updated, err := s.repos.Tasks.SaveIfStatus(ctx, task, entity.TaskStatusFailure)
+	if err != nil {
+		return fmt.Errorf("failed to reset task: %w", err)
+	}
+	if !updated {
+		return ErrTaskNotRetryable
+	}
+
+	dispatchOpts := DispatchOptions{InstanceID: opts.InstanceID}
+	if opts.ExcludeFailedInstance && failedInstanceID != "" {
+		dispatchOpts.ExcludeInstanceIDs = []string{failedInstanceID}
+	}
+
+	if err := s.Dispatch(ctx, task, dispatchOpts); err != nil {
+		return err
+	}
+
+	s.logger.Infof("Task %s retried (attempt %d), previous instance %s", task.ID, retryCount+1, failedInstanceID)
+	return nil
+}
+
+// RetryFailed 批量重试指定时间段内失败的任务
+func (s *TaskService) RetryFailed(ctx context.Context, filter BulkRetryFilter, opts RetryOptions) (*BulkRetryResult, error) {
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 100
+	}
+
+	tasks, err := s.repos.Tasks.Find(ctx, repository.TaskQuery{
+		Statuses:     []entity.TaskStatus{entity.TaskStatusFailure},
+		FinishedFrom: &filter.Start,
+		FinishedTo:   &filter.End,
+		FailReason:   filter.Reason,
+		Sort:         repository.SortFinishAsc,
+		Limit:        filter.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed tasks: %w", err)
+	}
+
+	result := &BulkRetryResult{
+		Total:  len(tasks),
+		Failed: make(map[string]string),
+	}
+
+	for i := range tasks {
+		if err := s.Retry(ctx, &tasks[i], opts); err != nil {
+			result.Failed[tasks[i].ID] = err.Error()
+			continue
+		}
+		result.Retried++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// ErrTaskFinished 任务已结束
+var ErrTaskFinished = errors.New("任务已结束")
+
+// TaskService 任务服务，负责任务入队、执行和状态持久化
+type TaskService struct {
+	repos          *repository.Repositories
+	discordManager *discord.Manager
+	notifyService  *NotifyService
+	events         *TaskEventHub
+	results        *ResultStore
+	images         *ImageProxy
+	logger         logger.Logger
+
+	// 提交流程的运行时设置
+	promptMutex     sync.RWMutex
+	translator      Translator
+	checkBanned     bool
+	checkTranslated bool
+
+	recoveryMutex sync.RWMutex
+	lastRecovery  *RecoverySummary
+
+	backfillMutex sync.Mutex
+	backfill      *ThumbnailBackfillStatus
+
+	replicate ReplicateHandler
+
+	// 集群模式下的多副本任务协调，单副本时为nil
+	cluster *TaskCluster
+}
+
+// ReplicateHandler 恢复换脸等不经过Discord的任务，返回任务是否重新入队
+type ReplicateHandler func(ctx context.Context, task *entity.Task) (bool, error)
+
+// NewTaskService 创建任务服务，并注册为Discord实例的任务执行函数
+func NewTaskService(repos *repository.Repositories, discordManager *discord.Manager, notifyService *NotifyService, translator Translator, results *ResultStore, images *ImageProxy, logger logger.Logger) *TaskService {
+	s := &TaskService{
+		repos:          repos,
+		discordManager: discordManager,
+		notifyService:  notifyService,
+		events:         NewTaskEventHub(),
+		results:        results,
+		images:         images,
+		logger:         logger,
+
+		translator:      translator,
+		checkBanned:     true,
+		checkTranslated: true,
+	}
+	discordManager.SetTaskRunner(s.run)
+	discordManager.SetMessageHandler(s.handleMessage)
+
+	return s
+}
+
+// SetReplicateHandler 注册换脸任务的恢复函数
+func (s *TaskService) SetReplicateHandler(handler ReplicateHandler) {
+	s.replicate = handler
+}
+
+// SetTranslator 替换提示词翻译器，对之后提交的任务生效
+func (s *TaskService) SetTranslator(translator Translator) {
+	s.promptMutex.Lock()
+	defer s.promptMutex.Unlock()
+	s.translator = translator
+}
+
+// SetBannedWordCheck 设置是否检查禁用词，以及是否同时检查翻译后的提示词
+func (s *TaskService) SetBannedWordCheck(enabled, checkTranslated bool) {
+	s.promptMutex.Lock()
+	defer s.promptMutex.Unlock()
+	s.checkBanned = enabled
+	s.checkTranslated = checkTranslated
+}
+
+// Events 获取任务事件分发中心
+func (s *TaskService) Events() *TaskEventHub {
+	return s.events
+}
+
+// changed 任务状态或进度变更后推送回调和实时事件
+func (s *TaskService) changed(task *entity.Task) {
+	s.notifyService.Notify(task)
+	s.events.Publish(task)
+}
+
+// markNode 集群模式下记录执行任务的节点，启动恢复时跳过仍由其他存活节点执行的任务
+func (s *TaskService) markNode(task *entity.Task) {
+	if s.cluster != nil {
+		task.SetProperty(NodeProperty, s.cluster.node.ID())
+	}
+}
+
+// Submit 启动任务并提交到实例的执行队列
+func (s *TaskService) Submit(task *entity.Task, instance *discord.Instance) error {
+	task.Start()
+	task.InstanceID = instance.ID
+	if task.Nonce == "" {
+		task.Nonce = discord.NewNonce()
+	}
+	s.markNode(task)
+	s.chargeQuota(task)
+
+	if err := s.repos.Tasks.Save(context.Background(), task); err != nil {
+		return fmt.Errorf("failed to save task: %w", err)
+	}
+	s.changed(task)
+
+	if err := instance.Executor().Submit(task); err != nil {
+		if _, failErr := s.FailTask(task, err.Error()); failErr != nil {
+			s.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Save 保存任务
+func (s *TaskService) Save(task *entity.Task) error {
+	return s.repos.Tasks.Save(context.Background(), task)
+}
+
+// SaveIfUnfinished 仅当任务在数据库中仍未结束时保存，避免迟到的更新覆盖已取消或已超时的任务
+// 保存成功后推送回调和实时事件
+func (s *TaskService) SaveIfUnfinished(task *entity.Task) (bool, error) {
+	updated, err := s.repos.Tasks.SaveIfUnfinished(context.Background(), task)
+	if err != nil || !updated {
+		return false, err
+	}
+
+	s.changed(task)
+	return true, nil
+}
+
+// Cancel 取消任务：排队中的任务直接出队，已提交到Discord的任务尝试点击取消按钮
+func (s *TaskService) Cancel(ctx context.Context, task *entity.Task) error {
+	if task.IsFinished() {
+		return ErrTaskFinished
+	}
+
+	if instance := s.discordManager.GetInstance(task.InstanceID); instance != nil {
+		s.cancelOnInstance(ctx, instance, task)
+	} else if s.cluster != nil {
+		// 任务可能在其他副本的共享队列或执行器中
+		s.cluster.cancel(ctx, task)
+	}
+
+	task.Cancel()
+	updated, err := s.repos.Tasks.UpdateIfUnfinished(ctx, task.ID, map[string]interface{}{
+		"status":      task.Status,
+		"finish_time": task.FinishTime,
+		"progress":    task.Progress,
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrTaskFinished
+	}
+
+	s.refundQuota(task)
+	s.changed(task)
+
+	s.logger.Infof("Task %s cancelled", task.ID)
+	return nil
+}
+
+// cancelOnInstance 将任务移出实例的执行队列，正在执行的任务取消执行，已提交到Discord的任务尝试点击取消按钮
+func (s *TaskService) cancelOnInstance(ctx context.Context, instance *discord.Instance, task *entity.Task) {
+	if instance.Executor().Remove(task.ID) {
+		return
+	}
+	instance.Executor().Cancel(task.ID)
+
+	if isSentToDiscord(task) {
+		if customID := cancelButtonID(task); customID != "" && task.MessageID != "" {
+			if err := instance.ClickButton(ctx, task.MessageID, customID, discord.NewNonce(), task.BotType); err != nil {
+				s.logger.Warnf("Failed to click cancel button for task %s: %v", task.ID, err)
+			}
+		}
+	}
+}
+
+// chargeQuota 提交任务时扣减用户绘图次数
+func (s *TaskService) chargeQuota(task *entity.Task) {
+	if charged, _ := task.GetProperty("quotaCharged"); charged == true {
+		return
+	}
+
+	charged, err := s.repos.Users.AdjustDrawCount(context.Background(), task.UserID, 1)
+	if err != nil {
+		s.logger.Errorf("Failed to charge quota for task %s: %v", task.ID, err)
+		return
+	}
+
+	if charged {
+		task.SetProperty("quotaCharged", true)
+	}
+}
+
+// refundQuota 退还任务扣减的用户绘图次数
+func (s *TaskService) refundQuota(task *entity.Task) {
+	if charged, _ := task.GetProperty("quotaCharged"); charged != true {
+		return
+	}
+
+	if _, err := s.repos.Users.AdjustDrawCount(context.Background(), task.UserID, -1); err != nil {
+		s.logger.Errorf("Failed to refund quota for task %s: %v", task.ID, err)
+		return
+	}
+
+	task.SetProperty("quotaCharged", false)
+	if err := s.repos.Tasks.UpdateColumns(context.Background(), task, "properties"); err != nil {
+		s.logger.Errorf("Failed to save task %s properties: %v", task.ID, err)
+	}
+}
+
+// cancelButtonID 获取Midjourney取消任务按钮的custom_id
+func cancelButtonID(task *entity.Task) string {
+	for _, button := range task.Buttons {
+		if strings.Contains(button.CustomID, "CancelJob") {
+			return button.CustomID
+		}
+	}
+
+	if task.JobID != "" {
+		return "MJ::CancelJob::ByJobid::" + task.JobID
+	}
+
+	return ""
+}
+
+// FailTask 将未结束的任务标记为失败并退还扣减的绘图次数，返回是否实际更新。
+// 任务已结束（如已取消并退还）时不做处理，避免重复退还
+func (s *TaskService) FailTask(task *entity.Task, reason string) (bool, error) {
+	task.Fail(reason)
+
+	updated, err := s.repos.Tasks.UpdateIfUnfinished(context.Background(), task.ID, map[string]interface{}{
+		"status":      task.Status,
+		"fail_reason": task.FailReason,
+		"finish_time": task.FinishTime,
+		"progress":    task.Progress,
+	})
+	if err != nil || !updated {
+		return false, err
+	}
+
+	s.refundQuota(task)
+	s.changed(task)
+	return true, nil
+}
+
+// currentStatus 查询任务在数据库中的当前状态
+func (s *TaskService) currentStatus(taskID string) (entity.TaskStatus, error) {
+	task, err := s.repos.Tasks.Get(context.Background(), taskID)
+	if err != nil {
+		return "", err
+	}
+	return task.Status, nil
+}
+
+// run 执行任务，将任务提交到Discord
+func (s *TaskService) run(ctx context.Context, instance *discord.Instance, task *entity.Task) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// 排队期间已结束的任务（如超时）不再提交
+	if current, err := s.repos.Tasks.Get(ctx, task.ID); err == nil && current.IsFinished() {
+		return nil
+	}
+
+	var err error
+	switch task.Action {
+	case entity.TaskActionImagine:
+		prompt := task.PromptEn
+		if prompt == "" {
+			prompt = task.Prompt
+		}
+		err = instance.SubmitImagine(ctx, prompt, task.Nonce, task.BotType)
+	default:
+		// 提交时已拒绝，这里只会出现在恢复的旧任务中
+		err = unsupportedActionError(task.Action)
+	}
+
+	if err != nil {
+		if _, failErr := s.FailTask(task, err.Error()); failErr != nil {
+			s.logger.Errorf("Failed to mark task %s as failed: %v", task.ID, failErr)
+		}
+		return err
+	}
+
+	task.Status = entity.TaskStatusInProgress
+	s.logger.Infof("Task %s submitted to Discord instance %s", task.ID, instance.ID)
+
+	_, err = s.SaveIfUnfinished(task)
+	return err
+}
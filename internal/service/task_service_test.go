@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/internal/infrastructure/config"
+	"midjourney-proxy-go/internal/infrastructure/discord"
+)
+
+// initialDrawCount 测试用户初始的绘图次数，退还多次时会低于该值
+const initialDrawCount = 5
+
+// taskFixture 任务服务测试环境：一个已有绘图次数的用户和一个未连接的实例
+type taskFixture struct {
+	service  *TaskService
+	repos    *repository.Repositories
+	user     *entity.User
+	instance *discord.Instance
+}
+
+func newTaskFixture(t *testing.T) *taskFixture {
+	t.Helper()
+
+	repos := newTestRepositories(t)
+	service, manager := newTestTaskService(t, repos)
+
+	user := &entity.User{
+		ID:             uuid.New().String(),
+		Username:       "user-" + uuid.New().String()[:8],
+		Role:           entity.RoleUser,
+		Enabled:        true,
+		TotalDrawCount: initialDrawCount,
+		DayDrawCount:   initialDrawCount,
+	}
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	account := config.DiscordAccount{ID: "account-1", Enabled: true, QueueSize: 10}
+	if err := manager.AddAccount(account); err != nil {
+		t.Fatalf("AddAccount: %v", err)
+	}
+
+	return &taskFixture{
+		service:  service,
+		repos:    repos,
+		user:     user,
+		instance: manager.GetInstance(account.ID),
+	}
+}
+
+// newTask 创建并保存未启动的任务
+func (f *taskFixture) newTask(t *testing.T, action entity.TaskAction) *entity.Task {
+	t.Helper()
+
+	now := time.Now()
+	task := &entity.Task{
+		ID:         uuid.New().String(),
+		UserID:     f.user.ID,
+		Action:     action,
+		Status:     entity.TaskStatusNotStart,
+		Prompt:     "a cat",
+		SubmitTime: &now,
+	}
+	if err := f.repos.Tasks.Create(context.Background(), task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	return task
+}
+
+// assertDrawCount 检查用户当前的绘图次数
+func (f *taskFixture) assertDrawCount(t *testing.T, want int) {
+	t.Helper()
+
+	user, err := f.repos.Users.Get(context.Background(), f.user.ID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if user.TotalDrawCount != want || user.DayDrawCount != want {
+		t.Fatalf("draw count = %d/%d, want %d", user.TotalDrawCount, user.DayDrawCount, want)
+	}
+}
+
+// assertStatus 检查任务在数据库中的状态
+func (f *taskFixture) assertStatus(t *testing.T, taskID string, want entity.TaskStatus) *entity.Task {
+	t.Helper()
+
+	task, err := f.repos.Tasks.Get(context.Background(), taskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if task.Status != want {
+		t.Fatalf("task status = %s (%s), want %s", task.Status, task.FailReason, want)
+	}
+	return task
+}
+
+func TestDispatchRejectsUnsupportedAction(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionUpscale)
+
+	err := f.service.Dispatch(context.Background(), task, DispatchOptions{})
+	if !errors.Is(err, ErrUnsupportedAction) {
+		t.Fatalf("Dispatch = %v, want ErrUnsupportedAction", err)
+	}
+
+	f.assertStatus(t, task.ID, entity.TaskStatusFailure)
+	f.assertDrawCount(t, initialDrawCount)
+	if f.instance.Executor().Remove(task.ID) {
+		t.Fatal("unsupported task was queued")
+	}
+}
+
+func TestDispatchWithoutInstanceDoesNotCharge(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+
+	// 唯一的实例未连接
+	if err := f.service.Dispatch(context.Background(), task, DispatchOptions{}); err != ErrNoAvailableInstance {
+		t.Fatalf("Dispatch = %v, want ErrNoAvailableInstance", err)
+	}
+
+	f.assertStatus(t, task.ID, entity.TaskStatusFailure)
+	f.assertDrawCount(t, initialDrawCount)
+}
+
+func TestSubmitChargesQuota(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+
+	if err := f.service.Submit(task, f.instance); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	stored := f.assertStatus(t, task.ID, entity.TaskStatusSubmitted)
+	if charged, _ := stored.GetProperty("quotaCharged"); charged != true {
+		t.Fatalf("quotaCharged = %v, want true", charged)
+	}
+	f.assertDrawCount(t, initialDrawCount+1)
+
+	// 重复提交（如恢复时重新入队）不会再次扣减
+	if err := f.service.Submit(stored, f.instance); err != nil {
+		t.Fatalf("Submit again: %v", err)
+	}
+	f.assertDrawCount(t, initialDrawCount+1)
+}
+
+func TestRunFailureRefundsQuota(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+
+	if err := f.service.Submit(task, f.instance); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	f.assertDrawCount(t, initialDrawCount+1)
+
+	// 实例未连接，提交到Discord失败
+	if err := f.service.run(context.Background(), f.instance, task); err == nil {
+		t.Fatal("run on a disconnected instance succeeded")
+	}
+
+	stored := f.assertStatus(t, task.ID, entity.TaskStatusFailure)
+	if charged, _ := stored.GetProperty("quotaCharged"); charged != false {
+		t.Fatalf("quotaCharged = %v, want false", charged)
+	}
+	f.assertDrawCount(t, initialDrawCount)
+
+	// 已失败的任务再次失败不会重复退还
+	if updated, err := f.service.FailTask(task, "again"); err != nil || updated {
+		t.Fatalf("FailTask on failed task = %v, %v; want false", updated, err)
+	}
+	f.assertDrawCount(t, initialDrawCount)
+}
+
+func TestRunUnsupportedActionRefundsQuota(t *testing.T) {
+	f := newTaskFixture(t)
+	// 旧版本提交、恢复后重新入队的任务
+	task := f.newTask(t, entity.TaskActionVariation)
+
+	if err := f.service.Submit(task, f.instance); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if err := f.service.run(context.Background(), f.instance, task); !errors.Is(err, ErrUnsupportedAction) {
+		t.Fatalf("run = %v, want ErrUnsupportedAction", err)
+	}
+
+	f.assertStatus(t, task.ID, entity.TaskStatusFailure)
+	f.assertDrawCount(t, initialDrawCount)
+}
+
+func TestCancelRefundsOnce(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+
+	if err := f.service.Submit(task, f.instance); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	queued := *task
+
+	if err := f.service.Cancel(context.Background(), task); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	f.assertStatus(t, task.ID, entity.TaskStatusCancel)
+	f.assertDrawCount(t, initialDrawCount)
+
+	// 执行器中的副本在取消后才执行，不再提交也不再退还
+	if err := f.service.run(context.Background(), f.instance, &queued); err != nil {
+		t.Fatalf("run after cancel: %v", err)
+	}
+	if updated, err := f.service.FailTask(&queued, "late"); err != nil || updated {
+		t.Fatalf("FailTask after cancel = %v, %v; want false", updated, err)
+	}
+	f.assertStatus(t, task.ID, entity.TaskStatusCancel)
+	f.assertDrawCount(t, initialDrawCount)
+}
+
+func TestWatchdogTimeoutRefundsQuota(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+
+	if err := f.service.Submit(task, f.instance); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	started := time.Now().Add(-time.Hour)
+	task.StartTime = &started
+	if err := f.service.Save(task); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if count := NewTaskWatchdog(f.service, testLogger()).Check(); count != 1 {
+		t.Fatalf("Check = %d, want 1", count)
+	}
+
+	stored := f.assertStatus(t, task.ID, entity.TaskStatusFailure)
+	if stored.FailReason != entity.TaskFailReasonTimeout {
+		t.Fatalf("fail reason = %q, want timeout", stored.FailReason)
+	}
+	f.assertDrawCount(t, initialDrawCount)
+	if f.instance.Executor().Remove(task.ID) {
+		t.Fatal("timed out task still queued")
+	}
+}
+
+func TestRetryClearsPreviousResult(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+
+	task.Status = entity.TaskStatusFailure
+	task.URL = "https://cdn.discordapp.com/attachments/1/2/old.png"
+	task.ProxyURL = "https://media.discordapp.net/attachments/1/2/old.png"
+	task.ImageURL = "https://storage.example.com/tasks/" + task.ID + "/result.png"
+	task.ThumbnailURL = "https://storage.example.com/tasks/" + task.ID + "/thumb.webp"
+	task.SetProperty("storageKey", "tasks/"+task.ID+"/result.png")
+	task.SetProperty("thumbnails", map[string]interface{}{"small": task.ThumbnailURL})
+	task.SetProperty(GridImagesProperty, []interface{}{map[string]interface{}{"url": task.ImageURL}})
+	if err := f.service.Save(task); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// 唯一的实例未连接，重置后重新提交失败
+	if err := f.service.Retry(context.Background(), task, RetryOptions{}); err != ErrNoAvailableInstance {
+		t.Fatalf("Retry = %v, want ErrNoAvailableInstance", err)
+	}
+
+	stored := f.assertStatus(t, task.ID, entity.TaskStatusFailure)
+	if stored.URL != "" || stored.ProxyURL != "" || stored.ImageURL != "" || stored.ThumbnailURL != "" {
+		t.Fatalf("result urls not cleared: %q %q %q %q", stored.URL, stored.ProxyURL, stored.ImageURL, stored.ThumbnailURL)
+	}
+	for _, property := range []string{"storageKey", "thumbnails", GridImagesProperty} {
+		if _, exists := stored.GetProperty(property); exists {
+			t.Fatalf("property %s not cleared", property)
+		}
+	}
+	if count, _ := stored.GetProperty("retryCount"); count != float64(1) {
+		t.Fatalf("retryCount = %v, want 1", count)
+	}
+}
+
+func TestRetryOnlyOnce(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+
+	task.Status = entity.TaskStatusFailure
+	if err := f.service.Save(task); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	stale := *task
+
+	// 另一个请求已经重置了任务，内存中的副本仍是失败状态
+	task.Status = entity.TaskStatusNotStart
+	if err := f.repos.Tasks.UpdateColumns(context.Background(), task, "status"); err != nil {
+		t.Fatalf("UpdateColumns: %v", err)
+	}
+
+	if err := f.service.Retry(context.Background(), &stale, RetryOptions{}); err != ErrTaskNotRetryable {
+		t.Fatalf("Retry = %v, want ErrTaskNotRetryable", err)
+	}
+	stored := f.assertStatus(t, task.ID, entity.TaskStatusNotStart)
+	if _, exists := stored.GetProperty("retryCount"); exists {
+		t.Fatal("concurrent retry was recorded")
+	}
+}
+
+func TestSaveSuccessPersistsBeforeStoring(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+	if err := f.service.Submit(task, f.instance); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	discordURL := "https://cdn.discordapp.com/attachments/1/2/result.png"
+	task.ImageURL = discordURL
+	task.URL = discordURL
+	task.Success()
+
+	stored := false
+	updated, err := f.service.saveSuccess(context.Background(), task, func(ctx context.Context, task *entity.Task) {
+		// 转存期间任务已是成功状态，超时检查不会再判定失败
+		current := f.assertStatus(t, task.ID, entity.TaskStatusSuccess)
+		if current.ImageURL != discordURL {
+			t.Errorf("image url while storing = %q, want %q", current.ImageURL, discordURL)
+		}
+		task.ImageURL = "https://storage.example.com/tasks/" + task.ID + "/result.png"
+		task.SetProperty("storageKey", "tasks/"+task.ID+"/result.png")
+		stored = true
+	})
+	if err != nil || !updated || !stored {
+		t.Fatalf("saveSuccess = %v, %v, stored %v", updated, err, stored)
+	}
+
+	current := f.assertStatus(t, task.ID, entity.TaskStatusSuccess)
+	if current.ImageURL != task.ImageURL || current.URL != discordURL {
+		t.Fatalf("saved urls = %q, %q", current.ImageURL, current.URL)
+	}
+	if key, _ := current.GetProperty("storageKey"); key != "tasks/"+task.ID+"/result.png" {
+		t.Fatalf("storageKey = %v", key)
+	}
+	f.assertDrawCount(t, initialDrawCount+1)
+}
+
+func TestSaveSuccessSkipsFinishedTask(t *testing.T) {
+	f := newTaskFixture(t)
+	task := f.newTask(t, entity.TaskActionImagine)
+	if err := f.service.Submit(task, f.instance); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	late := *task
+	if _, err := f.service.FailTask(task, entity.TaskFailReasonTimeout); err != nil {
+		t.Fatalf("FailTask: %v", err)
+	}
+
+	late.ImageURL = "https://cdn.discordapp.com/attachments/1/2/result.png"
+	late.Success()
+	updated, err := f.service.saveSuccess(context.Background(), &late, func(context.Context, *entity.Task) {
+		t.Error("result of a timed out task was stored")
+	})
+	if err != nil || updated {
+		t.Fatalf("saveSuccess = %v, %v; want false", updated, err)
+	}
+	f.assertStatus(t, task.ID, entity.TaskStatusFailure)
+}
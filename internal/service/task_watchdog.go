@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+	"midjourney-proxy-go/pkg/logger"
+)
+
+// DefaultTimeoutMinutes 账号未配置超时时间时的默认值
+const DefaultTimeoutMinutes = 5
+
+// TaskWatchdog 任务超时看门狗，将超时的任务标记为失败，由调度器在领导者节点上定期执行
+type TaskWatchdog struct {
+	service *TaskService
+	logger  logger.Logger
+}
+
+// NewTaskWatchdog 创建任务超时看门狗
+func NewTaskWatchdog(service *TaskService, logger logger.Logger) *TaskWatchdog {
+	return &TaskWatchdog{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// Run 作为定时任务执行一次检查
+func (w *TaskWatchdog) Run(ctx context.Context) error {
+	w.Check()
+	return nil
+}
+
+// Check 检查一次未完成的任务，返回被标记超时的任务数
+func (w *TaskWatchdog) Check() int {
+	tasks, err := w.service.repos.Tasks.Find(context.Background(), repository.TaskQuery{
+		Statuses: entity.UnfinishedTaskStatuses,
+	})
+	if err != nil {
+		w.logger.Errorf("Failed to query unfinished tasks: %v", err)
+		return 0
+	}
+
+	now := time.Now()
+	timeouts := make(map[string]time.Duration)
+	count := 0
+
+	for i := range tasks {
+		task := &tasks[i]
+
+		// 换脸任务由换脸执行器按自身配置的超时时间处理
+		if task.IsReplicate {
+			continue
+		}
+
+		timeout, exists := timeouts[task.InstanceID]
+		if !exists {
+			timeout = w.service.timeoutFor(task.InstanceID)
+			timeouts[task.InstanceID] = timeout
+		}
+
+		if now.Sub(taskStartedAt(task)) < timeout {
+			continue
+		}
+
+		// 从执行器中移除，避免超时后仍被提交；任务在其他副本上时通知对应副本移除
+		if instance := w.service.discordManager.GetInstance(task.InstanceID); instance != nil {
+			instance.Executor().Remove(task.ID)
+			instance.Executor().Cancel(task.ID)
+		} else if w.service.cluster != nil {
+			w.service.cluster.abort(context.Background(), task)
+		}
+
+		updated, err := w.service.FailTask(task, entity.TaskFailReasonTimeout)
+		if err != nil {
+			w.logger.Errorf("Failed to mark task %s as timeout: %v", task.ID, err)
+			continue
+		}
+		if updated {
+			count++
+			w.logger.Warnf("Task %s timed out after %s on instance %s", task.ID, timeout, task.InstanceID)
+		}
+	}
+
+	return count
+}
+
+// timeoutFor 获取实例对应账号的任务超时时间
+func (s *TaskService) timeoutFor(instanceID string) time.Duration {
+	minutes := 0
+	if instance := s.discordManager.GetInstance(instanceID); instance != nil {
+		minutes = instance.GetAccount().TimeoutMinutes
+	} else if instanceID != "" {
+		if account, err := s.repos.Accounts.Get(context.Background(), instanceID); err == nil {
+			minutes = account.TimeoutMinutes
+		}
+	}
+
+	if minutes <= 0 {
+		minutes = DefaultTimeoutMinutes
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// taskStartedAt 任务计时起点
+func taskStartedAt(task *entity.Task) time.Time {
+	if task.StartTime != nil {
+		return *task.StartTime
+	}
+	if task.SubmitTime != nil {
+		return *task.SubmitTime
+	}
+	return task.CreatedAt
+}
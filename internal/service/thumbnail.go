@@ -0,0 +1,217 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"sort"
+	"strings"
+
+	// 注册GIF和WebP解码器
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+// maxDecodePixels 允许解码的最大像素数，按RGBA计算约256MB，防止声明超大尺寸的图片耗尽内存
+const maxDecodePixels = 64 << 20
+
+var (
+	// ErrUnsupportedImage 无法解码的图片格式
+	ErrUnsupportedImage = errors.New("不支持的图片格式")
+	// ErrImageTooLarge 图片像素数超过解码上限
+	ErrImageTooLarge = errors.New("图片尺寸过大")
+)
+
+// Thumbnail 生成的缩略图
+type Thumbnail struct {
+	Size        int
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// Thumbnailer 缩略图生成器
+type Thumbnailer struct {
+	sizes   []int
+	format  string
+	quality int
+}
+
+// NewThumbnailer 创建缩略图生成器，未启用时返回nil
+func NewThumbnailer(cfg config.ThumbnailConfig) *Thumbnailer {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var sizes []int
+	for _, size := range cfg.Sizes {
+		if size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	if len(sizes) == 0 {
+		sizes = []int{512}
+	}
+
+	format := strings.ToLower(cfg.Format)
+	if format != "png" {
+		format = "jpeg"
+	}
+
+	quality := cfg.Quality
+	if quality <= 0 || quality > 100 {
+		quality = 80
+	}
+
+	return &Thumbnailer{sizes: sizes, format: format, quality: quality}
+}
+
+// DecodeImageConfig 读取图片尺寸，不解码像素
+func DecodeImageConfig(data []byte) (int, int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, ErrUnsupportedImage
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// DecodeImage 解码图片，解码前先读取尺寸，像素数超过上限时不解码
+func DecodeImage(data []byte) (image.Image, error) {
+	width, height, err := DecodeImageConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(width)*int64(height) > maxDecodePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	return img, nil
+}
+
+// Generate 按配置的尺寸生成缩略图，顺序与配置一致；原图小于目标尺寸时不放大
+func (t *Thumbnailer) Generate(src image.Image) ([]Thumbnail, error) {
+	// 从大到小逐级缩小，减少大图重复采样
+	order := make([]int, len(t.sizes))
+	copy(order, t.sizes)
+	sort.Sort(sort.Reverse(sort.IntSlice(order)))
+
+	resized := make(map[int]image.Image, len(order))
+	current := toRGBA(src)
+	for _, size := range order {
+		current = resize(current, size)
+		resized[size] = current
+	}
+
+	thumbnails := make([]Thumbnail, 0, len(t.sizes))
+	for _, size := range t.sizes {
+		encoded, err := t.encode(resized[size])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %dpx thumbnail: %w", size, err)
+		}
+		thumbnails = append(thumbnails, Thumbnail{
+			Size:        size,
+			Data:        encoded,
+			ContentType: "image/" + t.format,
+			Ext:         t.ext(),
+		})
+	}
+
+	return thumbnails, nil
+}
+
+// encode 编码缩略图
+func (t *Thumbnailer) encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if t.format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: t.quality})
+	}
+	return buf.Bytes(), err
+}
+
+// ext 缩略图扩展名
+func (t *Thumbnailer) ext() string {
+	if t.format == "png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// toRGBA 转换为RGBA便于直接访问像素，透明部分以白色填充
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Over)
+	return dst
+}
+
+// resize 按最长边等比缩小，使用区域平均采样
+func resize(src *image.RGBA, maxSize int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw <= maxSize && sh <= maxSize {
+		return src
+	}
+
+	dw, dh := maxSize, maxSize
+	if sw >= sh {
+		dh = sh * maxSize / sw
+	} else {
+		dw = sw * maxSize / sh
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, count uint32
+			for sy := y0; sy < y1; sy++ {
+				offset := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[offset])
+					g += uint32(src.Pix[offset+1])
+					b += uint32(src.Pix[offset+2])
+					a += uint32(src.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / count)
+			dst.Pix[i+1] = uint8(g / count)
+			dst.Pix[i+2] = uint8(b / count)
+			dst.Pix[i+3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
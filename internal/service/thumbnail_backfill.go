@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"midjourney-proxy-go/internal/domain/entity"
+	"midjourney-proxy-go/internal/domain/repository"
+)
+
+const (
+	backfillBatchSize = 100
+	backfillMaxErrors = 50
+)
+
+var (
+	// ErrBackfillRunning 回填任务正在运行
+	ErrBackfillRunning = errors.New("缩略图回填任务正在运行")
+	// ErrThumbnailsDisabled 未启用结果转存或缩略图
+	ErrThumbnailsDisabled = errors.New("未启用结果转存或缩略图")
+)
+
+// ThumbnailBackfillStatus 缩略图回填进度
+type ThumbnailBackfillStatus struct {
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Total      int64      `json:"total"`
+	Processed  int        `json:"processed"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Errors     []string   `json:"errors,omitempty"`
+}
+
+// StartThumbnailBackfill 在后台为缺少缩略图的成功任务生成缩略图，同一时间只运行一个回填任务
+func (s *TaskService) StartThumbnailBackfill() (*ThumbnailBackfillStatus, error) {
+	if !s.results.ThumbnailsEnabled() {
+		return nil, ErrThumbnailsDisabled
+	}
+
+	s.backfillMutex.Lock()
+	defer s.backfillMutex.Unlock()
+
+	if s.backfill != nil && s.backfill.Running {
+		return nil, ErrBackfillRunning
+	}
+
+	status := &ThumbnailBackfillStatus{Running: true, StartedAt: time.Now()}
+	total, err := s.repos.Tasks.Count(context.Background(), missingThumbnails)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tasks: %w", err)
+	}
+	status.Total = total
+	s.backfill = status
+
+	go s.runThumbnailBackfill()
+
+	return s.copyBackfill(), nil
+}
+
+// ThumbnailBackfillStatus 获取最近一次回填进度
+func (s *TaskService) ThumbnailBackfillStatus() *ThumbnailBackfillStatus {
+	s.backfillMutex.Lock()
+	defer s.backfillMutex.Unlock()
+
+	return s.copyBackfill()
+}
+
+// runThumbnailBackfill 按ID分批处理，失败的任务不会重复处理
+func (s *TaskService) runThumbnailBackfill() {
+	lastID := ""
+	for {
+		query := missingThumbnails
+		query.AfterID = lastID
+		query.Sort = repository.SortIDAsc
+		query.Limit = backfillBatchSize
+
+		tasks, err := s.repos.Tasks.Find(context.Background(), query)
+		if err != nil {
+			s.recordBackfill(func(status *ThumbnailBackfillStatus) {
+				status.Errors = append(status.Errors, err.Error())
+			})
+			break
+		}
+		if len(tasks) == 0 {
+			break
+		}
+
+		for i := range tasks {
+			task := &tasks[i]
+			lastID = task.ID
+
+			err := s.backfillTask(task)
+			s.recordBackfill(func(status *ThumbnailBackfillStatus) {
+				status.Processed++
+				if err != nil {
+					status.Failed++
+					if len(status.Errors) < backfillMaxErrors {
+						status.Errors = append(status.Errors, fmt.Sprintf("%s: %v", task.ID, err))
+					}
+				} else {
+					status.Succeeded++
+				}
+			})
+		}
+	}
+
+	s.recordBackfill(func(status *ThumbnailBackfillStatus) {
+		now := time.Now()
+		status.Running = false
+		status.FinishedAt = &now
+	})
+
+	status := s.ThumbnailBackfillStatus()
+	s.logger.WithFields(map[string]interface{}{
+		"total":     status.Total,
+		"succeeded": status.Succeeded,
+		"failed":    status.Failed,
+	}).Info("Thumbnail backfill completed")
+}
+
+// backfillTask 为单个任务生成缩略图并保存相关字段
+func (s *TaskService) backfillTask(task *entity.Task) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if err := s.results.Thumbnail(ctx, task); err != nil {
+		return err
+	}
+
+	return s.repos.Tasks.UpdateColumns(ctx, task, "thumbnail_url", "width", "height", "size", "content_type", "properties")
+}
+
+// missingThumbnails 缺少缩略图的成功任务，视频任务的缩略图来自截图，不参与回填
+var missingThumbnails = repository.TaskQuery{
+	Statuses:         []entity.TaskStatus{entity.TaskStatusSuccess},
+	ExcludeActions:   []entity.TaskAction{entity.TaskActionSwapVideoFace},
+	MissingThumbnail: true,
+}
+
+// recordBackfill 更新回填进度
+func (s *TaskService) recordBackfill(update func(status *ThumbnailBackfillStatus)) {
+	s.backfillMutex.Lock()
+	defer s.backfillMutex.Unlock()
+
+	update(s.backfill)
+}
+
+// copyBackfill 复制回填进度，调用方需持有锁
+func (s *TaskService) copyBackfill() *ThumbnailBackfillStatus {
+	if s.backfill == nil {
+		return nil
+	}
+
+	status := *s.backfill
+	status.Errors = append([]string(nil), s.backfill.Errors...)
+	return &status
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// testWebP 无损WebP测试图片（golang.org/x/image testdata/gopher-doc.1bpp.lossless.webp）
+var testWebP = mustDecodeBase64(
+	"UklGRrIBAABXRUJQVlA4TKUBAAAvSsAYAA8w//M///MfeJAkbXvaSG7m8Q3GfYSBJekwQztm/IcZ" +
+		"lgwnmWImn2BK7aFmBtnVir6q//8VOkFE/xm4baTIu8c48ArEo6+B3zFKYln3pqClSCKX0begFTAX" +
+		"FOLXHSyF8cCNcZEG4OywuA4KVVfJCiArU7GAgJI8+lJP/OKMT/fBAjevg1cYB7YVkFuWga2lyPi5" +
+		"I0HFy5YTpWIHg0RZpkniRVW9odHAKOwosWuOGdxIyn2OvaCDvhg/we6TwadPBPbqBV58MsLmMJ8y" +
+		"ZnOWk8SRz4N+QoyPL+MnamzMvcE1rHNEr91F9GKZPVUcS9w7PhhH36suB9qPeYb/oLk6cuTiJ0wO" +
+		"K3m5h1cKjW6EVZCYMK7dxcKCBdgP9HkKr9gkAO2P8GKZGWVdIAatQa+1IDpt6qyorVwdy01xdW8J" +
+		"kfk6xjEXmVQQ+HQdFr6OKhIN34dXWq0+0qr6EJSCeeVLH9+gvGTLyqM65PQ44ihzlTXxQKjKbAvs" +
+		"hXgir7Lil9w4L2bvMycmjQcqXaMCO6BlY28i+FOLzbfI1vEqxAhotocAAA==")
+
+func mustDecodeBase64(text string) []byte {
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// pngWithSize 只包含文件签名和IHDR的PNG，声明指定尺寸但没有像素数据
+func pngWithSize(width, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // 位深度
+	ihdr[13] = 6 // RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(13))
+	buf.Write(ihdr)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return buf.Bytes()
+}
+
+func TestDecodeImageWebP(t *testing.T) {
+	width, height, err := DecodeImageConfig(testWebP)
+	if err != nil {
+		t.Fatalf("DecodeImageConfig: %v", err)
+	}
+	img, err := DecodeImage(testWebP)
+	if err != nil {
+		t.Fatalf("DecodeImage: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != width || bounds.Dy() != height || width == 0 {
+		t.Fatalf("decoded %v, config %dx%d", bounds, width, height)
+	}
+}
+
+func TestDecodeImageRejectsTooManyPixels(t *testing.T) {
+	data := pngWithSize(20000, 20000)
+
+	width, height, err := DecodeImageConfig(data)
+	if err != nil || width != 20000 || height != 20000 {
+		t.Fatalf("DecodeImageConfig = %dx%d, %v", width, height, err)
+	}
+	if _, err := DecodeImage(data); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("DecodeImage = %v, want ErrImageTooLarge", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := DecodeImage(buf.Bytes()); err != nil {
+		t.Fatalf("DecodeImage(small) = %v", err)
+	}
+}
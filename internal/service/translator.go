@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"midjourney-proxy-go/internal/infrastructure/config"
+)
+
+// Translator 提示词翻译器
+type Translator interface {
+	Translate(ctx context.Context, text string) (string, error)
+}
+
+// NewTranslator 根据配置创建翻译器
+func NewTranslator(cfg config.TranslateConfig) Translator {
+	switch strings.ToUpper(cfg.Way) {
+	case "BAIDU":
+		return &baiduTranslator{
+			config: cfg.Baidu,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+	case "GPT":
+		timeout := time.Duration(cfg.OpenAI.Timeout) * time.Second
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		return &openAITranslator{
+			config: cfg.OpenAI,
+			client: &http.Client{Timeout: timeout},
+		}
+	default:
+		return noopTranslator{}
+	}
+}
+
+// TranslatePrompt 翻译提示词中的中文描述部分，保留 "--" 开头的参数
+func TranslatePrompt(ctx context.Context, translator Translator, prompt string) (string, error) {
+	if !containsChinese(prompt) {
+		return prompt, nil
+	}
+
+	text, params := prompt, ""
+	if index := strings.Index(prompt, " --"); index >= 0 {
+		text, params = prompt[:index], prompt[index:]
+	}
+
+	translated, err := translator.Translate(ctx, text)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(translated) + params, nil
+}
+
+// containsChinese 是否包含中文字符
+func containsChinese(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// noopTranslator 不翻译
+type noopTranslator struct{}
+
+func (noopTranslator) Translate(ctx context.Context, text string) (string, error) {
+	return text, nil
+}
+
+// baiduTranslator 百度翻译
+type baiduTranslator struct {
+	config config.BaiduConfig
+	client *http.Client
+}
+
+func (t *baiduTranslator) Translate(ctx context.Context, text string) (string, error) {
+	salt := strconv.FormatInt(time.Now().UnixNano(), 10)
+	sum := md5.Sum([]byte(t.config.AppID + text + salt + t.config.AppSecret))
+
+	form := url.Values{}
+	form.Set("q", text)
+	form.Set("from", "zh")
+	form.Set("to", "en")
+	form.Set("appid", t.config.AppID)
+	form.Set("salt", salt)
+	form.Set("sign", hex.EncodeToString(sum[:]))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://fanyi-api.baidu.com/api/trans/vip/translate", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("baidu translate request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ErrorCode   string `json:"error_code"`
+		ErrorMsg    string `json:"error_msg"`
+		TransResult []struct {
+			Dst string `json:"dst"`
+		} `json:"trans_result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode baidu translate response: %w", err)
+	}
+	if result.ErrorCode != "" && result.ErrorCode != "52000" {
+		return "", fmt.Errorf("baidu translate error %s: %s", result.ErrorCode, result.ErrorMsg)
+	}
+
+	var parts []string
+	for _, item := range result.TransResult {
+		parts = append(parts, item.Dst)
+	}
+
+	return strings.Join(parts, "\n"), nil
+}
+
+// openAITranslator OpenAI翻译
+type openAITranslator struct {
+	config config.OpenAIConfig
+	client *http.Client
+}
+
+func (t *openAITranslator) Translate(ctx context.Context, text string) (string, error) {
+	payload := map[string]interface{}{
+		"model": t.config.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": "Translate the user's Midjourney prompt into English. Output only the translation."},
+			{"role": "user", "content": text},
+		},
+		"max_tokens":  t.config.MaxTokens,
+		"temperature": t.config.Temperature,
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.APIURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.config.APIKey)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("openai translate request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("openai translate returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode openai translate response: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("openai translate returned no choices")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
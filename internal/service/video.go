@@ -0,0 +1,115 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+var (
+	// ErrUnsupportedVideo 无法解析的视频格式
+	ErrUnsupportedVideo = errors.New("不支持的视频格式，仅支持MP4/MOV")
+	// ErrSnapshotUnavailable 未安装ffmpeg，无法截取视频画面
+	ErrSnapshotUnavailable = errors.New("ffmpeg not found")
+)
+
+// VideoDuration 读取MP4/MOV的时长（moov/mvhd），不解码视频
+func VideoDuration(data []byte) (time.Duration, error) {
+	moov := findBox(data, "moov")
+	if moov == nil {
+		return 0, ErrUnsupportedVideo
+	}
+	mvhd := findBox(moov, "mvhd")
+	if len(mvhd) < 20 {
+		return 0, ErrUnsupportedVideo
+	}
+
+	var timescale uint32
+	var duration uint64
+	if mvhd[0] == 1 {
+		// 版本1：创建和修改时间、时长为64位
+		if len(mvhd) < 32 {
+			return 0, ErrUnsupportedVideo
+		}
+		timescale = binary.BigEndian.Uint32(mvhd[20:24])
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(mvhd[12:16])
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return 0, ErrUnsupportedVideo
+	}
+
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
+
+// findBox 在ISO BMFF的box序列中查找指定类型，返回box内容
+func findBox(data []byte, boxType string) []byte {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil
+		}
+
+		if string(data[4:8]) == boxType {
+			return data[header:size]
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// extractSnapshot 使用ffmpeg截取视频第一帧为PNG，未安装ffmpeg时返回 ErrSnapshotUnavailable
+func extractSnapshot(ctx context.Context, video []byte) ([]byte, error) {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, ErrSnapshotUnavailable
+	}
+
+	// MP4的moov可能位于文件末尾，无法通过管道输入，需先写入临时文件
+	tmp, err := os.CreateTemp("", "snapshot-*.mp4")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(video)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "-loglevel", "error", "-i", tmp.Name(),
+		"-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-")
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no frame")
+	}
+
+	return output, nil
+}
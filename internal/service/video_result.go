@@ -0,0 +1,76 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"midjourney-proxy-go/internal/domain/entity"
+)
+
+// StoreVideo 转存视频结果，并将视频截图保存为缩略图
+// snapshotURL为服务提供方返回的截图地址，为空时使用ffmpeg截取第一帧
+func (r *ResultStore) StoreVideo(ctx context.Context, task *entity.Task, snapshotURL string) error {
+	if !r.Enabled() {
+		task.ThumbnailURL = snapshotURL
+		return nil
+	}
+
+	video, err := r.store(ctx, task)
+	if err != nil {
+		return err
+	}
+
+	var snapshot []byte
+	switch {
+	case snapshotURL != "":
+		if snapshot, _, err = r.download(ctx, snapshotURL); err != nil {
+			return fmt.Errorf("failed to download snapshot: %w", err)
+		}
+	case video != nil:
+		if snapshot, err = extractSnapshot(ctx, video); err != nil {
+			if err == ErrSnapshotUnavailable {
+				r.logger.Debugf("Skip snapshot of task %s: %v", task.ID, err)
+				return nil
+			}
+			return err
+		}
+	default:
+		return nil
+	}
+
+	return r.storeSnapshot(ctx, task, snapshot)
+}
+
+// storeSnapshot 保存视频截图并生成缩略图，未启用缩略图时截图本身作为缩略图
+func (r *ResultStore) storeSnapshot(ctx context.Context, task *entity.Task, data []byte) error {
+	img, err := DecodeImage(data)
+	if err != nil {
+		return err
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	task.Width = &width
+	task.Height = &height
+
+	contentType := entity.SniffContentType(data)
+	key := "tasks/" + task.ID + "/snapshot" + extensionByContentType(contentType)
+	result, err := r.storage.Save(ctx, key, bytes.NewReader(data), contentType)
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	task.SetProperty("snapshotKey", result.Key)
+	task.ThumbnailURL = result.URL
+	task.SetProperty("thumbnailKey", result.Key)
+
+	if r.thumbnailer != nil {
+		thumbnail, urls, err := r.storeThumbnails(ctx, "tasks/"+task.ID+"/thumb", img)
+		if err != nil {
+			return err
+		}
+		task.ThumbnailURL = thumbnail.URL
+		task.SetProperty("thumbnailKey", thumbnail.Key)
+		task.SetProperty("thumbnails", urls)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package fieldcrypt 数据库字段级加密：AES-256-GCM，密文带密钥ID前缀以支持密钥轮换
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// EnvKeys 密钥环境变量，优先于密钥文件；格式与密钥文件相同，多个密钥可用逗号分隔
+const EnvKeys = "MJ_ENCRYPTION_KEYS"
+
+// prefix 密文前缀，完整格式为 enc:<密钥ID>:<base64(nonce+密文)>
+const prefix = "enc:"
+
+var (
+	// ErrNoKey 读取到密文但未配置密钥
+	ErrNoKey = errors.New("encrypted value found but no encryption key is configured")
+	// ErrUnknownKey 密文使用的密钥不在密钥列表中
+	ErrUnknownKey = errors.New("encrypted value uses an unknown key")
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Keyring 密钥列表，第一个密钥用于加密，其余密钥只用于解密轮换前写入的密文
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+var current atomic.Pointer[Keyring]
+
+// Use 设置全局使用的密钥，为nil时不加密，读取到密文会返回 ErrNoKey
+func Use(keyring *Keyring) {
+	current.Store(keyring)
+}
+
+// Load 从环境变量 EnvKeys 或密钥文件读取密钥，两者都未配置时返回nil
+func Load(keyFile string) (*Keyring, error) {
+	if text := os.Getenv(EnvKeys); strings.TrimSpace(text) != "" {
+		return Parse(text)
+	}
+	if keyFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+	}
+	return Parse(string(data))
+}
+
+// Parse 解析密钥列表：每行或每个逗号分隔的条目为 <密钥ID>:<base64编码的32字节密钥>，
+// 第一个为当前密钥，#开头的行为注释
+func Parse(text string) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if err := keyring.add(entry); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if keyring.active == "" {
+		return nil, errors.New("no encryption key found")
+	}
+	return keyring, nil
+}
+
+// add 添加一个 <密钥ID>:<密钥> 条目
+func (k *Keyring) add(entry string) error {
+	id, encoded, found := strings.Cut(entry, ":")
+	if !found || !keyIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid encryption key entry, expected <id>:<base64 key>")
+	}
+	if _, exists := k.keys[id]; exists {
+		return fmt.Errorf("duplicate encryption key id %q", id)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.RawStdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return fmt.Errorf("encryption key %q is not valid base64", id)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("encryption key %q must be 32 bytes, got %d", id, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	k.keys[id] = aead
+	if k.active == "" {
+		k.active = id
+	}
+	return nil
+}
+
+// ActiveID 当前用于加密的密钥ID
+func (k *Keyring) ActiveID() string {
+	return k.active
+}
+
+// IsEncrypted 值是否带有密文前缀
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt 使用当前密钥加密，空值、未配置密钥时和能用已知密钥解密的密文原样返回；
+// 恰好以密文前缀开头的明文仍会被加密
+func Encrypt(plaintext string) (string, error) {
+	keyring := current.Load()
+	if plaintext == "" || keyring == nil {
+		return plaintext, nil
+	}
+	if IsEncrypted(plaintext) {
+		if _, err := keyring.open(plaintext); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	aead := keyring.keys[keyring.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	// 密钥ID作为附加数据，篡改前缀后无法解密
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(keyring.active))
+	return prefix + keyring.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密，不带密文前缀的值视为加密前写入的明文原样返回
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	keyring := current.Load()
+	if keyring == nil {
+		return "", ErrNoKey
+	}
+	return keyring.open(value)
+}
+
+// open 解密带前缀的密文
+func (k *Keyring) open(value string) (string, error) {
+	id, encoded, found := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !found {
+		return "", errors.New("malformed encrypted value")
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value with key %s: %w", id, err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,137 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKey 生成由同一字节填充的32字节密钥条目
+func testKey(id string, fill byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))
+}
+
+// useKeys 设置测试使用的全局密钥，测试结束后恢复
+func useKeys(t *testing.T, text string) {
+	t.Helper()
+
+	previous := current.Load()
+	t.Cleanup(func() { Use(previous) })
+
+	if text == "" {
+		Use(nil)
+		return
+	}
+	keyring, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	Use(keyring)
+}
+
+func mustEncrypt(t *testing.T, plaintext string) string {
+	t.Helper()
+
+	value, err := Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	return value
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	useKeys(t, testKey("k1", 1))
+
+	value := mustEncrypt(t, "discord-user-token")
+	if !strings.HasPrefix(value, "enc:k1:") || strings.Contains(value, "discord-user-token") {
+		t.Fatalf("Encrypt = %q", value)
+	}
+	if again := mustEncrypt(t, "discord-user-token"); again == value {
+		t.Fatal("two encryptions produced the same ciphertext")
+	}
+
+	plaintext, err := Decrypt(value)
+	if err != nil || plaintext != "discord-user-token" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	// 已加密的值不重复加密，空值和加密前写入的明文原样返回
+	if got := mustEncrypt(t, value); got != value {
+		t.Fatalf("Encrypt(ciphertext) = %q, want unchanged", got)
+	}
+	if got := mustEncrypt(t, ""); got != "" {
+		t.Fatalf("Encrypt(\"\") = %q", got)
+	}
+	if got, err := Decrypt("legacy-plaintext"); err != nil || got != "legacy-plaintext" {
+		t.Fatalf("Decrypt(plaintext) = %q, %v", got, err)
+	}
+}
+
+func TestEncryptPlaintextWithPrefix(t *testing.T) {
+	useKeys(t, testKey("k1", 1))
+
+	// 看起来像密文但无法解密的明文需要加密，否则会以明文保存且之后读取失败
+	for _, plaintext := range []string{"enc:my-password", "enc:k1:bm90LWEtY2lwaGVydGV4dA==", "enc:other:abc"} {
+		value := mustEncrypt(t, plaintext)
+		if value == plaintext {
+			t.Fatalf("Encrypt(%q) returned the plaintext", plaintext)
+		}
+		if got, err := Decrypt(value); err != nil || got != plaintext {
+			t.Fatalf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, got, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	useKeys(t, testKey("old", 1))
+	oldValue := mustEncrypt(t, "secret")
+
+	// 新密钥在前用于加密，旧密钥保留用于解密
+	useKeys(t, testKey("new", 2)+"\n"+testKey("old", 1))
+	if got, err := Decrypt(oldValue); err != nil || got != "secret" {
+		t.Fatalf("Decrypt(old) = %q, %v", got, err)
+	}
+	newValue := mustEncrypt(t, "secret")
+	if !strings.HasPrefix(newValue, "enc:new:") {
+		t.Fatalf("Encrypt after rotation = %q, want key new", newValue)
+	}
+	if got, err := Decrypt(newValue); err != nil || got != "secret" {
+		t.Fatalf("Decrypt(new) = %q, %v", got, err)
+	}
+}
+
+func TestDecryptTamperedKeyID(t *testing.T) {
+	useKeys(t, testKey("k1", 1)+","+testKey("k2", 1))
+
+	// 两个ID对应相同的密钥，密钥ID是附加数据，改写前缀后认证失败
+	value := mustEncrypt(t, "secret")
+	tampered := strings.Replace(value, "enc:k1:", "enc:k2:", 1)
+	if _, err := Decrypt(tampered); err == nil {
+		t.Fatal("ciphertext with a tampered key id was decrypted")
+	}
+}
+
+func TestDecryptUnknownKey(t *testing.T) {
+	useKeys(t, testKey("old", 1))
+	value := mustEncrypt(t, "secret")
+
+	useKeys(t, testKey("new", 2))
+	if _, err := Decrypt(value); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Decrypt = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestNoKey(t *testing.T) {
+	useKeys(t, testKey("k1", 1))
+	value := mustEncrypt(t, "secret")
+
+	useKeys(t, "")
+	if got := mustEncrypt(t, "secret"); got != "secret" {
+		t.Fatalf("Encrypt without key = %q, want plaintext", got)
+	}
+	if _, err := Decrypt(value); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("Decrypt without key = %v, want ErrNoKey", err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 
 	"github.com/sirupsen/logrus"
+
+	"midjourney-proxy-go/pkg/redact"
 )
 
 // Logger 日志接口
@@ -64,6 +66,9 @@ func New(level, format string) Logger {
 		})
 	}
 
+	// 输出前替换日志中的密钥
+	log.SetOutput(redact.Writer(log.Out))
+
 	return &logger{
 		entry: logrus.NewEntry(log),
 	}
@@ -128,6 +133,9 @@ func NewWithOutput(level, format, output, filePath string) Logger {
 		log.SetOutput(os.Stdout)
 	}
 
+	// 输出前替换日志中的密钥
+	log.SetOutput(redact.Writer(log.Out))
+
 	return &logger{
 		entry: logrus.NewEntry(log),
 	}
@@ -0,0 +1,134 @@
+// Package redact 敏感信息脱敏：API响应中的密钥掩码和日志输出中的密钥替换
+package redact
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Placeholder 掩码中替换密钥内容的部分，包含该文本的值视为掩码而不是密钥
+const Placeholder = "********"
+
+// minRegisterLength 登记到日志脱敏的密钥最短长度，过短的值（如测试用的admin）会误伤普通文本
+const minRegisterLength = 8
+
+// visibleLength 掩码保留的首尾字符数，密钥长度不足 minVisibleLength 时不保留
+const (
+	visibleLength    = 4
+	minVisibleLength = 16
+)
+
+// patterns 未登记的密钥按格式替换：URL中的用户名密码、Bearer令牌、key=value形式的参数
+var patterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(://[^:/@\s]+:)[^@/\s]+@`), "${1}" + Placeholder + "@"},
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + Placeholder},
+	{regexp.MustCompile(`(?i)(\b(?:password|passwd|pwd|secret|token|access_token|refresh_token|api_key|apikey|sign)=)[^&\s"']+`), "${1}" + Placeholder},
+}
+
+var registry = struct {
+	mu       sync.RWMutex
+	secrets  map[string]struct{}
+	replacer *strings.Replacer
+}{secrets: make(map[string]struct{})}
+
+// Mask 返回密钥的掩码，较长的密钥保留首尾各4个字符便于辨认，空值保持为空
+func Mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < minVisibleLength {
+		return Placeholder
+	}
+	return secret[:visibleLength] + Placeholder + secret[len(secret)-visibleLength:]
+}
+
+// MaskAll 返回不保留任何字符的掩码，用于密码、2FA密钥等部分泄露也会降低强度的值，空值保持为空
+func MaskAll(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return Placeholder
+}
+
+// IsMasked 值是否为 Mask 或 MaskAll 生成的掩码
+func IsMasked(value string) bool {
+	return strings.Contains(value, Placeholder)
+}
+
+// Keep 更新密钥字段时使用：客户端原样提交了响应中的掩码时保留原值，否则使用提交的新值
+func Keep(submitted, stored string) string {
+	if IsMasked(submitted) {
+		return stored
+	}
+	return submitted
+}
+
+// Register 登记需要在日志中替换的密钥，重复登记和过短的值会被忽略
+func Register(secrets ...string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	changed := false
+	for _, secret := range secrets {
+		if len(secret) < minRegisterLength || IsMasked(secret) {
+			continue
+		}
+		if _, exists := registry.secrets[secret]; !exists {
+			registry.secrets[secret] = struct{}{}
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// 较长的密钥优先匹配，避免包含关系的密钥只被替换一部分
+	keys := make([]string, 0, len(registry.secrets))
+	for secret := range registry.secrets {
+		keys = append(keys, secret)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	pairs := make([]string, 0, 2*len(keys))
+	for _, secret := range keys {
+		pairs = append(pairs, secret, Mask(secret))
+	}
+	registry.replacer = strings.NewReplacer(pairs...)
+}
+
+// String 替换文本中已登记的密钥和常见格式的凭据
+func String(s string) string {
+	registry.mu.RLock()
+	replacer := registry.replacer
+	registry.mu.RUnlock()
+
+	if replacer != nil {
+		s = replacer.Replace(s)
+	}
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// Writer 包装日志输出，写入前替换其中的密钥；每次Write应为完整的日志行
+func Writer(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+type writer struct {
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
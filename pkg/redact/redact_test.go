@@ -0,0 +1,26 @@
+package redact
+
+import "testing"
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		secret string
+		mask   string
+		all    string
+	}{
+		{"", "", ""},
+		{"short-secret", Placeholder, Placeholder},
+		{"MTA5ODc2NTQzMjEw.token.value", "MTA5" + Placeholder + "alue", Placeholder},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.secret); got != tt.mask {
+			t.Errorf("Mask(%q) = %q, want %q", tt.secret, got, tt.mask)
+		}
+		if got := MaskAll(tt.secret); got != tt.all {
+			t.Errorf("MaskAll(%q) = %q, want %q", tt.secret, got, tt.all)
+		}
+		if tt.secret != "" && (!IsMasked(Mask(tt.secret)) || !IsMasked(MaskAll(tt.secret))) {
+			t.Errorf("masks of %q are not recognized as masked", tt.secret)
+		}
+	}
+}
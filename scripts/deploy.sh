@@ -189,7 +189,8 @@ security:
   admin_token: "$(openssl rand -hex 16)"
   user_token: ""
   jwt_secret: "$(openssl rand -hex 32)"
-  jwt_expire_hours: 24
+  access_token_minutes: 15
+  refresh_token_days: 30
 
 discord:
   accounts: []